@@ -99,6 +99,7 @@ func main() {
 	<-c
 
 	sh.ShutdownServers()
+	services.ShutdownServices(inj)
 	log.Root.Info("finished")
 
 	os.Exit(0)
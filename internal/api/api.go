@@ -5,6 +5,15 @@ import "github.com/go-chi/chi/v5"
 // TenantHeaderKey in this header the right tenant should be inserted
 const TenantHeaderKey = "tenant"
 
+// TotalCountHeader in this header the total number of entries of a paged list is returned
+const TotalCountHeader = "X-Total-Count"
+
+// IdempotencyKeyHeader in this header the client key for retrying a request without duplicates is sent
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader this header marks a response replayed for an already used idempotency key
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
 // URLParamTenantID url parameter for the tenant id
 const URLParamTenantID = "tntid"
 
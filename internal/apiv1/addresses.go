@@ -2,29 +2,34 @@ package apiv1
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/samber/do/v2"
+	"github.com/willie68/go-micro/internal/auth"
 	"github.com/willie68/go-micro/internal/logging"
 	"github.com/willie68/go-micro/internal/serror"
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+	"github.com/willie68/go-micro/internal/services/events"
+	"github.com/willie68/go-micro/internal/utils/jsonpatch"
 	"github.com/willie68/go-micro/pkg/pmodel"
 
 	"github.com/willie68/go-micro/internal/api"
 	"github.com/willie68/go-micro/internal/utils/httputils"
 )
 
-const (
-	errMissingTenantKey = "missing-tenant"
-	errMissingTenantMsg = "tenant header %s missing"
-)
-
 var (
 	postAdrCounter = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "gomicro_post_adr_total",
@@ -32,68 +37,243 @@ var (
 	})
 )
 
+// AddressStorage the storage of the addresses, the addresses of every tenant are separated, addresses of other tenants
+// are not found. Every address has a version, starting with common.FirstVersion and counted up with every update.
+// Update, Delete and Purge are compare and swap operations, the address is only changed, if the stored version is the
+// given version, otherwise common.ErrVersionConflict is returned. Version 0 changes any version.
+// Delete moves the address into the trash, deleted addresses are only listed by Trash, until they are restored or
+// purged. Every other method treats them as not found.
+// Every change is recorded as revision with the user as actor, History returns the revisions of an address, even of
+// a purged one, sorted by version.
 type AddressStorage interface {
-	Addresses() ([]pmodel.Address, error)
-	Has(id string) bool
-	Read(id string) (*pmodel.Address, error)
-	Create(adr pmodel.Address) (string, error)
-	Update(adr pmodel.Address) error
-	Delete(id string) error
+	Addresses(tenant string, q pmodel.Query) (*pmodel.Page, error)
+	Trash(tenant string, q pmodel.Query) (*pmodel.Page, error)
+	Has(tenant, id string) bool
+	Read(tenant, id string) (*pmodel.Address, error)
+	Create(tenant string, adr pmodel.Address, user string) (string, error)
+	Update(tenant string, adr pmodel.Address, version int, user string) (int, error)
+	Delete(tenant, id string, version int, user string) (*pmodel.Address, error)
+	Restore(tenant, id, user string) (*pmodel.Address, error)
+	Purge(tenant, id string, version int, user string) (*pmodel.Address, error)
+	History(tenant, id string) ([]pmodel.Revision, error)
+}
+
+// Searcher an optional full text search of an AddressStorage, with typo tolerance and phonetic matching. The hits are
+// ranked by score.
+type Searcher interface {
+	Search(tenant string, q pmodel.SearchQuery) (*pmodel.SearchPage, error)
+}
+
+func init() {
+	httputils.RegisterStructValidation(pmodel.ValidateAddress, pmodel.Address{})
 }
 
 // AdrHandler the address handler
 type AdrHandler struct {
 	adrstg AddressStorage
+	idem   IdempotencyStorage
+	pubs   []EventPublisher
+	broker *events.Broker
 	logger *slog.Logger
 }
 
-// NewAdrHandler creates a new REST address handler
-func NewAdrHandler(inj do.Injector) api.Handler {
-	return &AdrHandler{
+// NewAdrHandler creates a new REST address handler, without an idempotency storage the Idempotency-Key header is
+// ignored. The changes of the addresses are published to the webhooks and the event streams, if enabled.
+func NewAdrHandler(inj do.Injector) *AdrHandler {
+	idem, _ := do.InvokeAs[IdempotencyStorage](inj)
+	c := &AdrHandler{
 		adrstg: do.MustInvokeAs[AddressStorage](inj),
+		idem:   idem,
+		pubs:   make([]EventPublisher, 0),
 		logger: logging.New("addresshandler"),
 	}
+	if dsp := dispatcher(inj); dsp != nil {
+		c.pubs = append(c.pubs, dsp)
+	}
+	if b, err := do.Invoke[*events.Broker](inj); err == nil {
+		c.broker = b
+		c.pubs = append(c.pubs, b)
+	}
+	return c
 }
 
 // Routes getting all routes for the address endpoint
 func (c *AdrHandler) Routes() (string, *chi.Mux) {
 	router := chi.NewRouter()
-	router.Post("/", c.PostAddress)
-	router.Get("/", c.GetAddresses)
-	router.Get("/{id}", c.GetAddress)
-	router.Post("/{id}", c.UpdateAddress)
-	router.Delete("/{id}", c.DeleteAddress)
+	router.With(auth.RoleCheck(auth.RoleObjectCreator), c.idempotent).Post("/", c.PostAddress)
+	router.With(auth.RoleCheck(auth.RoleObjectReader)).Get("/", c.GetAddresses)
+	router.With(auth.RoleCheck(auth.RoleObjectReader)).Get("/search", c.SearchAddresses)
+	router.With(auth.RoleCheck(auth.RoleObjectReader)).Get("/events", c.GetEvents)
+	router.With(auth.RoleCheck(auth.RoleObjectAdmin)).Get("/trash", c.GetTrash)
+	router.With(auth.RoleCheck(auth.RoleObjectReader)).Get("/{id}", c.GetAddress)
+	router.With(auth.RoleCheck(auth.RoleObjectReader)).Get("/{id}/history", c.GetHistory)
+	router.With(auth.RoleCheck(auth.RoleObjectCreator)).Put("/{id}", c.PutAddress)
+	router.With(auth.RoleCheck(auth.RoleObjectCreator)).Patch("/{id}", c.PatchAddress)
+	// deprecated, use put
+	router.With(auth.RoleCheck(auth.RoleObjectCreator)).Post("/{id}", c.UpdateAddress)
+	router.With(auth.RoleCheck(auth.RoleObjectAdmin)).Delete("/{id}", c.DeleteAddress)
+	router.With(auth.RoleCheck(auth.RoleObjectAdmin)).Post("/{id}:restore", c.RestoreAddress)
 	return BaseURL + addressesSubpath, router
 }
 
-// GetAddresses getting all addresses
+// GetAddresses getting one page of the addresses, the total count is returned in the X-Total-Count header and the
+// links to the next and previous page in the Link header
 //
-//	@Summary	getting all addresses
+//	@Summary	getting a page of the addresses
 //	@Tags		addresses
 //	@Accept		json
 //	@Produce	json
 //	@Security	api_key
-//	@Param		tenant	header		string			true	"Tenant"
-//	@Success	200		{array}		pmodel.Address	"response with list of addresses as json"
-//	@Failure	400		{object}	serror.Serr		"client error information as json"
-//	@Failure	500		{object}	serror.Serr		"server error information as json"
+//	@Param		tenant		header		string			true	"Tenant"
+//	@Param		limit		query		int				false	"maximal number of addresses, default 100, max 1000"
+//	@Param		offset		query		int				false	"number of addresses to skip"
+//	@Param		cursor		query		string			false	"cursor of the next or previous page"
+//	@Param		city		query		string			false	"filter city"
+//	@Param		state		query		string			false	"filter state"
+//	@Param		zip_code	query		string			false	"filter zip code"
+//	@Param		name		query		string			false	"filter name prefix"
+//	@Param		sort		query		string			false	"sort fields, - for descending, e.g. name,-city"
+//	@Success	200			{array}		pmodel.Address	"response with list of addresses as json"
+//	@Header		200			{int}		X-Total-Count	"total number of matching addresses"
+//	@Header		200			{string}	Link			"links to the next and previous page"
+//	@Failure	400			{object}	serror.Serr		"client error information as json"
+//	@Failure	403			{object}	serror.Serr		"missing role"
+//	@Failure	500			{object}	serror.Serr		"server error information as json"
 //	@Router		/addresses [get]
 func (c *AdrHandler) GetAddresses(response http.ResponseWriter, request *http.Request) {
-	tenant := getTenant(request)
-	if tenant == "" {
-		msg := fmt.Sprintf(errMissingTenantMsg, api.TenantHeaderKey)
-		httputils.Err(response, request, serror.BadRequest(nil, errMissingTenantKey, msg))
+	c.listAddresses(response, request, c.adrstg.Addresses)
+}
+
+// GetTrash getting one page of the deleted addresses, with the time and the user of the deletion. Paging, filters and
+// sorting are the same as for the addresses.
+//
+//	@Summary	getting a page of the deleted addresses
+//	@Tags		addresses
+//	@Accept		json
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant		header		string			true	"Tenant"
+//	@Param		limit		query		int				false	"maximal number of addresses, default 100, max 1000"
+//	@Param		offset		query		int				false	"number of addresses to skip"
+//	@Param		cursor		query		string			false	"cursor of the next or previous page"
+//	@Param		city		query		string			false	"filter city"
+//	@Param		state		query		string			false	"filter state"
+//	@Param		zip_code	query		string			false	"filter zip code"
+//	@Param		name		query		string			false	"filter name prefix"
+//	@Param		sort		query		string			false	"sort fields, - for descending, e.g. name,-city"
+//	@Success	200			{array}		pmodel.Address	"response with list of deleted addresses as json"
+//	@Header		200			{int}		X-Total-Count	"total number of matching deleted addresses"
+//	@Header		200			{string}	Link			"links to the next and previous page"
+//	@Failure	400			{object}	serror.Serr		"client error information as json"
+//	@Failure	403			{object}	serror.Serr		"missing role"
+//	@Failure	500			{object}	serror.Serr		"server error information as json"
+//	@Router		/addresses/trash [get]
+func (c *AdrHandler) GetTrash(response http.ResponseWriter, request *http.Request) {
+	c.listAddresses(response, request, c.adrstg.Trash)
+}
+
+// listAddresses writing one page of the addresses of the list function to the response
+func (c *AdrHandler) listAddresses(response http.ResponseWriter, request *http.Request, list func(tenant string, q pmodel.Query) (*pmodel.Page, error)) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
 		return
 	}
-	l, err := c.adrstg.Addresses()
+	q, err := pmodel.ParseQuery(request.URL.Query())
 	if err != nil {
+		httputils.Err(response, request, serror.BadRequest(err, "invalid-query", err.Error()))
+		return
+	}
+	p, err := list(tenant, q)
+	if err != nil {
+		if errors.Is(err, pmodel.ErrInvalidQuery) {
+			httputils.Err(response, request, serror.BadRequest(err, "invalid-query", err.Error()))
+			return
+		}
 		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
 		return
 	}
-	render.JSON(response, request, l)
+	response.Header().Set(api.TotalCountHeader, strconv.Itoa(p.Total))
+	links := make([]string, 0, 2)
+	link := func(cursor, rel string) {
+		if cursor != "" {
+			lq := q
+			lq.Offset = 0
+			lq.Cursor = cursor
+			links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, request.URL.Path, lq.Values().Encode(), rel))
+		}
+	}
+	link(p.Next, "next")
+	link(p.Prev, "prev")
+	if len(links) > 0 {
+		response.Header().Set("Link", strings.Join(links, ", "))
+	}
+	render.JSON(response, request, p.Addresses)
 }
 
-// GetAddress getting one address
+// SearchAddresses searching addresses by partial name, first name, street or city, with typo tolerance and phonetic
+// matching (Kölner Phonetik). The hits are ranked by score and paged by offset, the total count is returned in the
+// X-Total-Count header and the links to the next and previous page in the Link header.
+//
+//	@Summary	searching addresses
+//	@Tags		addresses
+//	@Accept		json
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string				true	"Tenant"
+//	@Param		q		query		string				true	"search terms, all terms must match"
+//	@Param		limit	query		int					false	"maximal number of hits, default 100, max 1000"
+//	@Param		offset	query		int					false	"number of hits to skip"
+//	@Success	200		{array}		pmodel.SearchHit	"the ranked hits"
+//	@Header		200		{int}		X-Total-Count		"total number of hits"
+//	@Header		200		{string}	Link				"links to the next and previous page"
+//	@Failure	400		{object}	serror.Serr			"client error information as json"
+//	@Failure	403		{object}	serror.Serr			"missing role"
+//	@Failure	501		{object}	serror.Serr			"the storage has no search"
+//	@Failure	500		{object}	serror.Serr			"server error information as json"
+//	@Router		/addresses/search [get]
+func (c *AdrHandler) SearchAddresses(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	searcher, ok := c.adrstg.(Searcher)
+	if !ok {
+		httputils.Err(response, request, serror.New(http.StatusNotImplemented, "search-not-supported", "the address storage has no search"))
+		return
+	}
+	q, err := pmodel.ParseSearchQuery(request.URL.Query())
+	if err != nil {
+		httputils.Err(response, request, serror.BadRequest(err, "invalid-query", err.Error()))
+		return
+	}
+	p, err := searcher.Search(tenant, q)
+	if err != nil {
+		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+		return
+	}
+	response.Header().Set(api.TotalCountHeader, strconv.Itoa(p.Total))
+	links := make([]string, 0, 2)
+	link := func(offset int, rel string) {
+		lq := q
+		lq.Offset = offset
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, request.URL.Path, lq.Values().Encode(), rel))
+	}
+	if q.Offset+q.PageSize() < p.Total {
+		link(q.Offset+q.PageSize(), "next")
+	}
+	if q.Offset > 0 {
+		link(max(0, q.Offset-q.PageSize()), "prev")
+	}
+	if len(links) > 0 {
+		response.Header().Set("Link", strings.Join(links, ", "))
+	}
+	render.JSON(response, request, p.Hits)
+}
+
+// GetAddress getting one address, the version of the address is returned as ETag. With a matching If-None-Match
+// header 304 is returned. With asOf the address is read as it was at this time, replayed from the history.
 //
 //	@Summary	getting one address
 //	@Tags		addresses
@@ -102,32 +282,97 @@ func (c *AdrHandler) GetAddresses(response http.ResponseWriter, request *http.Re
 //	@Security	api_key
 //	@Param		tenant	header		string			true	"Tenant"
 //	@Param		id		path		string			true	"ID"
-//	@Success	200		{array}		pmodel.Address	"response with the address with id as json"
+//	@Param		asOf	query		string			false	"read the address as it was at this time, RFC 3339"
+//	@Param		If-None-Match	header	string	false	"ETag of the cached address"
+//	@Success	200		{object}	pmodel.Address	"response with the address with id as json"
+//	@Header		200		{string}	ETag			"version of the address"
+//	@Success	304		"address not modified"
 //	@Failure	400		{object}	serror.Serr		"client error information as json"
+//	@Failure	403		{object}	serror.Serr		"missing role"
 //	@Failure	500		{object}	serror.Serr		"server error information as json"
 //	@Router		/addresses/{id} [get]
 func (c *AdrHandler) GetAddress(response http.ResponseWriter, request *http.Request) {
-	tenant := getTenant(request)
-	if tenant == "" {
-		msg := fmt.Sprintf(errMissingTenantMsg, api.TenantHeaderKey)
-		httputils.Err(response, request, serror.BadRequest(nil, errMissingTenantKey, msg))
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
 		return
 	}
 	n := chi.URLParam(request, "id")
-	if !c.adrstg.Has(n) {
-		httputils.Err(response, request, serror.ErrNotExists)
+	if s := request.URL.Query().Get("asOf"); s != "" {
+		c.getAddressAt(response, request, tenant, n, s)
+		return
+	}
+	if !c.adrstg.Has(tenant, n) {
+		httputils.Err(response, request, serror.NotFound("address", n))
 		return
 	}
-	adr, err := c.adrstg.Read(n)
+	adr, err := c.adrstg.Read(tenant, n)
 	if err != nil {
 		httputils.Err(response, request, serror.ErrUnknowError)
 		return
 	}
+	response.Header().Set("ETag", etag(adr.Version))
+	if inm := request.Header.Get("If-None-Match"); inm != "" && noneMatch(inm, adr.Version) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	render.JSON(response, request, adr)
+}
 
+// getAddressAt writing the address as it was at the time to the response, not found, if the address didn't exist or
+// was deleted at this time
+func (c *AdrHandler) getAddressAt(response http.ResponseWriter, request *http.Request, tenant, id, asOf string) {
+	at, err := time.Parse(time.RFC3339Nano, asOf)
+	if err != nil {
+		httputils.Err(response, request, serror.BadRequest(err, "invalid-parameter", "asOf must be a RFC 3339 timestamp"))
+		return
+	}
+	revs, err := c.adrstg.History(tenant, id)
+	if err != nil {
+		c.storageErr(response, request, id, err)
+		return
+	}
+	adr, ok := pmodel.AddressAt(revs, at)
+	if !ok {
+		httputils.Err(response, request, serror.NotFound("address", id))
+		return
+	}
 	render.JSON(response, request, adr)
 }
 
-// PostAddress create a new address, this method will always return 201
+// GetHistory getting the revisions of an address, sorted by version. Every revision has the action, the actor, the
+// time and the changed fields with the old and the new value. The history of deleted and purged addresses is kept.
+//
+//	@Summary	getting the history of an address
+//	@Tags		addresses
+//	@Accept		json
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string				true	"Tenant"
+//	@Param		id		path		string				true	"ID"
+//	@Success	200		{array}		pmodel.Revision		"the revisions of the address"
+//	@Failure	400		{object}	serror.Serr			"client error information as json"
+//	@Failure	403		{object}	serror.Serr			"missing role"
+//	@Failure	404		{object}	serror.Serr			"address not found"
+//	@Failure	500		{object}	serror.Serr			"server error information as json"
+//	@Router		/addresses/{id}/history [get]
+func (c *AdrHandler) GetHistory(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	n := chi.URLParam(request, "id")
+	revs, err := c.adrstg.History(tenant, n)
+	if err != nil {
+		c.storageErr(response, request, n, err)
+		return
+	}
+	render.JSON(response, request, revs)
+}
+
+// PostAddress create a new address, this method will always return 201. With an Idempotency-Key header a retry
+// returns the response of the first request, instead of creating the address again.
 //
 //	@Summary	Create a new address
 //	@Tags		addresses
@@ -135,131 +380,427 @@ func (c *AdrHandler) GetAddress(response http.ResponseWriter, request *http.Requ
 //	@Produce	json
 //	@Security	api_key
 //	@Param		tenant	header		string			true	"Tenant"
+//	@Param		Idempotency-Key	header	string	false	"key of the request for retries"
 //	@Param		payload	body		pmodel.Address	true	"address to be added"
 //	@Success	201		{string}	string			"tenant"
+//	@Header		201		{string}	ETag			"version of the address"
 //	@Failure	400		{object}	serror.Serr		"client error information as json"
+//	@Failure	403		{object}	serror.Serr		"missing role"
+//	@Failure	409		{object}	serror.Serr		"request with the idempotency key in flight"
+//	@Failure	422		{object}	serror.Serr		"idempotency key used with a different body"
 //	@Failure	500		{object}	serror.Serr		"server error information as json"
 //	@Router		/addresses [post]
 func (c *AdrHandler) PostAddress(response http.ResponseWriter, request *http.Request) {
-	var b []byte
-	var err error
-	tenant := getTenant(request)
-	if tenant == "" {
-		msg := fmt.Sprintf(errMissingTenantMsg, api.TenantHeaderKey)
-		httputils.Err(response, request, serror.BadRequest(nil, errMissingTenantKey, msg))
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
 		return
 	}
 	c.logger.Info(fmt.Sprintf("create config: tenant %s", tenant))
 
-	if b, err = io.ReadAll(request.Body); err != nil {
-		httputils.Err(response, request, serror.Wrapc(err, http.StatusBadRequest))
-		return
-	}
 	var adr pmodel.Address
-
-	err = json.Unmarshal(b, &adr)
-	if err != nil {
-		httputils.Err(response, request, serror.Wrapc(err, http.StatusBadRequest))
+	if err := httputils.Decode(request, &adr); err != nil {
+		httputils.Err(response, request, err)
 		return
 	}
 	postAdrCounter.Inc()
-	n, err := c.adrstg.Create(adr)
+	n, err := c.adrstg.Create(tenant, adr, actor(request))
 	if err != nil {
 		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
 		return
 	}
+	adr.ID = n
+	adr.Version = common.FirstVersion
+	c.publish(tenant, pmodel.EventAddressCreated, adr)
 	id := struct {
 		ID string `json:"id"`
 	}{
 		ID: n,
 	}
 
+	response.Header().Set("ETag", etag(common.FirstVersion))
 	render.Status(request, http.StatusCreated)
 	render.JSON(response, request, id)
 }
 
-// UpdateAddress update an address, this method will always return 201
+// PutAddress replacing the address, the id of the path is authoritative, a different id in the body is a bad request.
+// The version of the body is ignored, with an If-Match header the address is only replaced, if the stored version
+// matches.
 //
-//	@Summary	Create a new address
+//	@Summary	Replace an address
 //	@Tags		addresses
 //	@Accept		json
 //	@Produce	json
 //	@Security	api_key
-//	@Param		tenant	header		string		true	"Tenant"
-//	@Param		payload	body		string		true	"Add store"
-//	@Success	201		{string}	string		"tenant"
-//	@Failure	400		{object}	serror.Serr	"client error information as json"
-//	@Failure	500		{object}	serror.Serr	"server error information as json"
+//	@Param		tenant	header		string			true	"Tenant"
+//	@Param		id		path		string			true	"ID"
+//	@Param		payload	body		pmodel.Address	true	"the new address"
+//	@Param		If-Match	header	string	false	"ETag of the address to change"
+//	@Success	200		{object}	pmodel.Address	"the updated address"
+//	@Header		200		{string}	ETag			"the new version of the address"
+//	@Failure	400		{object}	serror.Serr		"client error information as json"
+//	@Failure	403		{object}	serror.Serr		"missing role"
+//	@Failure	404		{object}	serror.Serr		"address not found"
+//	@Failure	412		{object}	serror.Serr		"address was changed, the version doesn't match"
+//	@Failure	500		{object}	serror.Serr		"server error information as json"
+//	@Router		/addresses/{id} [put]
+func (c *AdrHandler) PutAddress(response http.ResponseWriter, request *http.Request) {
+	adr, ok := c.replaceAddress(response, request)
+	if !ok {
+		return
+	}
+	render.JSON(response, request, adr)
+}
+
+// UpdateAddress the legacy update of an address, same as PutAddress, but returns 201
+//
+//	@Summary	Update an address, deprecated, use PUT
+//	@Tags		addresses
+//	@Accept		json
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string			true	"Tenant"
+//	@Param		id		path		string			true	"ID"
+//	@Param		payload	body		pmodel.Address	true	"the new address"
+//	@Param		If-Match	header	string	false	"ETag of the address to change"
+//	@Success	201		{object}	pmodel.Address	"the updated address"
+//	@Header		201		{string}	ETag			"the new version of the address"
+//	@Failure	400		{object}	serror.Serr		"client error information as json"
+//	@Failure	403		{object}	serror.Serr		"missing role"
+//	@Failure	404		{object}	serror.Serr		"address not found"
+//	@Failure	412		{object}	serror.Serr		"address was changed, the version doesn't match"
+//	@Failure	500		{object}	serror.Serr		"server error information as json"
+//	@Deprecated
 //	@Router		/addresses/{id} [post]
 func (c *AdrHandler) UpdateAddress(response http.ResponseWriter, request *http.Request) {
-	var b []byte
-	var err error
-	tenant := getTenant(request)
-	if tenant == "" {
-		msg := fmt.Sprintf(errMissingTenantMsg, api.TenantHeaderKey)
-		httputils.Err(response, request, serror.BadRequest(nil, errMissingTenantKey, msg))
+	response.Header().Set("Deprecation", "true")
+	adr, ok := c.replaceAddress(response, request)
+	if !ok {
 		return
 	}
-	logger.Info(fmt.Sprintf("create config: tenant %s", tenant))
+	render.Status(request, http.StatusCreated)
+	render.JSON(response, request, adr)
+}
 
-	if b, err = io.ReadAll(request.Body); err != nil {
-		httputils.Err(response, request, serror.Wrapc(err, http.StatusBadRequest))
-		return
+func (c *AdrHandler) replaceAddress(response http.ResponseWriter, request *http.Request) (*pmodel.Address, bool) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return nil, false
 	}
 	var adr pmodel.Address
+	if err := httputils.Decode(request, &adr); err != nil {
+		httputils.Err(response, request, err)
+		return nil, false
+	}
+	id := chi.URLParam(request, "id")
+	if adr.ID != "" && adr.ID != id {
+		httputils.Err(response, request, serror.BadRequest(nil, "id-mismatch", fmt.Sprintf("id %s of the body doesn't match the path", adr.ID)))
+		return nil, false
+	}
+	adr.ID = id
+	version, err := c.ifMatch(request, tenant, id)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return nil, false
+	}
+	if !c.update(response, request, tenant, &adr, version) {
+		return nil, false
+	}
+	return &adr, true
+}
 
-	err = json.Unmarshal(b, &adr)
+// PatchAddress patching the address, with a json merge patch (RFC 7386, content type application/merge-patch+json)
+// or a json patch (RFC 6902, content type application/json-patch+json). The patch is applied to the stored version of
+// the address, if this version has changed meanwhile, or doesn't match the If-Match header, 412 is returned.
+//
+//	@Summary	Patch an address
+//	@Tags		addresses
+//	@Accept		application/merge-patch+json,application/json-patch+json
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string			true	"Tenant"
+//	@Param		id		path		string			true	"ID"
+//	@Param		payload	body		string			true	"the patch"
+//	@Param		If-Match	header	string	false	"ETag of the address to change"
+//	@Success	200		{object}	pmodel.Address	"the patched address"
+//	@Header		200		{string}	ETag			"the new version of the address"
+//	@Failure	400		{object}	serror.Serr		"client error information as json"
+//	@Failure	403		{object}	serror.Serr		"missing role"
+//	@Failure	404		{object}	serror.Serr		"address not found"
+//	@Failure	409		{object}	serror.Serr		"a test operation of the patch failed"
+//	@Failure	412		{object}	serror.Serr		"address was changed, the version doesn't match"
+//	@Failure	415		{object}	serror.Serr		"unsupported patch format"
+//	@Failure	500		{object}	serror.Serr		"server error information as json"
+//	@Router		/addresses/{id} [patch]
+func (c *AdrHandler) PatchAddress(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	var apply func(doc, patch []byte) ([]byte, error)
+	ct, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	switch ct {
+	case jsonpatch.MergePatchMediaType:
+		apply = jsonpatch.MergePatch
+	case jsonpatch.PatchMediaType:
+		apply = jsonpatch.Apply
+	default:
+		httputils.Err(response, request, serror.New(http.StatusUnsupportedMediaType, "unsupported-media-type",
+			fmt.Sprintf("content type must be %s or %s", jsonpatch.MergePatchMediaType, jsonpatch.PatchMediaType)))
+		return
+	}
+	patch, err := io.ReadAll(request.Body)
 	if err != nil {
 		httputils.Err(response, request, serror.Wrapc(err, http.StatusBadRequest))
 		return
 	}
-	postAdrCounter.Inc()
-	err = c.adrstg.Update(adr)
+	id := chi.URLParam(request, "id")
+	version, err := c.ifMatch(request, tenant, id)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	adr, err := c.adrstg.Read(tenant, id)
 	if err != nil {
+		if errors.Is(err, common.ErrNotFound) {
+			httputils.Err(response, request, serror.NotFound("address", id))
+			return
+		}
 		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
 		return
 	}
-	render.Status(request, http.StatusCreated)
-	render.JSON(response, request, adr)
+	if version != 0 && version != adr.Version {
+		httputils.Err(response, request, preconditionFailed(id))
+		return
+	}
+	doc, err := json.Marshal(adr)
+	if err != nil {
+		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+		return
+	}
+	doc, err = apply(doc, patch)
+	if err != nil {
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			httputils.Err(response, request, serror.New(http.StatusConflict, "patch-test-failed", err.Error()))
+			return
+		}
+		httputils.Err(response, request, serror.BadRequest(err, "invalid-patch", err.Error()))
+		return
+	}
+	var padr pmodel.Address
+	if err := json.Unmarshal(doc, &padr); err != nil {
+		httputils.Err(response, request, serror.BadRequest(err, "invalid-patch", "patched address is invalid"))
+		return
+	}
+	if padr.ID != id {
+		httputils.Err(response, request, serror.BadRequest(nil, "id-mismatch", "the id can't be patched"))
+		return
+	}
+	if err := httputils.Validate(&padr); err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	// the patch was applied to the read version, so it's only stored, if this version is still current
+	if !c.update(response, request, tenant, &padr, adr.Version) {
+		return
+	}
+	render.JSON(response, request, padr)
+}
+
+// update storing the address, if the stored version matches, and setting the new version to the address and the ETag
+// header. Errors are written to the response.
+func (c *AdrHandler) update(response http.ResponseWriter, request *http.Request, tenant string, adr *pmodel.Address, version int) bool {
+	postAdrCounter.Inc()
+	v, err := c.adrstg.Update(tenant, *adr, version, actor(request))
+	if err != nil {
+		c.storageErr(response, request, adr.ID, err)
+		return false
+	}
+	adr.Version = v
+	c.publish(tenant, pmodel.EventAddressUpdated, *adr)
+	response.Header().Set("ETag", etag(v))
+	c.logger.Info(fmt.Sprintf("address updated: tenant %s, id %s, version %d", tenant, adr.ID, v))
+	return true
 }
 
-// DeleteAddress deleting address
+// storageErr writing the error of a storage change of the address to the response
+func (c *AdrHandler) storageErr(response http.ResponseWriter, request *http.Request, id string, err error) {
+	switch {
+	case errors.Is(err, common.ErrNotFound):
+		httputils.Err(response, request, serror.NotFound("address", id))
+	case errors.Is(err, common.ErrVersionConflict):
+		httputils.Err(response, request, preconditionFailed(id))
+	default:
+		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+	}
+}
+
+// DeleteAddress deleting address, the address is moved into the trash and can be restored until it's purged. With
+// hard=true the address is deleted permanently, this needs the tenant-admin role. With an If-Match header the address
+// is only deleted, if the stored version matches.
 //
 //	@Summary	Delete a address
 //	@Tags		addresses
 //	@Accept		json
 //	@Produce	json
 //	@Security	api_key
-//	@Param		tenant	header	string	true	"Tenant"
-//	@Success	200		"ok"
+//	@Param		tenant		header	string	true	"Tenant"
+//	@Param		id			path	string	true	"ID"
+//	@Param		hard		query	bool	false	"delete the address permanently, deleted or not"
+//	@Param		If-Match	header	string	false	"ETag of the address to delete"
+//	@Success	200		{object}	pmodel.Address	"the deleted address"
 //	@Failure	400		{object}	serror.Serr	"client error information as json"
+//	@Failure	403		{object}	serror.Serr	"missing role"
+//	@Failure	404		{object}	serror.Serr	"address not found"
+//	@Failure	412		{object}	serror.Serr	"address was changed, the version doesn't match"
 //	@Router		/addresses/{id} [delete]
 func (c *AdrHandler) DeleteAddress(response http.ResponseWriter, request *http.Request) {
-	tenant := getTenant(request)
-	if tenant == "" {
-		msg := fmt.Sprintf(errMissingTenantMsg, api.TenantHeaderKey)
-		httputils.Err(response, request, serror.BadRequest(nil, errMissingTenantKey, msg))
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
 		return
 	}
 	n := chi.URLParam(request, "id")
-	if !c.adrstg.Has(n) {
-		httputils.Err(response, request, serror.NotFound("address", n))
+	hard := false
+	if s := request.URL.Query().Get("hard"); s != "" {
+		if hard, err = strconv.ParseBool(s); err != nil {
+			httputils.Err(response, request, serror.BadRequest(err, "invalid-parameter", "hard must be true or false"))
+			return
+		}
+	}
+	if hard && !auth.HasRole(request.Context(), tenant, auth.RoleTenantAdmin) {
+		httputils.Err(response, request, serror.Forbidden(nil, "missing-role", fmt.Sprintf("the role %s is needed for a hard delete", auth.RoleTenantAdmin)))
 		return
 	}
-	adr, err := c.adrstg.Read(n)
+	version, err := c.ifMatch(request, tenant, n)
 	if err != nil {
-		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+		httputils.Err(response, request, err)
 		return
 	}
-	err = c.adrstg.Delete(n)
+	var adr *pmodel.Address
+	if hard {
+		adr, err = c.adrstg.Purge(tenant, n, version, actor(request))
+	} else {
+		adr, err = c.adrstg.Delete(tenant, n, version, actor(request))
+	}
 	if err != nil {
-		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+		c.storageErr(response, request, n, err)
+		return
+	}
+	// purging an address from the trash is no change for the subscribers
+	if !hard || adr.DeletedAt == nil {
+		c.publish(tenant, pmodel.EventAddressDeleted, *adr)
+	}
+	c.logger.Info(fmt.Sprintf("address deleted: tenant %s, id %s, hard %t", tenant, n, hard))
+	render.JSON(response, request, adr)
+}
+
+// RestoreAddress restoring a deleted address from the trash, the version of the address is counted up
+//
+//	@Summary	Restore a deleted address
+//	@Tags		addresses
+//	@Accept		json
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string			true	"Tenant"
+//	@Param		id		path		string			true	"ID"
+//	@Success	200		{object}	pmodel.Address	"the restored address"
+//	@Header		200		{string}	ETag			"the new version of the address"
+//	@Failure	400		{object}	serror.Serr		"client error information as json"
+//	@Failure	403		{object}	serror.Serr		"missing role"
+//	@Failure	404		{object}	serror.Serr		"address not found in the trash"
+//	@Failure	500		{object}	serror.Serr		"server error information as json"
+//	@Router		/addresses/{id}:restore [post]
+func (c *AdrHandler) RestoreAddress(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
 		return
 	}
+	n := chi.URLParam(request, "id")
+	adr, err := c.adrstg.Restore(tenant, n, actor(request))
+	if err != nil {
+		c.storageErr(response, request, n, err)
+		return
+	}
+	// for the subscribers the restored address is a new one
+	c.publish(tenant, pmodel.EventAddressCreated, *adr)
+	c.logger.Info(fmt.Sprintf("address restored: tenant %s, id %s, version %d", tenant, n, adr.Version))
+	response.Header().Set("ETag", etag(adr.Version))
 	render.JSON(response, request, adr)
 }
 
-// getTenant getting the tenant from the request
-func getTenant(req *http.Request) string {
-	return req.Header.Get(api.TenantHeaderKey)
+// publish publishing the change of the address to all event publishers
+func (c *AdrHandler) publish(tenant, typ string, adr pmodel.Address) {
+	for _, p := range c.pubs {
+		p.Publish(tenant, typ, adr)
+	}
+}
+
+// actor the subject of the token of the request, empty without authentication
+func actor(request *http.Request) string {
+	_, claims, _ := auth.FromContext(request.Context())
+	sub, _ := claims["sub"].(string)
+	return sub
+}
+
+// etag the entity tag of the address version
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// etags splitting the list of entity tags of an If-Match or If-None-Match header
+func etags(header string) []string {
+	tags := strings.Split(header, ",")
+	for x, t := range tags {
+		tags[x] = strings.TrimSpace(t)
+	}
+	return tags
+}
+
+// noneMatch checking the If-None-Match header against the version, with the weak comparison of RFC 9110
+func noneMatch(header string, version int) bool {
+	return slices.ContainsFunc(etags(header), func(t string) bool {
+		return t == "*" || strings.TrimPrefix(t, "W/") == etag(version)
+	})
+}
+
+// ifMatch getting the version of the If-Match header for the compare and swap of the storage, 0 for a missing header
+// or *. With more than one entity tag the stored version is used, if it's one of them. If-Match uses the strong
+// comparison, weak or foreign entity tags never match.
+func (c *AdrHandler) ifMatch(request *http.Request, tenant, id string) (int, error) {
+	header := request.Header.Get("If-Match")
+	if header == "" {
+		return 0, nil
+	}
+	tags := etags(header)
+	if slices.Contains(tags, "*") {
+		return 0, nil
+	}
+	if len(tags) > 1 {
+		adr, err := c.adrstg.Read(tenant, id)
+		if err != nil {
+			// not found is reported by the following change
+			return 0, nil
+		}
+		if !slices.Contains(tags, etag(adr.Version)) {
+			return 0, preconditionFailed(id)
+		}
+		return adr.Version, nil
+	}
+	v, err := strconv.Unquote(tags[0])
+	if err != nil || !strings.HasPrefix(tags[0], `"`) {
+		return 0, preconditionFailed(id)
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < common.FirstVersion {
+		return 0, preconditionFailed(id)
+	}
+	return version, nil
+}
+
+func preconditionFailed(id string) error {
+	return serror.New(http.StatusPreconditionFailed, "precondition-failed", fmt.Sprintf("address %s was changed, the version doesn't match", id))
 }
@@ -1,6 +1,7 @@
 package apiv1
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -20,6 +21,7 @@ import (
 	"github.com/willie68/go-micro/internal/config"
 	"github.com/willie68/go-micro/internal/logging"
 	"github.com/willie68/go-micro/internal/services/health"
+	"github.com/willie68/go-micro/internal/services/issuer"
 	"github.com/willie68/go-micro/internal/utils/httputils"
 	"github.com/willie68/go-micro/pkg/web"
 )
@@ -47,9 +49,25 @@ func APIRoutes(inj do.Injector, cfn config.Config, trc opentracing.Tracer) (*chi
 	router := chi.NewRouter()
 	setDefaultHandler(router, cfn, trc)
 
-	// jwt is activated, register the Authenticator and Validator
-	if strings.EqualFold(cfn.Auth.Type, "jwt") {
-		err := setJWTHandler(router, cfn)
+	// client certificates are mapped to the client identity
+	if cfn.HTTP.ClientAuth.Active() {
+		router.Use(auth.ClientCertIdentity(cfn.HTTP.ClientAuth))
+	}
+
+	// jwt, api key or introspection is activated, register the Authenticator and Validator
+	switch strings.ToLower(cfn.Auth.Type) {
+	case "jwt":
+		err := setJWTHandler(inj, router, cfn)
+		if err != nil {
+			return nil, err
+		}
+	case "apikey":
+		err := setAPIKeyHandler(inj, router, cfn)
+		if err != nil {
+			return nil, err
+		}
+	case "introspection":
+		err := setIntrospectionHandler(inj, router, cfn)
 		if err != nil {
 			return nil, err
 		}
@@ -57,7 +75,20 @@ func APIRoutes(inj do.Injector, cfn config.Config, trc opentracing.Tracer) (*chi
 
 	// building the routes
 	router.Route("/", func(r chi.Router) {
-		r.Mount(NewAdrHandler(inj).Routes())
+		adrs := NewAdrHandler(inj)
+		r.Mount(adrs.Routes())
+		// the bulk methods are on the address collection, not below it
+		r.With(auth.RoleCheck(auth.RoleObjectCreator)).Post(BaseURL+addressesSubpath+":import", adrs.ImportAddresses)
+		r.With(auth.RoleCheck(auth.RoleObjectReader)).Get(BaseURL+addressesSubpath+":export", adrs.ExportAddresses)
+		if iss := localIssuer(inj); iss != nil {
+			r.Mount(NewIssuerHandler(iss).Routes())
+		}
+		if dsp := dispatcher(inj); dsp != nil {
+			r.Mount(NewWebhookHandler(dsp).Routes())
+		}
+		if rl, err := do.Invoke[*auth.RevocationList](inj); err == nil && strings.EqualFold(cfn.Auth.Type, "jwt") {
+			r.Mount(NewRevocationHandler(rl).Routes())
+		}
 
 		r.Mount(health.NewHealthHandler(inj).Routes())
 		if cfn.Metrics.Enable {
@@ -83,17 +114,84 @@ func APIRoutes(inj do.Injector, cfn config.Config, trc opentracing.Tracer) (*chi
 	return router, nil
 }
 
-func setJWTHandler(router *chi.Mux, cfn config.Config) error {
+func setJWTHandler(inj do.Injector, router *chi.Mux, cfn config.Config) error {
 	jwtConfig, err := auth.ParseJWTConfig(cfn.Auth)
 	if err != nil {
 		return err
 	}
+	if iss := localIssuer(inj); iss != nil {
+		// the issuer endpoints must be reachable without a token
+		jwtConfig.IgnorePages = append(jwtConfig.IgnorePages, issuer.Subpath)
+		if jwtConfig.LocalIssuer {
+			jwtConfig.LocalKeys = []auth.PublicKey{{Kid: iss.KeyID(), Alg: issuer.Algorithm, Key: iss.PublicKey()}}
+		}
+	} else if jwtConfig.LocalIssuer {
+		return errors.New("localissuer needs the enabled issuer")
+	}
 	logger.Info(fmt.Sprintf("jwt config: %v", jwtConfig))
-	jwtAuth := auth.JWTAuth{
-		Config: jwtConfig,
+	httputils.TenantClaim = jwtConfig.TenantClaim
+	httputils.TenantsClaim = jwtConfig.TenantsClaim
+	httputils.Strict = jwtConfig.Strict
+	jwtAuth, err := auth.InitJWT(jwtConfig)
+	if err != nil {
+		return err
+	}
+	if jwtConfig.Revocation {
+		if jwtAuth.Revocations, err = newRevocationList(inj, jwtConfig); err != nil {
+			return err
+		}
+	}
+	if jwtAuth.Keys != nil {
+		// failing key refreshes should be visible in the health system
+		if err := health.Register(inj, jwtAuth.Keys); err != nil {
+			return err
+		}
+	}
+	router.Use(
+		auth.Verifier(jwtAuth),
+		auth.Authenticator,
+	)
+	return nil
+}
+
+func setAPIKeyHandler(inj do.Injector, router *chi.Mux, cfn config.Config) error {
+	akConfig, err := auth.ParseAPIKeyConfig(cfn.Auth)
+	if err != nil {
+		return err
+	}
+	if localIssuer(inj) != nil {
+		akConfig.IgnorePages = append(akConfig.IgnorePages, issuer.Subpath)
+	}
+	logger.Info(fmt.Sprintf("api key config: header %q, query %q, %d keys", akConfig.Header, akConfig.Query, len(akConfig.Keys)))
+	// every api key is bound to exactly one tenant
+	httputils.TenantClaim = auth.APIKeyTenantClaim
+	httputils.TenantsClaim = nil
+	httputils.Strict = true
+	akAuth, err := auth.InitAPIKey(akConfig)
+	if err != nil {
+		return err
+	}
+	router.Use(
+		akAuth.Verifier(),
+		auth.Authenticator,
+	)
+	return nil
+}
+
+func setIntrospectionHandler(inj do.Injector, router *chi.Mux, cfn config.Config) error {
+	icfg, err := auth.ParseIntrospectionConfig(cfn.Auth)
+	if err != nil {
+		return err
+	}
+	if localIssuer(inj) != nil {
+		icfg.Claims.IgnorePages = append(icfg.Claims.IgnorePages, issuer.Subpath)
 	}
+	logger.Info(fmt.Sprintf("introspection config: url %q, client %q, cache %v", icfg.URL, icfg.ClientID, icfg.CacheTTL))
+	httputils.TenantClaim = icfg.Claims.TenantClaim
+	httputils.TenantsClaim = icfg.Claims.TenantsClaim
+	httputils.Strict = icfg.Claims.Strict
 	router.Use(
-		auth.Verifier(&jwtAuth),
+		auth.InitIntrospection(icfg).Verifier(),
 		auth.Authenticator,
 	)
 	return nil
@@ -108,9 +206,9 @@ func setDefaultHandler(router *chi.Mux, cfn config.Config, tracer opentracing.Tr
 			// AllowedOrigins: []string{"https://foo.com"}, // Use this to allow specific origin hosts
 			AllowedOrigins: []string{"*"},
 			// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-mcs-username", "X-mcs-password", "X-mcs-profile"},
-			ExposedHeaders:   []string{"Link"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", auth.DefaultAPIKeyHeader, "X-mcs-username", "X-mcs-password", "X-mcs-profile", "If-Match", "If-None-Match", api.IdempotencyKeyHeader, LastEventIDHeader},
+			ExposedHeaders:   []string{"Link", "ETag", api.TotalCountHeader, api.IdempotentReplayedHeader},
 			AllowCredentials: true,
 			MaxAge:           300, // Maximum value not ignored by any of major browsers
 		}),
@@ -0,0 +1,256 @@
+package apiv1
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/willie68/go-micro/internal/api"
+	"github.com/willie68/go-micro/internal/serror"
+	"github.com/willie68/go-micro/internal/services/adrsvc/bulk"
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+	"github.com/willie68/go-micro/internal/utils/httputils"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// ImportAddresses importing a stream of addresses as json array, ndjson or csv with header, the format is taken from
+// the content type. The rows are read and stored one by one, every failing row is reported and the import goes on with
+// the next row.
+//
+//	@Summary	Import addresses
+//	@Tags		addresses
+//	@Accept		json,application/x-ndjson,text/csv
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string				true	"Tenant"
+//	@Param		mode	query		string				false	"create (default), upsert or skip"
+//	@Param		dryrun	query		bool				false	"only check the rows, nothing is stored"
+//	@Param		map		query		string				false	"mapping of source fields to address fields, e.g. lastname:name"
+//	@Param		payload	body		string				true	"the addresses"
+//	@Success	200		{object}	pmodel.ImportReport	"the import report with the row errors"
+//	@Failure	400		{object}	serror.Serr			"client error information as json"
+//	@Failure	403		{object}	serror.Serr			"missing role"
+//	@Failure	415		{object}	serror.Serr			"unsupported format"
+//	@Failure	500		{object}	serror.Serr			"server error information as json"
+//	@Router		/addresses:import [post]
+func (c *AdrHandler) ImportAddresses(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	opts, err := pmodel.ParseImportOptions(request.URL.Query())
+	if err != nil {
+		httputils.Err(response, request, serror.BadRequest(err, "invalid-query", err.Error()))
+		return
+	}
+	f, err := bulk.ParseFormat(request.Header.Get("Content-Type"))
+	if err != nil {
+		httputils.Err(response, request, serror.New(http.StatusUnsupportedMediaType, "unsupported-media-type",
+			"content type must be application/json, application/x-ndjson or text/csv"))
+		return
+	}
+	rd, err := bulk.NewReader(request.Body, f, opts.Mapping)
+	if err != nil {
+		httputils.Err(response, request, serror.BadRequest(err, "invalid-import", err.Error()))
+		return
+	}
+	c.logger.Info(fmt.Sprintf("import addresses: tenant %s, format %s, mode %s, dry run %t", tenant, f, opts.Mode, opts.DryRun))
+
+	report := pmodel.ImportReport{
+		DryRun: opts.DryRun,
+	}
+	// ids of this import, to skip duplicates inside of the import
+	seen := make(map[string]bool)
+	user := actor(request)
+	for {
+		row, adr, err := rd.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		report.Rows = row
+		if err != nil {
+			importFailed(&report, row, adr.ID, err)
+			if !errors.Is(err, bulk.ErrInvalidRow) {
+				report.Aborted = true
+				break
+			}
+			continue
+		}
+		c.importRow(tenant, user, opts, &report, seen, row, adr)
+	}
+	c.logger.Info(fmt.Sprintf("import addresses: tenant %s, %d rows, %d created, %d updated, %d skipped, %d failed",
+		tenant, report.Rows, report.Created, report.Updated, report.Skipped, report.Failed))
+	render.JSON(response, request, report)
+}
+
+// importRow validating and storing one row of the import, depending on the mode, the user is the actor of the changes
+func (c *AdrHandler) importRow(tenant, user string, opts pmodel.ImportOptions, report *pmodel.ImportReport, seen map[string]bool, row int, adr pmodel.Address) {
+	if err := httputils.Validate(&adr); err != nil {
+		importFailed(report, row, adr.ID, err)
+		return
+	}
+	id := adr.ID
+	exists := id != "" && opts.Mode != pmodel.ImportCreate && c.adrstg.Has(tenant, id)
+	switch {
+	case opts.Mode == pmodel.ImportSkip && id != "" && (exists || seen[id]):
+		report.Skipped++
+	case opts.Mode == pmodel.ImportUpsert && id != "" && seen[id]:
+		importFailed(report, row, id, serror.BadRequest(nil, "duplicate-id", fmt.Sprintf("address %s is repeated in the import", id)))
+		return
+	case opts.Mode == pmodel.ImportUpsert && id != "" && !exists:
+		// the storage is creating the ids, so a created address would not get the id of the row and every further
+		// import would create it again
+		importFailed(report, row, id, serror.NotFound("address", id))
+		return
+	case opts.Mode == pmodel.ImportUpsert && exists:
+		if !opts.DryRun {
+			v, err := c.adrstg.Update(tenant, adr, 0, user)
+			if err != nil {
+				importFailed(report, row, id, err)
+				return
+			}
+			adr.Version = v
+			c.publish(tenant, pmodel.EventAddressUpdated, adr)
+		}
+		report.Updated++
+	default:
+		if !opts.DryRun {
+			// the storage is creating the id
+			adr.ID = ""
+			n, err := c.adrstg.Create(tenant, adr, user)
+			if err != nil {
+				importFailed(report, row, id, err)
+				return
+			}
+			adr.ID = n
+			adr.Version = common.FirstVersion
+			c.publish(tenant, pmodel.EventAddressCreated, adr)
+		}
+		report.Created++
+	}
+	if id != "" {
+		seen[id] = true
+	}
+}
+
+// importFailed adding the error of the row to the report
+func importFailed(report *pmodel.ImportReport, row int, id string, err error) {
+	report.Failed++
+	if len(report.Errors) >= pmodel.MaxImportErrors {
+		report.Truncated = true
+		return
+	}
+	ie := pmodel.ImportError{
+		Row: row,
+		ID:  id,
+		Msg: err.Error(),
+	}
+	var serr *serror.Serr
+	if errors.As(err, &serr) {
+		ie.Msg = serr.Msg
+		ie.Fields = serr.Fields
+	}
+	report.Errors = append(report.Errors, ie)
+}
+
+// ExportAddresses exporting the addresses as json array, ndjson or csv. The format is taken from the format parameter
+// or the Accept header, default is json. The addresses are read page by page and streamed to the client.
+//
+//	@Summary	Export addresses
+//	@Tags		addresses
+//	@Produce	json,application/x-ndjson,text/csv
+//	@Security	api_key
+//	@Param		tenant		header		string			true	"Tenant"
+//	@Param		format		query		string			false	"json, ndjson or csv"
+//	@Param		city		query		string			false	"filter city"
+//	@Param		state		query		string			false	"filter state"
+//	@Param		zip_code	query		string			false	"filter zip code"
+//	@Param		name		query		string			false	"filter name prefix"
+//	@Param		sort		query		string			false	"sort fields, - for descending, e.g. name,-city"
+//	@Success	200			{array}		pmodel.Address	"the addresses"
+//	@Header		200			{int}		X-Total-Count	"total number of exported addresses"
+//	@Failure	400			{object}	serror.Serr		"client error information as json"
+//	@Failure	403			{object}	serror.Serr		"missing role"
+//	@Failure	500			{object}	serror.Serr		"server error information as json"
+//	@Router		/addresses:export [get]
+func (c *AdrHandler) ExportAddresses(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	q, err := pmodel.ParseQuery(request.URL.Query())
+	if err != nil {
+		httputils.Err(response, request, serror.BadRequest(err, "invalid-query", err.Error()))
+		return
+	}
+	f := exportFormat(request)
+	if s := request.URL.Query().Get("format"); s != "" {
+		if f, err = bulk.ParseFormat(s); err != nil {
+			httputils.Err(response, request, serror.BadRequest(err, "invalid-query", err.Error()))
+			return
+		}
+	}
+	q.Limit = pmodel.MaxLimit
+	q.Offset = 0
+	q.Cursor = ""
+	// the first page is read before writing, so errors can still be responded
+	p, err := c.adrstg.Addresses(tenant, q)
+	if err != nil {
+		if errors.Is(err, pmodel.ErrInvalidQuery) {
+			httputils.Err(response, request, serror.BadRequest(err, "invalid-query", err.Error()))
+			return
+		}
+		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+		return
+	}
+	bw, err := bulk.NewWriter(response, f)
+	if err != nil {
+		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+		return
+	}
+	response.Header().Set("Content-Type", f.MediaType())
+	response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="addresses.%s"`, f))
+	response.Header().Set(api.TotalCountHeader, strconv.Itoa(p.Total))
+	rc := http.NewResponseController(response)
+	for {
+		for _, adr := range p.Addresses {
+			if err := bw.Write(adr); err != nil {
+				c.logger.Error(fmt.Sprintf("export addresses: tenant %s, write failed: %v", tenant, err))
+				return
+			}
+		}
+		if err := bw.Flush(); err != nil {
+			c.logger.Error(fmt.Sprintf("export addresses: tenant %s, write failed: %v", tenant, err))
+			return
+		}
+		_ = rc.Flush()
+		if p.Next == "" {
+			break
+		}
+		q.Cursor = p.Next
+		if p, err = c.adrstg.Addresses(tenant, q); err != nil {
+			// the response is already started, the client gets an incomplete stream
+			c.logger.Error(fmt.Sprintf("export addresses: tenant %s, reading failed: %v", tenant, err))
+			return
+		}
+	}
+	if err := bw.Close(); err != nil {
+		c.logger.Error(fmt.Sprintf("export addresses: tenant %s, write failed: %v", tenant, err))
+	}
+}
+
+// exportFormat the first supported format of the Accept header, json if there is none
+func exportFormat(request *http.Request) bulk.Format {
+	for _, a := range strings.Split(request.Header.Get("Accept"), ",") {
+		if f, err := bulk.ParseFormat(strings.TrimSpace(a)); err == nil {
+			return f
+		}
+	}
+	return bulk.JSON
+}
@@ -0,0 +1,100 @@
+package apiv1
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/willie68/go-micro/internal/serror"
+	"github.com/willie68/go-micro/internal/services/shttp"
+	"github.com/willie68/go-micro/internal/utils/httputils"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// LastEventIDHeader the header of a resumed event stream with the id of the last received event
+const LastEventIDHeader = "Last-Event-ID"
+
+// GetEvents streaming the changes of the addresses of the tenant as server-sent events, the event name is the event
+// type and the data the event as json. With a Last-Event-ID header the stream is resumed with the missed events, as far
+// as they are still in the replay buffer. An idle stream gets a heartbeat comment. A client, which doesn't keep up with
+// the events, is disconnected and has to resume.
+//
+//	@Summary	stream the address changes
+//	@Tags		addresses
+//	@Produce	text/event-stream
+//	@Security	api_key
+//	@Param		tenant			header		string			true	"Tenant"
+//	@Param		Last-Event-ID	header		string			false	"id of the last received event"
+//	@Success	200				{object}	pmodel.Event	"stream of events"
+//	@Failure	403				{object}	serror.Serr		"missing role"
+//	@Failure	501				{object}	serror.Serr		"event streams not enabled"
+//	@Router		/addresses/events [get]
+func (c *AdrHandler) GetEvents(response http.ResponseWriter, request *http.Request) {
+	if c.broker == nil {
+		httputils.Err(response, request, serror.New(http.StatusNotImplemented, "events-not-enabled", "the event streams are not enabled"))
+		return
+	}
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	stream, err := shttp.NewStreamer(response, request)
+	if err != nil {
+		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+		return
+	}
+	sub, replay := c.broker.Subscribe(tenant, request.Header.Get(LastEventIDHeader))
+	defer c.broker.Unsubscribe(sub)
+
+	response.Header().Set("Content-Type", "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.Header().Set("Connection", "keep-alive")
+	// no buffering by a reverse proxy
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(stream, ": connected\n\n"); err != nil {
+		return
+	}
+	for _, ev := range replay {
+		if err := writeEvent(stream, ev); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(c.broker.Heartbeat())
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-stream.Done:
+			return
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if err := writeEvent(stream, ev); err != nil {
+				c.logger.Info(fmt.Sprintf("event stream of tenant %s closed: %v", tenant, err))
+				return
+			}
+			heartbeat.Reset(c.broker.Heartbeat())
+		case <-heartbeat.C:
+			if _, err := io.WriteString(stream, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writing the event as server-sent event
+func writeEvent(w io.Writer, ev pmodel.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
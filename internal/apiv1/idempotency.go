@@ -0,0 +1,121 @@
+package apiv1
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/xid"
+	"github.com/willie68/go-micro/internal/api"
+	"github.com/willie68/go-micro/internal/serror"
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+	"github.com/willie68/go-micro/internal/utils/httputils"
+)
+
+// maxIdempotencyKeyLen the maximal length of an idempotency key
+const maxIdempotencyKeyLen = 255
+
+// IdempotencyStorage the storage of the responses of requests with an idempotency key, the keys of every tenant are
+// separated. Reserve reserves an unknown key for the request with the token and the fingerprint, for a known key the
+// stored entry is returned. The reservation is kept for the configured lease, the response of the reserved key is
+// stored with Complete, or the key is released for a retry. Both only succeed for the token of the reservation,
+// Complete fails with common.ErrReservationLost, if the lease is over and the key was reserved by another request. The
+// responses are kept for the configured window.
+type IdempotencyStorage interface {
+	Reserve(tenant, key, token, fingerprint string) (*common.IdempotencyEntry, bool, error)
+	Complete(tenant, key, token string, e common.IdempotencyEntry) error
+	Release(tenant, key, token string) error
+}
+
+// idempotent a middleware for requests with an Idempotency-Key header. The first response of the tenant and key is
+// stored and replayed for every retry with the same body. A retry with a different body is rejected with 422, a retry
+// while the first request is still in flight with 409. Server errors are not stored, the request can be retried.
+func (c *AdrHandler) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		key := request.Header.Get(api.IdempotencyKeyHeader)
+		if key == "" || c.idem == nil {
+			next.ServeHTTP(response, request)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			httputils.Err(response, request, serror.BadRequest(nil, "invalid-idempotency-key", fmt.Sprintf("idempotency key is longer than %d characters", maxIdempotencyKeyLen)))
+			return
+		}
+		tenant, err := httputils.TenantID(request)
+		if err != nil {
+			httputils.Err(response, request, err)
+			return
+		}
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			httputils.Err(response, request, serror.BadRequest(err, "invalid-body", "can't read the body"))
+			return
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+		fp := hex.EncodeToString(hash[:])
+
+		token := xid.New().String()
+		e, ok, err := c.idem.Reserve(tenant, key, token, fp)
+		if err != nil {
+			httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+			return
+		}
+		if !ok {
+			c.replay(response, request, fp, e)
+			return
+		}
+
+		completed := false
+		defer func() {
+			if !completed {
+				if err := c.idem.Release(tenant, key, token); err != nil {
+					c.logger.Error(fmt.Sprintf("can't release idempotency key %s: %v", key, err))
+				}
+			}
+		}()
+		var buf bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(response, request.ProtoMajor)
+		ww.Tee(&buf)
+		next.ServeHTTP(ww, request)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		if err := c.idem.Complete(tenant, key, token, common.IdempotencyEntry{Fingerprint: fp, Status: status, ETag: ww.Header().Get("ETag"), Body: buf.Bytes()}); err != nil {
+			c.logger.Error(fmt.Sprintf("can't store response of idempotency key %s: %v", key, err))
+			return
+		}
+		completed = true
+	})
+}
+
+// replay writing the stored response of an already used idempotency key
+func (c *AdrHandler) replay(response http.ResponseWriter, request *http.Request, fp string, e *common.IdempotencyEntry) {
+	if e.Fingerprint != fp {
+		httputils.Err(response, request, serror.New(http.StatusUnprocessableEntity, "idempotency-key-reused", "idempotency key was already used with a different body"))
+		return
+	}
+	if e.Status == 0 {
+		response.Header().Set("Retry-After", "1")
+		httputils.Err(response, request, serror.New(http.StatusConflict, "idempotency-key-in-flight", "a request with this idempotency key is still in flight"))
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Set(api.IdempotentReplayedHeader, "true")
+	if e.ETag != "" {
+		response.Header().Set("ETag", e.ETag)
+	}
+	response.WriteHeader(e.Status)
+	if _, err := response.Write(e.Body); err != nil {
+		c.logger.Error(fmt.Sprintf("can't write replayed response: %v", err))
+	}
+}
@@ -0,0 +1,125 @@
+package apiv1
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/do/v2"
+	"github.com/willie68/go-micro/internal/api"
+	"github.com/willie68/go-micro/internal/serror"
+	"github.com/willie68/go-micro/internal/services/issuer"
+	"github.com/willie68/go-micro/internal/utils/httputils"
+)
+
+// IssuerHandler the handler of the development token issuer
+type IssuerHandler struct {
+	iss *issuer.Issuer
+}
+
+// NewIssuerHandler creates a new REST handler for the development token issuer
+func NewIssuerHandler(iss *issuer.Issuer) api.Handler {
+	return &IssuerHandler{
+		iss: iss,
+	}
+}
+
+// localIssuer getting the development token issuer, nil if not enabled
+func localIssuer(inj do.Injector) *issuer.Issuer {
+	iss, err := do.Invoke[*issuer.Issuer](inj)
+	if err != nil {
+		return nil
+	}
+	return iss
+}
+
+// Routes getting all routes for the issuer endpoint
+func (i *IssuerHandler) Routes() (string, *chi.Mux) {
+	router := chi.NewRouter()
+	router.Get("/.well-known/openid-configuration", i.GetDiscovery)
+	router.Get("/.well-known/jwks.json", i.GetJWKS)
+	router.Post("/token", i.PostToken)
+	return issuer.Subpath, router
+}
+
+// GetDiscovery getting the openid discovery document
+//
+//	@Summary	openid discovery document of the development issuer
+//	@Tags		issuer
+//	@Produce	json
+//	@Success	200	{object}	map[string]any	"discovery document"
+//	@Router		/issuer/.well-known/openid-configuration [get]
+func (i *IssuerHandler) GetDiscovery(response http.ResponseWriter, request *http.Request) {
+	render.JSON(response, request, i.iss.Discovery())
+}
+
+// GetJWKS getting the json web key set with the signing key
+//
+//	@Summary	json web key set of the development issuer
+//	@Tags		issuer
+//	@Produce	json
+//	@Success	200	{object}	map[string]any	"json web key set"
+//	@Router		/issuer/.well-known/jwks.json [get]
+func (i *IssuerHandler) GetJWKS(response http.ResponseWriter, request *http.Request) {
+	render.JSON(response, request, i.iss.JWKS())
+}
+
+// PostToken minting a new token, the parameters can be send as json or as form
+//
+//	@Summary	mint a new token
+//	@Tags		issuer
+//	@Accept		json
+//	@Produce	json
+//	@Param		payload	body		issuer.TokenRequest		true	"token parameters"
+//	@Success	200		{object}	issuer.TokenResponse	"the signed token"
+//	@Failure	400		{object}	serror.Serr				"client error information as json"
+//	@Router		/issuer/token [post]
+func (i *IssuerHandler) PostToken(response http.ResponseWriter, request *http.Request) {
+	var tr issuer.TokenRequest
+	var err error
+	if strings.HasPrefix(request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		tr, err = tokenRequestFromForm(request)
+	} else {
+		err = render.DefaultDecoder(request, &tr)
+	}
+	if err != nil {
+		httputils.Err(response, request, serror.BadRequest(err, "decode-body", "could not decode token request"))
+		return
+	}
+	res, err := i.iss.Mint(tr, time.Now())
+	if err != nil {
+		httputils.Err(response, request, serror.BadRequest(err, "invalid-token-request", err.Error()))
+		return
+	}
+	render.JSON(response, request, res)
+}
+
+// tokenRequestFromForm reading the token request from the form values, lists are space separated or repeated
+func tokenRequestFromForm(request *http.Request) (issuer.TokenRequest, error) {
+	var tr issuer.TokenRequest
+	if err := request.ParseForm(); err != nil {
+		return tr, err
+	}
+	tr.Subject = request.PostForm.Get("sub")
+	tr.Tenant = request.PostForm.Get("tenant")
+	tr.Tenants = formList(request.PostForm["tenants"])
+	tr.Roles = formList(request.PostForm["roles"])
+	if ttl := request.PostForm.Get("ttl"); ttl != "" {
+		var err error
+		if tr.TTL, err = strconv.Atoi(ttl); err != nil {
+			return tr, err
+		}
+	}
+	return tr, nil
+}
+
+func formList(values []string) []string {
+	l := make([]string, 0)
+	for _, v := range values {
+		l = append(l, strings.Fields(v)...)
+	}
+	return l
+}
@@ -0,0 +1,131 @@
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/do/v2"
+	"github.com/willie68/go-micro/internal/api"
+	"github.com/willie68/go-micro/internal/auth"
+	"github.com/willie68/go-micro/internal/config"
+	"github.com/willie68/go-micro/internal/serror"
+	"github.com/willie68/go-micro/internal/utils/httputils"
+)
+
+// defining the sub path of the revocation admin endpoint
+const revocationsSubpath = "/admin/revocations"
+
+// RevocationHandler the admin handler for token revocations
+type RevocationHandler struct {
+	rl *auth.RevocationList
+}
+
+// revocationRequest a revocation, alternatively the token itself can be given, then jti and exp are taken from it
+type revocationRequest struct {
+	auth.Revocation
+	Token string `json:"token,omitempty"`
+}
+
+// NewRevocationHandler creates a new REST handler for the token revocations
+func NewRevocationHandler(rl *auth.RevocationList) api.Handler {
+	return &RevocationHandler{
+		rl: rl,
+	}
+}
+
+// newRevocationList creates the revocation list. The revocations are stored in the revocation storage of the
+// address storage, if present, otherwise in the configured file.
+func newRevocationList(inj do.Injector, cfg auth.JWTAuthConfig) (*auth.RevocationList, error) {
+	var stg auth.RevocationStorage
+	if s, err := do.InvokeAs[auth.RevocationStorage](inj); err == nil {
+		stg = s
+	} else if cfg.RevocationFile != "" {
+		file, err := config.ReplaceConfigdir(cfg.RevocationFile)
+		if err != nil {
+			return nil, err
+		}
+		stg = auth.NewFileRevocations(file)
+	} else {
+		logger.Warn("no revocation storage configured, revocations will be lost on restart")
+	}
+	rl, err := auth.NewRevocationList(stg, cfg.RevocationTTL)
+	if err != nil {
+		return nil, err
+	}
+	do.OverrideValue(inj, rl)
+	return rl, nil
+}
+
+// Routes getting all routes for the revocation endpoint
+func (h *RevocationHandler) Routes() (string, *chi.Mux) {
+	router := chi.NewRouter()
+	router.Use(auth.RoleCheck(auth.RoleAdmin))
+	router.Get("/", h.GetRevocations)
+	router.Post("/", h.PostRevocation)
+	return BaseURL + revocationsSubpath, router
+}
+
+// GetRevocations getting all active revocations
+//
+//	@Summary	getting all active token revocations
+//	@Tags		admin
+//	@Produce	json
+//	@Security	api_key
+//	@Success	200	{array}		auth.Revocation	"list of revocations"
+//	@Failure	403	{object}	serror.Serr		"missing role"
+//	@Router		/admin/revocations [get]
+func (h *RevocationHandler) GetRevocations(response http.ResponseWriter, request *http.Request) {
+	render.JSON(response, request, h.rl.Revocations())
+}
+
+// PostRevocation revoking a token by jti, all tokens of a subject issued before a point in time or the given token
+//
+//	@Summary	revoke tokens
+//	@Tags		admin
+//	@Accept		json
+//	@Produce	json
+//	@Security	api_key
+//	@Param		payload	body		revocationRequest	true	"the revocation"
+//	@Success	201		{object}	auth.Revocation		"the active revocation"
+//	@Failure	400		{object}	serror.Serr			"client error information as json"
+//	@Failure	403		{object}	serror.Serr			"missing role"
+//	@Failure	500		{object}	serror.Serr			"server error information as json"
+//	@Router		/admin/revocations [post]
+func (h *RevocationHandler) PostRevocation(response http.ResponseWriter, request *http.Request) {
+	var rr revocationRequest
+	if err := render.DefaultDecoder(request, &rr); err != nil {
+		httputils.Err(response, request, serror.BadRequest(err, "decode-body", "could not decode revocation"))
+		return
+	}
+	rev := rr.Revocation
+	if rr.Token != "" {
+		jt, err := auth.DecodeJWT(rr.Token)
+		if err != nil {
+			httputils.Err(response, request, serror.BadRequest(err, "invalid-token", "could not decode token"))
+			return
+		}
+		rev.ID, _ = jt.Payload["jti"].(string)
+		if exp, ok := jt.Payload["exp"].(float64); ok {
+			rev.Expires = time.Unix(int64(exp)+1, 0)
+		}
+		if rev.ID == "" {
+			httputils.Err(response, request, serror.BadRequest(nil, "missing-jti", "token without jti can't be revoked"))
+			return
+		}
+	}
+	if rev.ID == "" && rev.Subject == "" {
+		httputils.Err(response, request, serror.BadRequest(nil, "missing-param", "jti, sub or token is needed"))
+		return
+	}
+	rev, err := h.rl.Revoke(rev, time.Now())
+	if err != nil {
+		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+		return
+	}
+	logger.Info(fmt.Sprintf("token revoked: jti %q, sub %q", rev.ID, rev.Subject))
+	render.Status(request, http.StatusCreated)
+	render.JSON(response, request, rev)
+}
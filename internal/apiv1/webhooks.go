@@ -0,0 +1,249 @@
+package apiv1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/do/v2"
+	"github.com/willie68/go-micro/internal/api"
+	"github.com/willie68/go-micro/internal/auth"
+	"github.com/willie68/go-micro/internal/serror"
+	"github.com/willie68/go-micro/internal/services/webhooks"
+	"github.com/willie68/go-micro/internal/utils/httputils"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// EventPublisher a publisher of the address changes, e.g. the webhooks or the event streams
+type EventPublisher interface {
+	Publish(tenant, typ string, adr pmodel.Address)
+}
+
+// WebhookHandler the handler of the webhook subscriptions and their deliveries
+type WebhookHandler struct {
+	dsp *webhooks.Dispatcher
+}
+
+// NewWebhookHandler creates a new REST handler for the webhook subscriptions
+func NewWebhookHandler(dsp *webhooks.Dispatcher) api.Handler {
+	return &WebhookHandler{
+		dsp: dsp,
+	}
+}
+
+// dispatcher getting the webhook dispatcher, nil if not enabled
+func dispatcher(inj do.Injector) *webhooks.Dispatcher {
+	dsp, err := do.Invoke[*webhooks.Dispatcher](inj)
+	if err != nil {
+		return nil
+	}
+	return dsp
+}
+
+// Routes getting all routes for the webhook endpoint, the subscriptions of a tenant are managed by the tenant admin
+func (h *WebhookHandler) Routes() (string, *chi.Mux) {
+	router := chi.NewRouter()
+	router.Use(auth.RoleCheck(auth.RoleTenantAdmin))
+	router.Get("/", h.GetSubscriptions)
+	router.Post("/", h.PostSubscription)
+	router.Get("/deadletters", h.GetDeadLetters)
+	router.Post("/deadletters/{id}:redeliver", h.Redeliver)
+	router.Get("/{id}", h.GetSubscription)
+	router.Delete("/{id}", h.DeleteSubscription)
+	router.Get("/{id}/deliveries", h.GetDeliveries)
+	return BaseURL + webhooks.Subpath, router
+}
+
+// GetSubscriptions getting all webhook subscriptions of the tenant
+//
+//	@Summary	list the webhook subscriptions
+//	@Tags		webhooks
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string					true	"Tenant"
+//	@Success	200		{array}		pmodel.Subscription		"the subscriptions without secrets"
+//	@Failure	403		{object}	serror.Serr				"missing role"
+//	@Router		/webhooks [get]
+func (h *WebhookHandler) GetSubscriptions(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	render.JSON(response, request, h.dsp.Subscriptions(tenant))
+}
+
+// PostSubscription subscribing an url to the address events of the tenant, every event is posted to the url, signed
+// with the secret of the subscription
+//
+//	@Summary	create a webhook subscription
+//	@Tags		webhooks
+//	@Accept		json
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string				true	"Tenant"
+//	@Param		payload	body		pmodel.Subscription	true	"url, event types and secret"
+//	@Success	201		{object}	pmodel.Subscription	"the subscription without secret"
+//	@Failure	400		{object}	serror.Serr			"client error information as json"
+//	@Failure	403		{object}	serror.Serr			"missing role"
+//	@Failure	500		{object}	serror.Serr			"subscription can't be stored"
+//	@Router		/webhooks [post]
+func (h *WebhookHandler) PostSubscription(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	var sub pmodel.Subscription
+	if err := httputils.Decode(request, &sub); err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	sub, err = h.dsp.Subscribe(tenant, sub)
+	if err != nil {
+		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+		return
+	}
+	httputils.Created(response, request, sub.ID, sub)
+}
+
+// GetSubscription getting the webhook subscription with the id
+//
+//	@Summary	get a webhook subscription
+//	@Tags		webhooks
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string				true	"Tenant"
+//	@Param		id		path		string				true	"ID"
+//	@Success	200		{object}	pmodel.Subscription	"the subscription without secret"
+//	@Failure	403		{object}	serror.Serr			"missing role"
+//	@Failure	404		{object}	serror.Serr			"subscription not found"
+//	@Router		/webhooks/{id} [get]
+func (h *WebhookHandler) GetSubscription(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	id := chi.URLParam(request, "id")
+	sub, err := h.dsp.Subscription(tenant, id)
+	if err != nil {
+		webhookErr(response, request, "subscription", id, err)
+		return
+	}
+	render.JSON(response, request, sub)
+}
+
+// DeleteSubscription deleting the webhook subscription with the id, pending deliveries are moved to the dead letters
+//
+//	@Summary	delete a webhook subscription
+//	@Tags		webhooks
+//	@Security	api_key
+//	@Param		tenant	header	string	true	"Tenant"
+//	@Param		id		path	string	true	"ID"
+//	@Success	204
+//	@Failure	403	{object}	serror.Serr	"missing role"
+//	@Failure	404	{object}	serror.Serr	"subscription not found"
+//	@Failure	500	{object}	serror.Serr	"subscription can't be deleted"
+//	@Router		/webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteSubscription(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	id := chi.URLParam(request, "id")
+	if err := h.dsp.Unsubscribe(tenant, id); err != nil {
+		webhookErr(response, request, "subscription", id, err)
+		return
+	}
+	render.NoContent(response, request)
+}
+
+// GetDeliveries getting the deliveries of the webhook subscription with their status
+//
+//	@Summary	list the deliveries of a webhook subscription
+//	@Tags		webhooks
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string				true	"Tenant"
+//	@Param		id		path		string				true	"ID"
+//	@Success	200		{array}		pmodel.Delivery		"the deliveries sorted by creation"
+//	@Failure	403		{object}	serror.Serr			"missing role"
+//	@Failure	404		{object}	serror.Serr			"subscription not found"
+//	@Router		/webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) GetDeliveries(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	id := chi.URLParam(request, "id")
+	dls, err := h.dsp.Deliveries(tenant, id)
+	if err != nil {
+		webhookErr(response, request, "subscription", id, err)
+		return
+	}
+	render.JSON(response, request, dls)
+}
+
+// GetDeadLetters getting the deliveries of the tenant, which failed all attempts
+//
+//	@Summary	list the dead webhook deliveries
+//	@Tags		webhooks
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string				true	"Tenant"
+//	@Success	200		{array}		pmodel.Delivery		"the dead deliveries sorted by creation"
+//	@Failure	403		{object}	serror.Serr			"missing role"
+//	@Router		/webhooks/deadletters [get]
+func (h *WebhookHandler) GetDeadLetters(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	render.JSON(response, request, h.dsp.DeadLetters(tenant))
+}
+
+// Redeliver delivering a dead delivery again, with a new set of attempts
+//
+//	@Summary	redeliver a dead webhook delivery
+//	@Tags		webhooks
+//	@Produce	json
+//	@Security	api_key
+//	@Param		tenant	header		string				true	"Tenant"
+//	@Param		id		path		string				true	"ID of the delivery"
+//	@Success	202		{object}	pmodel.Delivery		"the pending delivery"
+//	@Failure	403		{object}	serror.Serr			"missing role"
+//	@Failure	404		{object}	serror.Serr			"delivery not found"
+//	@Failure	409		{object}	serror.Serr			"delivery is not dead"
+//	@Router		/webhooks/deadletters/{id}:redeliver [post]
+func (h *WebhookHandler) Redeliver(response http.ResponseWriter, request *http.Request) {
+	tenant, err := httputils.TenantID(request)
+	if err != nil {
+		httputils.Err(response, request, err)
+		return
+	}
+	id := chi.URLParam(request, "id")
+	dl, err := h.dsp.Redeliver(tenant, id)
+	if err != nil {
+		webhookErr(response, request, "delivery", id, err)
+		return
+	}
+	render.Status(request, http.StatusAccepted)
+	render.JSON(response, request, dl)
+}
+
+// webhookErr writing the error of the dispatcher
+func webhookErr(response http.ResponseWriter, request *http.Request, typ, id string, err error) {
+	switch {
+	case errors.Is(err, webhooks.ErrNotFound):
+		httputils.Err(response, request, serror.NotFound(typ, id))
+	case errors.Is(err, webhooks.ErrNotDead):
+		httputils.Err(response, request, serror.New(http.StatusConflict, "delivery-not-dead", err.Error()))
+	default:
+		httputils.Err(response, request, serror.Wrapc(err, http.StatusInternalServerError))
+	}
+}
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/willie68/go-micro/internal/config"
+)
+
+// the claims of the token created for an api key
+const (
+	APIKeyTenantClaim = "tenant"
+	APIKeyRolesClaim  = "roles"
+)
+
+// DefaultAPIKeyHeader the default header for the api key
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// ErrUnknownAPIKey the api key is not configured
+var ErrUnknownAPIKey = errors.New("api key unknown")
+
+var apiKeyCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gomicro_apikey_requests_total",
+	Help: "The total number of requests per api key",
+}, []string{"key", "result"})
+
+// APIKey one configured api key, only the sha256 hash of the key is stored
+type APIKey struct {
+	Name    string
+	Hash    string
+	Tenant  string
+	Roles   []string
+	Expires time.Time
+}
+
+// APIKeyConfig configuration of the api key authentication
+type APIKeyConfig struct {
+	// Header the header with the api key, empty to disable
+	Header string
+	// Query the query parameter with the api key, empty to disable
+	Query       string
+	IgnorePages []string
+	Keys        []APIKey
+}
+
+// APIKeyAuth the api key authentication
+type APIKeyAuth struct {
+	Config APIKeyConfig
+	keys   map[string]APIKey
+}
+
+// HashAPIKey getting the hash of an api key, as it should be stored in the config
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseAPIKeyConfig building up the api key configuration from the auth properties
+func ParseAPIKeyConfig(cfg config.Authentication) (APIKeyConfig, error) {
+	akcfg := APIKeyConfig{
+		Header:      DefaultAPIKeyHeader,
+		IgnorePages: make([]string, 0),
+		Keys:        make([]APIKey, 0),
+	}
+	if err := akcfg.parse(cfg.Properties); err != nil {
+		return akcfg, fmt.Errorf("invalid auth properties: %w", err)
+	}
+	return akcfg, nil
+}
+
+func (c *APIKeyConfig) parse(props map[string]any) error {
+	var err error
+	if _, ok := props["header"]; ok {
+		if c.Header, err = config.GetConfigValueAsString(props, "header"); err != nil {
+			return err
+		}
+	}
+	if c.Query, err = optionalString(props, "query"); err != nil {
+		return err
+	}
+	if c.Header == "" && c.Query == "" {
+		return errors.New("one of header or query is needed")
+	}
+	if c.IgnorePages, err = optionalStrings(props, "ignorePages"); err != nil {
+		return err
+	}
+	keys, ok := props["keys"].([]any)
+	if !ok {
+		return errors.New("config value for keys is not a list")
+	}
+	for x, k := range keys {
+		m, ok := k.(map[string]any)
+		if !ok {
+			return fmt.Errorf("keys entry %d is not a map", x)
+		}
+		key, err := parseAPIKey(m)
+		if err != nil {
+			return fmt.Errorf("keys entry %d: %w", x, err)
+		}
+		c.Keys = append(c.Keys, key)
+	}
+	return nil
+}
+
+func parseAPIKey(m map[string]any) (APIKey, error) {
+	var key APIKey
+	var err error
+	if key.Name, err = config.GetConfigValueAsString(m, "name"); err != nil {
+		return key, err
+	}
+	if key.Hash, err = config.GetConfigValueAsString(m, "hash"); err != nil {
+		return key, err
+	}
+	key.Hash = strings.ToLower(strings.TrimPrefix(key.Hash, "sha256:"))
+	if b, err := hex.DecodeString(key.Hash); err != nil || len(b) != sha256.Size {
+		return key, fmt.Errorf("hash of key %s is not a sha256 hex value", key.Name)
+	}
+	if key.Tenant, err = config.GetConfigValueAsString(m, "tenant"); err != nil {
+		return key, err
+	}
+	if key.Roles, err = optionalStrings(m, "roles"); err != nil {
+		return key, err
+	}
+	for _, r := range key.Roles {
+		if !slices.Contains(Roles, r) {
+			return key, fmt.Errorf("unknown role %q for key %s", r, key.Name)
+		}
+	}
+	switch v := m["expires"].(type) {
+	case nil:
+	case time.Time:
+		key.Expires = v
+	case string:
+		key.Expires, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			key.Expires, err = time.Parse(time.DateOnly, v)
+		}
+		if err != nil {
+			return key, fmt.Errorf("expires of key %s is not a valid date", key.Name)
+		}
+	default:
+		return key, fmt.Errorf("expires of key %s is not a valid date", key.Name)
+	}
+	return key, nil
+}
+
+// InitAPIKey initialize the api key authentication
+func InitAPIKey(cfg APIKeyConfig) (*APIKeyAuth, error) {
+	ak := APIKeyAuth{
+		Config: cfg,
+		keys:   make(map[string]APIKey),
+	}
+	for _, k := range cfg.Keys {
+		if _, ok := ak.keys[k.Hash]; ok {
+			return nil, fmt.Errorf("duplicate api key %s", k.Name)
+		}
+		ak.keys[k.Hash] = k
+	}
+	return &ak, nil
+}
+
+// Verifier returns a handler for verification of the api key. The key is converted into a token with the
+// tenant and roles claims, so all handlers can use FromContext.
+func (a *APIKeyAuth) Verifier() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			noCheck := false
+			for _, p := range a.Config.IgnorePages {
+				if strings.HasPrefix(r.URL.Path, p) {
+					noCheck = true
+				}
+			}
+			token, err := a.VerifyRequest(r)
+			ctx := NewContext(r.Context(), token, err, noCheck)
+			ctx = context.WithValue(ctx, RolesCtxKey, a)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// VerifyRequest checking the api key of the request
+func (a *APIKeyAuth) VerifyRequest(r *http.Request) (*JWT, error) {
+	var key string
+	if a.Config.Header != "" {
+		key = r.Header.Get(a.Config.Header)
+	}
+	if key == "" && a.Config.Query != "" {
+		key = r.URL.Query().Get(a.Config.Query)
+	}
+	if key == "" {
+		return nil, ErrNoTokenFound
+	}
+	return a.VerifyKey(key, time.Now())
+}
+
+// VerifyKey checking the api key and creating a token for it
+func (a *APIKeyAuth) VerifyKey(key string, now time.Time) (*JWT, error) {
+	ak, ok := a.keys[HashAPIKey(key)]
+	if !ok {
+		apiKeyCounter.WithLabelValues("", "unknown").Inc()
+		return nil, ErrUnknownAPIKey
+	}
+	if !ak.Expires.IsZero() && now.After(ak.Expires) {
+		apiKeyCounter.WithLabelValues(ak.Name, "expired").Inc()
+		return nil, ErrExpired
+	}
+	apiKeyCounter.WithLabelValues(ak.Name, "ok").Inc()
+	roles := make([]any, 0, len(ak.Roles))
+	for _, r := range ak.Roles {
+		roles = append(roles, r)
+	}
+	payload := map[string]any{
+		"sub":             ak.Name,
+		APIKeyTenantClaim: ak.Tenant,
+		APIKeyRolesClaim:  roles,
+	}
+	if !ak.Expires.IsZero() {
+		payload["exp"] = float64(ak.Expires.Unix())
+	}
+	return &JWT{
+		Header:  map[string]any{"alg": "none", "typ": "apikey"},
+		Payload: payload,
+		IsValid: true,
+	}, nil
+}
+
+// ResolveRoles getting all logical roles of the api key, including the implied lower roles
+func (a *APIKeyAuth) ResolveRoles(claims map[string]any, _ string) []string {
+	rm := RoleMapping{Claims: []string{APIKeyRolesClaim}}
+	return rm.ResolveRoles(claims, "")
+}
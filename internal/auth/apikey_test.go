@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/config"
+	"github.com/willie68/go-micro/internal/serror"
+)
+
+func testAPIKeyAuth(t *testing.T) *APIKeyAuth {
+	ast := assert.New(t)
+	cfg, err := ParseAPIKeyConfig(config.Authentication{
+		Type: "apikey",
+		Properties: map[string]any{
+			"query": "apikey",
+			"keys": []any{
+				map[string]any{
+					"name":   "importer",
+					"hash":   "sha256:" + HashAPIKey("secret1"),
+					"tenant": "tenant1",
+					"roles":  []any{RoleObjectCreator},
+				},
+				map[string]any{
+					"name":    "old",
+					"hash":    HashAPIKey("secret2"),
+					"tenant":  "tenant2",
+					"roles":   "object-admin",
+					"expires": "2020-01-01",
+				},
+			},
+		},
+	})
+	ast.Nil(err)
+	ast.Equal(DefaultAPIKeyHeader, cfg.Header)
+	ast.Len(cfg.Keys, 2)
+	ak, err := InitAPIKey(cfg)
+	ast.Nil(err)
+	return ak
+}
+
+func TestParseAPIKeyConfig(t *testing.T) {
+	ast := assert.New(t)
+	ak := testAPIKeyAuth(t)
+	ast.Equal("apikey", ak.Config.Query)
+	ast.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ak.Config.Keys[1].Expires)
+
+	props := []map[string]any{
+		{},
+		{"header": "", "keys": []any{}},
+		{"keys": []any{map[string]any{"name": "k", "hash": "abc", "tenant": "t"}}},
+		{"keys": []any{map[string]any{"name": "k", "hash": HashAPIKey("k"), "tenant": "t", "roles": "root"}}},
+		{"keys": []any{map[string]any{"name": "k", "hash": HashAPIKey("k"), "tenant": "t", "expires": "tomorrow"}}},
+	}
+	for _, p := range props {
+		_, err := ParseAPIKeyConfig(config.Authentication{Type: "apikey", Properties: p})
+		ast.NotNil(err, "%v", p)
+	}
+
+	_, err := InitAPIKey(APIKeyConfig{Keys: []APIKey{{Name: "a", Hash: "1"}, {Name: "b", Hash: "1"}}})
+	ast.NotNil(err)
+}
+
+func TestVerifyAPIKey(t *testing.T) {
+	ast := assert.New(t)
+	ak := testAPIKeyAuth(t)
+
+	var claims map[string]any
+	var roles []string
+	hnd := ak.Verifier()(Authenticator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, claims, _ = FromContext(r.Context())
+		roles, _ = RolesFromContext(r.Context(), "")
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultAPIKeyHeader, "secret1")
+	rec := httptest.NewRecorder()
+	hnd.ServeHTTP(rec, req)
+	ast.Equal(http.StatusOK, rec.Code)
+	ast.Equal("importer", claims["sub"])
+	ast.Equal("tenant1", claims[APIKeyTenantClaim])
+	ast.Equal([]string{RoleObjectReader, RoleObjectCreator}, roles)
+
+	rec = httptest.NewRecorder()
+	hnd.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?apikey=secret1", nil))
+	ast.Equal(http.StatusOK, rec.Code)
+
+	tests := []struct {
+		url string
+		key string
+	}{
+		{url: "/", key: "token-missing"},
+		{url: "/?apikey=wrong", key: "apikey-unknown"},
+		{url: "/?apikey=secret2", key: "token-expired"},
+	}
+	for _, tc := range tests {
+		rec = httptest.NewRecorder()
+		hnd.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.url, nil))
+		ast.Equal(http.StatusUnauthorized, rec.Code)
+		var serr serror.Serr
+		ast.Nil(json.Unmarshal(rec.Body.Bytes(), &serr))
+		ast.Equal(tc.key, serr.Key)
+	}
+
+	// before the expiry the key is valid
+	jt, err := ak.VerifyKey("secret2", time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC))
+	ast.Nil(err)
+	ast.True(jt.IsValid)
+	ctx := NewContext(context.Background(), jt, nil, false)
+	ctx = context.WithValue(ctx, RolesCtxKey, ak)
+	ast.True(HasRole(ctx, "tenant2", RoleObjectAdmin))
+	ast.False(HasRole(ctx, "tenant2", RoleTenantAdmin))
+}
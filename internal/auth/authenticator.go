@@ -6,6 +6,9 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/willie68/go-micro/internal/serror"
 )
 
 // used context key for parameter given in a std context
@@ -34,6 +37,9 @@ func FromContext(ctx context.Context) (*JWT, map[string]any, error) {
 
 	if !ok || (token == nil) {
 		claims = map[string]any{}
+		if err, ok = ctx.Value(ErrorCtxKey).(error); ok && err != nil {
+			return token, claims, err
+		}
 		return token, claims, errors.New("token not present")
 	}
 
@@ -55,13 +61,13 @@ func Authenticator(next http.Handler) http.Handler {
 		}
 		token, _, err := FromContext(r.Context())
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
+		if err == nil && (token == nil || !token.IsValid) {
+			err = ErrUnauthorized
 		}
-
-		if token == nil || !token.IsValid {
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		if err != nil {
+			apierr := UnauthorizedError(err)
+			render.Status(r, apierr.Code)
+			render.JSON(w, r, apierr)
 			return
 		}
 		// Token is authenticated, pass it through
@@ -69,6 +75,33 @@ func Authenticator(next http.Handler) http.Handler {
 	})
 }
 
+// errorKeys the keys of the service errors for the different token errors
+var errorKeys = map[error]string{
+	ErrExpired:             "token-expired",
+	ErrNBFInvalid:          "token-not-yet-valid",
+	ErrIATInvalid:          "token-iat-invalid",
+	ErrIssuerInvalid:       "token-issuer-invalid",
+	ErrAudienceInvalid:     "token-audience-invalid",
+	ErrAlgoInvalid:         "token-algorithm-invalid",
+	ErrSignatureInvalid:    "token-signature-invalid",
+	ErrUnknownKey:          "token-unknown-key",
+	ErrNoTokenFound:        "token-missing",
+	ErrUnknownAPIKey:       "apikey-unknown",
+	ErrRevoked:             "token-revoked",
+	ErrTokenInactive:       "token-inactive",
+	ErrIntrospectionFailed: "token-introspection-failed",
+}
+
+// UnauthorizedError converts a token error into an unauthorized service error with a distinct key
+func UnauthorizedError(err error) *serror.Serr {
+	for e, key := range errorKeys {
+		if errors.Is(err, e) {
+			return serror.Unauthorized(err, key, e.Error())
+		}
+	}
+	return serror.Unauthorized(err, "unauthorized", ErrUnauthorized.Error())
+}
+
 // Verifier returns a handler for verification
 func Verifier(ja *JWTAuth) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -90,6 +123,7 @@ func Verify(ja *JWTAuth, findTokenFns ...func(r *http.Request) string) func(http
 			}
 			token, err := VerifyRequest(ja, r, findTokenFns...)
 			ctx = NewContext(ctx, token, err, noCheck)
+			ctx = context.WithValue(ctx, RolesCtxKey, ja)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 		return http.HandlerFunc(hfn)
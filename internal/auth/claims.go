@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// errors of the registered claim validation
+var (
+	ErrIssuerInvalid   = errors.New("token issuer not allowed")
+	ErrAudienceInvalid = errors.New("token audience not allowed")
+)
+
+// validateClaims checking the registered claims exp, nbf, iat, iss and aud against the configuration
+func (j *JWT) validateClaims(cfg JWTAuthConfig, now time.Time) error {
+	skew := cfg.ClockSkew
+	if exp, ok := j.numericDate("exp"); ok && now.After(exp.Add(skew)) {
+		return ErrExpired
+	}
+	if nbf, ok := j.numericDate("nbf"); ok && now.Add(skew).Before(nbf) {
+		return ErrNBFInvalid
+	}
+	iat, ok := j.numericDate("iat")
+	if ok && now.Add(skew).Before(iat) {
+		return ErrIATInvalid
+	}
+	if cfg.MaxAge > 0 && (!ok || now.After(iat.Add(cfg.MaxAge+skew))) {
+		return ErrIATInvalid
+	}
+	if len(cfg.Issuers) > 0 {
+		iss, _ := j.Payload["iss"].(string)
+		if !slices.Contains(cfg.Issuers, iss) {
+			return ErrIssuerInvalid
+		}
+	}
+	if len(cfg.Audiences) > 0 && !j.hasAudience(cfg.Audiences) {
+		return ErrAudienceInvalid
+	}
+	return nil
+}
+
+// numericDate getting a claim as time, the claim is a json number of seconds since epoch
+func (j *JWT) numericDate(claim string) (time.Time, bool) {
+	v, ok := j.Payload[claim].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	sec := int64(v)
+	return time.Unix(sec, int64((v-float64(sec))*float64(time.Second))), true
+}
+
+// hasAudience checking if one of the audiences is present in the aud claim, which can be a string or an array
+func (j *JWT) hasAudience(auds []string) bool {
+	switch v := j.Payload["aud"].(type) {
+	case string:
+		return slices.Contains(auds, v)
+	case []any:
+		for _, a := range v {
+			if s, ok := a.(string); ok && slices.Contains(auds, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
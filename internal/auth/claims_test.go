@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/serror"
+)
+
+func TestValidateClaims(t *testing.T) {
+	ast := assert.New(t)
+	now := time.Now()
+	cfg := JWTAuthConfig{
+		Issuers:   []string{"https://idp.example.com"},
+		Audiences: []string{"broker", "go-micro"},
+		MaxAge:    time.Hour,
+		ClockSkew: 30 * time.Second,
+	}
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss": "https://idp.example.com",
+			"aud": []any{"account", "broker"},
+			"iat": float64(now.Add(-time.Minute).Unix()),
+			"nbf": float64(now.Add(-time.Minute).Unix()),
+			"exp": float64(now.Add(time.Minute).Unix()),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(c map[string]any)
+		err    error
+	}{
+		{"valid", func(_ map[string]any) {}, nil},
+		{"single audience", func(c map[string]any) { c["aud"] = "go-micro" }, nil},
+		{"expired", func(c map[string]any) { c["exp"] = float64(now.Add(-time.Minute).Unix()) }, ErrExpired},
+		{"expired within skew", func(c map[string]any) { c["exp"] = float64(now.Add(-10 * time.Second).Unix()) }, nil},
+		{"not yet valid", func(c map[string]any) { c["nbf"] = float64(now.Add(time.Minute).Unix()) }, ErrNBFInvalid},
+		{"nbf within skew", func(c map[string]any) { c["nbf"] = float64(now.Add(10 * time.Second).Unix()) }, nil},
+		{"issued in future", func(c map[string]any) { c["iat"] = float64(now.Add(time.Minute).Unix()) }, ErrIATInvalid},
+		{"too old", func(c map[string]any) { c["iat"] = float64(now.Add(-2 * time.Hour).Unix()) }, ErrIATInvalid},
+		{"missing iat with max age", func(c map[string]any) { delete(c, "iat") }, ErrIATInvalid},
+		{"wrong issuer", func(c map[string]any) { c["iss"] = "https://evil.example.com" }, ErrIssuerInvalid},
+		{"missing issuer", func(c map[string]any) { delete(c, "iss") }, ErrIssuerInvalid},
+		{"wrong audience", func(c map[string]any) { c["aud"] = []any{"account"} }, ErrAudienceInvalid},
+		{"missing audience", func(c map[string]any) { delete(c, "aud") }, ErrAudienceInvalid},
+	}
+	for _, tc := range tests {
+		claims := valid()
+		tc.change(claims)
+		j := JWT{Payload: claims}
+		err := j.validateClaims(cfg, now)
+		if tc.err == nil {
+			ast.Nil(err, tc.name)
+		} else {
+			ast.ErrorIs(err, tc.err, tc.name)
+		}
+	}
+
+	// without configuration only the time based claims are checked
+	j := JWT{Payload: map[string]any{"iss": "someone"}}
+	ast.Nil(j.validateClaims(JWTAuthConfig{}, now))
+}
+
+func TestAuthenticatorErrorKeys(t *testing.T) {
+	ast := assert.New(t)
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	data, _ := json.Marshal(JWKS{Keys: []JWK{rsaJWK("rsa", &rk.PublicKey)}})
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	ast.Nil(os.WriteFile(file, data, 0o600))
+	ja := testJWTAuth(t, JWTAuthConfig{
+		JWKSFile:  file,
+		Audiences: []string{"go-micro"},
+	})
+
+	hnd := Verifier(ja)(Authenticator(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	now := time.Now()
+	tests := []struct {
+		name   string
+		claims map[string]any
+		code   int
+		key    string
+	}{
+		{"valid", map[string]any{"aud": "go-micro", "exp": float64(now.Add(time.Minute).Unix())}, http.StatusOK, ""},
+		{"expired", map[string]any{"aud": "go-micro", "exp": float64(now.Add(-time.Minute).Unix())}, http.StatusUnauthorized, "token-expired"},
+		{"audience", map[string]any{"aud": "other", "exp": float64(now.Add(time.Minute).Unix())}, http.StatusUnauthorized, "token-audience-invalid"},
+		{"missing", nil, http.StatusUnauthorized, "token-missing"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.claims != nil {
+			req.Header.Set("Authorization", "Bearer "+signTestToken(t, "RS256", "rsa", rk, tc.claims))
+		}
+		rec := httptest.NewRecorder()
+		hnd.ServeHTTP(rec, req)
+		ast.Equal(tc.code, rec.Code, tc.name)
+		if tc.key != "" {
+			var serr serror.Serr
+			ast.Nil(json.Unmarshal(rec.Body.Bytes(), &serr), tc.name)
+			ast.Equal(tc.key, serr.Key, tc.name)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"github.com/willie68/go-micro/internal/services/shttp"
+)
+
+// ClientCertCtxKey context key for the identity of the verified client certificate
+var ClientCertCtxKey = &contextKey{"ClientCert"}
+
+// ClientIdentity the identity of a client, authenticated by a verified client certificate
+type ClientIdentity struct {
+	// ID the identity of the client, from the subject or the san of the certificate
+	ID string
+	// Tenant the tenant of the client, empty if not configured
+	Tenant string
+	// Certificate the verified client certificate
+	Certificate *x509.Certificate
+}
+
+// ClientCertIdentity returns a handler, which maps a verified client certificate to a client identity in the request
+// context. Certificates, which are only requested but not verified, are ignored.
+func ClientCertIdentity(cfg shttp.ClientAuth) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+				ci := NewClientIdentity(cfg, r.TLS.VerifiedChains[0][0])
+				r = r.WithContext(context.WithValue(r.Context(), ClientCertCtxKey, ci))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NewClientIdentity mapping the certificate to a client identity
+func NewClientIdentity(cfg shttp.ClientAuth, cert *x509.Certificate) *ClientIdentity {
+	ci := ClientIdentity{
+		ID:          cert.Subject.CommonName,
+		Certificate: cert,
+	}
+	if strings.EqualFold(cfg.Identity, "san") {
+		switch {
+		case len(cert.URIs) > 0:
+			ci.ID = cert.URIs[0].String()
+		case len(cert.DNSNames) > 0:
+			ci.ID = cert.DNSNames[0]
+		case len(cert.EmailAddresses) > 0:
+			ci.ID = cert.EmailAddresses[0]
+		}
+	}
+	switch strings.ToLower(cfg.Tenant) {
+	case "ou":
+		if len(cert.Subject.OrganizationalUnit) > 0 {
+			ci.Tenant = strings.ToLower(cert.Subject.OrganizationalUnit[0])
+		}
+	case "o":
+		if len(cert.Subject.Organization) > 0 {
+			ci.Tenant = strings.ToLower(cert.Subject.Organization[0])
+		}
+	}
+	return &ci
+}
+
+// ClientIdentityFromContext getting the client identity of a verified client certificate
+func ClientIdentityFromContext(ctx context.Context) (*ClientIdentity, bool) {
+	ci, ok := ctx.Value(ClientCertCtxKey).(*ClientIdentity)
+	return ci, ok && ci != nil
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/services/shttp"
+)
+
+func TestClientCertIdentity(t *testing.T) {
+	ast := assert.New(t)
+	spiffe, _ := url.Parse("spiffe://example.com/importer")
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "importer",
+			Organization:       []string{"Example"},
+			OrganizationalUnit: []string{"Tenant1"},
+		},
+		URIs:     []*url.URL{spiffe},
+		DNSNames: []string{"importer.example.com"},
+	}
+
+	ci := NewClientIdentity(shttp.ClientAuth{}, cert)
+	ast.Equal("importer", ci.ID)
+	ast.Empty(ci.Tenant)
+
+	ci = NewClientIdentity(shttp.ClientAuth{Identity: "san", Tenant: "ou"}, cert)
+	ast.Equal("spiffe://example.com/importer", ci.ID)
+	ast.Equal("tenant1", ci.Tenant)
+
+	ci = NewClientIdentity(shttp.ClientAuth{Identity: "subject", Tenant: "o"}, cert)
+	ast.Equal("importer", ci.ID)
+	ast.Equal("example", ci.Tenant)
+
+	var found *ClientIdentity
+	hnd := ClientCertIdentity(shttp.ClientAuth{Tenant: "ou"})(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		found, _ = ClientIdentityFromContext(r.Context())
+	}))
+
+	// only verified certificates are used
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	hnd.ServeHTTP(httptest.NewRecorder(), req)
+	ast.Nil(found)
+
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	hnd.ServeHTTP(httptest.NewRecorder(), req)
+	ast.NotNil(found)
+	ast.Equal("importer", found.ID)
+	ast.Equal("tenant1", found.Tenant)
+}
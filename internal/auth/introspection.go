@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/willie68/go-micro/internal/config"
+	"github.com/willie68/go-micro/internal/utils/ttlcache"
+)
+
+// defaults of the introspection
+const (
+	defaultIntrospectionCacheTTL = 60 * time.Second
+	defaultIntrospectionTimeout  = 10 * time.Second
+)
+
+// errors of the introspection
+var (
+	ErrTokenInactive       = errors.New("token is not active")
+	ErrIntrospectionFailed = errors.New("token introspection failed")
+)
+
+// IntrospectionConfig configuration of the token introspection (RFC 7662) for opaque tokens
+type IntrospectionConfig struct {
+	// URL the introspection endpoint
+	URL string
+	// ClientID and ClientSecret the client credentials for the introspection endpoint
+	ClientID     string
+	ClientSecret string
+	// CacheTTL maximal duration an introspection result is cached, active results never longer than the token lives
+	CacheTTL time.Duration
+	// Timeout of the introspection request
+	Timeout time.Duration
+	// Claims the claim validation, tenant, role and ignore page settings, the same as for jwt
+	Claims JWTAuthConfig
+}
+
+// introspectionResult a cached introspection result
+type introspectionResult struct {
+	active bool
+	claims map[string]any
+}
+
+// IntrospectionAuth the introspection authentication
+type IntrospectionAuth struct {
+	Config IntrospectionConfig
+	client http.Client
+	cache  *ttlcache.Cache[string, introspectionResult]
+}
+
+// ParseIntrospectionConfig building up the introspection configuration from the auth properties
+func ParseIntrospectionConfig(cfg config.Authentication) (IntrospectionConfig, error) {
+	icfg := IntrospectionConfig{
+		Claims: JWTAuthConfig{
+			Active:      true,
+			IgnorePages: make([]string, 0),
+		},
+	}
+	if err := icfg.parse(cfg.Properties); err != nil {
+		return icfg, fmt.Errorf("invalid auth properties: %w", err)
+	}
+	return icfg, nil
+}
+
+func (c *IntrospectionConfig) parse(props map[string]any) error {
+	var err error
+	if c.URL, err = config.GetConfigValueAsString(props, "url"); err != nil {
+		return err
+	}
+	if _, err := url.ParseRequestURI(c.URL); err != nil {
+		return fmt.Errorf("introspection url invalid: %w", err)
+	}
+	if c.ClientID, err = optionalString(props, "clientid"); err != nil {
+		return err
+	}
+	if c.ClientSecret, err = optionalString(props, "clientsecret"); err != nil {
+		return err
+	}
+	if c.CacheTTL, err = optionalSeconds(props, "cachettl"); err != nil {
+		return err
+	}
+	if c.CacheTTL == 0 {
+		c.CacheTTL = defaultIntrospectionCacheTTL
+	}
+	if c.Timeout, err = optionalSeconds(props, "timeout"); err != nil {
+		return err
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultIntrospectionTimeout
+	}
+	// the claim settings are the same as for jwt, the signature can't be validated on opaque tokens
+	claimProps := make(map[string]any, len(props)+1)
+	for k, v := range props {
+		claimProps[k] = v
+	}
+	claimProps["validate"] = false
+	return c.Claims.parse(claimProps)
+}
+
+// InitIntrospection initialize the introspection authentication
+func InitIntrospection(cfg IntrospectionConfig) *IntrospectionAuth {
+	return &IntrospectionAuth{
+		Config: cfg,
+		client: http.Client{
+			Timeout: cfg.Timeout,
+		},
+		cache: ttlcache.New(ttlcache.WithTTL[string, introspectionResult](0), ttlcache.WithAutoDeletion[string, introspectionResult](time.Minute)),
+	}
+}
+
+// Verifier returns a handler for verification of the token via introspection. The claims of the introspection
+// response are stored like the claims of a jwt, so all handlers can use FromContext.
+func (ia *IntrospectionAuth) Verifier() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			noCheck := false
+			for _, p := range ia.Config.Claims.IgnorePages {
+				if strings.HasPrefix(r.URL.Path, p) {
+					noCheck = true
+				}
+			}
+			var token *JWT
+			tk := TokenFromHeader(r)
+			if tk == "" {
+				tk = TokenFromCookie(r)
+			}
+			err := ErrNoTokenFound
+			if tk != "" {
+				token, err = ia.Introspect(r.Context(), tk)
+			}
+			ctx := NewContext(r.Context(), token, err, noCheck)
+			ctx = context.WithValue(ctx, RolesCtxKey, ia)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Introspect checking the token at the introspection endpoint, results are cached
+func (ia *IntrospectionAuth) Introspect(ctx context.Context, token string) (*JWT, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	res, ok := ia.cache.Get(key)
+	if !ok {
+		r, err := ia.request(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		res = &r
+		ia.cacheResult(key, r, time.Now())
+	}
+	if !res.active {
+		return nil, ErrTokenInactive
+	}
+	jt := JWT{
+		Token:   token,
+		Header:  map[string]any{"typ": "opaque"},
+		Payload: res.claims,
+		IsValid: true,
+	}
+	if err := jt.validateClaims(ia.Config.Claims, time.Now()); err != nil {
+		jt.IsValid = false
+		return &jt, err
+	}
+	return &jt, nil
+}
+
+// cacheResult caching the result, an active token at most until it expires
+func (ia *IntrospectionAuth) cacheResult(key string, r introspectionResult, now time.Time) {
+	ttl := ia.Config.CacheTTL
+	if r.active {
+		jt := JWT{Payload: r.claims}
+		if exp, ok := jt.numericDate("exp"); ok && exp.Sub(now) < ttl {
+			ttl = exp.Sub(now)
+		}
+	}
+	if ttl > 0 {
+		ia.cache.AddWithTTL(key, r, ttl)
+	}
+}
+
+func (ia *IntrospectionAuth) request(ctx context.Context, token string) (introspectionResult, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ia.Config.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return introspectionResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if ia.Config.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(ia.Config.ClientID), url.QueryEscape(ia.Config.ClientSecret))
+	}
+	res, err := ia.client.Do(req)
+	if err != nil {
+		logger.Error(fmt.Sprintf("introspection request failed: %v", err))
+		return introspectionResult{}, fmt.Errorf("%w: %v", ErrIntrospectionFailed, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		logger.Error(fmt.Sprintf("introspection request failed, status: %d", res.StatusCode))
+		return introspectionResult{}, fmt.Errorf("%w: status %d", ErrIntrospectionFailed, res.StatusCode)
+	}
+	claims := make(map[string]any)
+	if err := json.NewDecoder(res.Body).Decode(&claims); err != nil {
+		return introspectionResult{}, fmt.Errorf("%w: %v", ErrIntrospectionFailed, err)
+	}
+	active, _ := claims["active"].(bool)
+	delete(claims, "active")
+	return introspectionResult{
+		active: active,
+		claims: claims,
+	}, nil
+}
+
+// ResolveRoles getting all logical roles of the claims for the tenant
+func (ia *IntrospectionAuth) ResolveRoles(claims map[string]any, tenant string) []string {
+	return ia.Config.Claims.Roles.ResolveRoles(claims, tenant)
+}
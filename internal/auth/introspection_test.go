@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/config"
+)
+
+// testIdP a minimal identity provider with an introspection endpoint
+func testIdP(t *testing.T, calls *atomic.Int32) *httptest.Server {
+	tokens := map[string]map[string]any{
+		"active-token": {
+			"active":       true,
+			"iss":          "https://idp.example.com",
+			"sub":          "user1",
+			"Tenant":       "tenant1",
+			"exp":          float64(time.Now().Add(time.Hour).Unix()),
+			"realm_access": map[string]any{"roles": []any{"object-reader"}},
+		},
+		"short-token": {
+			"active": true,
+			"iss":    "https://idp.example.com",
+			"sub":    "user2",
+			"exp":    float64(time.Now().Unix() + 1),
+		},
+		"foreign-token": {
+			"active": true,
+			"sub":    "user3",
+			"iss":    "https://other.example.com",
+		},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.PostFormValue("token_type_hint") != "access_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		res, ok := tokens[r.PostFormValue("token")]
+		if !ok {
+			res = map[string]any{"active": false}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			t.Errorf("encoding response: %v", err)
+		}
+	}))
+}
+
+func testIntrospectionConfig(url string) IntrospectionConfig {
+	cfg, _ := ParseIntrospectionConfig(config.Authentication{
+		Type: "introspection",
+		Properties: map[string]any{
+			"url":          url,
+			"clientid":     "client",
+			"clientsecret": "secret",
+			"tenantClaim":  "Tenant",
+			"roleClaim":    "realm_access.roles",
+			"issuers":      []any{"https://idp.example.com"},
+		},
+	})
+	return cfg
+}
+
+func TestParseIntrospectionConfig(t *testing.T) {
+	ast := assert.New(t)
+	cfg := testIntrospectionConfig("https://idp.example.com/introspect")
+	ast.Equal("https://idp.example.com/introspect", cfg.URL)
+	ast.Equal("client", cfg.ClientID)
+	ast.Equal(defaultIntrospectionCacheTTL, cfg.CacheTTL)
+	ast.Equal(defaultIntrospectionTimeout, cfg.Timeout)
+	ast.False(cfg.Claims.Validate)
+	ast.Equal("Tenant", cfg.Claims.TenantClaim)
+
+	_, err := ParseIntrospectionConfig(config.Authentication{Type: "introspection", Properties: map[string]any{}})
+	ast.NotNil(err)
+	_, err = ParseIntrospectionConfig(config.Authentication{Type: "introspection", Properties: map[string]any{"url": "muck"}})
+	ast.NotNil(err)
+}
+
+func TestIntrospect(t *testing.T) {
+	ast := assert.New(t)
+	var calls atomic.Int32
+	idp := testIdP(t, &calls)
+	defer idp.Close()
+
+	ia := InitIntrospection(testIntrospectionConfig(idp.URL))
+	defer ia.cache.Close()
+	ctx := context.Background()
+
+	jt, err := ia.Introspect(ctx, "active-token")
+	ast.Nil(err)
+	ast.True(jt.IsValid)
+	ast.Equal("user1", jt.Payload["sub"])
+	ast.NotContains(jt.Payload, "active")
+	ast.Contains(ia.ResolveRoles(jt.Payload, "tenant1"), RoleObjectReader)
+	ast.Equal(int32(1), calls.Load())
+
+	// the second call is answered by the cache
+	_, err = ia.Introspect(ctx, "active-token")
+	ast.Nil(err)
+	ast.Equal(int32(1), calls.Load())
+
+	// inactive tokens are cached, too
+	_, err = ia.Introspect(ctx, "unknown-token")
+	ast.ErrorIs(err, ErrTokenInactive)
+	ast.Equal("token-inactive", UnauthorizedError(err).Key)
+	_, err = ia.Introspect(ctx, "unknown-token")
+	ast.ErrorIs(err, ErrTokenInactive)
+	ast.Equal(int32(2), calls.Load())
+
+	// the claims are validated like the claims of a jwt
+	jt, err = ia.Introspect(ctx, "foreign-token")
+	ast.ErrorIs(err, ErrIssuerInvalid)
+	ast.False(jt.IsValid)
+
+	// a token is never cached longer than its exp
+	_, err = ia.Introspect(ctx, "short-token")
+	ast.Nil(err)
+	calls.Store(0)
+	time.Sleep(time.Until(time.Unix(time.Now().Unix()+2, 0)))
+	_, err = ia.Introspect(ctx, "short-token")
+	ast.ErrorIs(err, ErrExpired)
+	ast.Equal(int32(1), calls.Load())
+}
+
+func TestIntrospectEndpointError(t *testing.T) {
+	ast := assert.New(t)
+	var calls atomic.Int32
+	idp := testIdP(t, &calls)
+	defer idp.Close()
+
+	cfg := testIntrospectionConfig(idp.URL)
+	cfg.ClientSecret = "wrong"
+	ia := InitIntrospection(cfg)
+	defer ia.cache.Close()
+
+	_, err := ia.Introspect(context.Background(), "active-token")
+	ast.ErrorIs(err, ErrIntrospectionFailed)
+	ast.Equal("token-introspection-failed", UnauthorizedError(err).Key)
+	// errors are not cached
+	_, err = ia.Introspect(context.Background(), "active-token")
+	ast.ErrorIs(err, ErrIntrospectionFailed)
+	ast.Equal(int32(2), calls.Load())
+}
+
+func TestIntrospectionVerifier(t *testing.T) {
+	ast := assert.New(t)
+	var calls atomic.Int32
+	idp := testIdP(t, &calls)
+	defer idp.Close()
+
+	ia := InitIntrospection(testIntrospectionConfig(idp.URL))
+	defer ia.cache.Close()
+	var claims map[string]any
+	h := ia.Verifier()(Authenticator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, claims, _ = FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/addresses", nil)
+	req.Header.Set("Authorization", "Bearer active-token")
+	h.ServeHTTP(rec, req)
+	ast.Equal(http.StatusOK, rec.Code)
+	ast.Equal("tenant1", claims["Tenant"])
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/addresses", nil)
+	req.Header.Set("Authorization", "Bearer unknown-token")
+	h.ServeHTTP(rec, req)
+	ast.Equal(http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/addresses", nil)
+	h.ServeHTTP(rec, req)
+	ast.Equal(http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK a single json web key, as defined in RFC 7517. Only the public parts are used.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS a json web key set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKey a public key for verifying token signatures
+type PublicKey struct {
+	Kid string
+	// Alg is the algorithm the key is restricted to, empty if all fitting algorithms are allowed
+	Alg string
+	Key crypto.PublicKey
+}
+
+// ParseJWKS parsing a json web key set, keys not used for signatures will be skipped
+func ParseJWKS(data []byte) ([]PublicKey, error) {
+	var jwks JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("can't parse jwks: %v", err)
+	}
+	keys := make([]PublicKey, 0, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		pk, err := jwk.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("can't parse jwk %q: %v", jwk.Kid, err)
+		}
+		keys = append(keys, PublicKey{
+			Kid: jwk.Kid,
+			Alg: jwk.Alg,
+			Key: pk,
+		})
+	}
+	return keys, nil
+}
+
+// PublicKey converting the jwk into a crypto public key
+func (j *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent out of range")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		return j.ecPublicKey()
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported okp curve %s", j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("wrong ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", j.Kty)
+}
+
+func (j *JWK) ecPublicKey() (crypto.PublicKey, error) {
+	var crv elliptic.Curve
+	var ecrv ecdh.Curve
+	switch j.Crv {
+	case "P-256":
+		crv, ecrv = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		crv, ecrv = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		crv, ecrv = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("unsupported ec curve %s", j.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(j.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(j.Y)
+	if err != nil {
+		return nil, err
+	}
+	size := (crv.Params().BitSize + 7) / 8
+	if len(x) != size || len(y) != size {
+		return nil, errors.New("wrong ec coordinate size")
+	}
+	// the ecdh package checks, if the point is on the curve
+	point := append([]byte{4}, x...)
+	point = append(point, y...)
+	if _, err := ecrv.NewPublicKey(point); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{
+		Curve: crv,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// ParsePEMKey parsing a pem encoded public key or certificate
+func ParsePEMKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no pem block found")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		crt, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return crt.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unsupported pem type %s", block.Type)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
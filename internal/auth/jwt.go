@@ -6,17 +6,51 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/willie68/go-micro/internal/config"
+	"github.com/willie68/go-micro/internal/logging"
 )
 
+var logger = logging.New("auth")
+
 // JWTAuthConfig authentication/Authorisation configuration for JWT authentification
 type JWTAuthConfig struct {
 	Active      bool
 	Validate    bool
 	TenantClaim string
-	Strict      bool
-	IgnorePages []string
+	// TenantsClaim claim pathes with all tenants the token is a member of
+	TenantsClaim []string
+	Strict       bool
+	IgnorePages  []string
+	// JWKSFile path to a local jwks file
+	JWKSFile string
+	// KeysDir directory with pem encoded public keys, the file name is used as kid
+	KeysDir string
+	// JWKSURL url of a remote jwks
+	JWKSURL string
+	// LocalIssuer trust the keys of the built-in development issuer
+	LocalIssuer bool
+	// LocalKeys static keys, e.g. of the built-in development issuer, not part of the properties
+	LocalKeys []PublicKey
+	// KeyRefresh minimal duration between two refreshes of the key set
+	KeyRefresh time.Duration
+	// Issuers allowed issuers of the token, empty for all
+	Issuers []string
+	// Audiences one of these must be present in the aud claim, empty for all
+	Audiences []string
+	// MaxAge maximal age of the token, measured from the iat claim, 0 for unlimited
+	MaxAge time.Duration
+	// ClockSkew tolerance for the time based claims
+	ClockSkew time.Duration
+	// Roles mapping of the token roles to the logical roles
+	Roles RoleMapping
+	// Revocation activates the token revocation
+	Revocation bool
+	// RevocationFile file for the revocations, if no other revocation storage is present
+	RevocationFile string
+	// RevocationTTL how long revocations without expiry are kept, default MaxAge or 24h
+	RevocationTTL time.Duration
 }
 
 // JWT struct for the decoded jwt token
@@ -30,7 +64,9 @@ type JWT struct {
 
 // JWTAuth the jwt authentication struct
 type JWTAuth struct {
-	Config JWTAuthConfig
+	Config      JWTAuthConfig
+	Keys        *KeySet
+	Revocations *RevocationList
 }
 
 // JWTConfig for the service
@@ -38,26 +74,170 @@ var JWTConfig = JWTAuthConfig{
 	Active: false,
 }
 
-// InitJWT initialize the JWT for this service
-func InitJWT(cnfg JWTAuthConfig) JWTAuth {
+// InitJWT initialize the JWT for this service, if validation is active the key set will be loaded
+func InitJWT(cnfg JWTAuthConfig) (*JWTAuth, error) {
 	JWTConfig = cnfg
-	return JWTAuth{
+	ja := JWTAuth{
 		Config: cnfg,
 	}
+	if cnfg.Validate {
+		ks, err := NewKeySet(cnfg)
+		if err != nil {
+			return nil, err
+		}
+		ja.Keys = ks
+	}
+	return &ja, nil
 }
 
 // ParseJWTConfig building up the dynamical configuration for this
 func ParseJWTConfig(cfg config.Authentication) (JWTAuthConfig, error) {
 	jwtcfg := JWTAuthConfig{
-		Active: true,
+		Active:      true,
 		IgnorePages: make([]string, 0),
 	}
+	if err := jwtcfg.parse(cfg.Properties); err != nil {
+		return jwtcfg, fmt.Errorf("invalid auth properties: %w", err)
+	}
+	return jwtcfg, nil
+}
+
+func (c *JWTAuthConfig) parse(props map[string]any) error {
 	var err error
-	jwtcfg.Validate, err = config.GetConfigValueAsBool(cfg.Properties, "validate")
+	if c.Validate, err = config.GetConfigValueAsBool(props, "validate"); err != nil {
+		return err
+	}
+	if c.Strict, err = optionalBool(props, "strict"); err != nil {
+		return err
+	}
+	if c.TenantClaim, err = optionalString(props, "tenantClaim"); err != nil {
+		return err
+	}
+	if c.TenantsClaim, err = optionalStrings(props, "tenantsClaim"); err != nil {
+		return err
+	}
+	if c.IgnorePages, err = optionalStrings(props, "ignorePages"); err != nil {
+		return err
+	}
+	if c.JWKSFile, err = optionalString(props, "jwks"); err != nil {
+		return err
+	}
+	if c.KeysDir, err = optionalString(props, "keysdir"); err != nil {
+		return err
+	}
+	if c.JWKSURL, err = optionalString(props, "jwksurl"); err != nil {
+		return err
+	}
+	if c.LocalIssuer, err = optionalBool(props, "localissuer"); err != nil {
+		return err
+	}
+	if c.KeyRefresh, err = optionalSeconds(props, "keyrefresh"); err != nil {
+		return err
+	}
+	if c.Issuers, err = optionalStrings(props, "issuers"); err != nil {
+		return err
+	}
+	if c.Audiences, err = optionalStrings(props, "audiences"); err != nil {
+		return err
+	}
+	if c.MaxAge, err = optionalSeconds(props, "maxage"); err != nil {
+		return err
+	}
+	if c.ClockSkew, err = optionalSeconds(props, "clockskew"); err != nil {
+		return err
+	}
+	if c.Roles.Claims, err = optionalStrings(props, "roleClaim"); err != nil {
+		return err
+	}
+	if c.Roles.Mapping, err = ParseRoleMapping(props["rolemapping"]); err != nil {
+		return err
+	}
+	if c.Revocation, err = optionalBool(props, "revocation"); err != nil {
+		return err
+	}
+	if c.RevocationFile, err = optionalString(props, "revocationfile"); err != nil {
+		return err
+	}
+	if c.RevocationTTL, err = optionalSeconds(props, "revocationttl"); err != nil {
+		return err
+	}
+	if c.RevocationTTL == 0 {
+		c.RevocationTTL = c.MaxAge
+	}
+	if _, ok := props["tenantAdminPrefix"]; ok {
+		if c.Roles.TenantAdminPrefix, err = config.GetConfigValueAsString(props, "tenantAdminPrefix"); err != nil {
+			return err
+		}
+	} else if len(c.TenantsClaim) > 0 {
+		c.Roles.TenantAdminPrefix = DefaultTenantAdminPrefix
+	}
+	return c.check()
+}
+
+// check checking the configuration for consistency
+func (c *JWTAuthConfig) check() error {
+	if c.Validate && c.JWKSFile == "" && c.KeysDir == "" && c.JWKSURL == "" && !c.LocalIssuer {
+		return errors.New("validate needs one of the key sources jwks, keysdir, jwksurl or localissuer")
+	}
+	if c.Strict && c.TenantClaim == "" && len(c.TenantsClaim) == 0 {
+		return errors.New("strict needs the tenantClaim or tenantsClaim")
+	}
+	for _, p := range c.IgnorePages {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("ignorePages entry %q must start with /", p)
+		}
+	}
+	return nil
+}
+
+// checkClaims checking if the registered claims are validated, always with the signature validation, otherwise if one
+// of the claim settings is configured
+func (c *JWTAuthConfig) checkClaims() bool {
+	return c.Validate || len(c.Issuers) > 0 || len(c.Audiences) > 0 || c.MaxAge > 0 || c.ClockSkew > 0
+}
+
+// optionalBool getting a bool property, a missing property will return false
+func optionalBool(properties map[string]any, key string) (bool, error) {
+	if _, ok := properties[key]; !ok {
+		return false, nil
+	}
+	return config.GetConfigValueAsBool(properties, key)
+}
+
+// optionalString getting a string property, a missing property will return an empty string
+func optionalString(properties map[string]any, key string) (string, error) {
+	if _, ok := properties[key]; !ok {
+		return "", nil
+	}
+	return config.GetConfigValueAsString(properties, key)
+}
+
+// optionalStrings getting a string list property, a missing property will return an empty list
+func optionalStrings(properties map[string]any, key string) ([]string, error) {
+	if _, ok := properties[key]; !ok {
+		return []string{}, nil
+	}
+	return config.GetConfigValueAsStringSlice(properties, key)
+}
+
+// optionalSeconds getting a duration property given in seconds, a missing property will return 0
+func optionalSeconds(properties map[string]any, key string) (time.Duration, error) {
+	if _, ok := properties[key]; !ok {
+		return 0, nil
+	}
+	secs, err := config.GetConfigValueAsInt(properties, key)
 	if err != nil {
-		return jwtcfg, err
+		return 0, err
 	}
-	return jwtcfg, nil
+	if secs < 0 {
+		return 0, fmt.Errorf("config value for %s must not be negative", key)
+	}
+	return time.Duration(secs) * time.Second, nil
+}
+
+// ResolveRoles getting all logical roles of the claims for the tenant
+func (ja *JWTAuth) ResolveRoles(claims map[string]any, tenant string) []string {
+	return ja.Config.Roles.ResolveRoles(claims, tenant)
 }
 
 // DecodeJWT simple decode the jwt token string
@@ -116,8 +296,63 @@ func jwtDecodePart(payload string) (map[string]any, error) {
 	return result, nil
 }
 
-// Validate validation of the token is not implemented
-func (j *JWT) Validate(_ *JWTAuth) error {
-	//TODO here should be the implementation of the validation of the token
-	return nil
+// Validate validation of the token signature against the key set of the authentication, if validate is set, and of the
+// registered claims, if validate or one of the claim settings is set. Revoked tokens are always invalid.
+func (j *JWT) Validate(ja *JWTAuth) error {
+	var err error
+	if ja.Config.Validate {
+		err = j.verifySignature(ja.Keys)
+	}
+	if err == nil && ja.Config.checkClaims() {
+		err = j.validateClaims(ja.Config, time.Now())
+	}
+	if err == nil && ja.Revocations != nil && ja.Revocations.IsRevoked(j) {
+		err = ErrRevoked
+	}
+	if err != nil {
+		j.IsValid = false
+	}
+	return err
+}
+
+func (j *JWT) verifySignature(ks *KeySet) error {
+	alg, _ := j.Header["alg"].(string)
+	if !IsSupportedAlgorithm(alg) {
+		return ErrAlgoInvalid
+	}
+	if ks == nil {
+		return errors.New("no key set for validation")
+	}
+	token := j.Token
+	if len(token) > 7 && strings.ToUpper(token[0:6]) == "BEARER" {
+		token = token[7:]
+	}
+	idx := strings.LastIndex(token, ".")
+	if idx < 0 || j.Signature == "" {
+		return ErrSignatureInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(j.Signature)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	kid, _ := j.Header["kid"].(string)
+	keys, err := ks.Lookup(kid)
+	if err != nil {
+		return err
+	}
+	err = ErrAlgoInvalid
+	for _, k := range keys {
+		if k.Alg != "" && k.Alg != alg {
+			continue
+		}
+		verr := verifySignature(alg, k.Key, []byte(token[:idx]), sig)
+		if verr == nil {
+			return nil
+		}
+		// a key with the wrong type should not hide a failed signature check
+		if !errors.Is(verr, ErrAlgoInvalid) {
+			err = verr
+		}
+	}
+	return err
 }
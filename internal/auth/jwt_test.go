@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/config"
 )
 
 // const testTokenSignature = "SflKxwRJSMeKKF2QT4fwpMeJf36POk6yJV_adQssw5c"
@@ -47,3 +48,47 @@ func TestRegex(t *testing.T) {
 	resourceName = m.ReplaceAllString(resourceName, "_")
 	fmt.Println(resourceName)
 }
+
+func TestParseJWTConfig(t *testing.T) {
+	ast := assert.New(t)
+	props := map[string]any{
+		"validate":    false,
+		"strict":      true,
+		"tenantClaim": "Tenant",
+		"ignorePages": []any{"/livez", "/api/v1/public"},
+	}
+	cfg, err := ParseJWTConfig(config.Authentication{Type: "jwt", Properties: props})
+	ast.Nil(err)
+	ast.True(cfg.Active)
+	ast.True(cfg.Strict)
+	ast.Equal("Tenant", cfg.TenantClaim)
+	ast.Equal([]string{"/livez", "/api/v1/public"}, cfg.IgnorePages)
+
+	props["tenantClaim"] = ""
+	_, err = ParseJWTConfig(config.Authentication{Type: "jwt", Properties: props})
+	ast.ErrorContains(err, "tenantClaim")
+
+	props["tenantClaim"] = "Tenant"
+	props["ignorePages"] = []any{"livez"}
+	_, err = ParseJWTConfig(config.Authentication{Type: "jwt", Properties: props})
+	ast.ErrorContains(err, "ignorePages")
+
+	props["ignorePages"] = nil
+	props["strict"] = "yes"
+	_, err = ParseJWTConfig(config.Authentication{Type: "jwt", Properties: props})
+	ast.ErrorContains(err, "strict")
+
+	props["strict"] = true
+	props["validate"] = true
+	_, err = ParseJWTConfig(config.Authentication{Type: "jwt", Properties: props})
+	ast.ErrorContains(err, "key sources")
+
+	props["localissuer"] = true
+	cfg, err = ParseJWTConfig(config.Authentication{Type: "jwt", Properties: props})
+	ast.Nil(err)
+	ast.True(cfg.LocalIssuer)
+
+	delete(props, "validate")
+	_, err = ParseJWTConfig(config.Authentication{Type: "jwt", Properties: props})
+	ast.ErrorContains(err, "validate")
+}
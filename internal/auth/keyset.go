@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultKeyRefresh minimal duration between two refreshes of the key set
+const defaultKeyRefresh = 30 * time.Second
+
+// ErrUnknownKey no key found for the key id of the token
+var ErrUnknownKey = errors.New("no key found for token")
+
+// KeySet caching all public keys for verifying the token signatures. Keys can be loaded from a jwks file,
+// a directory with pem files (the file name is used as kid) or an jwks url. Local keys are always part of the set.
+type KeySet struct {
+	localKeys   []PublicKey
+	jwksFile    string
+	keysDir     string
+	jwksURL     string
+	minRefresh  time.Duration
+	client      http.Client
+	lock        sync.RWMutex
+	keys        []PublicKey
+	lastRefresh time.Time
+	lastErr     error
+}
+
+// NewKeySet creates a new key set from the configured sources and loads the keys.
+// A failing jwks url will not lead to an error, as the set will be refreshed on demand.
+func NewKeySet(cfg JWTAuthConfig) (*KeySet, error) {
+	if cfg.JWKSFile == "" && cfg.KeysDir == "" && cfg.JWKSURL == "" && len(cfg.LocalKeys) == 0 {
+		return nil, errors.New("no key source (jwks, keysdir, jwksurl or local keys) configured")
+	}
+	ks := KeySet{
+		localKeys:  cfg.LocalKeys,
+		jwksFile:   cfg.JWKSFile,
+		keysDir:    cfg.KeysDir,
+		jwksURL:    cfg.JWKSURL,
+		minRefresh: cfg.KeyRefresh,
+		client: http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+	if ks.minRefresh <= 0 {
+		ks.minRefresh = defaultKeyRefresh
+	}
+	err := ks.Refresh()
+	if err != nil && ks.jwksURL == "" {
+		return nil, err
+	}
+	return &ks, nil
+}
+
+// Lookup getting all keys for the kid, if the kid is empty, all keys will be returned.
+// If no key is found, the key set will be refreshed.
+func (k *KeySet) Lookup(kid string) ([]PublicKey, error) {
+	keys := k.find(kid)
+	if len(keys) > 0 {
+		return keys, nil
+	}
+	k.lock.RLock()
+	refresh := time.Since(k.lastRefresh) >= k.minRefresh
+	k.lock.RUnlock()
+	if refresh {
+		if err := k.Refresh(); err != nil {
+			return nil, err
+		}
+		keys = k.find(kid)
+	}
+	if len(keys) == 0 {
+		return nil, ErrUnknownKey
+	}
+	return keys, nil
+}
+
+func (k *KeySet) find(kid string) []PublicKey {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	keys := make([]PublicKey, 0)
+	for _, pk := range k.keys {
+		if kid == "" || pk.Kid == kid {
+			keys = append(keys, pk)
+		}
+	}
+	return keys
+}
+
+// Refresh reloads all keys from the configured sources
+func (k *KeySet) Refresh() error {
+	keys, err := k.load()
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.lastRefresh = time.Now()
+	k.lastErr = err
+	if err != nil {
+		logger.Error(fmt.Sprintf("can't refresh key set: %v", err))
+		return err
+	}
+	k.keys = keys
+	return nil
+}
+
+func (k *KeySet) load() ([]PublicKey, error) {
+	keys := append(make([]PublicKey, 0), k.localKeys...)
+	if k.jwksFile != "" {
+		data, err := os.ReadFile(k.jwksFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read jwks file: %v", err)
+		}
+		pks, err := ParseJWKS(data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, pks...)
+	}
+	if k.keysDir != "" {
+		pks, err := loadPEMDir(k.keysDir)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, pks...)
+	}
+	if k.jwksURL != "" {
+		pks, err := k.loadURL()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, pks...)
+	}
+	return keys, nil
+}
+
+func (k *KeySet) loadURL() ([]PublicKey, error) {
+	res, err := k.client.Get(k.jwksURL)
+	if err != nil {
+		return nil, fmt.Errorf("can't get jwks from url: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("can't get jwks from url, status: %d", res.StatusCode)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// loadPEMDir loads all pem files of the directory, the file name without extension will be the kid
+func loadPEMDir(dir string) ([]PublicKey, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read keys dir: %v", err)
+	}
+	keys := make([]PublicKey, 0)
+	for _, e := range entries {
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(e.Name()), ".pem") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		pk, err := ParsePEMKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse key file %s: %v", e.Name(), err)
+		}
+		keys = append(keys, PublicKey{
+			Kid: strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())),
+			Key: pk,
+		})
+	}
+	return keys, nil
+}
+
+// CheckName should return the name of this healthcheck. The name should be unique.
+func (k *KeySet) CheckName() string {
+	return "jwks"
+}
+
+// Check proceed a check and return state, true for healthy or false and an optional error, if the healthcheck fails
+func (k *KeySet) Check() (bool, error) {
+	k.lock.RLock()
+	err := k.lastErr
+	k.lock.RUnlock()
+	if err != nil {
+		// try to recover from the last failed refresh
+		err = k.Refresh()
+	}
+	return err == nil, err
+}
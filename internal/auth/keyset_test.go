@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/services/issuer"
+)
+
+// signTestToken creates a signed token for testing
+func signTestToken(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	hd := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		hd["kid"] = kid
+	}
+	hb, _ := json.Marshal(hd)
+	pb, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(pb)
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(input))
+	case *rsa.PrivateKey:
+		h := algHash(alg).New()
+		h.Write([]byte(input))
+		if alg[:2] == "PS" {
+			sig, err = rsa.SignPSS(rand.Reader, k, algHash(alg), h.Sum(nil), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, k, algHash(alg), h.Sum(nil))
+		}
+	case *ecdsa.PrivateKey:
+		h := algHash(alg).New()
+		h.Write([]byte(input))
+		r, s, serr := ecdsa.Sign(rand.Reader, k, h.Sum(nil))
+		err = serr
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+	}
+	if err != nil {
+		t.Fatalf("can't sign token: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func writePEM(t *testing.T, dir, name string, pub crypto.PublicKey) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func rsaJWK(kid string, k *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString([]byte{1, 0, 1}),
+	}
+}
+
+func ecJWK(kid string, k *ecdsa.PrivateKey) JWK {
+	size := (k.Curve.Params().BitSize + 7) / 8
+	x := make([]byte, size)
+	y := make([]byte, size)
+	k.X.FillBytes(x)
+	k.Y.FillBytes(y)
+	return JWK{
+		Kty: "EC",
+		Kid: kid,
+		Crv: k.Curve.Params().Name,
+		X:   base64.RawURLEncoding.EncodeToString(x),
+		Y:   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+func testJWTAuth(t *testing.T, cfg JWTAuthConfig) *JWTAuth {
+	cfg.Validate = true
+	ja, err := InitJWT(cfg)
+	if err != nil {
+		t.Fatalf("can't init jwt: %v", err)
+	}
+	return ja
+}
+
+func TestVerifyJWKSFile(t *testing.T) {
+	ast := assert.New(t)
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ek, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ek384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	ek521, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	epub, epriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	jwks := JWKS{Keys: []JWK{
+		rsaJWK("rsa", &rk.PublicKey),
+		ecJWK("ec256", ek),
+		ecJWK("ec384", ek384),
+		ecJWK("ec521", ek521),
+		{Kty: "OKP", Kid: "ed", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(epub)},
+	}}
+	data, _ := json.Marshal(jwks)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	ast.Nil(os.WriteFile(file, data, 0o600))
+
+	ja := testJWTAuth(t, JWTAuthConfig{JWKSFile: file})
+	claims := map[string]any{"sub": "tester"}
+
+	tests := []struct {
+		alg string
+		kid string
+		key crypto.Signer
+	}{
+		{"RS256", "rsa", rk},
+		{"RS384", "rsa", rk},
+		{"RS512", "rsa", rk},
+		{"PS256", "rsa", rk},
+		{"ES256", "ec256", ek},
+		{"ES384", "ec384", ek384},
+		{"ES512", "ec521", ek521},
+		{"EdDSA", "ed", epriv},
+	}
+	for _, tc := range tests {
+		tk := signTestToken(t, tc.alg, tc.kid, tc.key, claims)
+		jt, err := VerifyToken(ja, "Bearer "+tk)
+		ast.Nil(err, tc.alg)
+		ast.True(jt.IsValid, tc.alg)
+
+		// manipulated payload
+		_, err = VerifyToken(ja, tk[:len(tk)-4]+"AAAA")
+		ast.ErrorIs(err, ErrSignatureInvalid, tc.alg)
+	}
+
+	// wrong key for a kid
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, err := VerifyToken(ja, signTestToken(t, "RS256", "rsa", other, claims))
+	ast.ErrorIs(err, ErrSignatureInvalid)
+
+	// unknown kid
+	_, err = VerifyToken(ja, signTestToken(t, "RS256", "unknown", rk, claims))
+	ast.ErrorIs(err, ErrUnknownKey)
+}
+
+func TestVerifyAlgorithmConfusion(t *testing.T) {
+	ast := assert.New(t)
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ek, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	jwk := rsaJWK("rsa", &rk.PublicKey)
+	jwk.Alg = "RS256"
+	data, _ := json.Marshal(JWKS{Keys: []JWK{jwk, ecJWK("ec", ek)}})
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	ast.Nil(os.WriteFile(file, data, 0o600))
+	ja := testJWTAuth(t, JWTAuthConfig{JWKSFile: file})
+
+	claims := map[string]any{"sub": "tester"}
+	// none algorithm
+	hb := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	pb := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"tester"}`))
+	_, err := VerifyToken(ja, hb+"."+pb+".")
+	ast.ErrorIs(err, ErrAlgoInvalid)
+
+	// symmetric algorithm
+	hb = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT","kid":"rsa"}`))
+	_, err = VerifyToken(ja, hb+"."+pb+".c2lnbmF0dXJl")
+	ast.ErrorIs(err, ErrAlgoInvalid)
+
+	// key restricted to RS256
+	_, err = VerifyToken(ja, signTestToken(t, "PS256", "rsa", rk, claims))
+	ast.ErrorIs(err, ErrAlgoInvalid)
+
+	// ec key used with an rsa algorithm
+	_, err = VerifyToken(ja, signTestToken(t, "RS256", "ec", rk, claims))
+	ast.ErrorIs(err, ErrAlgoInvalid)
+
+	// ec key with the wrong curve size
+	_, err = VerifyToken(ja, signTestToken(t, "ES384", "ec", ek, claims))
+	ast.ErrorIs(err, ErrAlgoInvalid)
+}
+
+func TestVerifyPEMDir(t *testing.T) {
+	ast := assert.New(t)
+	dir := t.TempDir()
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ek, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	writePEM(t, dir, "rsakey.pem", &rk.PublicKey)
+	writePEM(t, dir, "eckey.pem", &ek.PublicKey)
+
+	ja := testJWTAuth(t, JWTAuthConfig{KeysDir: dir})
+	claims := map[string]any{"sub": "tester"}
+
+	_, err := VerifyToken(ja, signTestToken(t, "RS256", "rsakey", rk, claims))
+	ast.Nil(err)
+	_, err = VerifyToken(ja, signTestToken(t, "ES384", "eckey", ek, claims))
+	ast.Nil(err)
+	// without kid all keys will be tried
+	_, err = VerifyToken(ja, signTestToken(t, "ES384", "", ek, claims))
+	ast.Nil(err)
+}
+
+func TestVerifyJWKSURL(t *testing.T) {
+	ast := assert.New(t)
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rk2, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	var calls atomic.Int32
+	var fail atomic.Bool
+	keys := []JWK{rsaJWK("first", &rk.PublicKey)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(JWKS{Keys: keys})
+	}))
+	defer srv.Close()
+
+	ja := testJWTAuth(t, JWTAuthConfig{JWKSURL: srv.URL, KeyRefresh: 1})
+	claims := map[string]any{"sub": "tester"}
+	_, err := VerifyToken(ja, signTestToken(t, "RS256", "first", rk, claims))
+	ast.Nil(err)
+	ast.Equal(int32(1), calls.Load())
+
+	// key rotation, the unknown kid forces a refresh
+	keys = append(keys, rsaJWK("second", &rk2.PublicKey))
+	_, err = VerifyToken(ja, signTestToken(t, "RS256", "second", rk2, claims))
+	ast.Nil(err)
+	ast.Equal(int32(2), calls.Load())
+
+	ok, err := ja.Keys.Check()
+	ast.True(ok)
+	ast.Nil(err)
+
+	// a failing refresh is reported to the health system
+	fail.Store(true)
+	_, err = VerifyToken(ja, signTestToken(t, "RS256", "third", rk2, claims))
+	ast.NotNil(err)
+	ok, err = ja.Keys.Check()
+	ast.False(ok)
+	ast.NotNil(err)
+
+	fail.Store(false)
+	ok, err = ja.Keys.Check()
+	ast.True(ok)
+	ast.Nil(err)
+}
+
+func TestVerifyNoValidation(t *testing.T) {
+	ast := assert.New(t)
+	ja, err := InitJWT(JWTAuthConfig{Active: true, Validate: false})
+	ast.Nil(err)
+	jt, err := VerifyToken(ja, testToken)
+	ast.Nil(err)
+	ast.True(jt.IsValid)
+
+	// configured claim settings are checked without the signature validation, the test token is expired
+	for _, cfg := range []JWTAuthConfig{
+		{Active: true, Issuers: []string{"https://localhost/issuer"}},
+		{Active: true, Audiences: []string{"go-micro"}},
+		{Active: true, MaxAge: time.Hour},
+		{Active: true, ClockSkew: time.Minute},
+	} {
+		ja, err = InitJWT(cfg)
+		ast.Nil(err)
+		jt, err = VerifyToken(ja, testToken)
+		ast.ErrorIs(err, ErrExpired)
+		ast.False(jt.IsValid)
+	}
+}
+
+func TestVerifyLocalIssuer(t *testing.T) {
+	ast := assert.New(t)
+	iss, err := issuer.NewIssuer(issuer.Config{Issuer: "https://localhost/issuer"})
+	ast.Nil(err)
+
+	// the jwks of the issuer must be readable
+	data, err := json.Marshal(iss.JWKS())
+	ast.Nil(err)
+	pks, err := ParseJWKS(data)
+	ast.Nil(err)
+	ast.Len(pks, 1)
+	ast.Equal(iss.KeyID(), pks[0].Kid)
+
+	ja := testJWTAuth(t, JWTAuthConfig{
+		Validate:  true,
+		Issuers:   []string{"https://localhost/issuer"},
+		LocalKeys: []PublicKey{{Kid: iss.KeyID(), Alg: issuer.Algorithm, Key: iss.PublicKey()}},
+	})
+	tr, err := iss.Mint(issuer.TokenRequest{Subject: "tester", Roles: []string{RoleObjectAdmin}}, time.Now())
+	ast.Nil(err)
+	jt, err := VerifyToken(ja, tr.AccessToken)
+	ast.Nil(err)
+	ast.True(jt.IsValid)
+	ast.Equal([]string{RoleObjectReader, RoleObjectCreator, RoleObjectAdmin}, ja.ResolveRoles(jt.Payload, ""))
+
+	other, err := issuer.NewIssuer(issuer.Config{Issuer: "https://localhost/issuer"})
+	ast.Nil(err)
+	tr, err = other.Mint(issuer.TokenRequest{Subject: "tester"}, time.Now())
+	ast.Nil(err)
+	_, err = VerifyToken(ja, tr.AccessToken)
+	ast.ErrorIs(err, ErrUnknownKey)
+}
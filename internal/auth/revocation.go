@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/willie68/go-micro/internal/utils/ttlcache"
+)
+
+// DefaultRevocationTTL how long a revocation is kept, if the lifetime of the revoked tokens is unknown
+const DefaultRevocationTTL = 24 * time.Hour
+
+// ErrRevoked the token has been revoked
+var ErrRevoked = errors.New("token is revoked")
+
+// Revocation a revoked token, identified by its jti, or all tokens of a subject issued before a point in time
+type Revocation struct {
+	// ID the jti of the revoked token
+	ID string `json:"jti,omitempty"`
+	// Subject all tokens of this subject issued before IssuedBefore are revoked
+	Subject      string    `json:"sub,omitempty"`
+	IssuedBefore time.Time `json:"issuedBefore,omitzero"`
+	// Expires after this time the revoked tokens are expired anyway, so the revocation can be removed
+	Expires time.Time `json:"expires"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// RevocationStorage persistence of the revocations, so they survive restarts
+type RevocationStorage interface {
+	// Revocations getting all stored revocations
+	Revocations() ([]Revocation, error)
+	// StoreRevocation storing a revocation, expired revocations may be removed
+	StoreRevocation(rev Revocation) error
+}
+
+// RevocationList all active revocations, held in a ttl cache, so every revocation lives as long as the revoked tokens
+type RevocationList struct {
+	cache *ttlcache.Cache[string, Revocation]
+	stg   RevocationStorage
+	ttl   time.Duration
+	lock  sync.Mutex
+}
+
+// key the cache key of the revocation
+func (r Revocation) key() string {
+	if r.ID != "" {
+		return "jti:" + r.ID
+	}
+	return "sub:" + r.Subject
+}
+
+// NewRevocationList creates a new revocation list and loads all active revocations from the storage.
+// ttl is used for revocations without expiry, the storage can be nil for an in memory list.
+func NewRevocationList(stg RevocationStorage, ttl time.Duration) (*RevocationList, error) {
+	if ttl <= 0 {
+		ttl = DefaultRevocationTTL
+	}
+	rl := RevocationList{
+		cache: ttlcache.New(ttlcache.WithTTL[string, Revocation](0), ttlcache.WithAutoDeletion[string, Revocation](time.Minute)),
+		stg:   stg,
+		ttl:   ttl,
+	}
+	if stg != nil {
+		revs, err := stg.Revocations()
+		if err != nil {
+			rl.Close()
+			return nil, fmt.Errorf("can't load revocations: %w", err)
+		}
+		now := time.Now()
+		for _, rev := range revs {
+			rl.add(rev, now)
+		}
+	}
+	return &rl, nil
+}
+
+// Revoke adding a new revocation, it will be stored before it's active. Missing expiry and issued before
+// will be filled with defaults.
+func (rl *RevocationList) Revoke(rev Revocation, now time.Time) (Revocation, error) {
+	if rev.ID == "" && rev.Subject == "" {
+		return rev, errors.New("jti or sub is needed for a revocation")
+	}
+	if rev.ID == "" && rev.IssuedBefore.IsZero() {
+		rev.IssuedBefore = now
+	}
+	if rev.Expires.IsZero() {
+		rev.Expires = now.Add(rl.ttl)
+		if !rev.IssuedBefore.IsZero() {
+			rev.Expires = rev.IssuedBefore.Add(rl.ttl)
+		}
+	}
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	if old, ok := rl.cache.Get(rev.key()); ok && rev.ID == "" {
+		// a subject revocation never shrinks
+		if old.IssuedBefore.After(rev.IssuedBefore) {
+			rev.IssuedBefore = old.IssuedBefore
+		}
+		if old.Expires.After(rev.Expires) {
+			rev.Expires = old.Expires
+		}
+	}
+	if rl.stg != nil {
+		if err := rl.stg.StoreRevocation(rev); err != nil {
+			return rev, err
+		}
+	}
+	rl.add(rev, now)
+	return rev, nil
+}
+
+func (rl *RevocationList) add(rev Revocation, now time.Time) {
+	if !rev.Expires.After(now) {
+		return
+	}
+	rl.cache.AddWithTTL(rev.key(), rev, rev.Expires.Sub(now))
+}
+
+// IsRevoked checking if the token is revoked, by its jti or by its subject and issued at. A token without iat
+// of a revoked subject is revoked.
+func (rl *RevocationList) IsRevoked(j *JWT) bool {
+	if jti, ok := j.Payload["jti"].(string); ok && jti != "" && rl.cache.Has(Revocation{ID: jti}.key()) {
+		return true
+	}
+	sub, ok := j.Payload["sub"].(string)
+	if !ok || sub == "" {
+		return false
+	}
+	rev, ok := rl.cache.Get(Revocation{Subject: sub}.key())
+	if !ok {
+		return false
+	}
+	iat, ok := j.numericDate("iat")
+	return !ok || iat.Before(rev.IssuedBefore)
+}
+
+// Revocations getting all active revocations
+func (rl *RevocationList) Revocations() []Revocation {
+	items := rl.cache.Items()
+	revs := make([]Revocation, 0, len(items))
+	for _, rev := range items {
+		revs = append(revs, rev)
+	}
+	slices.SortFunc(revs, func(a, b Revocation) int {
+		return strings.Compare(a.key(), b.key())
+	})
+	return revs
+}
+
+// Close stopping the revocation list
+func (rl *RevocationList) Close() {
+	rl.cache.Close()
+}
+
+// FileRevocations storing the revocations as json in a file
+type FileRevocations struct {
+	file string
+	lock sync.Mutex
+}
+
+// NewFileRevocations creates a new file based revocation storage
+func NewFileRevocations(file string) *FileRevocations {
+	return &FileRevocations{
+		file: file,
+	}
+}
+
+// Revocations getting all stored revocations, a missing file is an empty list
+func (f *FileRevocations) Revocations() ([]Revocation, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.read()
+}
+
+// StoreRevocation storing a revocation, all expired revocations will be removed
+func (f *FileRevocations) StoreRevocation(rev Revocation) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	revs, err := f.read()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	active := make([]Revocation, 0, len(revs)+1)
+	for _, r := range revs {
+		if r.Expires.After(now) && r.key() != rev.key() {
+			active = append(active, r)
+		}
+	}
+	active = append(active, rev)
+	data, err := json.MarshalIndent(active, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := f.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("can't write revocation file: %w", err)
+	}
+	return os.Rename(tmp, f.file)
+}
+
+func (f *FileRevocations) read() ([]Revocation, error) {
+	data, err := os.ReadFile(f.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Revocation{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read revocation file: %w", err)
+	}
+	revs := make([]Revocation, 0)
+	if err := json.Unmarshal(data, &revs); err != nil {
+		return nil, fmt.Errorf("can't parse revocation file: %w", err)
+	}
+	return revs, nil
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func revTestToken(jti, sub string, iat time.Time) *JWT {
+	return &JWT{
+		Payload: map[string]any{
+			"jti": jti,
+			"sub": sub,
+			"iat": float64(iat.Unix()),
+		},
+		IsValid: true,
+	}
+}
+
+func TestRevocationList(t *testing.T) {
+	ast := assert.New(t)
+	rl, err := NewRevocationList(nil, time.Hour)
+	ast.Nil(err)
+	defer rl.Close()
+	now := time.Now()
+
+	ast.False(rl.IsRevoked(revTestToken("jti1", "user1", now)))
+
+	_, err = rl.Revoke(Revocation{}, now)
+	ast.NotNil(err)
+
+	rev, err := rl.Revoke(Revocation{ID: "jti1", Reason: "leaked"}, now)
+	ast.Nil(err)
+	ast.Equal(now.Add(time.Hour), rev.Expires)
+	ast.True(rl.IsRevoked(revTestToken("jti1", "user1", now)))
+	ast.False(rl.IsRevoked(revTestToken("jti2", "user1", now)))
+
+	// all tokens of the subject issued before now
+	rev, err = rl.Revoke(Revocation{Subject: "user2"}, now)
+	ast.Nil(err)
+	ast.Equal(now, rev.IssuedBefore)
+	ast.True(rl.IsRevoked(revTestToken("jti3", "user2", now.Add(-time.Minute))))
+	ast.False(rl.IsRevoked(revTestToken("jti4", "user2", now.Add(time.Minute))))
+	ast.True(rl.IsRevoked(&JWT{Payload: map[string]any{"sub": "user2"}}))
+
+	// a subject revocation never shrinks
+	_, err = rl.Revoke(Revocation{Subject: "user2", IssuedBefore: now.Add(-time.Hour)}, now)
+	ast.Nil(err)
+	ast.True(rl.IsRevoked(revTestToken("jti3", "user2", now.Add(-time.Minute))))
+
+	// expired revocations are gone
+	_, err = rl.Revoke(Revocation{ID: "jti5", Expires: now.Add(50 * time.Millisecond)}, now)
+	ast.Nil(err)
+	ast.True(rl.IsRevoked(revTestToken("jti5", "user3", now)))
+	time.Sleep(100 * time.Millisecond)
+	ast.False(rl.IsRevoked(revTestToken("jti5", "user3", now)))
+
+	revs := rl.Revocations()
+	ast.Len(revs, 2)
+	ast.Equal("jti1", revs[0].ID)
+	ast.Equal("user2", revs[1].Subject)
+}
+
+func TestFileRevocations(t *testing.T) {
+	ast := assert.New(t)
+	file := filepath.Join(t.TempDir(), "revocations.json")
+	stg := NewFileRevocations(file)
+	now := time.Now()
+
+	revs, err := stg.Revocations()
+	ast.Nil(err)
+	ast.Empty(revs)
+
+	rl, err := NewRevocationList(stg, time.Hour)
+	ast.Nil(err)
+	_, err = rl.Revoke(Revocation{ID: "jti1"}, now)
+	ast.Nil(err)
+	_, err = rl.Revoke(Revocation{Subject: "user1"}, now)
+	ast.Nil(err)
+	ast.Nil(stg.StoreRevocation(Revocation{ID: "old", Expires: now.Add(-time.Minute)}))
+	rl.Close()
+
+	// a new list, e.g. after a restart, knows all active revocations
+	rl, err = NewRevocationList(NewFileRevocations(file), time.Hour)
+	ast.Nil(err)
+	defer rl.Close()
+	ast.True(rl.IsRevoked(revTestToken("jti1", "user2", now)))
+	ast.True(rl.IsRevoked(revTestToken("jti2", "user1", now.Add(-time.Minute))))
+	ast.Len(rl.Revocations(), 2)
+}
+
+func TestVerifyRevokedToken(t *testing.T) {
+	ast := assert.New(t)
+	jt, err := DecodeJWT(testToken)
+	ast.Nil(err)
+	ja, err := InitJWT(JWTAuthConfig{Validate: false})
+	ast.Nil(err)
+	ja.Revocations, err = NewRevocationList(nil, time.Hour)
+	ast.Nil(err)
+	defer ja.Revocations.Close()
+
+	_, err = VerifyToken(ja, testToken)
+	ast.Nil(err)
+
+	sub, _ := jt.Payload["sub"].(string)
+	_, err = ja.Revocations.Revoke(Revocation{Subject: sub}, time.Now())
+	ast.Nil(err)
+	jt2, err := VerifyToken(ja, testToken)
+	ast.ErrorIs(err, ErrRevoked)
+	ast.False(jt2.IsValid)
+	ast.Equal("token-revoked", UnauthorizedError(err).Key)
+}
@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/willie68/go-micro/internal/api"
+	"github.com/willie68/go-micro/internal/serror"
+)
+
+// the logical roles of the service
+const (
+	RoleObjectReader  = "object-reader"
+	RoleObjectCreator = "object-creator"
+	RoleObjectAdmin   = "object-admin"
+	RoleTenantAdmin   = "tenant-admin"
+	RoleAdmin         = "admin"
+)
+
+// Roles all logical roles, ordered from the lowest to the highest. Every role implies all lower roles.
+var Roles = []string{RoleObjectReader, RoleObjectCreator, RoleObjectAdmin, RoleTenantAdmin, RoleAdmin}
+
+// DefaultRoleClaims the claims used for the token roles, if no role claim is configured (keycloak style)
+var DefaultRoleClaims = []string{"realm_access.roles", "resource_access.*.roles"}
+
+// RolesCtxKey context key for the role resolver of the actual request
+var RolesCtxKey = &contextKey{"Roles"}
+
+// DefaultTenantAdminPrefix the default prefix of tenant scoped admin roles, e.g. tenantadmin-<tenant>
+const DefaultTenantAdminPrefix = "tenantadmin-"
+
+// RoleResolver resolves the logical roles from the claims of a request
+type RoleResolver interface {
+	// ResolveRoles getting all logical roles of the claims for the requested tenant
+	ResolveRoles(claims map[string]any, tenant string) []string
+}
+
+// RoleMapping maps the roles of the token to the logical roles of the service
+type RoleMapping struct {
+	// Claims the claim pathes with the token roles, pathes are dot separated, * matches every key
+	Claims []string
+	// Mapping logical role to a list of token roles. A missing or empty entry maps the token role with the same name.
+	Mapping map[string][]string
+	// TenantAdminPrefix token roles with this prefix followed by the tenant grant the tenant-admin role for this tenant only
+	TenantAdminPrefix string
+}
+
+// ParseRoleMapping parsing the rolemapping property
+func ParseRoleMapping(value any) (map[string][]string, error) {
+	mapping := make(map[string][]string)
+	if value == nil {
+		return mapping, nil
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("config value for rolemapping is not a map")
+	}
+	for k, v := range m {
+		if !slices.Contains(Roles, k) {
+			return nil, fmt.Errorf("unknown role %q in rolemapping, allowed are %s", k, strings.Join(Roles, ", "))
+		}
+		switch tv := v.(type) {
+		case nil:
+			mapping[k] = []string{}
+		case string:
+			mapping[k] = []string{tv}
+		case []any:
+			l := make([]string, 0, len(tv))
+			for _, e := range tv {
+				s, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("rolemapping for %s is not a list of strings", k)
+				}
+				l = append(l, s)
+			}
+			mapping[k] = l
+		default:
+			return nil, fmt.Errorf("rolemapping for %s is not a list of strings", k)
+		}
+	}
+	return mapping, nil
+}
+
+// TokenRoles getting all roles of the token
+func (m *RoleMapping) TokenRoles(claims map[string]any) []string {
+	paths := m.Claims
+	if len(paths) == 0 {
+		paths = DefaultRoleClaims
+	}
+	return ClaimValues(claims, paths)
+}
+
+// ResolveRoles getting all logical roles of the claims for the tenant, including the implied lower roles
+func (m *RoleMapping) ResolveRoles(claims map[string]any, tenant string) []string {
+	tokenRoles := m.TokenRoles(claims)
+	roles := m.MapRoles(tokenRoles)
+	if m.TenantAdminPrefix == "" || tenant == "" || slices.Contains(roles, RoleTenantAdmin) {
+		return roles
+	}
+	for _, tr := range tokenRoles {
+		if strings.EqualFold(tr, m.TenantAdminPrefix+tenant) {
+			return slices.Clone(Roles[:slices.Index(Roles, RoleTenantAdmin)+1])
+		}
+	}
+	return roles
+}
+
+// MapRoles maps token roles to the logical roles, including the implied lower roles
+func (m *RoleMapping) MapRoles(tokenRoles []string) []string {
+	highest := -1
+	for x, r := range Roles {
+		mapped := m.Mapping[r]
+		if len(mapped) == 0 {
+			mapped = []string{r}
+		}
+		for _, tr := range tokenRoles {
+			if slices.Contains(mapped, tr) {
+				highest = x
+				break
+			}
+		}
+	}
+	return slices.Clone(Roles[:highest+1])
+}
+
+// ClaimValues getting all string values of the claim pathes. Pathes are dot separated, * matches every key,
+// arrays of objects are traversed, e.g. systemidentities.tenant
+func ClaimValues(claims map[string]any, paths []string) []string {
+	values := make([]string, 0)
+	for _, p := range paths {
+		values = append(values, claimValues(claims, strings.Split(p, "."))...)
+	}
+	return values
+}
+
+func claimValues(claims map[string]any, path []string) []string {
+	values := make([]string, 0)
+	if len(path) == 0 {
+		return values
+	}
+	for k, v := range claims {
+		if path[0] != "*" && path[0] != k {
+			continue
+		}
+		if len(path) > 1 {
+			values = append(values, subClaimValues(v, path[1:])...)
+			continue
+		}
+		switch tv := v.(type) {
+		case string:
+			values = append(values, strings.Fields(tv)...)
+		case []any:
+			for _, e := range tv {
+				if s, ok := e.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func subClaimValues(v any, path []string) []string {
+	values := make([]string, 0)
+	switch tv := v.(type) {
+	case map[string]any:
+		values = append(values, claimValues(tv, path)...)
+	case []any:
+		for _, e := range tv {
+			if sub, ok := e.(map[string]any); ok {
+				values = append(values, claimValues(sub, path)...)
+			}
+		}
+	}
+	return values
+}
+
+// RequestedTenant getting the tenant the request is asking for, from the url or the tenant header
+func RequestedTenant(r *http.Request) string {
+	tenant := chi.URLParam(r, api.URLParamTenantID)
+	if tenant == "" {
+		tenant = r.Header.Get(api.TenantHeaderKey)
+	}
+	return strings.ToLower(tenant)
+}
+
+// RolesFromContext getting the logical roles of the request for the tenant. If no role resolver is present, ok is false.
+func RolesFromContext(ctx context.Context, tenant string) ([]string, bool) {
+	rr, ok := ctx.Value(RolesCtxKey).(RoleResolver)
+	if !ok || rr == nil {
+		return nil, false
+	}
+	_, claims, _ := FromContext(ctx)
+	return rr.ResolveRoles(claims, tenant), true
+}
+
+// HasRole checking if the request has one of the roles for the tenant. Without an active authentication every role is granted.
+func HasRole(ctx context.Context, tenant string, roles ...string) bool {
+	granted, ok := RolesFromContext(ctx, tenant)
+	if !ok {
+		return true
+	}
+	for _, r := range roles {
+		if slices.Contains(granted, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleCheck returns a handler, which only passes requests with one of the roles, otherwise forbidden is returned.
+// Without an active authentication or on ignored pages, every request will pass.
+func RoleCheck(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if nocheck, ok := r.Context().Value(CheckCtxKey).(bool); ok && nocheck {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !HasRole(r.Context(), RequestedTenant(r), roles...) {
+				apierr := serror.Forbidden(nil, "missing-role", fmt.Sprintf("one of the roles %s is needed", strings.Join(roles, ", ")))
+				render.Status(r, apierr.Code)
+				render.JSON(w, r, apierr)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/config"
+	"github.com/willie68/go-micro/internal/serror"
+)
+
+func TestTokenRoles(t *testing.T) {
+	ast := assert.New(t)
+	jt, err := DecodeJWT(testToken)
+	ast.Nil(err)
+
+	rm := RoleMapping{}
+	roles := rm.TokenRoles(jt.Payload)
+	ast.Contains(roles, "offline_access")
+	ast.Contains(roles, "tenantadmin-c133dkd5bculje2nj2i0")
+	ast.Contains(roles, "read-token")
+	ast.Contains(roles, "manage-account")
+
+	rm = RoleMapping{Claims: []string{"resource_access.broker.roles"}}
+	roles = rm.TokenRoles(jt.Payload)
+	ast.Equal([]string{"read-token"}, roles)
+
+	rm = RoleMapping{Claims: []string{"scope"}}
+	roles = rm.TokenRoles(jt.Payload)
+	ast.Equal([]string{"openid", "profile", "email"}, roles)
+}
+
+func TestResolveRoles(t *testing.T) {
+	ast := assert.New(t)
+	jt, err := DecodeJWT(testToken)
+	ast.Nil(err)
+
+	rm := RoleMapping{
+		Mapping: map[string][]string{
+			RoleObjectReader: {"read-token"},
+			RoleObjectAdmin:  {"manage-account"},
+			RoleAdmin:        {},
+		},
+	}
+	roles := rm.ResolveRoles(jt.Payload, "")
+	ast.Equal([]string{RoleObjectReader, RoleObjectCreator, RoleObjectAdmin}, roles)
+
+	rm = RoleMapping{
+		Claims: []string{"resource_access.broker.roles"},
+		Mapping: map[string][]string{
+			RoleObjectReader: {"read-token"},
+			RoleObjectAdmin:  {"manage-account"},
+		},
+	}
+	roles = rm.ResolveRoles(jt.Payload, "")
+	ast.Equal([]string{RoleObjectReader}, roles)
+
+	// unmapped roles are used with their own name
+	roles = rm.MapRoles([]string{"admin"})
+	ast.Equal(Roles, roles)
+
+	roles = rm.MapRoles([]string{"unknown"})
+	ast.Empty(roles)
+}
+
+func TestParseRoleMapping(t *testing.T) {
+	ast := assert.New(t)
+	m, err := ParseRoleMapping(map[string]any{
+		"object-reader":  "Reader",
+		"object-creator": []any{"Creator", "Writer"},
+		"admin":          nil,
+	})
+	ast.Nil(err)
+	ast.Equal([]string{"Reader"}, m[RoleObjectReader])
+	ast.Equal([]string{"Creator", "Writer"}, m[RoleObjectCreator])
+	ast.Empty(m[RoleAdmin])
+
+	_, err = ParseRoleMapping(map[string]any{"superuser": "root"})
+	ast.NotNil(err)
+
+	_, err = ParseRoleMapping("object-reader")
+	ast.NotNil(err)
+
+	cfg, err := ParseJWTConfig(config.Authentication{
+		Type: "jwt",
+		Properties: map[string]any{
+			"validate":  false,
+			"roleClaim": "realm_access.roles",
+			"rolemapping": map[string]any{
+				"object-reader": "offline_access",
+			},
+		},
+	})
+	ast.Nil(err)
+	ast.Equal([]string{"realm_access.roles"}, cfg.Roles.Claims)
+	ast.Equal([]string{"offline_access"}, cfg.Roles.Mapping[RoleObjectReader])
+}
+
+func TestRoleCheck(t *testing.T) {
+	ast := assert.New(t)
+	jt, err := DecodeJWT(testToken)
+	ast.Nil(err)
+
+	hnd := RoleCheck(RoleObjectAdmin)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// without authentication everything is allowed
+	rec := httptest.NewRecorder()
+	hnd.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil))
+	ast.Equal(http.StatusOK, rec.Code)
+
+	ja := JWTAuth{Config: JWTAuthConfig{Roles: RoleMapping{
+		Mapping: map[string][]string{RoleObjectReader: {"read-token"}},
+	}}}
+	ctx := NewContext(context.Background(), &jt, nil, false)
+	ctx = context.WithValue(ctx, RolesCtxKey, &ja)
+
+	rec = httptest.NewRecorder()
+	hnd.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil).WithContext(ctx))
+	ast.Equal(http.StatusForbidden, rec.Code)
+	var serr serror.Serr
+	ast.Nil(json.Unmarshal(rec.Body.Bytes(), &serr))
+	ast.Equal("missing-role", serr.Key)
+
+	ja.Config.Roles.Mapping[RoleObjectAdmin] = []string{"manage-account"}
+	rec = httptest.NewRecorder()
+	hnd.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil).WithContext(ctx))
+	ast.Equal(http.StatusOK, rec.Code)
+}
+
+func TestTenantAdminRoles(t *testing.T) {
+	ast := assert.New(t)
+	jt, err := DecodeJWT(testToken)
+	ast.Nil(err)
+
+	rm := RoleMapping{
+		Claims:            []string{"realm_access.roles"},
+		Mapping:           map[string][]string{RoleObjectReader: {"offline_access"}},
+		TenantAdminPrefix: DefaultTenantAdminPrefix,
+	}
+	// tenant admin only for the tenant of the role
+	roles := rm.ResolveRoles(jt.Payload, "c133dkd5bculje2nj2i0")
+	ast.Equal([]string{RoleObjectReader, RoleObjectCreator, RoleObjectAdmin, RoleTenantAdmin}, roles)
+
+	roles = rm.ResolveRoles(jt.Payload, "c133dkd5bculje2nj2i1")
+	ast.Equal([]string{RoleObjectReader}, roles)
+
+	roles = rm.ResolveRoles(jt.Payload, "")
+	ast.Equal([]string{RoleObjectReader}, roles)
+
+	// without prefix no tenant admin
+	rm.TenantAdminPrefix = ""
+	roles = rm.ResolveRoles(jt.Payload, "c133dkd5bculje2nj2i0")
+	ast.Equal([]string{RoleObjectReader}, roles)
+}
+
+func TestClaimValues(t *testing.T) {
+	ast := assert.New(t)
+	jt, err := DecodeJWT(testToken)
+	ast.Nil(err)
+
+	tenants := ClaimValues(jt.Payload, []string{"tenants"})
+	ast.Len(tenants, 4)
+	ast.Contains(tenants, "c133dvd5bculje2nj2jg")
+
+	tenants = ClaimValues(jt.Payload, []string{"systemidentities.tenant"})
+	ast.Equal([]string{"c133dvd5bculje2nj2jg"}, tenants)
+
+	ast.Empty(ClaimValues(jt.Payload, []string{"unknown.path"}))
+}
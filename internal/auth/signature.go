@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"math/big"
+	"slices"
+
+	// registering the needed hash functions
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// ErrSignatureInvalid the signature of the token doesn't match
+var ErrSignatureInvalid = errors.New("token signature invalid")
+
+// SupportedAlgorithms all asymmetric algorithms, which can be verified
+var SupportedAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// IsSupportedAlgorithm checking if the algorithm can be used for token verification, "none" and all symmetric algorithms are never supported
+func IsSupportedAlgorithm(alg string) bool {
+	return slices.Contains(SupportedAlgorithms, alg)
+}
+
+// algHash the hash function used for an algorithm
+func algHash(alg string) crypto.Hash {
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256
+	case "384":
+		return crypto.SHA384
+	case "512":
+		return crypto.SHA512
+	}
+	return 0
+}
+
+// keyFitsAlgorithm checking the key type against the algorithm to prevent algorithm confusion
+func keyFitsAlgorithm(alg string, key crypto.PublicKey) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return alg[:2] == "RS" || alg[:2] == "PS"
+	case *ecdsa.PublicKey:
+		switch alg {
+		case "ES256":
+			return k.Curve.Params().BitSize == 256
+		case "ES384":
+			return k.Curve.Params().BitSize == 384
+		case "ES512":
+			return k.Curve.Params().BitSize == 521
+		}
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+	return false
+}
+
+// verifySignature verify the signature of the signing input with the given key and algorithm
+func verifySignature(alg string, key crypto.PublicKey, input, sig []byte) error {
+	if !IsSupportedAlgorithm(alg) || !keyFitsAlgorithm(alg, key) {
+		return ErrAlgoInvalid
+	}
+	if alg == "EdDSA" {
+		if !ed25519.Verify(key.(ed25519.PublicKey), input, sig) {
+			return ErrSignatureInvalid
+		}
+		return nil
+	}
+	hash := algHash(alg)
+	hasher := hash.New()
+	hasher.Write(input)
+	digest := hasher.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		if alg[:2] == "PS" {
+			err = rsa.VerifyPSS(k, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			err = rsa.VerifyPKCS1v15(k, hash, digest, sig)
+		}
+		if err != nil {
+			return ErrSignatureInvalid
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return ErrSignatureInvalid
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrSignatureInvalid
+		}
+		return nil
+	}
+	return ErrAlgoInvalid
+}
@@ -13,8 +13,11 @@ import (
 	"github.com/willie68/go-micro/internal/logging"
 	adrcfg "github.com/willie68/go-micro/internal/services/adrsvc/common"
 	"github.com/willie68/go-micro/internal/services/caservice"
+	"github.com/willie68/go-micro/internal/services/events"
 	"github.com/willie68/go-micro/internal/services/health"
+	"github.com/willie68/go-micro/internal/services/issuer"
 	"github.com/willie68/go-micro/internal/services/shttp"
+	"github.com/willie68/go-micro/internal/services/webhooks"
 	"gopkg.in/yaml.v3"
 )
 
@@ -43,6 +46,12 @@ type Config struct {
 	Profiling Profiling `yaml:"profiling"`
 	// This is the demo address storage config
 	AddressStorage adrcfg.Config `yaml:"addressstorage"`
+	// development token issuer, only for local development and tests
+	Issuer issuer.Config `yaml:"issuer"`
+	// webhooks for the address changes
+	Webhooks webhooks.Config `yaml:"webhooks"`
+	// server-sent event streams of the address changes
+	Events events.Config `yaml:"events"`
 }
 
 // Authentication configuration
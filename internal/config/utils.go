@@ -57,3 +57,29 @@ func GetConfigValueAsInt(properties map[string]any, key string) (int64, error) {
 	}
 	return value, nil
 }
+
+// GetConfigValueAsStringSlice getting a value as a slice of strings, if possible. A single string will be converted into a slice with one entry.
+func GetConfigValueAsStringSlice(properties map[string]any, key string) ([]string, error) {
+	if _, ok := properties[key]; !ok {
+		return nil, fmt.Errorf(errMissingConfigValue, key)
+	}
+	values := make([]string, 0)
+	switch v := properties[key].(type) {
+	case nil:
+	case string:
+		values = append(values, v)
+	case []string:
+		values = append(values, v...)
+	case []any:
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("config value for %s is not a list of strings", key)
+			}
+			values = append(values, s)
+		}
+	default:
+		return nil, fmt.Errorf("config value for %s is not a list of strings", key)
+	}
+	return values, nil
+}
@@ -13,6 +13,7 @@ func init() {
 	prop["string"] = "string value"
 	prop["bool"] = true
 	prop["number"] = 12345678
+	prop["list"] = []any{"first", "second"}
 }
 
 func TestConfigValueAsString(t *testing.T) {
@@ -62,3 +63,20 @@ func TestConfigValueAsInt(t *testing.T) {
 	_, err = GetConfigValueAsInt(prop, "string")
 	ast.NotNil(err)
 }
+
+func TestConfigValueAsStringSlice(t *testing.T) {
+	ast := assert.New(t)
+	v, err := GetConfigValueAsStringSlice(prop, "list")
+	ast.Nil(err)
+	ast.Equal([]string{"first", "second"}, v)
+
+	v, err = GetConfigValueAsStringSlice(prop, "string")
+	ast.Nil(err)
+	ast.Equal([]string{"string value"}, v)
+
+	_, err = GetConfigValueAsStringSlice(prop, "muck")
+	ast.NotNil(err)
+
+	_, err = GetConfigValueAsStringSlice(prop, "number")
+	ast.NotNil(err)
+}
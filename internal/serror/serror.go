@@ -9,11 +9,19 @@ import (
 
 // Serr service error model
 type Serr struct {
-	Code   int    `json:"code"`
-	Key    string `json:"key"`
-	Srv    string `json:"service,omitempty"`
-	Msg    string `json:"message,omitempty"`
-	Origin string `json:"origin,omitempty"`
+	Code   int          `json:"code"`
+	Key    string       `json:"key"`
+	Srv    string       `json:"service,omitempty"`
+	Msg    string       `json:"message,omitempty"`
+	Origin string       `json:"origin,omitempty"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError the error of one field of an invalid object
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Msg   string `json:"message"`
 }
 
 // Service the service name
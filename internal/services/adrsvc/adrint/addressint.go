@@ -1,77 +1,389 @@
 package adrint
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	// needed declaration
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/rs/xid"
+	"github.com/willie68/go-micro/internal/logging"
 	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+	"github.com/willie68/go-micro/internal/services/adrsvc/search"
 	"github.com/willie68/go-micro/pkg/pmodel"
 )
 
-// AdrInt the internal address storage type
+var logger = logging.New("adrint")
+
+// ErrClosed the storage is shut down, no further changes are accepted
+var ErrClosed = errors.New("address storage is shut down")
+
+// AdrInt the internal address storage type, the addresses are partitioned by tenant. Every tenant has an inverted
+// index for the search of the addresses, which are not deleted, and the revisions of every address. The storage is
+// safe for concurrent use. With persistence every change is written to a journal, before it's applied.
 type AdrInt struct {
-	adrs map[string]pmodel.Address
+	mu   sync.RWMutex
+	adrs map[string]map[string]pmodel.Address
+	idxs map[string]*search.Index
+	revs map[string]map[string][]pmodel.Revision
+	jrn  *journal
+	// closed after the shutdown, the changes would not be persisted anymore
+	closed bool
 }
 
-// NewAdrInt create a new instance of the internal address storage
+// NewAdrInt create a new instance of the internal address storage, only kept in memory
 func NewAdrInt() (*AdrInt, error) {
 	am := AdrInt{
-		adrs: make(map[string]pmodel.Address),
+		adrs: make(map[string]map[string]pmodel.Address),
+		idxs: make(map[string]*search.Index),
+		revs: make(map[string]map[string][]pmodel.Revision),
 	}
 	return &am, nil
 }
 
-// Addresses list all addresses
-func (a *AdrInt) Addresses() ([]pmodel.Address, error) {
+// NewPersistentAdrInt create a new instance of the internal address storage, persisted in the snapshot file and the
+// journal file beside it with the suffix .journal. After the number of changes a new snapshot is written and the
+// journal is truncated, 0 for the default. The stored addresses are loaded from both files.
+func NewPersistentAdrInt(file string, snapshotEvery int) (*AdrInt, error) {
+	am, err := NewAdrInt()
+	if err != nil {
+		return nil, err
+	}
+	jrn, err := openJournal(file, snapshotEvery, am)
+	if err != nil {
+		return nil, err
+	}
+	am.jrn = jrn
+	return am, nil
+}
+
+// Addresses list one page of the filtered and sorted addresses of the tenant
+func (a *AdrInt) Addresses(tenant string, q pmodel.Query) (*pmodel.Page, error) {
+	return a.list(tenant, q, false)
+}
+
+// Trash list one page of the filtered and sorted deleted addresses of the tenant
+func (a *AdrInt) Trash(tenant string, q pmodel.Query) (*pmodel.Page, error) {
+	return a.list(tenant, q, true)
+}
+
+// list one page of the addresses or of the deleted addresses of the tenant
+func (a *AdrInt) list(tenant string, q pmodel.Query, deleted bool) (*pmodel.Page, error) {
+	order, err := common.SortOrder(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+	var cursor *common.Cursor
+	if q.Cursor != "" {
+		c, err := common.ParseCursor(q.Cursor, order)
+		if err != nil {
+			return nil, err
+		}
+		cursor = c
+	}
 	addresses := make([]pmodel.Address, 0)
-	for _, v := range a.adrs {
-		addresses = append(addresses, v)
+	a.mu.RLock()
+	for _, v := range a.adrs[tenant] {
+		if (v.DeletedAt != nil) == deleted && matches(q, v) {
+			addresses = append(addresses, v)
+		}
+	}
+	a.mu.RUnlock()
+	total := len(addresses)
+	slices.SortFunc(addresses, func(x, y pmodel.Address) int {
+		return common.Compare(order, x, y)
+	})
+	start := min(q.Offset, len(addresses))
+	if cursor != nil {
+		// the first address after the cursor position
+		start = sort.Search(len(addresses), func(x int) bool {
+			return cursor.Compare(order, addresses[x]) > 0
+		})
+		if cursor.Backward {
+			// the page before the cursor position, in reversed order
+			end := sort.Search(len(addresses), func(x int) bool {
+				return cursor.Compare(order, addresses[x]) >= 0
+			})
+			page := slices.Clone(addresses[max(0, end-q.PageSize()-1):end])
+			slices.Reverse(page)
+			return common.NewPage(page, q, order, cursor, total), nil
+		}
 	}
-	return addresses, nil
+	end := min(start+q.PageSize()+1, len(addresses))
+	return common.NewPage(addresses[start:end], q, order, cursor, total), nil
 }
 
-// Has checking if an adress is present
-func (a *AdrInt) Has(id string) bool {
-	_, ok := a.adrs[id]
-	return ok
+// matches checking the address against the filters of the query, case insensitive like the sql storages
+func matches(q pmodel.Query, adr pmodel.Address) bool {
+	return (q.City == "" || strings.EqualFold(adr.City, q.City)) &&
+		(q.State == "" || strings.EqualFold(adr.State, q.State)) &&
+		(q.ZipCode == "" || strings.EqualFold(adr.ZipCode, q.ZipCode)) &&
+		strings.HasPrefix(strings.ToLower(adr.Name), strings.ToLower(q.Name))
 }
 
-// Read getting the address with id
-func (a *AdrInt) Read(id string) (*pmodel.Address, error) {
-	adr, ok := a.adrs[id]
-	if !ok {
+// Has checking if an adress of the tenant is present
+func (a *AdrInt) Has(tenant, id string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	adr, ok := a.adrs[tenant][id]
+	return ok && adr.DeletedAt == nil
+}
+
+// Read getting the address of the tenant with id
+func (a *AdrInt) Read(tenant, id string) (*pmodel.Address, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	adr, ok := a.adrs[tenant][id]
+	if !ok || adr.DeletedAt != nil {
 		return nil, common.ErrNotFound
 	}
 	return &adr, nil
 }
 
-// Create creates a new Address
-func (a *AdrInt) Create(adr pmodel.Address) (string, error) {
+// Create creates a new Address for the tenant, the user is recorded as actor
+func (a *AdrInt) Create(tenant string, adr pmodel.Address, user string) (string, error) {
 	id := xid.New().String()
 	adr.ID = id
-	a.adrs[id] = adr
+	adr.Version = common.FirstVersion
+	adr.DeletedAt, adr.DeletedBy = nil, ""
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	idx := a.index(tenant)
+	if err := a.change(tenant, pmodel.ActionCreate, user, pmodel.Address{}, adr); err != nil {
+		return "", err
+	}
+	idx.Add(adr)
 	return id, nil
 }
 
-// Update updates the address
-func (a *AdrInt) Update(adr pmodel.Address) error {
-	_, ok := a.adrs[adr.ID]
+// Update updates the address of the tenant, if the stored address still has the version, 0 updates any version.
+// The user is recorded as actor. Returns the new version of the address.
+func (a *AdrInt) Update(tenant string, adr pmodel.Address, version int, user string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	old, err := a.check(tenant, adr.ID, version)
+	if err != nil {
+		return 0, err
+	}
+	adr.Version = old.Version + 1
+	adr.DeletedAt, adr.DeletedBy = nil, ""
+	idx := a.index(tenant)
+	if err := a.change(tenant, pmodel.ActionUpdate, user, old, adr); err != nil {
+		return 0, err
+	}
+	idx.Remove(old)
+	idx.Add(adr)
+	return adr.Version, nil
+}
+
+// Delete moves the address of the tenant with id into the trash, if the stored address still has the version, 0
+// deletes any version. The user is stored as the deleting user. Returns the deleted address.
+func (a *AdrInt) Delete(tenant, id string, version int, user string) (*pmodel.Address, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	adr, err := a.check(tenant, id, version)
+	if err != nil {
+		return nil, err
+	}
+	idx := a.index(tenant)
+	old := adr
+	now := time.Now().UTC()
+	adr.Version++
+	adr.DeletedAt, adr.DeletedBy = &now, user
+	if err := a.change(tenant, pmodel.ActionDelete, user, adr, adr); err != nil {
+		return nil, err
+	}
+	idx.Remove(old)
+	return &adr, nil
+}
+
+// Restore restores the deleted address of the tenant with id from the trash, the user is recorded as actor. Returns
+// the restored address.
+func (a *AdrInt) Restore(tenant, id, user string) (*pmodel.Address, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	adr, ok := a.adrs[tenant][id]
+	if !ok || adr.DeletedAt == nil {
+		return nil, common.ErrNotFound
+	}
+	idx := a.index(tenant)
+	adr.Version++
+	adr.DeletedAt, adr.DeletedBy = nil, ""
+	if err := a.change(tenant, pmodel.ActionRestore, user, adr, adr); err != nil {
+		return nil, err
+	}
+	idx.Add(adr)
+	return &adr, nil
+}
+
+// Purge deletes the address of the tenant with id permanently, deleted or not, if the stored address still has the
+// version, 0 deletes any version. The user is recorded as actor, the revisions are kept. Returns the purged address.
+func (a *AdrInt) Purge(tenant, id string, version int, user string) (*pmodel.Address, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	adr, ok := a.adrs[tenant][id]
 	if !ok {
-		return common.ErrNotFound
+		return nil, common.ErrNotFound
+	}
+	if version != 0 && adr.Version != version {
+		return nil, common.ErrVersionConflict
+	}
+	idx := a.index(tenant)
+	if err := a.change(tenant, pmodel.ActionPurge, user, adr, pmodel.Address{ID: id, Version: adr.Version + 1}); err != nil {
+		return nil, err
+	}
+	if adr.DeletedAt == nil {
+		idx.Remove(adr)
+	}
+	return &adr, nil
+}
+
+// PurgeDeleted deletes all addresses of all tenants permanently, which are deleted before the time, the revisions are
+// kept. Returns the number of purged addresses.
+func (a *AdrInt) PurgeDeleted(before time.Time) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	count := 0
+	for tenant, tadrs := range a.adrs {
+		for id, adr := range tadrs {
+			if adr.DeletedAt != nil && adr.DeletedAt.Before(before) {
+				if err := a.change(tenant, pmodel.ActionPurge, common.SystemActor, adr, pmodel.Address{ID: id, Version: adr.Version + 1}); err != nil {
+					return count, err
+				}
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// change recording the revision of the change from the old to the new address and storing the new address, a purge
+// removes the address. With persistence the change is written to the journal first, nothing is changed, if this
+// fails. After the shutdown every change is rejected. The write lock must be held. The fields of deletions, restores
+// and purges are not changed.
+func (a *AdrInt) change(tenant, action, user string, old, adr pmodel.Address) error {
+	if a.closed {
+		return ErrClosed
+	}
+	changes := []pmodel.FieldChange{}
+	if action == pmodel.ActionCreate || action == pmodel.ActionUpdate {
+		changes = pmodel.Diff(old, adr)
+	}
+	rev := pmodel.Revision{
+		Tenant:  tenant,
+		ID:      adr.ID,
+		Version: adr.Version,
+		Action:  action,
+		Actor:   user,
+		Time:    time.Now().UTC(),
+		Changes: changes,
+	}
+	var stored *pmodel.Address
+	if action != pmodel.ActionPurge {
+		stored = &adr
+	}
+	if a.jrn != nil {
+		if err := a.jrn.append(rev, stored); err != nil {
+			return err
+		}
+	}
+	a.apply(rev, stored)
+	if a.jrn != nil && a.jrn.due() {
+		if err := a.jrn.snapshot(a); err != nil {
+			// the changes are still in the journal
+			logger.Error(fmt.Sprintf("can't write snapshot: %v", err))
+		}
 	}
-	a.adrs[adr.ID] = adr
 	return nil
 }
 
-// Delete deletes the address with id
-func (a *AdrInt) Delete(id string) error {
-	_, ok := a.adrs[id]
+// apply appending the revision and storing the address, nil removes it. The write lock must be held.
+func (a *AdrInt) apply(rev pmodel.Revision, adr *pmodel.Address) {
+	if a.revs == nil {
+		a.revs = make(map[string]map[string][]pmodel.Revision)
+	}
+	trevs, ok := a.revs[rev.Tenant]
 	if !ok {
-		return common.ErrNotFound
+		trevs = make(map[string][]pmodel.Revision)
+		a.revs[rev.Tenant] = trevs
 	}
-	delete(a.adrs, id)
-	return nil
+	trevs[rev.ID] = append(trevs[rev.ID], rev)
+	tadrs, ok := a.adrs[rev.Tenant]
+	if !ok {
+		tadrs = make(map[string]pmodel.Address)
+		a.adrs[rev.Tenant] = tadrs
+	}
+	if adr == nil {
+		delete(tadrs, rev.ID)
+		return
+	}
+	tadrs[rev.ID] = *adr
+}
+
+// History getting the revisions of the address of the tenant with id, sorted by version. The revisions of deleted
+// and purged addresses are kept.
+func (a *AdrInt) History(tenant, id string) ([]pmodel.Revision, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	revs, ok := a.revs[tenant][id]
+	if !ok {
+		return nil, common.ErrNotFound
+	}
+	return slices.Clone(revs), nil
+}
+
+// check getting the stored address with the expected version, deleted addresses are not found. The write lock must
+// be held.
+func (a *AdrInt) check(tenant, id string, version int) (pmodel.Address, error) {
+	old, ok := a.adrs[tenant][id]
+	if !ok || old.DeletedAt != nil {
+		return old, common.ErrNotFound
+	}
+	if version != 0 && old.Version != version {
+		return old, common.ErrVersionConflict
+	}
+	return old, nil
+}
+
+// Search searching the addresses of the tenant with the inverted index, ranked by score
+func (a *AdrInt) Search(tenant string, q pmodel.SearchQuery) (*pmodel.SearchPage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	hits := a.index(tenant).Search(q.Q)
+	start := min(q.Offset, len(hits))
+	end := min(start+q.PageSize(), len(hits))
+	p := pmodel.SearchPage{
+		Hits:  make([]pmodel.SearchHit, 0, end-start),
+		Total: len(hits),
+	}
+	for _, h := range hits[start:end] {
+		p.Hits = append(p.Hits, pmodel.SearchHit{Address: a.adrs[tenant][h.ID], Score: h.Score})
+	}
+	return &p, nil
+}
+
+// index getting the search index of the tenant, a missing index is build from the stored addresses. The write lock
+// must be held.
+func (a *AdrInt) index(tenant string) *search.Index {
+	if a.idxs == nil {
+		a.idxs = make(map[string]*search.Index)
+	}
+	idx, ok := a.idxs[tenant]
+	if !ok {
+		idx = search.NewIndex()
+		for _, adr := range a.adrs[tenant] {
+			if adr.DeletedAt == nil {
+				idx.Add(adr)
+			}
+		}
+		a.idxs[tenant] = idx
+	}
+	return idx
 }
 
 // CheckName should return the name of this healthcheck. The name should be unique.
@@ -90,10 +402,23 @@ func (a *AdrInt) Init() error {
 	return nil
 }
 
-// Shutdown this service
+// Shutdown this service, with persistence a last snapshot is written and the journal is closed. Further changes are
+// rejected with ErrClosed, the addresses can still be read.
 func (a *AdrInt) Shutdown() error {
-	// Nothing to do here
-	return nil
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	if a.jrn == nil {
+		return nil
+	}
+	err := a.jrn.snapshot(a)
+	if cerr := a.jrn.close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
 func (a *AdrInt) HealthCheck() error {
@@ -4,13 +4,17 @@ import (
 	"encoding/json"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
 	"github.com/willie68/go-micro/pkg/pmodel"
 )
 
+const tenant = "tenant1"
+
 var (
-	madrs map[string]pmodel.Address
+	madrs map[string]map[string]pmodel.Address
 	adrs  []pmodel.Address
 )
 
@@ -24,38 +28,372 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
-	madrs = make(map[string]pmodel.Address)
+	madrs = map[string]map[string]pmodel.Address{
+		tenant: make(map[string]pmodel.Address),
+	}
 	for _, v := range adrs {
-		madrs[v.ID] = v
+		madrs[tenant][v.ID] = v
 	}
 }
 
 func TestAdrMdbList(t *testing.T) {
 	ast := assert.New(t)
-	stg := AdrInt{
+	stg := &AdrInt{
 		adrs: madrs,
 	}
 	ast.NotNil(stg)
 
-	as, err := stg.Addresses()
+	as, err := stg.Addresses(tenant, pmodel.Query{})
 	ast.Nil(err)
 	ast.NotNil(as)
-	ast.Len(as, 10)
+	ast.Len(as.Addresses, 10)
+}
+
+func TestAdrIntQuery(t *testing.T) {
+	ast := assert.New(t)
+	stg := &AdrInt{
+		adrs: madrs,
+	}
+
+	// paging through all addresses with the cursor and back
+	q := pmodel.Query{Limit: 4, Sort: []string{"-id"}}
+	ids := make([]string, 0)
+	prevs := make([]string, 0)
+	for {
+		p, err := stg.Addresses(tenant, q)
+		ast.Nil(err)
+		ast.Equal(10, p.Total)
+		for _, adr := range p.Addresses {
+			ids = append(ids, adr.ID)
+		}
+		prevs = append(prevs, p.Prev)
+		if p.Next == "" {
+			break
+		}
+		q.Cursor = p.Next
+	}
+	ast.Equal([]string{"9", "8", "7", "6", "5", "4", "3", "2", "10", "1"}, ids)
+	q.Cursor = prevs[2]
+	p, err := stg.Addresses(tenant, q)
+	ast.Nil(err)
+	ast.Len(p.Addresses, 4)
+	ast.Equal("5", p.Addresses[0].ID)
+	ast.Equal("2", p.Addresses[3].ID)
+
+	// offset
+	p, err = stg.Addresses(tenant, pmodel.Query{Limit: 3, Offset: 8})
+	ast.Nil(err)
+	ast.Len(p.Addresses, 2)
+	ast.Empty(p.Next)
+	ast.NotEmpty(p.Prev)
+
+	// filters
+	p, err = stg.Addresses(tenant, pmodel.Query{State: adrs[0].State})
+	ast.Nil(err)
+	for _, adr := range p.Addresses {
+		ast.Equal(adrs[0].State, adr.State)
+	}
+	ast.Equal(len(p.Addresses), p.Total)
+	p, err = stg.Addresses(tenant, pmodel.Query{City: adrs[0].City, ZipCode: adrs[0].ZipCode})
+	ast.Nil(err)
+	ast.Contains(p.Addresses, adrs[0])
+
+	stg, _ = NewAdrInt()
+	for _, n := range []string{"Smith", "Smithson", "Miller", "Schmidt"} {
+		_, err = stg.Create(tenant, pmodel.Address{Name: n}, "tester")
+		ast.Nil(err)
+	}
+	p, err = stg.Addresses(tenant, pmodel.Query{Name: "Smith", Sort: []string{"-name"}})
+	ast.Nil(err)
+	ast.Len(p.Addresses, 2)
+	ast.Equal("Smithson", p.Addresses[0].Name)
+
+	// the filters are case insensitive, like with the sql storages
+	p, err = stg.Addresses(tenant, pmodel.Query{Name: "smi"})
+	ast.Nil(err)
+	ast.Len(p.Addresses, 2)
+	_, err = stg.Create(tenant, pmodel.Address{Name: "Maier", City: "Anytown", State: "CA", ZipCode: "ab12"}, "tester")
+	ast.Nil(err)
+	p, err = stg.Addresses(tenant, pmodel.Query{City: "ANYTOWN", State: "ca", ZipCode: "AB12"})
+	ast.Nil(err)
+	ast.Len(p.Addresses, 1)
+
+	_, err = stg.Addresses(tenant, pmodel.Query{Cursor: "muck"})
+	ast.ErrorIs(err, pmodel.ErrInvalidQuery)
 }
 
 func TestAdrMdbRead(t *testing.T) {
 	ast := assert.New(t)
-	stg := AdrInt{
+	stg := &AdrInt{
 		adrs: madrs,
 	}
 	ast.NotNil(stg)
 
-	as, err := stg.Read("4")
+	as, err := stg.Read(tenant, "4")
 	ast.Nil(err)
 	ast.NotNil(as)
 	ast.Equal("4", as.ID)
 }
 
+func TestAdrIntTenants(t *testing.T) {
+	ast := assert.New(t)
+	stg, err := NewAdrInt()
+	ast.Nil(err)
+
+	id, err := stg.Create(tenant, adrs[0], "tester")
+	ast.Nil(err)
+	ast.True(stg.Has(tenant, id))
+
+	// other tenants don't see the address
+	ast.False(stg.Has("tenant2", id))
+	_, err = stg.Read("tenant2", id)
+	ast.ErrorIs(err, common.ErrNotFound)
+	adr := adrs[1]
+	adr.ID = id
+	_, err = stg.Update("tenant2", adr, 0, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+	_, err = stg.Delete("tenant2", id, 0, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+	p, err := stg.Addresses("tenant2", pmodel.Query{})
+	ast.Nil(err)
+	ast.Empty(p.Addresses)
+
+	p, err = stg.Addresses(tenant, pmodel.Query{})
+	ast.Nil(err)
+	ast.Len(p.Addresses, 1)
+	_, err = stg.Delete(tenant, id, 0, "tester")
+	ast.Nil(err)
+}
+
+func TestAdrIntVersion(t *testing.T) {
+	ast := assert.New(t)
+	stg, err := NewAdrInt()
+	ast.Nil(err)
+
+	id, err := stg.Create(tenant, adrs[0], "tester")
+	ast.Nil(err)
+	adr, err := stg.Read(tenant, id)
+	ast.Nil(err)
+	ast.Equal(common.FirstVersion, adr.Version)
+
+	adr.City = "Othertown"
+	v, err := stg.Update(tenant, *adr, adr.Version, "tester")
+	ast.Nil(err)
+	ast.Equal(2, v)
+
+	// the old version is outdated
+	_, err = stg.Update(tenant, *adr, adr.Version, "tester")
+	ast.ErrorIs(err, common.ErrVersionConflict)
+	_, err = stg.Delete(tenant, id, adr.Version, "tester")
+	ast.ErrorIs(err, common.ErrVersionConflict)
+	_, err = stg.Update(tenant, *adr, 42, "tester")
+	ast.ErrorIs(err, common.ErrVersionConflict)
+
+	// without version the address is always updated
+	v, err = stg.Update(tenant, *adr, 0, "tester")
+	ast.Nil(err)
+	ast.Equal(3, v)
+	adr, err = stg.Read(tenant, id)
+	ast.Nil(err)
+	ast.Equal(3, adr.Version)
+	ast.Equal("Othertown", adr.City)
+
+	_, err = stg.Delete(tenant, id, 3, "tester")
+	ast.Nil(err)
+	ast.False(stg.Has(tenant, id))
+}
+
+func TestAdrIntSearch(t *testing.T) {
+	ast := assert.New(t)
+	stg, err := NewAdrInt()
+	ast.Nil(err)
+	ids := make([]string, 0)
+	for _, n := range []string{"Meier", "Mayer", "Schmidt", "Müller"} {
+		id, err := stg.Create(tenant, pmodel.Address{Name: n, City: "Köln"}, "tester")
+		ast.Nil(err)
+		ids = append(ids, id)
+	}
+
+	p, err := stg.Search(tenant, pmodel.SearchQuery{Q: "maier", Limit: 1})
+	ast.Nil(err)
+	ast.Equal(2, p.Total)
+	ast.Len(p.Hits, 1)
+	p, err = stg.Search(tenant, pmodel.SearchQuery{Q: "mueller koeln"})
+	ast.Nil(err)
+	ast.Len(p.Hits, 1)
+	ast.Equal(ids[3], p.Hits[0].Address.ID)
+	p, err = stg.Search("tenant2", pmodel.SearchQuery{Q: "mueller"})
+	ast.Nil(err)
+	ast.Empty(p.Hits)
+
+	// the index follows the changes
+	_, err = stg.Update(tenant, pmodel.Address{ID: ids[2], Name: "Schmitt", City: "Bonn"}, 0, "tester")
+	ast.Nil(err)
+	_, err = stg.Delete(tenant, ids[0], 0, "tester")
+	ast.Nil(err)
+	p, err = stg.Search(tenant, pmodel.SearchQuery{Q: "köln"})
+	ast.Nil(err)
+	ast.Equal(2, p.Total)
+	p, err = stg.Search(tenant, pmodel.SearchQuery{Q: "schmidt bonn"})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+	ast.Equal("Schmitt", p.Hits[0].Address.Name)
+
+	// the index of a filled storage is build on the first search
+	stg = &AdrInt{
+		adrs: madrs,
+	}
+	p, err = stg.Search(tenant, pmodel.SearchQuery{Q: "anytown"})
+	ast.Nil(err)
+	ast.NotEmpty(p.Hits)
+}
+
+func TestAdrIntTrash(t *testing.T) {
+	ast := assert.New(t)
+	stg, err := NewAdrInt()
+	ast.Nil(err)
+	id, err := stg.Create(tenant, pmodel.Address{Name: "Meier", City: "Köln"}, "tester")
+	ast.Nil(err)
+	_, err = stg.Create(tenant, pmodel.Address{Name: "Schmidt", City: "Köln"}, "tester")
+	ast.Nil(err)
+
+	adr, err := stg.Delete(tenant, id, 0, "tester")
+	ast.Nil(err)
+	ast.Equal(2, adr.Version)
+	ast.NotNil(adr.DeletedAt)
+	ast.Equal("tester", adr.DeletedBy)
+
+	// deleted addresses are only in the trash
+	ast.False(stg.Has(tenant, id))
+	_, err = stg.Read(tenant, id)
+	ast.ErrorIs(err, common.ErrNotFound)
+	_, err = stg.Update(tenant, pmodel.Address{ID: id, Name: "Maier"}, 0, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+	_, err = stg.Delete(tenant, id, 0, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+	p, err := stg.Addresses(tenant, pmodel.Query{})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+	sp, err := stg.Search(tenant, pmodel.SearchQuery{Q: "meier"})
+	ast.Nil(err)
+	ast.Empty(sp.Hits)
+	p, err = stg.Trash(tenant, pmodel.Query{})
+	ast.Nil(err)
+	ast.Len(p.Addresses, 1)
+	ast.Equal(id, p.Addresses[0].ID)
+	ast.Equal("tester", p.Addresses[0].DeletedBy)
+	p, err = stg.Trash("tenant2", pmodel.Query{})
+	ast.Nil(err)
+	ast.Empty(p.Addresses)
+
+	adr, err = stg.Restore(tenant, id, "tester")
+	ast.Nil(err)
+	ast.Equal(3, adr.Version)
+	ast.Nil(adr.DeletedAt)
+	ast.Empty(adr.DeletedBy)
+	ast.True(stg.Has(tenant, id))
+	sp, err = stg.Search(tenant, pmodel.SearchQuery{Q: "meier"})
+	ast.Nil(err)
+	ast.Len(sp.Hits, 1)
+	_, err = stg.Restore(tenant, id, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+
+	// only addresses deleted before the time are purged
+	_, err = stg.Delete(tenant, id, 3, "tester")
+	ast.Nil(err)
+	n, err := stg.PurgeDeleted(time.Now().Add(-time.Hour))
+	ast.Nil(err)
+	ast.Equal(0, n)
+	n, err = stg.PurgeDeleted(time.Now().Add(time.Second))
+	ast.Nil(err)
+	ast.Equal(1, n)
+	p, err = stg.Trash(tenant, pmodel.Query{})
+	ast.Nil(err)
+	ast.Empty(p.Addresses)
+	_, err = stg.Restore(tenant, id, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+}
+
+func TestAdrIntPurge(t *testing.T) {
+	ast := assert.New(t)
+	stg, err := NewAdrInt()
+	ast.Nil(err)
+	id, err := stg.Create(tenant, pmodel.Address{Name: "Meier"}, "tester")
+	ast.Nil(err)
+
+	// addresses are purged deleted or not
+	_, err = stg.Purge(tenant, id, 2, "tester")
+	ast.ErrorIs(err, common.ErrVersionConflict)
+	adr, err := stg.Purge(tenant, id, common.FirstVersion, "tester")
+	ast.Nil(err)
+	ast.Equal("Meier", adr.Name)
+	ast.False(stg.Has(tenant, id))
+	sp, err := stg.Search(tenant, pmodel.SearchQuery{Q: "meier"})
+	ast.Nil(err)
+	ast.Empty(sp.Hits)
+
+	id, err = stg.Create(tenant, pmodel.Address{Name: "Meier"}, "tester")
+	ast.Nil(err)
+	_, err = stg.Delete(tenant, id, 0, "tester")
+	ast.Nil(err)
+	_, err = stg.Purge("tenant2", id, 0, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+	_, err = stg.Purge(tenant, id, 0, "tester")
+	ast.Nil(err)
+	_, err = stg.Restore(tenant, id, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+}
+
+func TestAdrIntHistory(t *testing.T) {
+	ast := assert.New(t)
+	stg, err := NewAdrInt()
+	ast.Nil(err)
+	id, err := stg.Create(tenant, pmodel.Address{Name: "Meier", City: "Köln"}, "creator")
+	ast.Nil(err)
+	_, err = stg.Update(tenant, pmodel.Address{ID: id, Name: "Maier", City: "Köln"}, 0, "updater")
+	ast.Nil(err)
+	_, err = stg.Delete(tenant, id, 0, "deleter")
+	ast.Nil(err)
+	_, err = stg.Restore(tenant, id, "restorer")
+	ast.Nil(err)
+	_, err = stg.Purge(tenant, id, 0, "purger")
+	ast.Nil(err)
+
+	// the history is kept after purging
+	revs, err := stg.History(tenant, id)
+	ast.Nil(err)
+	ast.Len(revs, 5)
+	for x, action := range []string{pmodel.ActionCreate, pmodel.ActionUpdate, pmodel.ActionDelete, pmodel.ActionRestore, pmodel.ActionPurge} {
+		ast.Equal(action, revs[x].Action)
+		ast.Equal(x+1, revs[x].Version)
+		ast.Equal(tenant, revs[x].Tenant)
+	}
+	ast.Equal("updater", revs[1].Actor)
+	ast.Equal([]pmodel.FieldChange{{Field: "name", Old: "Meier", New: "Maier"}}, revs[1].Changes)
+	ast.Len(revs[0].Changes, 2)
+	ast.Empty(revs[2].Changes)
+
+	// replaying the history
+	_, ok := pmodel.AddressAt(revs, revs[0].Time.Add(-time.Second))
+	ast.False(ok)
+	adr, ok := pmodel.AddressAt(revs, revs[0].Time)
+	ast.True(ok)
+	ast.Equal(pmodel.Address{ID: id, Name: "Meier", City: "Köln", Version: 1}, adr)
+	adr, ok = pmodel.AddressAt(revs, revs[1].Time)
+	ast.True(ok)
+	ast.Equal("Maier", adr.Name)
+	_, ok = pmodel.AddressAt(revs, revs[2].Time)
+	ast.False(ok)
+	adr, ok = pmodel.AddressAt(revs, revs[3].Time)
+	ast.True(ok)
+	ast.Equal(4, adr.Version)
+	_, ok = pmodel.AddressAt(revs, revs[4].Time)
+	ast.False(ok)
+
+	_, err = stg.History("tenant2", id)
+	ast.ErrorIs(err, common.ErrNotFound)
+}
+
 func TestAdrMdbCreate(t *testing.T) {
 	t.SkipNow()
 }
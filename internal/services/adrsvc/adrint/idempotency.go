@@ -0,0 +1,84 @@
+package adrint
+
+import (
+	"sync"
+	"time"
+
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+	"github.com/willie68/go-micro/internal/utils/ttlcache"
+)
+
+// Idempotency the internal storage of the responses of requests with an idempotency key, the entries are kept for the
+// ttl and removed automatically
+type Idempotency struct {
+	ttl   time.Duration
+	lease time.Duration
+	lock  sync.Mutex
+	cache *ttlcache.Cache[idemKey, reservation]
+}
+
+type idemKey struct {
+	tenant string
+	key    string
+}
+
+// reservation the entry of a key with the token of the request, which reserved it
+type reservation struct {
+	token string
+	entry common.IdempotencyEntry
+}
+
+// NewIdempotency create a new instance of the internal idempotency storage, a key is reserved for the lease
+func NewIdempotency(ttl, lease time.Duration) *Idempotency {
+	return &Idempotency{
+		ttl:   ttl,
+		lease: lease,
+		cache: ttlcache.New(ttlcache.WithTTL[idemKey, reservation](0), ttlcache.WithAutoDeletion[idemKey, reservation](time.Minute)),
+	}
+}
+
+// Reserve reserving the key of the tenant for a request with the token and the fingerprint for the lease. If the key
+// is already known, the stored entry is returned and false.
+func (i *Idempotency) Reserve(tenant, key, token, fingerprint string) (*common.IdempotencyEntry, bool, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	r, ok := i.cache.AddIfAbsent(idemKey{tenant: tenant, key: key}, reservation{token: token, entry: common.IdempotencyEntry{Fingerprint: fingerprint}}, i.lease)
+	if !ok {
+		return &r.entry, false, nil
+	}
+	return nil, true, nil
+}
+
+// Complete storing the response of the request with the reserved key, if the reservation of the token is still active
+func (i *Idempotency) Complete(tenant, key, token string, e common.IdempotencyEntry) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	k := idemKey{tenant: tenant, key: key}
+	if !i.reserved(k, token) {
+		return common.ErrReservationLost
+	}
+	i.cache.AddWithTTL(k, reservation{token: token, entry: e}, i.ttl)
+	return nil
+}
+
+// Release removing the reservation of the key with the token, so the request can be retried
+func (i *Idempotency) Release(tenant, key, token string) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	k := idemKey{tenant: tenant, key: key}
+	if i.reserved(k, token) {
+		i.cache.Delete(k)
+	}
+	return nil
+}
+
+// reserved checking if the key is reserved with the token and still in flight
+func (i *Idempotency) reserved(k idemKey, token string) bool {
+	r, ok := i.cache.Get(k)
+	return ok && r.token == token && r.entry.Status == 0
+}
+
+// Shutdown stopping the automatic deletion of the expired entries
+func (i *Idempotency) Shutdown() {
+	i.cache.Close()
+}
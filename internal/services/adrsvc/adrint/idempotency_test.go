@@ -0,0 +1,73 @@
+package adrint
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+)
+
+func TestIdempotency(t *testing.T) {
+	ast := assert.New(t)
+	stg := NewIdempotency(time.Second, time.Minute)
+	defer stg.Shutdown()
+
+	e, ok, err := stg.Reserve("tenant1", "key1", "token1", "fp1")
+	ast.Nil(err)
+	ast.True(ok)
+	ast.Nil(e)
+
+	// in flight
+	e, ok, err = stg.Reserve("tenant1", "key1", "token2", "fp1")
+	ast.Nil(err)
+	ast.False(ok)
+	ast.Equal("fp1", e.Fingerprint)
+	ast.Equal(0, e.Status)
+
+	// keys are separated by tenant
+	_, ok, _ = stg.Reserve("tenant2", "key1", "token3", "fp2")
+	ast.True(ok)
+
+	// only the owner of the reservation stores the response
+	ast.ErrorIs(stg.Complete("tenant1", "key1", "token2", common.IdempotencyEntry{Fingerprint: "fp1", Status: http.StatusOK}), common.ErrReservationLost)
+	ast.Nil(stg.Complete("tenant1", "key1", "token1", common.IdempotencyEntry{Fingerprint: "fp1", Status: http.StatusCreated, Body: []byte(`{"id":"1"}`)}))
+	e, ok, _ = stg.Reserve("tenant1", "key1", "token4", "fp1")
+	ast.False(ok)
+	ast.Equal(http.StatusCreated, e.Status)
+	ast.Equal(`{"id":"1"}`, string(e.Body))
+	ast.ErrorIs(stg.Complete("tenant1", "key1", "token1", common.IdempotencyEntry{Fingerprint: "fp1", Status: http.StatusOK}), common.ErrReservationLost)
+	ast.Nil(stg.Release("tenant1", "key1", "token1"))
+	_, ok, _ = stg.Reserve("tenant1", "key1", "token4", "fp1")
+	ast.False(ok)
+
+	ast.Nil(stg.Release("tenant2", "key1", "token3"))
+	_, ok, _ = stg.Reserve("tenant2", "key1", "token5", "fp2")
+	ast.True(ok)
+
+	// the window is over
+	time.Sleep(1500 * time.Millisecond)
+	_, ok, _ = stg.Reserve("tenant1", "key1", "token6", "fp3")
+	ast.True(ok)
+}
+
+func TestIdempotencyLease(t *testing.T) {
+	ast := assert.New(t)
+	stg := NewIdempotency(time.Minute, 100*time.Millisecond)
+	defer stg.Shutdown()
+
+	_, ok, _ := stg.Reserve("tenant1", "key1", "token1", "fp1")
+	ast.True(ok)
+
+	// the expired reservation is taken over, the first request can't store or release it anymore
+	time.Sleep(200 * time.Millisecond)
+	_, ok, _ = stg.Reserve("tenant1", "key1", "token2", "fp1")
+	ast.True(ok)
+	ast.ErrorIs(stg.Complete("tenant1", "key1", "token1", common.IdempotencyEntry{Fingerprint: "fp1", Status: http.StatusCreated}), common.ErrReservationLost)
+	ast.Nil(stg.Release("tenant1", "key1", "token1"))
+	e, ok, _ := stg.Reserve("tenant1", "key1", "token3", "fp1")
+	ast.False(ok)
+	ast.Equal(0, e.Status)
+	ast.Nil(stg.Complete("tenant1", "key1", "token2", common.IdempotencyEntry{Fingerprint: "fp1", Status: http.StatusCreated}))
+}
@@ -0,0 +1,241 @@
+package adrint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// defaultSnapshotEvery the default number of changes between two snapshots
+const defaultSnapshotEvery = 1000
+
+// journalSuffix the suffix of the journal file beside the snapshot file
+const journalSuffix = ".journal"
+
+// journal the persistence of the internal storage. Every change is appended to the journal as json line and synced,
+// before it's applied. After a number of changes the whole storage is written as snapshot and the journal is
+// truncated. The snapshot is written to a temporary file, synced and renamed, so a crash leaves either the old or the
+// new snapshot. Every change has an ascending sequence, changes of the journal already contained in the snapshot are
+// skipped on loading.
+type journal struct {
+	file    string
+	every   int
+	f       journalFile
+	seq     uint64
+	changes int
+	// err a failed change, which couldn't be removed from the journal, no further changes are accepted until the next
+	// snapshot
+	err error
+}
+
+// journalFile the opened journal, an *os.File
+type journalFile interface {
+	io.WriteSeeker
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// journalEntry one change, the revision and the stored address, nil for a purge
+type journalEntry struct {
+	Seq      uint64          `json:"seq"`
+	Revision pmodel.Revision `json:"revision"`
+	Address  *pmodel.Address `json:"address,omitempty"`
+}
+
+// snapshotData the whole storage with the sequence of the last contained change
+type snapshotData struct {
+	Seq       uint64                                  `json:"seq"`
+	Addresses map[string]map[string]pmodel.Address    `json:"addresses"`
+	Revisions map[string]map[string][]pmodel.Revision `json:"revisions"`
+}
+
+// openJournal loading the snapshot and the journal into the storage and opening the journal for appending
+func openJournal(file string, every int, a *AdrInt) (*journal, error) {
+	if every <= 0 {
+		every = defaultSnapshotEvery
+	}
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return nil, err
+	}
+	j := &journal{
+		file:  file,
+		every: every,
+	}
+	if err := j.loadSnapshot(a); err != nil {
+		return nil, err
+	}
+	if err := j.replay(a); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(file+journalSuffix, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	j.f = f
+	logger.Info(fmt.Sprintf("internal storage loaded from %s, %d changes replayed", file, j.changes))
+	return j, nil
+}
+
+func (j *journal) loadSnapshot(a *AdrInt) error {
+	data, err := os.ReadFile(j.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var sd snapshotData
+	if err := json.Unmarshal(data, &sd); err != nil {
+		return fmt.Errorf("can't read snapshot %s: %v", j.file, err)
+	}
+	if sd.Addresses != nil {
+		a.adrs = sd.Addresses
+	}
+	if sd.Revisions != nil {
+		a.revs = sd.Revisions
+	}
+	j.seq = sd.Seq
+	return nil
+}
+
+// replay applying the changes of the journal after the snapshot. A torn last line of a crash while appending is
+// removed, every other invalid line is an error.
+func (j *journal) replay(a *AdrInt) error {
+	f, err := os.OpenFile(j.file+journalSuffix, os.O_RDWR, 0o600)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				logger.Warn(fmt.Sprintf("removing incomplete last change of journal %s", j.file+journalSuffix))
+				return f.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var e journalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("can't read journal %s at offset %d: %v", j.file+journalSuffix, offset, err)
+		}
+		offset += int64(len(line))
+		if e.Seq <= j.seq {
+			continue
+		}
+		a.apply(e.Revision, e.Address)
+		j.seq = e.Seq
+		j.changes++
+	}
+}
+
+// append writing the change to the journal and syncing it to the disk. A failed write is truncated, so no partial
+// change is followed by the next one. If this fails, too, the journal is broken and rejects every further change.
+func (j *journal) append(rev pmodel.Revision, adr *pmodel.Address) error {
+	if j.err != nil {
+		return j.err
+	}
+	line, err := json.Marshal(journalEntry{Seq: j.seq + 1, Revision: rev, Address: adr})
+	if err != nil {
+		return err
+	}
+	offset, err := j.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if err := j.write(append(line, '\n')); err != nil {
+		if terr := j.f.Truncate(offset); terr != nil {
+			j.err = fmt.Errorf("journal %s is broken, can't remove failed change: %v", j.file+journalSuffix, terr)
+			logger.Error(j.err.Error())
+		}
+		return err
+	}
+	j.seq++
+	j.changes++
+	return nil
+}
+
+func (j *journal) write(line []byte) error {
+	if _, err := j.f.Write(line); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// due checking if a new snapshot should be written
+func (j *journal) due() bool {
+	return j.changes >= j.every
+}
+
+// snapshot writing the whole storage atomically into the snapshot file and truncating the journal. The write lock of
+// the storage must be held.
+func (j *journal) snapshot(a *AdrInt) error {
+	data, err := json.Marshal(snapshotData{Seq: j.seq, Addresses: a.adrs, Revisions: a.revs})
+	if err != nil {
+		return err
+	}
+	tmp := j.file + ".tmp"
+	if err := writeSynced(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.file); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(j.file))
+	// a crash before the truncation is fine, the changes are skipped by their sequence
+	if err := j.f.Truncate(0); err != nil {
+		return err
+	}
+	// a broken journal is repaired with the truncation
+	j.err = nil
+	j.changes = 0
+	return j.f.Sync()
+}
+
+func (j *journal) close() error {
+	return j.f.Close()
+}
+
+// writeSynced writing the data into the file and syncing it to the disk
+func writeSynced(file string, data []byte) error {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncing the directory, so a rename is durable. Not every os supports this, e.g. windows, so errors are
+// ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,277 @@
+package adrint
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+func TestAdrIntPersistence(t *testing.T) {
+	ast := assert.New(t)
+	file := filepath.Join(t.TempDir(), "data", "addresses.json")
+
+	stg, err := NewPersistentAdrInt(file, 0)
+	ast.Nil(err)
+	id1, err := stg.Create("tenant1", pmodel.Address{Name: "Smith", City: "Anytown"}, "tester")
+	ast.Nil(err)
+	id2, err := stg.Create("tenant1", pmodel.Address{Name: "Miller", City: "Othertown"}, "tester")
+	ast.Nil(err)
+	_, err = stg.Update("tenant1", pmodel.Address{ID: id1, Name: "Smith", City: "Newtown"}, 1, "tester")
+	ast.Nil(err)
+	_, err = stg.Delete("tenant1", id2, 0, "tester")
+	ast.Nil(err)
+	id3, err := stg.Create("tenant2", pmodel.Address{Name: "Schmitt"}, "tester")
+	ast.Nil(err)
+	_, err = stg.Purge("tenant2", id3, 0, "admin")
+	ast.Nil(err)
+	// a crash, the journal is not compacted
+	ast.Nil(stg.jrn.close())
+
+	stg, err = NewPersistentAdrInt(file, 0)
+	ast.Nil(err)
+	adr, err := stg.Read("tenant1", id1)
+	ast.Nil(err)
+	ast.Equal("Newtown", adr.City)
+	ast.Equal(2, adr.Version)
+	ast.False(stg.Has("tenant1", id2))
+	p, err := stg.Trash("tenant1", pmodel.Query{})
+	ast.Nil(err)
+	ast.Len(p.Addresses, 1)
+	ast.Equal("tester", p.Addresses[0].DeletedBy)
+	ast.False(stg.Has("tenant2", id3))
+	revs, err := stg.History("tenant2", id3)
+	ast.Nil(err)
+	ast.Len(revs, 2)
+	// the index is rebuilt
+	sp, err := stg.Search("tenant1", pmodel.SearchQuery{Q: "newtown"})
+	ast.Nil(err)
+	ast.Equal(1, sp.Total)
+
+	// the shutdown writes a snapshot and truncates the journal
+	ast.Nil(stg.Shutdown())
+	fi, err := os.Stat(file + journalSuffix)
+	ast.Nil(err)
+	ast.Equal(int64(0), fi.Size())
+
+	// after the shutdown the changes are rejected, like with a broken journal, reading is still possible
+	_, err = stg.Create("tenant1", pmodel.Address{Name: "Maier"}, "tester")
+	ast.ErrorIs(err, ErrClosed)
+	_, err = stg.Update("tenant1", pmodel.Address{ID: id1, Name: "Smith"}, 0, "tester")
+	ast.ErrorIs(err, ErrClosed)
+	_, err = stg.Delete("tenant1", id1, 0, "tester")
+	ast.ErrorIs(err, ErrClosed)
+	_, err = stg.Restore("tenant1", id2, "tester")
+	ast.ErrorIs(err, ErrClosed)
+	_, err = stg.Purge("tenant1", id2, 0, "tester")
+	ast.ErrorIs(err, ErrClosed)
+	_, err = stg.PurgeDeleted(time.Now())
+	ast.ErrorIs(err, ErrClosed)
+	adr, err = stg.Read("tenant1", id1)
+	ast.Nil(err)
+	ast.Equal("Newtown", adr.City)
+	ast.Nil(stg.Shutdown())
+
+	stg, err = NewPersistentAdrInt(file, 0)
+	ast.Nil(err)
+	defer stg.Shutdown()
+	adr, err = stg.Read("tenant1", id1)
+	ast.Nil(err)
+	ast.Equal("Newtown", adr.City)
+	revs, err = stg.History("tenant1", id1)
+	ast.Nil(err)
+	ast.Len(revs, 2)
+}
+
+func TestAdrIntSnapshot(t *testing.T) {
+	ast := assert.New(t)
+	file := filepath.Join(t.TempDir(), "addresses.json")
+
+	stg, err := NewPersistentAdrInt(file, 3)
+	ast.Nil(err)
+	ids := make([]string, 0)
+	for range 2 {
+		id, err := stg.Create("tenant1", pmodel.Address{Name: "Smith"}, "tester")
+		ast.Nil(err)
+		ids = append(ids, id)
+	}
+	_, err = os.Stat(file)
+	ast.True(os.IsNotExist(err))
+	journal, err := os.ReadFile(file + journalSuffix)
+	ast.Nil(err)
+
+	// the snapshot is written after the third change
+	id, err := stg.Create("tenant1", pmodel.Address{Name: "Smith"}, "tester")
+	ast.Nil(err)
+	ids = append(ids, id)
+	_, err = os.Stat(file)
+	ast.Nil(err)
+	fi, err := os.Stat(file + journalSuffix)
+	ast.Nil(err)
+	ast.Equal(int64(0), fi.Size())
+	ast.Nil(stg.jrn.close())
+
+	// a crash after the snapshot, but before the truncation of the journal
+	ast.Nil(os.WriteFile(file+journalSuffix, journal, 0o600))
+
+	stg, err = NewPersistentAdrInt(file, 3)
+	ast.Nil(err)
+	defer stg.Shutdown()
+	p, err := stg.Addresses("tenant1", pmodel.Query{})
+	ast.Nil(err)
+	ast.Equal(3, p.Total)
+	for _, id := range ids {
+		revs, err := stg.History("tenant1", id)
+		ast.Nil(err)
+		ast.Len(revs, 1)
+	}
+}
+
+func TestAdrIntTornJournal(t *testing.T) {
+	ast := assert.New(t)
+	file := filepath.Join(t.TempDir(), "addresses.json")
+
+	stg, err := NewPersistentAdrInt(file, 0)
+	ast.Nil(err)
+	id, err := stg.Create("tenant1", pmodel.Address{Name: "Smith"}, "tester")
+	ast.Nil(err)
+	ast.Nil(stg.jrn.close())
+
+	// a crash while appending the next change
+	f, err := os.OpenFile(file+journalSuffix, os.O_WRONLY|os.O_APPEND, 0o600)
+	ast.Nil(err)
+	_, err = f.WriteString(`{"seq":2,"revision":{"tenant":"ten`)
+	ast.Nil(err)
+	ast.Nil(f.Close())
+
+	stg, err = NewPersistentAdrInt(file, 0)
+	ast.Nil(err)
+	ast.True(stg.Has("tenant1", id))
+	_, err = stg.Update("tenant1", pmodel.Address{ID: id, Name: "Smith", City: "Anytown"}, 0, "tester")
+	ast.Nil(err)
+	ast.Nil(stg.jrn.close())
+
+	stg, err = NewPersistentAdrInt(file, 0)
+	ast.Nil(err)
+	defer stg.Shutdown()
+	adr, err := stg.Read("tenant1", id)
+	ast.Nil(err)
+	ast.Equal("Anytown", adr.City)
+
+	// a corrupt change in the middle is an error
+	other := filepath.Join(t.TempDir(), "other.json")
+	ast.Nil(os.WriteFile(other+journalSuffix, []byte("{invalid}\n{}\n"), 0o600))
+	_, err = NewPersistentAdrInt(other, 0)
+	ast.NotNil(err)
+}
+
+// failingFile a journal file, which writes only the half of the data, if failing, and can't truncate it
+type failingFile struct {
+	*os.File
+	fail      bool
+	truncFail bool
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if !f.fail {
+		return f.File.Write(p)
+	}
+	n, _ := f.File.Write(p[:len(p)/2])
+	return n, io.ErrShortWrite
+}
+
+func (f *failingFile) Truncate(size int64) error {
+	if f.truncFail {
+		return errors.New("truncate failed")
+	}
+	return f.File.Truncate(size)
+}
+
+func TestAdrIntFailedAppend(t *testing.T) {
+	ast := assert.New(t)
+	file := filepath.Join(t.TempDir(), "addresses.json")
+
+	stg, err := NewPersistentAdrInt(file, 0)
+	ast.Nil(err)
+	id, err := stg.Create("tenant1", pmodel.Address{Name: "Smith"}, "tester")
+	ast.Nil(err)
+	ff := &failingFile{File: stg.jrn.f.(*os.File), fail: true}
+	stg.jrn.f = ff
+
+	// the partial change is removed from the journal and not applied
+	_, err = stg.Update("tenant1", pmodel.Address{ID: id, Name: "Smith", City: "Anytown"}, 0, "tester")
+	ast.ErrorIs(err, io.ErrShortWrite)
+	adr, err := stg.Read("tenant1", id)
+	ast.Nil(err)
+	ast.Empty(adr.City)
+	ff.fail = false
+	_, err = stg.Update("tenant1", pmodel.Address{ID: id, Name: "Smith", City: "Othertown"}, 0, "tester")
+	ast.Nil(err)
+	ast.Nil(stg.jrn.close())
+
+	stg, err = NewPersistentAdrInt(file, 0)
+	ast.Nil(err)
+	adr, err = stg.Read("tenant1", id)
+	ast.Nil(err)
+	ast.Equal("Othertown", adr.City)
+	ast.Equal(2, adr.Version)
+
+	// if the partial change can't be removed, the journal rejects every further change
+	ff = &failingFile{File: stg.jrn.f.(*os.File), fail: true, truncFail: true}
+	stg.jrn.f = ff
+	_, err = stg.Create("tenant1", pmodel.Address{Name: "Miller"}, "tester")
+	ast.ErrorIs(err, io.ErrShortWrite)
+	ff.fail = false
+	_, err = stg.Create("tenant1", pmodel.Address{Name: "Miller"}, "tester")
+	ast.ErrorContains(err, "broken")
+
+	// the snapshot of the shutdown repairs it
+	ff.truncFail = false
+	ast.Nil(stg.Shutdown())
+	stg, err = NewPersistentAdrInt(file, 0)
+	ast.Nil(err)
+	defer stg.Shutdown()
+	p, err := stg.Addresses("tenant1", pmodel.Query{})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+	_, err = stg.Create("tenant1", pmodel.Address{Name: "Miller"}, "tester")
+	ast.Nil(err)
+}
+
+func TestAdrIntConcurrent(t *testing.T) {
+	ast := assert.New(t)
+	stg, err := NewPersistentAdrInt(filepath.Join(t.TempDir(), "addresses.json"), 10)
+	ast.Nil(err)
+	defer stg.Shutdown()
+
+	done := make(chan bool)
+	for range 4 {
+		go func() {
+			for range 25 {
+				id, err := stg.Create("tenant1", pmodel.Address{Name: "Smith"}, "tester")
+				ast.Nil(err)
+				_, err = stg.Update("tenant1", pmodel.Address{ID: id, Name: "Smith", City: "Anytown"}, 0, "tester")
+				ast.Nil(err)
+				_, err = stg.Addresses("tenant1", pmodel.Query{})
+				ast.Nil(err)
+			}
+			done <- true
+		}()
+	}
+	timeout := time.After(10 * time.Second)
+	for range 4 {
+		select {
+		case <-done:
+		case <-timeout:
+			t.Fatal("timeout")
+		}
+	}
+	p, err := stg.Addresses("tenant1", pmodel.Query{})
+	ast.Nil(err)
+	ast.Equal(100, p.Total)
+}
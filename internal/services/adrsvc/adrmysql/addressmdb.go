@@ -2,13 +2,17 @@ package adrmysql
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	// needed declaration
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+	"github.com/willie68/go-micro/internal/services/adrsvc/search"
 	"github.com/willie68/go-micro/pkg/pmodel"
 )
 
@@ -19,9 +23,24 @@ type Config struct {
 	Table    string `yaml:"table"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
+	// HistoryTable the table of the revisions of the addresses, default is the table with the suffix _history
+	HistoryTable string `yaml:"historytable"`
 }
 
-// AdrMdb this is the address mysql type
+// columns of an address, trashColumns with the columns of the deletion
+const (
+	columns      = "id, name, firstname, street, city, state, zip_code, country, version"
+	trashColumns = columns + ", deleted_at, deleted_by"
+)
+
+// conditions of the addresses and of the deleted addresses in the trash
+const (
+	notDeleted = "deleted_at IS NULL"
+	isDeleted  = "deleted_at IS NOT NULL"
+)
+
+// AdrMdb this is the address mysql type, the addresses of all tenants are stored in one table with a tenant column.
+// Deleted addresses stay in the table with the deletion time in deleted_at, until they are purged.
 type AdrMdb struct {
 	db   *sql.DB
 	mcfg Config
@@ -29,7 +48,7 @@ type AdrMdb struct {
 
 // NewAdrMdb creates a new AdrMdb isntance
 func NewAdrMdb(cfg Config) (*AdrMdb, error) {
-	d, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:3306)/%s", cfg.Username, cfg.Password, cfg.Host, cfg.Database))
+	d, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?parseTime=true", cfg.Username, cfg.Password, cfg.Host, cfg.Database))
 	if err != nil {
 		return nil, err
 	}
@@ -40,40 +59,169 @@ func NewAdrMdb(cfg Config) (*AdrMdb, error) {
 	return &am, nil
 }
 
-// Addresses list all addresses
-func (a *AdrMdb) Addresses() ([]pmodel.Address, error) {
-	addresses := []pmodel.Address{}
+// Addresses list one page of the filtered and sorted addresses of the tenant. Filtering, sorting and paging is done by the database,
+// schema.sql contains the matching indexes.
+func (a *AdrMdb) Addresses(tenant string, q pmodel.Query) (*pmodel.Page, error) {
+	return a.list(tenant, q, false)
+}
+
+// Trash list one page of the filtered and sorted deleted addresses of the tenant
+func (a *AdrMdb) Trash(tenant string, q pmodel.Query) (*pmodel.Page, error) {
+	return a.list(tenant, q, true)
+}
+
+// list one page of the addresses or of the deleted addresses of the tenant
+func (a *AdrMdb) list(tenant string, q pmodel.Query, deleted bool) (*pmodel.Page, error) {
+	order, err := common.SortOrder(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+	var cursor *common.Cursor
+	if q.Cursor != "" {
+		if cursor, err = common.ParseCursor(q.Cursor, order); err != nil {
+			return nil, err
+		}
+	}
+	conds, args := filter(tenant, q, deleted)
+	var total int
+	err = a.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s%s", a.mcfg.Table, where(conds)), args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	backward := false
+	if cursor != nil {
+		backward = cursor.Backward
+		cond, cargs := keyset(order, cursor)
+		conds = append(conds, cond)
+		args = append(args, cargs...)
+	}
+	sorts := make([]string, len(order))
+	for x, o := range order {
+		sorts[x] = o.Field + " ASC"
+		if o.Desc != backward {
+			sorts[x] = o.Field + " DESC"
+		}
+	}
+	cols := columns
+	if deleted {
+		cols = trashColumns
+	}
+	stmt := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT ?", cols, a.mcfg.Table, where(conds), strings.Join(sorts, ", "))
+	args = append(args, q.PageSize()+1)
+	if cursor == nil && q.Offset > 0 {
+		stmt += " OFFSET ?"
+		args = append(args, q.Offset)
+	}
 
-	rows, err := a.db.Query(fmt.Sprintf("SELECT id, name, firstname, street, city, state, zip_code FROM %s", a.mcfg.Table))
+	addresses := []pmodel.Address{}
+	rows, err := a.db.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var address pmodel.Address
-		err := rows.Scan(&address.ID, &address.Name, &address.Firstname, &address.Street, &address.City, &address.State, &address.ZipCode)
+		address, err := scan(rows, deleted)
 		if err != nil {
 			return nil, err
 		}
 		addresses = append(addresses, address)
 	}
-	return addresses, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return common.NewPage(addresses, q, order, cursor, total), nil
+}
+
+// scanner the row of a query
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scan scanning the columns of an address, with deleted the trash columns
+func scan(row scanner, deleted bool) (pmodel.Address, error) {
+	var adr pmodel.Address
+	var at sql.NullTime
+	dest := []any{&adr.ID, &adr.Name, &adr.Firstname, &adr.Street, &adr.City, &adr.State, &adr.ZipCode, &adr.Country, &adr.Version}
+	if deleted {
+		dest = append(dest, &at, &adr.DeletedBy)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return adr, err
+	}
+	if at.Valid {
+		adr.DeletedAt = &at.Time
+	}
+	return adr, nil
 }
 
-// Has checking if an adress is present
-func (a *AdrMdb) Has(id string) bool {
+// likeEscaper escaping the wildcards of a like pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// filter building the conditions of the tenant, the deletion and the query filters. The filters are compared case
+// insensitive by the default _ci collation of the columns.
+func filter(tenant string, q pmodel.Query, deleted bool) ([]string, []any) {
+	conds := []string{"tenant=?", notDeleted}
+	if deleted {
+		conds[1] = isDeleted
+	}
+	args := []any{tenant}
+	eq := func(col, v string) {
+		if v != "" {
+			conds = append(conds, col+"=?")
+			args = append(args, v)
+		}
+	}
+	eq("city", q.City)
+	eq("state", q.State)
+	eq("zip_code", q.ZipCode)
+	if q.Name != "" {
+		conds = append(conds, "name LIKE ?")
+		args = append(args, likeEscaper.Replace(q.Name)+"%")
+	}
+	return conds, args
+}
+
+// keyset building the condition for all rows behind the cursor position in the sort order, or before for a backward
+// cursor: (f1 > v1) OR (f1 = v1 AND f2 > v2) OR ...
+func keyset(order []common.SortField, cursor *common.Cursor) (string, []any) {
+	ors := make([]string, 0, len(order))
+	args := make([]any, 0)
+	for x, o := range order {
+		ands := make([]string, 0, x+1)
+		for y := 0; y < x; y++ {
+			ands = append(ands, order[y].Field+"=?")
+			args = append(args, cursor.Values[y])
+		}
+		op := ">"
+		if o.Desc != cursor.Backward {
+			op = "<"
+		}
+		ands = append(ands, o.Field+op+"?")
+		args = append(args, cursor.Values[x])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+func where(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// Has checking if an adress of the tenant is present
+func (a *AdrMdb) Has(tenant, id string) bool {
 	var mid string
-	err := a.db.QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE id=?", a.mcfg.Table), id).Scan(&mid)
+	err := a.db.QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE tenant=? AND id=? AND %s", a.mcfg.Table, notDeleted), tenant, id).Scan(&mid)
 	return err == nil
 }
 
-// Read getting the address with id
-func (a *AdrMdb) Read(id string) (*pmodel.Address, error) {
-	var address pmodel.Address
-
-	err := a.db.QueryRow(fmt.Sprintf("SELECT id, name, firstname, street, city, state, zip_code FROM %s WHERE id=?", a.mcfg.Table), id).Scan(
-		&address.ID, &address.Name, &address.Firstname, &address.Street, &address.City, &address.State, &address.ZipCode)
+// Read getting the address of the tenant with id
+func (a *AdrMdb) Read(tenant, id string) (*pmodel.Address, error) {
+	address, err := scan(a.db.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE tenant=? AND id=? AND %s", columns, a.mcfg.Table, notDeleted), tenant, id), false)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, common.ErrNotFound
@@ -83,10 +231,15 @@ func (a *AdrMdb) Read(id string) (*pmodel.Address, error) {
 	return &address, nil
 }
 
-// Create creates a new Address
-func (a *AdrMdb) Create(adr pmodel.Address) (string, error) {
-	result, err := a.db.Exec(fmt.Sprintf("INSERT INTO %s (name, firstname, street, city, state, zip_code) VALUES (?, ?, ?, ?, ?, ?)",
-		a.mcfg.Table), adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode)
+// Create creates a new Address for the tenant, the user is recorded as actor
+func (a *AdrMdb) Create(tenant string, adr pmodel.Address, user string) (string, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (tenant, name, firstname, street, city, state, zip_code, country, phonetic, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		a.mcfg.Table), tenant, adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode, adr.Country, search.PrefixedCodes(adr), common.FirstVersion)
 
 	if err != nil {
 		return "", err
@@ -94,25 +247,280 @@ func (a *AdrMdb) Create(adr pmodel.Address) (string, error) {
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		return "", nil
+		return "", err
+	}
+	adr.ID = strconv.FormatInt(id, 10)
+	adr.Version = common.FirstVersion
+	if err := a.record(tx, tenant, pmodel.ActionCreate, user, pmodel.Diff(pmodel.Address{}, adr), adr); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
 	}
+	return adr.ID, nil
+}
 
-	return strconv.FormatInt(id, 10), nil
+// Update updates the address of the tenant, if the stored address still has the version, 0 updates any version.
+// The user is recorded as actor. Returns the new version of the address.
+func (a *AdrMdb) Update(tenant string, adr pmodel.Address, version int, user string) (int, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	old, err := a.lock(tx, tenant, adr.ID, notDeleted, version)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET name=?, firstname=?, street=?, city=?, state=?, zip_code=?, country=?, phonetic=?, version=? WHERE tenant=? AND id=?", a.mcfg.Table),
+		adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode, adr.Country, search.PrefixedCodes(adr), old.Version+1, tenant, adr.ID)
+	if err != nil {
+		return 0, err
+	}
+	adr.Version = old.Version + 1
+	if err := a.record(tx, tenant, pmodel.ActionUpdate, user, pmodel.Diff(old, adr), adr); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return old.Version + 1, nil
 }
 
-// Update updates the address
-func (a *AdrMdb) Update(adr pmodel.Address) error {
-	_, err := a.db.Exec(fmt.Sprintf("UPDATE %s SET name=?, firstname=?, street=?, city=?, state=?, zip_code=? WHERE id=?", a.mcfg.Table), adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode, adr.ID)
+// Delete moves the address of the tenant with id into the trash, if the stored address still has the version, 0
+// deletes any version. The user is stored as the deleting user. Returns the deleted address.
+func (a *AdrMdb) Delete(tenant, id string, version int, user string) (*pmodel.Address, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	adr, err := a.lock(tx, tenant, id, notDeleted, version)
+	if err != nil {
+		return nil, err
+	}
+	at := now()
+	adr.Version++
+	adr.DeletedAt, adr.DeletedBy = &at, user
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET deleted_at=?, deleted_by=?, version=? WHERE tenant=? AND id=?", a.mcfg.Table), at, user, adr.Version, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.record(tx, tenant, pmodel.ActionDelete, user, nil, adr); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &adr, nil
+}
 
-	return err
+// Restore restores the deleted address of the tenant with id from the trash, the user is recorded as actor. Returns
+// the restored address.
+func (a *AdrMdb) Restore(tenant, id, user string) (*pmodel.Address, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	adr, err := a.lock(tx, tenant, id, isDeleted, 0)
+	if err != nil {
+		return nil, err
+	}
+	adr.Version++
+	adr.DeletedAt, adr.DeletedBy = nil, ""
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET deleted_at=NULL, deleted_by='', version=? WHERE tenant=? AND id=?", a.mcfg.Table), adr.Version, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.record(tx, tenant, pmodel.ActionRestore, user, nil, adr); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &adr, nil
+}
+
+// Purge deletes the address of the tenant with id permanently, deleted or not, if the stored address still has the
+// version, 0 deletes any version. The user is recorded as actor, the revisions are kept. Returns the purged address.
+func (a *AdrMdb) Purge(tenant, id string, version int, user string) (*pmodel.Address, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	adr, err := a.lock(tx, tenant, id, "", version)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE tenant=? AND id=?", a.mcfg.Table), tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.record(tx, tenant, pmodel.ActionPurge, user, nil, pmodel.Address{ID: id, Version: adr.Version + 1}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &adr, nil
+}
+
+// PurgeDeleted deletes all addresses of all tenants permanently, which are deleted before the time, the revisions are
+// kept. Returns the number of purged addresses.
+func (a *AdrMdb) PurgeDeleted(before time.Time) (int, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (tenant, address_id, version, action, actor, changed_at, changes) SELECT tenant, id, version+1, ?, ?, ?, '[]' FROM %s WHERE deleted_at < ?",
+		a.historyTable(), a.mcfg.Table), pmodel.ActionPurge, common.SystemActor, now(), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE deleted_at < ?", a.mcfg.Table), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// now the current time with the precision of the time columns
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// historyTable the name of the table of the revisions
+func (a *AdrMdb) historyTable() string {
+	if a.mcfg.HistoryTable != "" {
+		return a.mcfg.HistoryTable
+	}
+	return a.mcfg.Table + "_history"
 }
 
-// Delete deletes the address with id
-func (a *AdrMdb) Delete(id string) error {
-	_, err := a.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id=?", a.mcfg.Table), id)
+// record inserting the revision of the change of the address with the changes of the fields, nil for none
+func (a *AdrMdb) record(tx *sql.Tx, tenant, action, user string, changes []pmodel.FieldChange, adr pmodel.Address) error {
+	if changes == nil {
+		changes = []pmodel.FieldChange{}
+	}
+	byt, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (tenant, address_id, version, action, actor, changed_at, changes) VALUES (?, ?, ?, ?, ?, ?, ?)", a.historyTable()),
+		tenant, adr.ID, adr.Version, action, user, now(), string(byt))
 	return err
 }
 
+// History getting the revisions of the address of the tenant with id, sorted by version. The revisions of deleted
+// and purged addresses are kept.
+func (a *AdrMdb) History(tenant, id string) ([]pmodel.Revision, error) {
+	rows, err := a.db.Query(fmt.Sprintf("SELECT version, action, actor, changed_at, changes FROM %s WHERE tenant=? AND address_id=? ORDER BY version", a.historyTable()), tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revs := make([]pmodel.Revision, 0)
+	for rows.Next() {
+		r := pmodel.Revision{Tenant: tenant, ID: id}
+		var changes string
+		if err := rows.Scan(&r.Version, &r.Action, &r.Actor, &r.Time, &changes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &r.Changes); err != nil {
+			return nil, err
+		}
+		revs = append(revs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(revs) == 0 {
+		return nil, common.ErrNotFound
+	}
+	return revs, nil
+}
+
+// lock locking the row of the address until the end of the transaction and checking the version, returns the
+// stored address. The address must match the optional condition.
+func (a *AdrMdb) lock(tx *sql.Tx, tenant, id, cond string, version int) (pmodel.Address, error) {
+	stmt := fmt.Sprintf("SELECT %s FROM %s WHERE tenant=? AND id=?", trashColumns, a.mcfg.Table)
+	if cond != "" {
+		stmt += " AND " + cond
+	}
+	old, err := scan(tx.QueryRow(stmt+" FOR UPDATE", tenant, id), true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return old, common.ErrNotFound
+		}
+		return old, err
+	}
+	if version != 0 && old.Version != version {
+		return old, common.ErrVersionConflict
+	}
+	return old, nil
+}
+
+// against building the boolean fulltext query, every term must match as prefix or by its phonetic code. The terms
+// are not folded, the collation of the table decides about umlauts.
+func against(q string) string {
+	terms := search.Words(q)
+	parts := make([]string, len(terms))
+	for x, t := range terms {
+		parts[x] = "+(" + t + "*"
+		if c := search.Cologne(t); c != "" {
+			parts[x] += " " + search.CodePrefix + c
+		}
+		parts[x] += ")"
+	}
+	return strings.Join(parts, " ")
+}
+
+// Search searching the addresses of the tenant with the fulltext index, ranked by the relevance of mysql. Typos are
+// only tolerated as far as the phonetic code is the same.
+func (a *AdrMdb) Search(tenant string, q pmodel.SearchQuery) (*pmodel.SearchPage, error) {
+	p := pmodel.SearchPage{
+		Hits: []pmodel.SearchHit{},
+	}
+	ag := against(q.Q)
+	if ag == "" {
+		return &p, nil
+	}
+	match := "MATCH(name, firstname, street, city, phonetic) AGAINST (? IN BOOLEAN MODE)"
+	err := a.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE tenant=? AND %s AND %s", a.mcfg.Table, notDeleted, match), tenant, ag).Scan(&p.Total)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := a.db.Query(fmt.Sprintf("SELECT %s, %s AS score FROM %s WHERE tenant=? AND %s AND %s ORDER BY score DESC, id LIMIT ? OFFSET ?",
+		columns, match, a.mcfg.Table, notDeleted, match), ag, tenant, ag, q.PageSize(), q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h pmodel.SearchHit
+		adr := &h.Address
+		err := rows.Scan(&adr.ID, &adr.Name, &adr.Firstname, &adr.Street, &adr.City, &adr.State, &adr.ZipCode, &adr.Country, &adr.Version, &h.Score)
+		if err != nil {
+			return nil, err
+		}
+		p.Hits = append(p.Hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
 // CheckName should return the name of this healthcheck. The name should be unique.
 func (a *AdrMdb) CheckName() string {
 	return "mysql"
@@ -1,18 +1,40 @@
 package adrmysql
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+	"github.com/willie68/go-micro/internal/services/adrsvc/search"
 	"github.com/willie68/go-micro/pkg/pmodel"
 )
 
+const tenant = "tenant1"
+
 var adrs []pmodel.Address
 
+// lockStmt the locking of an address, which is not deleted
+const lockStmt = "SELECT id, name, firstname, street, city, state, zip_code, country, version, deleted_at, deleted_by FROM address WHERE tenant=? AND id=? AND deleted_at IS NULL FOR UPDATE"
+
+// expectRecord expecting the insert of the revision of the address by the tester
+func expectRecord(mock sqlmock.Sqlmock, id string, version int, action, changes string) {
+	mock.ExpectExec("INSERT INTO address_history (tenant, address_id, version, action, actor, changed_at, changes) VALUES (?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(tenant, id, version, action, "tester", sqlmock.AnyArg(), changes).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// lockRows the result of a locking select of the address with the version
+func lockRows(adr pmodel.Address, version int) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "name", "firstname", "street", "city", "state", "zip_code", "country", "version", "deleted_at", "deleted_by"}).
+		AddRow(adr.ID, adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode, adr.Country, version, nil, "")
+}
+
 func init() {
 	data, err := os.ReadFile("../../../../testdata/addresses.json")
 	if err != nil {
@@ -47,17 +69,71 @@ func TestAdrMdbList(t *testing.T) {
 	ast.NotNil(stg)
 
 	// List
-	rows := sqlmock.NewRows([]string{"id", "lastname", "firstname", "street", "city", "state", "zip_code"})
+	rows := sqlmock.NewRows([]string{"id", "lastname", "firstname", "street", "city", "state", "zip_code", "country", "version"})
 	for _, adr := range adrs {
-		str := fmt.Sprintf("%s, %s, %s, %s, %s, %s, %s ", adr.ID, adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode)
+		str := fmt.Sprintf("%s, %s, %s, %s, %s, %s, %s, %s, 1", adr.ID, adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode, adr.Country)
 		rows = rows.FromCSVString(str)
 	}
-	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code FROM address").WillReturnRows(rows)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM address").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code, country, version FROM address").WillReturnRows(rows)
 
-	as, err := stg.Addresses()
+	as, err := stg.Addresses(tenant, pmodel.Query{})
 	ast.Nil(err)
 	ast.NotNil(as)
-	ast.Len(as, 10)
+	ast.Len(as.Addresses, 10)
+	ast.Equal(10, as.Total)
+	ast.Empty(as.Next)
+}
+
+func TestAdrMdbQuery(t *testing.T) {
+	ast := assert.New(t)
+	sdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer sdb.Close()
+
+	stg := AdrMdb{
+		db:   sdb,
+		mcfg: Config{Table: "address"},
+	}
+	q := pmodel.Query{Limit: 2, City: "Anytown", Name: "Sm_", Sort: []string{"-name"}}
+	order, err := common.SortOrder(q.Sort)
+	ast.Nil(err)
+	q.Cursor = common.NewCursor(order, pmodel.Address{ID: "7", Name: "Smith"}, false)
+
+	mock.ExpectQuery("SELECT COUNT(*) FROM address WHERE tenant=? AND deleted_at IS NULL AND city=? AND name LIKE ?").
+		WithArgs(tenant, "Anytown", `Sm\_%`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	rows := sqlmock.NewRows([]string{"id", "name", "firstname", "street", "city", "state", "zip_code", "country", "version"}).
+		AddRow("3", "Sm_a", "", "", "Anytown", "", "", "", 1).
+		AddRow("5", "Sm_a", "", "", "Anytown", "", "", "", 1).
+		AddRow("1", "Sm_", "", "", "Anytown", "", "", "", 1)
+	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code, country, version FROM address WHERE tenant=? AND deleted_at IS NULL AND city=? AND name LIKE ? AND ((name<?) OR (name=? AND id>?)) ORDER BY name DESC, id ASC LIMIT ?").
+		WithArgs(tenant, "Anytown", `Sm\_%`, "Smith", "Smith", "7", 3).
+		WillReturnRows(rows)
+
+	p, err := stg.Addresses(tenant, q)
+	ast.Nil(err)
+	ast.Equal(5, p.Total)
+	ast.Len(p.Addresses, 2)
+	ast.NotEmpty(p.Next)
+	ast.NotEmpty(p.Prev)
+
+	// the previous page is read backward
+	q.Cursor = p.Prev
+	mock.ExpectQuery("SELECT COUNT(*) FROM address WHERE tenant=? AND deleted_at IS NULL AND city=? AND name LIKE ?").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code, country, version FROM address WHERE tenant=? AND deleted_at IS NULL AND city=? AND name LIKE ? AND ((name>?) OR (name=? AND id<?)) ORDER BY name ASC, id DESC LIMIT ?").
+		WithArgs(tenant, "Anytown", `Sm\_%`, "Sm_a", "Sm_a", "3", 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "firstname", "street", "city", "state", "zip_code", "country", "version"}))
+	p, err = stg.Addresses(tenant, q)
+	ast.Nil(err)
+	ast.Empty(p.Addresses)
+
+	_, err = stg.Addresses(tenant, pmodel.Query{Sort: []string{"password"}})
+	ast.ErrorIs(err, pmodel.ErrInvalidQuery)
+	ast.Nil(mock.ExpectationsWereMet())
 }
 
 func TestAdrMdbRead(t *testing.T) {
@@ -82,18 +158,277 @@ func TestAdrMdbRead(t *testing.T) {
 	ast.NotNil(stg)
 
 	// List
-	rows := sqlmock.NewRows([]string{"id", "lastname", "firstname", "street", "city", "state", "zip_code"})
+	rows := sqlmock.NewRows([]string{"id", "lastname", "firstname", "street", "city", "state", "zip_code", "country", "version"})
 	adr := adrs[3]
-	str := fmt.Sprintf("%s, %s, %s, %s, %s, %s, %s ", adr.ID, adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode)
+	str := fmt.Sprintf("%s, %s, %s, %s, %s, %s, %s, %s, 1", adr.ID, adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode, adr.Country)
 	rows = rows.FromCSVString(str)
-	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code FROM address WHERE id=?").WillReturnRows(rows)
+	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code, country, version FROM address WHERE tenant=\\? AND id=\\?").WithArgs(tenant, "4").WillReturnRows(rows)
 
-	as, err := stg.Read("4")
+	as, err := stg.Read(tenant, "4")
 	ast.Nil(err)
 	ast.NotNil(as)
 	ast.Equal("4", as.ID)
 }
 
+func TestAdrMdbTenants(t *testing.T) {
+	ast := assert.New(t)
+	sdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer sdb.Close()
+
+	stg := AdrMdb{
+		db:   sdb,
+		mcfg: Config{Table: "address"},
+	}
+	adr := adrs[3]
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO address (tenant, name, firstname, street, city, state, zip_code, country, phonetic, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(tenant, adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode, adr.Country, search.PrefixedCodes(adr), common.FirstVersion).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	expectRecord(mock, "4", common.FirstVersion, pmodel.ActionCreate, `[{"field":"firstname","old":"","new":"Emily"},{"field":"street","old":"","new":"101 Elm St"},{"field":"city","old":"","new":"Yourtown"},{"field":"state","old":"","new":"FL"},{"field":"zip_code","old":"","new":"98765"}]`)
+	mock.ExpectCommit()
+	id, err := stg.Create(tenant, adr, "tester")
+	ast.Nil(err)
+	ast.Equal("4", id)
+
+	// addresses of other tenants are not found
+	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code, country, version FROM address WHERE tenant=? AND id=? AND deleted_at IS NULL").
+		WithArgs("tenant2", "4").
+		WillReturnError(sql.ErrNoRows)
+	_, err = stg.Read("tenant2", "4")
+	ast.ErrorIs(err, common.ErrNotFound)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockStmt).
+		WithArgs("tenant2", "4").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	_, err = stg.Update("tenant2", adr, 0, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockStmt).
+		WithArgs("tenant2", "4").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	_, err = stg.Delete("tenant2", "4", 0, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockStmt).
+		WithArgs(tenant, "4").
+		WillReturnRows(lockRows(adr, 1))
+	mock.ExpectExec("UPDATE address SET deleted_at=?, deleted_by=?, version=? WHERE tenant=? AND id=?").
+		WithArgs(sqlmock.AnyArg(), "tester", 2, tenant, "4").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectRecord(mock, "4", 2, pmodel.ActionDelete, "[]")
+	mock.ExpectCommit()
+	_, err = stg.Delete(tenant, "4", 0, "tester")
+	ast.Nil(err)
+	ast.Nil(mock.ExpectationsWereMet())
+}
+
+func TestAdrMdbVersion(t *testing.T) {
+	ast := assert.New(t)
+	sdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer sdb.Close()
+
+	stg := AdrMdb{
+		db:   sdb,
+		mcfg: Config{Table: "address"},
+	}
+	adr := adrs[3]
+
+	// the version is checked and counted up in one transaction
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockStmt).
+		WithArgs(tenant, "4").
+		WillReturnRows(lockRows(adr, 3))
+	mock.ExpectExec("UPDATE address SET name=?, firstname=?, street=?, city=?, state=?, zip_code=?, country=?, phonetic=?, version=? WHERE tenant=? AND id=?").
+		WithArgs(adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode, adr.Country, search.PrefixedCodes(adr), 4, tenant, "4").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectRecord(mock, "4", 4, pmodel.ActionUpdate, "[]")
+	mock.ExpectCommit()
+	v, err := stg.Update(tenant, adr, 3, "tester")
+	ast.Nil(err)
+	ast.Equal(4, v)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockStmt).
+		WithArgs(tenant, "4").
+		WillReturnRows(lockRows(adr, 4))
+	mock.ExpectRollback()
+	_, err = stg.Update(tenant, adr, 3, "tester")
+	ast.ErrorIs(err, common.ErrVersionConflict)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockStmt).
+		WithArgs(tenant, "4").
+		WillReturnRows(lockRows(adr, 4))
+	mock.ExpectRollback()
+	_, err = stg.Delete(tenant, "4", 3, "tester")
+	ast.ErrorIs(err, common.ErrVersionConflict)
+	ast.Nil(mock.ExpectationsWereMet())
+}
+
+func TestAdrMdbSearch(t *testing.T) {
+	ast := assert.New(t)
+	sdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer sdb.Close()
+
+	stg := AdrMdb{
+		db:   sdb,
+		mcfg: Config{Table: "address"},
+	}
+	ast.Equal("+(müller* kp657) +(köln* kp456)", against("Müller, Köln"))
+
+	match := "MATCH(name, firstname, street, city, phonetic) AGAINST (? IN BOOLEAN MODE)"
+	mock.ExpectQuery("SELECT COUNT(*) FROM address WHERE tenant=? AND deleted_at IS NULL AND "+match).
+		WithArgs(tenant, "+(mayer* kp67)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code, country, version, "+match+" AS score FROM address WHERE tenant=? AND deleted_at IS NULL AND "+match+" ORDER BY score DESC, id LIMIT ? OFFSET ?").
+		WithArgs("+(mayer* kp67)", tenant, "+(mayer* kp67)", 2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "firstname", "street", "city", "state", "zip_code", "country", "version", "score"}).
+			AddRow("3", "Meier", "", "", "", "", "", "", 1, 0.9).
+			AddRow("1", "Maier", "", "", "", "", "", "", 2, 0.5))
+	p, err := stg.Search(tenant, pmodel.SearchQuery{Q: "Mayer", Limit: 2, Offset: 1})
+	ast.Nil(err)
+	ast.Equal(3, p.Total)
+	ast.Len(p.Hits, 2)
+	ast.Equal("Meier", p.Hits[0].Address.Name)
+	ast.Equal(0.9, p.Hits[0].Score)
+
+	// nothing to search for
+	p, err = stg.Search(tenant, pmodel.SearchQuery{Q: "--"})
+	ast.Nil(err)
+	ast.Empty(p.Hits)
+	ast.Nil(mock.ExpectationsWereMet())
+}
+
+func TestAdrMdbTrash(t *testing.T) {
+	ast := assert.New(t)
+	sdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer sdb.Close()
+
+	stg := AdrMdb{
+		db:   sdb,
+		mcfg: Config{Table: "address"},
+	}
+	deleted := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// the trash lists the deleted addresses with the deletion
+	mock.ExpectQuery("SELECT COUNT(*) FROM address WHERE tenant=? AND deleted_at IS NOT NULL").
+		WithArgs(tenant).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code, country, version, deleted_at, deleted_by FROM address WHERE tenant=? AND deleted_at IS NOT NULL ORDER BY id ASC LIMIT ?").
+		WithArgs(tenant, 101).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "firstname", "street", "city", "state", "zip_code", "country", "version", "deleted_at", "deleted_by"}).
+			AddRow("4", "Meier", "", "", "", "", "", "", 2, deleted, "tester"))
+	p, err := stg.Trash(tenant, pmodel.Query{})
+	ast.Nil(err)
+	ast.Len(p.Addresses, 1)
+	ast.Equal(deleted, *p.Addresses[0].DeletedAt)
+	ast.Equal("tester", p.Addresses[0].DeletedBy)
+
+	// only deleted addresses are restored
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code, country, version, deleted_at, deleted_by FROM address WHERE tenant=? AND id=? AND deleted_at IS NOT NULL FOR UPDATE").
+		WithArgs(tenant, "4").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "firstname", "street", "city", "state", "zip_code", "country", "version", "deleted_at", "deleted_by"}).
+			AddRow("4", "Meier", "", "", "", "", "", "", 2, deleted, "tester"))
+	mock.ExpectExec("UPDATE address SET deleted_at=NULL, deleted_by='', version=? WHERE tenant=? AND id=?").
+		WithArgs(3, tenant, "4").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectRecord(mock, "4", 3, pmodel.ActionRestore, "[]")
+	mock.ExpectCommit()
+	adr, err := stg.Restore(tenant, "4", "tester")
+	ast.Nil(err)
+	ast.Equal(3, adr.Version)
+	ast.Nil(adr.DeletedAt)
+	ast.Empty(adr.DeletedBy)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code, country, version, deleted_at, deleted_by FROM address WHERE tenant=? AND id=? AND deleted_at IS NOT NULL FOR UPDATE").
+		WithArgs(tenant, "5").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	_, err = stg.Restore(tenant, "5", "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+
+	// purging deletes the row, deleted or not
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, name, firstname, street, city, state, zip_code, country, version, deleted_at, deleted_by FROM address WHERE tenant=? AND id=? FOR UPDATE").
+		WithArgs(tenant, "4").
+		WillReturnRows(lockRows(adrs[3], 3))
+	mock.ExpectExec("DELETE FROM address WHERE tenant=? AND id=?").
+		WithArgs(tenant, "4").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectRecord(mock, "4", 4, pmodel.ActionPurge, "[]")
+	mock.ExpectCommit()
+	adr, err = stg.Purge(tenant, "4", 3, "tester")
+	ast.Nil(err)
+	ast.Equal(adrs[3].Name, adr.Name)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO address_history (tenant, address_id, version, action, actor, changed_at, changes) SELECT tenant, id, version+1, ?, ?, ?, '[]' FROM address WHERE deleted_at < ?").
+		WithArgs(pmodel.ActionPurge, common.SystemActor, sqlmock.AnyArg(), deleted).
+		WillReturnResult(sqlmock.NewResult(0, 7))
+	mock.ExpectExec("DELETE FROM address WHERE deleted_at < ?").
+		WithArgs(deleted).
+		WillReturnResult(sqlmock.NewResult(0, 7))
+	mock.ExpectCommit()
+	n, err := stg.PurgeDeleted(deleted)
+	ast.Nil(err)
+	ast.Equal(7, n)
+	ast.Nil(mock.ExpectationsWereMet())
+}
+
+func TestAdrMdbHistory(t *testing.T) {
+	ast := assert.New(t)
+	sdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer sdb.Close()
+
+	stg := AdrMdb{
+		db:   sdb,
+		mcfg: Config{Table: "address", HistoryTable: "revisions"},
+	}
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT version, action, actor, changed_at, changes FROM revisions WHERE tenant=? AND address_id=? ORDER BY version").
+		WithArgs(tenant, "4").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "action", "actor", "changed_at", "changes"}).
+			AddRow(1, pmodel.ActionCreate, "tester", created, `[{"field":"name","old":"","new":"Meier"}]`).
+			AddRow(2, pmodel.ActionUpdate, "admin", created.Add(time.Hour), `[{"field":"name","old":"Meier","new":"Maier"}]`))
+	revs, err := stg.History(tenant, "4")
+	ast.Nil(err)
+	ast.Len(revs, 2)
+	ast.Equal(pmodel.Revision{Tenant: tenant, ID: "4", Version: 2, Action: pmodel.ActionUpdate, Actor: "admin", Time: created.Add(time.Hour),
+		Changes: []pmodel.FieldChange{{Field: "name", Old: "Meier", New: "Maier"}}}, revs[1])
+	adr, ok := pmodel.AddressAt(revs, created.Add(time.Minute))
+	ast.True(ok)
+	ast.Equal(pmodel.Address{ID: "4", Name: "Meier", Version: 1}, adr)
+
+	mock.ExpectQuery("SELECT version, action, actor, changed_at, changes FROM revisions WHERE tenant=? AND address_id=? ORDER BY version").
+		WithArgs("tenant2", "4").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "action", "actor", "changed_at", "changes"}))
+	_, err = stg.History("tenant2", "4")
+	ast.ErrorIs(err, common.ErrNotFound)
+	ast.Nil(mock.ExpectationsWereMet())
+}
+
 func TestAdrMdbCreate(t *testing.T) {
 	t.SkipNow()
 }
@@ -0,0 +1,81 @@
+package adrmysql
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+)
+
+// expiry matching an expiry in unix seconds the duration after now
+type expiry time.Duration
+
+func (d expiry) Match(v driver.Value) bool {
+	exp, ok := v.(int64)
+	want := time.Now().Add(time.Duration(d)).Unix()
+	return ok && exp >= want-1 && exp <= want
+}
+
+func TestIdempotency(t *testing.T) {
+	ast := assert.New(t)
+	sdb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer sdb.Close()
+
+	stg := NewIdempotency(&AdrMdb{db: sdb}, "", time.Hour, time.Minute)
+	ast.Equal(DefaultIdempotencyTable, stg.table)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS idempotency").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM idempotency WHERE expires <= ?").WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT IGNORE INTO idempotency").
+		WithArgs("tenant1", "key1", "token1", "fp1", expiry(time.Minute)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	e, ok, err := stg.Reserve("tenant1", "key1", "token1", "fp1")
+	ast.Nil(err)
+	ast.True(ok)
+	ast.Nil(e)
+
+	mock.ExpectExec("UPDATE idempotency SET fingerprint = \\?, status = \\?, etag = \\?, body = \\?, expires = \\? WHERE tenant = \\? AND ikey = \\? AND token = \\? AND status = 0").
+		WithArgs("fp1", http.StatusCreated, `"1"`, []byte(`{"id":"1"}`), expiry(time.Hour), "tenant1", "key1", "token1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = stg.Complete("tenant1", "key1", "token1", common.IdempotencyEntry{Fingerprint: "fp1", Status: http.StatusCreated, ETag: `"1"`, Body: []byte(`{"id":"1"}`)})
+	ast.Nil(err)
+
+	// the reservation was taken over by another request
+	mock.ExpectExec("UPDATE idempotency").
+		WithArgs("fp1", http.StatusCreated, `"1"`, []byte(`{"id":"1"}`), expiry(time.Hour), "tenant1", "key1", "token0").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = stg.Complete("tenant1", "key1", "token0", common.IdempotencyEntry{Fingerprint: "fp1", Status: http.StatusCreated, ETag: `"1"`, Body: []byte(`{"id":"1"}`)})
+	ast.ErrorIs(err, common.ErrReservationLost)
+
+	mock.ExpectExec("DELETE FROM idempotency WHERE expires <= ?").WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT IGNORE INTO idempotency").
+		WithArgs("tenant1", "key1", "token2", "fp2", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"fingerprint", "status", "etag", "body"}).AddRow("fp1", http.StatusCreated, `"1"`, []byte(`{"id":"1"}`))
+	mock.ExpectQuery("SELECT fingerprint, status, etag, body FROM idempotency WHERE tenant = \\? AND ikey = \\?").
+		WithArgs("tenant1", "key1").WillReturnRows(rows)
+
+	e, ok, err = stg.Reserve("tenant1", "key1", "token2", "fp2")
+	ast.Nil(err)
+	ast.False(ok)
+	ast.Equal("fp1", e.Fingerprint)
+	ast.Equal(http.StatusCreated, e.Status)
+	ast.Equal(`"1"`, e.ETag)
+	ast.Equal(`{"id":"1"}`, string(e.Body))
+
+	mock.ExpectExec("DELETE FROM idempotency WHERE tenant = \\? AND ikey = \\? AND token = \\? AND status = 0").
+		WithArgs("tenant1", "key1", "token1").WillReturnResult(sqlmock.NewResult(0, 1))
+	ast.Nil(stg.Release("tenant1", "key1", "token1"))
+
+	ast.Nil(mock.ExpectationsWereMet())
+}
@@ -0,0 +1,60 @@
+-- address table of the mysql/mariadb address storage, the table name is configured with addressstorage.connection.table
+CREATE TABLE IF NOT EXISTS address (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  tenant VARCHAR(255) NOT NULL,
+  name VARCHAR(255) NOT NULL DEFAULT '',
+  firstname VARCHAR(255) NOT NULL DEFAULT '',
+  street VARCHAR(255) NOT NULL DEFAULT '',
+  city VARCHAR(255) NOT NULL DEFAULT '',
+  state VARCHAR(255) NOT NULL DEFAULT '',
+  zip_code VARCHAR(32) NOT NULL DEFAULT '',
+  country CHAR(2) NOT NULL DEFAULT '',
+  phonetic VARCHAR(1024) NOT NULL DEFAULT '',
+  version INT NOT NULL DEFAULT 1,
+  deleted_at DATETIME(6) NULL,
+  deleted_by VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+-- every query is restricted to one tenant, so the tenant is the first column of all indexes. The id as last column
+-- makes the keyset paging (WHERE tenant = ? AND ((name > ?) OR (name = ? AND id > ?)) ORDER BY name, id) an index
+-- range scan.
+CREATE INDEX idx_address_tenant ON address (tenant, id);
+CREATE INDEX idx_address_name ON address (tenant, name, id);
+CREATE INDEX idx_address_city ON address (tenant, city, id);
+CREATE INDEX idx_address_state ON address (tenant, state, id);
+CREATE INDEX idx_address_zip_code ON address (tenant, zip_code, id);
+-- the purge of the trash deletes all addresses deleted before a time, over all tenants
+CREATE INDEX idx_address_deleted_at ON address (deleted_at);
+
+-- fulltext index of the search, phonetic contains the prefixed codes of the Kölner Phonetik of the searchable fields,
+-- computed by the service. The codes are at least 3 characters long, the default innodb_ft_min_token_size.
+CREATE FULLTEXT INDEX ft_address ON address (name, firstname, street, city, phonetic);
+
+-- the revisions of the addresses, the name is configured with addressstorage.connection.historytable, default is the
+-- table name with the suffix _history. Revisions are only inserted, never changed or deleted, the changes are a json
+-- array of the changed fields with the old and the new value.
+CREATE TABLE IF NOT EXISTS address_history (
+  tenant VARCHAR(255) NOT NULL,
+  address_id BIGINT NOT NULL,
+  version INT NOT NULL,
+  action VARCHAR(16) NOT NULL,
+  actor VARCHAR(255) NOT NULL DEFAULT '',
+  changed_at DATETIME(6) NOT NULL,
+  changes TEXT NOT NULL,
+  PRIMARY KEY (tenant, address_id, version)
+);
+
+-- migration of an existing table without tenants, the existing addresses are moved to the tenant 'default'
+-- ALTER TABLE address ADD COLUMN tenant VARCHAR(255) NOT NULL DEFAULT 'default' AFTER id;
+-- migration of an existing table without country
+-- ALTER TABLE address ADD COLUMN country CHAR(2) NOT NULL DEFAULT '' AFTER zip_code;
+-- migration of an existing table without version
+-- ALTER TABLE address ADD COLUMN version INT NOT NULL DEFAULT 1 AFTER country;
+-- migration of an existing table without search, the phonetic codes are set with the next update of the addresses
+-- ALTER TABLE address ADD COLUMN phonetic VARCHAR(1024) NOT NULL DEFAULT '' AFTER country;
+-- CREATE FULLTEXT INDEX ft_address ON address (name, firstname, street, city, phonetic);
+-- migration of an existing table without trash
+-- ALTER TABLE address ADD COLUMN deleted_at DATETIME(6) NULL AFTER version, ADD COLUMN deleted_by VARCHAR(255) NOT NULL DEFAULT '' AFTER deleted_at;
+-- CREATE INDEX idx_address_deleted_at ON address (deleted_at);
+-- migration of an existing table without history, create the address_history table. The existing addresses have no
+-- revisions, so reads as of an earlier time don't find them.
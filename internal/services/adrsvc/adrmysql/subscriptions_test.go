@@ -0,0 +1,47 @@
+package adrmysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+func TestSubscriptions(t *testing.T) {
+	ast := assert.New(t)
+	sdb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer sdb.Close()
+
+	stg := NewSubscriptions(&AdrMdb{db: sdb}, "")
+	ast.Equal(DefaultSubscriptionTable, stg.table)
+
+	created := time.Now().UTC().Truncate(time.Second)
+	sub := pmodel.Subscription{ID: "1", URL: "https://example.com/hook", Events: []string{pmodel.EventAddressCreated, pmodel.EventAddressDeleted}, Secret: "0123456789abcdef", Created: created}
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS subscriptions").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO subscriptions \\(tenant, id, url, events, secret, created\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?\\)").
+		WithArgs("tenant1", "1", "https://example.com/hook", "address.created,address.deleted", "0123456789abcdef", created.Unix()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	ast.Nil(stg.StoreSubscription("tenant1", sub))
+
+	rows := sqlmock.NewRows([]string{"tenant", "id", "url", "events", "secret", "created"}).
+		AddRow("tenant1", "1", "https://example.com/hook", "address.created,address.deleted", "0123456789abcdef", created.Unix()).
+		AddRow("tenant2", "2", "https://example.com/other", "address.updated", "fedcba9876543210", created.Unix())
+	mock.ExpectQuery("SELECT tenant, id, url, events, secret, created FROM subscriptions ORDER BY tenant, id").WillReturnRows(rows)
+
+	subs, err := stg.Subscriptions()
+	ast.Nil(err)
+	ast.Len(subs, 2)
+	ast.Equal([]pmodel.Subscription{sub}, subs["tenant1"])
+	ast.Equal([]string{pmodel.EventAddressUpdated}, subs["tenant2"][0].Events)
+
+	mock.ExpectExec("DELETE FROM subscriptions WHERE tenant = \\? AND id = \\?").
+		WithArgs("tenant1", "1").WillReturnResult(sqlmock.NewResult(0, 1))
+	ast.Nil(stg.DeleteSubscription("tenant1", "1"))
+
+	ast.Nil(mock.ExpectationsWereMet())
+}
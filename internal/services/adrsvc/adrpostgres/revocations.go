@@ -0,0 +1,107 @@
+package adrpostgres
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/willie68/go-micro/internal/auth"
+)
+
+// DefaultRevocationTable the default table for the token revocations
+const DefaultRevocationTable = "revocations"
+
+// Revocations storing the token revocations in a postgresql table, times are stored as unix seconds
+type Revocations struct {
+	db      *sql.DB
+	name    string
+	table   string
+	lock    sync.Mutex
+	created bool
+}
+
+// NewRevocations creates the revocation storage in the database and schema of the address storage. The table will
+// be created on first usage, if needed.
+func NewRevocations(a *AdrPg, table string) *Revocations {
+	if table == "" {
+		table = DefaultRevocationTable
+	}
+	return &Revocations{
+		db:    a.db,
+		name:  table,
+		table: a.qualified(table),
+	}
+}
+
+func (r *Revocations) ensureTable() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.created {
+		return nil
+	}
+	_, err := r.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		rkey VARCHAR(255) NOT NULL PRIMARY KEY,
+		jti VARCHAR(255) NOT NULL DEFAULT '',
+		sub VARCHAR(255) NOT NULL DEFAULT '',
+		issued_before BIGINT NOT NULL DEFAULT 0,
+		expires BIGINT NOT NULL,
+		reason VARCHAR(1024) NOT NULL DEFAULT ''
+	)`, r.table))
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (expires)", pgx.Identifier{"idx_" + r.name + "_expires"}.Sanitize(), r.table))
+	r.created = err == nil
+	return err
+}
+
+// Revocations getting all not expired revocations
+func (r *Revocations) Revocations() ([]auth.Revocation, error) {
+	if err := r.ensureTable(); err != nil {
+		return nil, err
+	}
+	revs := make([]auth.Revocation, 0)
+	rows, err := r.db.Query(fmt.Sprintf("SELECT jti, sub, issued_before, expires, reason FROM %s WHERE expires > $1", r.table), time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rev auth.Revocation
+		var ib, exp int64
+		if err := rows.Scan(&rev.ID, &rev.Subject, &ib, &exp, &rev.Reason); err != nil {
+			return nil, err
+		}
+		if ib > 0 {
+			rev.IssuedBefore = time.Unix(ib, 0)
+		}
+		rev.Expires = time.Unix(exp, 0)
+		revs = append(revs, rev)
+	}
+	return revs, rows.Err()
+}
+
+// StoreRevocation storing the revocation, a revocation with the same jti or sub will be replaced. Expired
+// revocations are removed.
+func (r *Revocations) StoreRevocation(rev auth.Revocation) error {
+	if err := r.ensureTable(); err != nil {
+		return err
+	}
+	if _, err := r.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expires <= $1", r.table), time.Now().Unix()); err != nil {
+		return err
+	}
+	key := "jti:" + rev.ID
+	if rev.ID == "" {
+		key = "sub:" + rev.Subject
+	}
+	var ib int64
+	if !rev.IssuedBefore.IsZero() {
+		ib = rev.IssuedBefore.Unix()
+	}
+	_, err := r.db.Exec(fmt.Sprintf(`INSERT INTO %s (rkey, jti, sub, issued_before, expires, reason) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (rkey) DO UPDATE SET jti=EXCLUDED.jti, sub=EXCLUDED.sub, issued_before=EXCLUDED.issued_before, expires=EXCLUDED.expires, reason=EXCLUDED.reason`, r.table),
+		key, rev.ID, rev.Subject, ib, rev.Expires.Unix(), rev.Reason)
+	return err
+}
@@ -0,0 +1,50 @@
+package adrpostgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/auth"
+)
+
+func TestRevocations(t *testing.T) {
+	ast := assert.New(t)
+	sdb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer sdb.Close()
+
+	stg := NewRevocations(&AdrPg{db: sdb, pcfg: Config{Schema: "gomicro"}}, "")
+	ast.Equal(`"gomicro"."revocations"`, stg.table)
+
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS \"gomicro\"\\.\"revocations\"").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE INDEX IF NOT EXISTS \"idx_revocations_expires\" ON \"gomicro\"\\.\"revocations\"").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM \"gomicro\"\\.\"revocations\" WHERE expires <= \\$1").WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO \"gomicro\"\\.\"revocations\" .* ON CONFLICT \\(rkey\\) DO UPDATE").
+		WithArgs("jti:jti1", "jti1", "", int64(0), exp.Unix(), "leaked").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = stg.StoreRevocation(auth.Revocation{ID: "jti1", Expires: exp, Reason: "leaked"})
+	ast.Nil(err)
+
+	ib := time.Now().Truncate(time.Second)
+	rows := sqlmock.NewRows([]string{"jti", "sub", "issued_before", "expires", "reason"}).
+		AddRow("jti1", "", 0, exp.Unix(), "leaked").
+		AddRow("", "user1", ib.Unix(), exp.Unix(), "")
+	mock.ExpectQuery("SELECT jti, sub, issued_before, expires, reason FROM \"gomicro\"\\.\"revocations\" WHERE expires > \\$1").WillReturnRows(rows)
+
+	revs, err := stg.Revocations()
+	ast.Nil(err)
+	ast.Len(revs, 2)
+	ast.Equal("jti1", revs[0].ID)
+	ast.True(revs[0].IssuedBefore.IsZero())
+	ast.Equal(exp, revs[0].Expires)
+	ast.Equal("user1", revs[1].Subject)
+	ast.Equal(ib, revs[1].IssuedBefore)
+
+	ast.Nil(mock.ExpectationsWereMet())
+}
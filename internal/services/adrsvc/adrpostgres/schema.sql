@@ -0,0 +1,57 @@
+-- address table of the postgresql address storage, the table name is configured with addressstorage.connection.table,
+-- the schema with addressstorage.connection.schema
+CREATE TABLE IF NOT EXISTS address (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  tenant VARCHAR(255) NOT NULL,
+  name VARCHAR(255) NOT NULL DEFAULT '',
+  firstname VARCHAR(255) NOT NULL DEFAULT '',
+  street VARCHAR(255) NOT NULL DEFAULT '',
+  city VARCHAR(255) NOT NULL DEFAULT '',
+  state VARCHAR(255) NOT NULL DEFAULT '',
+  zip_code VARCHAR(32) NOT NULL DEFAULT '',
+  country CHAR(2) NOT NULL DEFAULT '',
+  phonetic VARCHAR(1024) NOT NULL DEFAULT '',
+  version INT NOT NULL DEFAULT 1,
+  deleted_at TIMESTAMPTZ NULL,
+  deleted_by VARCHAR(255) NOT NULL DEFAULT '',
+  -- text search vector of the search, weighted like the fields of the internal search. phonetic contains the
+  -- prefixed codes of the Kölner Phonetik of the searchable fields, computed by the service.
+  search TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', name), 'A') ||
+    setweight(to_tsvector('simple', firstname), 'B') ||
+    setweight(to_tsvector('simple', city), 'C') ||
+    setweight(to_tsvector('simple', street), 'D') ||
+    setweight(to_tsvector('simple', phonetic), 'D')
+  ) STORED
+);
+
+-- every query is restricted to one tenant, so the tenant is the first column of all indexes. The id as last column
+-- makes the keyset paging (WHERE tenant = $1 AND ((name > $2) OR (name = $3 AND id > $4)) ORDER BY name, id) an index
+-- range scan.
+CREATE INDEX IF NOT EXISTS idx_address_tenant ON address (tenant, id);
+CREATE INDEX IF NOT EXISTS idx_address_name ON address (tenant, name, id);
+CREATE INDEX IF NOT EXISTS idx_address_city ON address (tenant, city, id);
+CREATE INDEX IF NOT EXISTS idx_address_state ON address (tenant, state, id);
+CREATE INDEX IF NOT EXISTS idx_address_zip_code ON address (tenant, zip_code, id);
+-- the filters are compared case insensitive (lower(city) = lower($2))
+CREATE INDEX IF NOT EXISTS idx_address_city_lower ON address (tenant, lower(city));
+CREATE INDEX IF NOT EXISTS idx_address_state_lower ON address (tenant, lower(state));
+CREATE INDEX IF NOT EXISTS idx_address_zip_code_lower ON address (tenant, lower(zip_code));
+-- the purge of the trash deletes all addresses deleted before a time, over all tenants
+CREATE INDEX IF NOT EXISTS idx_address_deleted_at ON address (deleted_at);
+-- the text search index
+CREATE INDEX IF NOT EXISTS ft_address ON address USING GIN (search);
+
+-- the revisions of the addresses, the name is configured with addressstorage.connection.historytable, default is the
+-- table name with the suffix _history. Revisions are only inserted, never changed or deleted, the changes are a json
+-- array of the changed fields with the old and the new value.
+CREATE TABLE IF NOT EXISTS address_history (
+  tenant VARCHAR(255) NOT NULL,
+  address_id BIGINT NOT NULL,
+  version INT NOT NULL,
+  action VARCHAR(16) NOT NULL,
+  actor VARCHAR(255) NOT NULL DEFAULT '',
+  changed_at TIMESTAMPTZ NOT NULL,
+  changes TEXT NOT NULL,
+  PRIMARY KEY (tenant, address_id, version)
+);
@@ -0,0 +1,98 @@
+package adrpostgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// DefaultSubscriptionTable the default table for the webhook subscriptions
+const DefaultSubscriptionTable = "subscriptions"
+
+// Subscriptions storing the webhook subscriptions with their secrets in a postgresql table, the event types are stored
+// comma separated, the creation as unix seconds
+type Subscriptions struct {
+	db      *sql.DB
+	table   string
+	lock    sync.Mutex
+	created bool
+}
+
+// NewSubscriptions creates the subscription storage in the database and schema of the address storage. The table will
+// be created on first usage, if needed.
+func NewSubscriptions(a *AdrPg, table string) *Subscriptions {
+	if table == "" {
+		table = DefaultSubscriptionTable
+	}
+	return &Subscriptions{
+		db:    a.db,
+		table: a.qualified(table),
+	}
+}
+
+func (s *Subscriptions) ensureTable() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.created {
+		return nil
+	}
+	_, err := s.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		tenant VARCHAR(255) NOT NULL,
+		id VARCHAR(64) NOT NULL,
+		url VARCHAR(2048) NOT NULL,
+		events VARCHAR(255) NOT NULL,
+		secret VARCHAR(255) NOT NULL,
+		created BIGINT NOT NULL,
+		PRIMARY KEY (tenant, id)
+	)`, s.table))
+	s.created = err == nil
+	return err
+}
+
+// Subscriptions getting all subscriptions, by tenant
+func (s *Subscriptions) Subscriptions() (map[string][]pmodel.Subscription, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+	subs := make(map[string][]pmodel.Subscription)
+	rows, err := s.db.Query(fmt.Sprintf("SELECT tenant, id, url, events, secret, created FROM %s ORDER BY tenant, id", s.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tenant, events string
+		var created int64
+		var sub pmodel.Subscription
+		if err := rows.Scan(&tenant, &sub.ID, &sub.URL, &events, &sub.Secret, &created); err != nil {
+			return nil, err
+		}
+		sub.Events = strings.Split(events, ",")
+		sub.Created = time.Unix(created, 0).UTC()
+		subs[tenant] = append(subs[tenant], sub)
+	}
+	return subs, rows.Err()
+}
+
+// StoreSubscription storing a new subscription of the tenant
+func (s *Subscriptions) StoreSubscription(tenant string, sub pmodel.Subscription) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(fmt.Sprintf("INSERT INTO %s (tenant, id, url, events, secret, created) VALUES ($1, $2, $3, $4, $5, $6)", s.table),
+		tenant, sub.ID, sub.URL, strings.Join(sub.Events, ","), sub.Secret, sub.Created.Unix())
+	return err
+}
+
+// DeleteSubscription deleting the subscription of the tenant
+func (s *Subscriptions) DeleteSubscription(tenant, id string) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE tenant = $1 AND id = $2", s.table), tenant, id)
+	return err
+}
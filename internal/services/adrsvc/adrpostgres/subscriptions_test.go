@@ -0,0 +1,44 @@
+package adrpostgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+func TestSubscriptions(t *testing.T) {
+	ast := assert.New(t)
+	sdb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer sdb.Close()
+
+	stg := NewSubscriptions(&AdrPg{db: sdb, pcfg: Config{Schema: "gomicro"}}, "")
+	ast.Equal(`"gomicro"."subscriptions"`, stg.table)
+
+	created := time.Now().UTC().Truncate(time.Second)
+	sub := pmodel.Subscription{ID: "1", URL: "https://example.com/hook", Events: []string{pmodel.EventAddressCreated, pmodel.EventAddressDeleted}, Secret: "0123456789abcdef", Created: created}
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS \"gomicro\"\\.\"subscriptions\"").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO \"gomicro\"\\.\"subscriptions\" \\(tenant, id, url, events, secret, created\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6\\)").
+		WithArgs("tenant1", "1", "https://example.com/hook", "address.created,address.deleted", "0123456789abcdef", created.Unix()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	ast.Nil(stg.StoreSubscription("tenant1", sub))
+
+	rows := sqlmock.NewRows([]string{"tenant", "id", "url", "events", "secret", "created"}).
+		AddRow("tenant1", "1", "https://example.com/hook", "address.created,address.deleted", "0123456789abcdef", created.Unix())
+	mock.ExpectQuery("SELECT tenant, id, url, events, secret, created FROM \"gomicro\"\\.\"subscriptions\" ORDER BY tenant, id").WillReturnRows(rows)
+
+	subs, err := stg.Subscriptions()
+	ast.Nil(err)
+	ast.Equal(map[string][]pmodel.Subscription{"tenant1": {sub}}, subs)
+
+	mock.ExpectExec("DELETE FROM \"gomicro\"\\.\"subscriptions\" WHERE tenant = \\$1 AND id = \\$2").
+		WithArgs("tenant1", "1").WillReturnResult(sqlmock.NewResult(0, 1))
+	ast.Nil(stg.DeleteSubscription("tenant1", "1"))
+
+	ast.Nil(mock.ExpectationsWereMet())
+}
@@ -0,0 +1,610 @@
+// Package adrsqlite the embedded address storage in a sqlite database file, with a pure go driver, so no cgo is
+// needed. The schema is created automatically.
+package adrsqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+	"github.com/willie68/go-micro/internal/services/adrsvc/search"
+	"github.com/willie68/go-micro/pkg/pmodel"
+	// needed declaration
+	_ "modernc.org/sqlite"
+)
+
+// defaults of the configuration
+const (
+	DefaultTable       = "address"
+	DefaultBusyTimeout = 5000
+)
+
+// Config configuration for sqlite
+type Config struct {
+	// File the database file, it's created with the directory, if not present
+	File  string `yaml:"file"`
+	Table string `yaml:"table"`
+	// HistoryTable the table of the revisions of the addresses, default is the table with the suffix _history
+	HistoryTable string `yaml:"historytable"`
+	// BusyTimeout milliseconds a write waits for the lock of another write, default 5000
+	BusyTimeout int `yaml:"busytimeout"`
+}
+
+// columns of an address, trashColumns with the columns of the deletion
+const (
+	columns      = "id, name, firstname, street, city, state, zip_code, country, version"
+	trashColumns = columns + ", deleted_at, deleted_by"
+)
+
+// conditions of the addresses and of the deleted addresses in the trash
+const (
+	notDeleted = "deleted_at IS NULL"
+	isDeleted  = "deleted_at IS NOT NULL"
+)
+
+// AdrSqlite this is the address sqlite type, the addresses of all tenants are stored in one table with a tenant
+// column. Deleted addresses stay in the table with the deletion time in deleted_at, until they are purged.
+// The database runs in WAL mode, so reads are not blocked by a write. Every transaction takes the write lock at the
+// start (immediate), concurrent writes are waiting up to the busy timeout.
+type AdrSqlite struct {
+	db   *sql.DB
+	scfg Config
+}
+
+// NewAdrSqlite opening the database file and creating the schema
+func NewAdrSqlite(cfg Config) (*AdrSqlite, error) {
+	if cfg.File == "" {
+		return nil, errors.New("sqlite: no database file configured")
+	}
+	if cfg.Table == "" {
+		cfg.Table = DefaultTable
+	}
+	if cfg.BusyTimeout <= 0 {
+		cfg.BusyTimeout = DefaultBusyTimeout
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.File), os.ModePerm); err != nil {
+		return nil, err
+	}
+	d, err := sql.Open("sqlite", dsn(cfg))
+	if err != nil {
+		return nil, err
+	}
+	am := AdrSqlite{
+		db:   d,
+		scfg: cfg,
+	}
+	if err := am.migrate(); err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+	return &am, nil
+}
+
+// dsn the data source name of the database file, the pragmas are set on every new connection
+func dsn(cfg Config) string {
+	v := url.Values{}
+	v.Add("_pragma", "journal_mode(WAL)")
+	v.Add("_pragma", "synchronous(NORMAL)")
+	v.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", cfg.BusyTimeout))
+	v.Set("_txlock", "immediate")
+	v.Set("_time_format", "sqlite")
+	return "file:" + filepath.ToSlash(cfg.File) + "?" + v.Encode()
+}
+
+// migrate creating the schema, if not present
+func (a *AdrSqlite) migrate() error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range schema(a.scfg.Table, a.historyTable()) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Addresses list one page of the filtered and sorted addresses of the tenant. Filtering, sorting and paging is done
+// by the database.
+func (a *AdrSqlite) Addresses(tenant string, q pmodel.Query) (*pmodel.Page, error) {
+	return a.list(tenant, q, false)
+}
+
+// Trash list one page of the filtered and sorted deleted addresses of the tenant
+func (a *AdrSqlite) Trash(tenant string, q pmodel.Query) (*pmodel.Page, error) {
+	return a.list(tenant, q, true)
+}
+
+// list one page of the addresses or of the deleted addresses of the tenant
+func (a *AdrSqlite) list(tenant string, q pmodel.Query, deleted bool) (*pmodel.Page, error) {
+	order, err := common.SortOrder(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+	var cursor *common.Cursor
+	if q.Cursor != "" {
+		if cursor, err = common.ParseCursor(q.Cursor, order); err != nil {
+			return nil, err
+		}
+	}
+	conds, args := filter(tenant, q, deleted)
+	var total int
+	err = a.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s%s", a.scfg.Table, where(conds)), args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	backward := false
+	if cursor != nil {
+		backward = cursor.Backward
+		cond, cargs := keyset(order, cursor)
+		conds = append(conds, cond)
+		args = append(args, cargs...)
+	}
+	sorts := make([]string, len(order))
+	for x, o := range order {
+		sorts[x] = o.Field + " ASC"
+		if o.Desc != backward {
+			sorts[x] = o.Field + " DESC"
+		}
+	}
+	cols := columns
+	if deleted {
+		cols = trashColumns
+	}
+	stmt := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT ?", cols, a.scfg.Table, where(conds), strings.Join(sorts, ", "))
+	args = append(args, q.PageSize()+1)
+	if cursor == nil && q.Offset > 0 {
+		stmt += " OFFSET ?"
+		args = append(args, q.Offset)
+	}
+
+	addresses := []pmodel.Address{}
+	rows, err := a.db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		address, err := scan(rows, deleted)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return common.NewPage(addresses, q, order, cursor, total), nil
+}
+
+// scanner the row of a query
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scan scanning the columns of an address, with deleted the trash columns
+func scan(row scanner, deleted bool) (pmodel.Address, error) {
+	var adr pmodel.Address
+	var at sql.NullTime
+	dest := []any{&adr.ID, &adr.Name, &adr.Firstname, &adr.Street, &adr.City, &adr.State, &adr.ZipCode, &adr.Country, &adr.Version}
+	if deleted {
+		dest = append(dest, &at, &adr.DeletedBy)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return adr, err
+	}
+	if at.Valid {
+		at.Time = at.Time.UTC()
+		adr.DeletedAt = &at.Time
+	}
+	return adr, nil
+}
+
+// likeEscaper escaping the wildcards of a like pattern, sqlite has no default escape character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// filter building the conditions of the tenant, the deletion and the query filters. The filters are compared case
+// insensitive like the collation of the mysql storage, sqlite only folds the ascii letters.
+func filter(tenant string, q pmodel.Query, deleted bool) ([]string, []any) {
+	conds := []string{"tenant=?", notDeleted}
+	if deleted {
+		conds[1] = isDeleted
+	}
+	args := []any{tenant}
+	eq := func(col, v string) {
+		if v != "" {
+			conds = append(conds, col+"=? COLLATE NOCASE")
+			args = append(args, v)
+		}
+	}
+	eq("city", q.City)
+	eq("state", q.State)
+	eq("zip_code", q.ZipCode)
+	if q.Name != "" {
+		conds = append(conds, `name LIKE ? ESCAPE '\'`)
+		args = append(args, likeEscaper.Replace(q.Name)+"%")
+	}
+	return conds, args
+}
+
+// keyset building the condition for all rows behind the cursor position in the sort order, or before for a backward
+// cursor: (f1 > v1) OR (f1 = v1 AND f2 > v2) OR ...
+func keyset(order []common.SortField, cursor *common.Cursor) (string, []any) {
+	ors := make([]string, 0, len(order))
+	args := make([]any, 0)
+	for x, o := range order {
+		ands := make([]string, 0, x+1)
+		for y := 0; y < x; y++ {
+			ands = append(ands, order[y].Field+"=?")
+			args = append(args, cursor.Values[y])
+		}
+		op := ">"
+		if o.Desc != cursor.Backward {
+			op = "<"
+		}
+		ands = append(ands, o.Field+op+"?")
+		args = append(args, cursor.Values[x])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+func where(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// Has checking if an adress of the tenant is present
+func (a *AdrSqlite) Has(tenant, id string) bool {
+	var mid string
+	err := a.db.QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE tenant=? AND id=? AND %s", a.scfg.Table, notDeleted), tenant, id).Scan(&mid)
+	return err == nil
+}
+
+// Read getting the address of the tenant with id
+func (a *AdrSqlite) Read(tenant, id string) (*pmodel.Address, error) {
+	address, err := scan(a.db.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE tenant=? AND id=? AND %s", columns, a.scfg.Table, notDeleted), tenant, id), false)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, common.ErrNotFound
+		}
+		return nil, err
+	}
+	return &address, nil
+}
+
+// Create creates a new Address for the tenant, the user is recorded as actor
+func (a *AdrSqlite) Create(tenant string, adr pmodel.Address, user string) (string, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (tenant, name, firstname, street, city, state, zip_code, country, phonetic, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		a.scfg.Table), tenant, adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode, adr.Country, search.Codes(adr), common.FirstVersion)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	adr.ID = strconv.FormatInt(id, 10)
+	adr.Version = common.FirstVersion
+	if err := a.record(tx, tenant, pmodel.ActionCreate, user, pmodel.Diff(pmodel.Address{}, adr), adr); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return adr.ID, nil
+}
+
+// Update updates the address of the tenant, if the stored address still has the version, 0 updates any version.
+// The user is recorded as actor. Returns the new version of the address.
+func (a *AdrSqlite) Update(tenant string, adr pmodel.Address, version int, user string) (int, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	old, err := a.lock(tx, tenant, adr.ID, notDeleted, version)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET name=?, firstname=?, street=?, city=?, state=?, zip_code=?, country=?, phonetic=?, version=? WHERE tenant=? AND id=?", a.scfg.Table),
+		adr.Name, adr.Firstname, adr.Street, adr.City, adr.State, adr.ZipCode, adr.Country, search.Codes(adr), old.Version+1, tenant, adr.ID)
+	if err != nil {
+		return 0, err
+	}
+	adr.Version = old.Version + 1
+	if err := a.record(tx, tenant, pmodel.ActionUpdate, user, pmodel.Diff(old, adr), adr); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return old.Version + 1, nil
+}
+
+// Delete moves the address of the tenant with id into the trash, if the stored address still has the version, 0
+// deletes any version. The user is stored as the deleting user. Returns the deleted address.
+func (a *AdrSqlite) Delete(tenant, id string, version int, user string) (*pmodel.Address, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	adr, err := a.lock(tx, tenant, id, notDeleted, version)
+	if err != nil {
+		return nil, err
+	}
+	at := now()
+	adr.Version++
+	adr.DeletedAt, adr.DeletedBy = &at, user
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET deleted_at=?, deleted_by=?, version=? WHERE tenant=? AND id=?", a.scfg.Table), at, user, adr.Version, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.record(tx, tenant, pmodel.ActionDelete, user, nil, adr); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &adr, nil
+}
+
+// Restore restores the deleted address of the tenant with id from the trash, the user is recorded as actor. Returns
+// the restored address.
+func (a *AdrSqlite) Restore(tenant, id, user string) (*pmodel.Address, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	adr, err := a.lock(tx, tenant, id, isDeleted, 0)
+	if err != nil {
+		return nil, err
+	}
+	adr.Version++
+	adr.DeletedAt, adr.DeletedBy = nil, ""
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET deleted_at=NULL, deleted_by='', version=? WHERE tenant=? AND id=?", a.scfg.Table), adr.Version, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.record(tx, tenant, pmodel.ActionRestore, user, nil, adr); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &adr, nil
+}
+
+// Purge deletes the address of the tenant with id permanently, deleted or not, if the stored address still has the
+// version, 0 deletes any version. The user is recorded as actor, the revisions are kept. Returns the purged address.
+func (a *AdrSqlite) Purge(tenant, id string, version int, user string) (*pmodel.Address, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	adr, err := a.lock(tx, tenant, id, "", version)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE tenant=? AND id=?", a.scfg.Table), tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.record(tx, tenant, pmodel.ActionPurge, user, nil, pmodel.Address{ID: id, Version: adr.Version + 1}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &adr, nil
+}
+
+// PurgeDeleted deletes all addresses of all tenants permanently, which are deleted before the time, the revisions are
+// kept. Returns the number of purged addresses.
+func (a *AdrSqlite) PurgeDeleted(before time.Time) (int, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (tenant, address_id, version, action, actor, changed_at, changes) SELECT tenant, id, version+1, ?, ?, ?, '[]' FROM %s WHERE deleted_at < ?",
+		a.historyTable(), a.scfg.Table), pmodel.ActionPurge, common.SystemActor, now(), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE deleted_at < ?", a.scfg.Table), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// now the current time with the precision of the mysql storage. The times are stored as text in utc, so they can
+// be compared.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// historyTable the name of the table of the revisions
+func (a *AdrSqlite) historyTable() string {
+	if a.scfg.HistoryTable != "" {
+		return a.scfg.HistoryTable
+	}
+	return a.scfg.Table + "_history"
+}
+
+// record inserting the revision of the change of the address with the changes of the fields, nil for none
+func (a *AdrSqlite) record(tx *sql.Tx, tenant, action, user string, changes []pmodel.FieldChange, adr pmodel.Address) error {
+	if changes == nil {
+		changes = []pmodel.FieldChange{}
+	}
+	byt, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (tenant, address_id, version, action, actor, changed_at, changes) VALUES (?, ?, ?, ?, ?, ?, ?)", a.historyTable()),
+		tenant, adr.ID, adr.Version, action, user, now(), string(byt))
+	return err
+}
+
+// History getting the revisions of the address of the tenant with id, sorted by version. The revisions of deleted
+// and purged addresses are kept.
+func (a *AdrSqlite) History(tenant, id string) ([]pmodel.Revision, error) {
+	rows, err := a.db.Query(fmt.Sprintf("SELECT version, action, actor, changed_at, changes FROM %s WHERE tenant=? AND address_id=? ORDER BY version", a.historyTable()), tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revs := make([]pmodel.Revision, 0)
+	for rows.Next() {
+		r := pmodel.Revision{Tenant: tenant, ID: id}
+		var changes string
+		if err := rows.Scan(&r.Version, &r.Action, &r.Actor, &r.Time, &changes); err != nil {
+			return nil, err
+		}
+		r.Time = r.Time.UTC()
+		if err := json.Unmarshal([]byte(changes), &r.Changes); err != nil {
+			return nil, err
+		}
+		revs = append(revs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(revs) == 0 {
+		return nil, common.ErrNotFound
+	}
+	return revs, nil
+}
+
+// lock reading the address in the transaction and checking the version, returns the stored address. The write lock
+// of the database is already taken with the begin of the transaction. The address must match the optional condition.
+func (a *AdrSqlite) lock(tx *sql.Tx, tenant, id, cond string, version int) (pmodel.Address, error) {
+	stmt := fmt.Sprintf("SELECT %s FROM %s WHERE tenant=? AND id=?", trashColumns, a.scfg.Table)
+	if cond != "" {
+		stmt += " AND " + cond
+	}
+	old, err := scan(tx.QueryRow(stmt, tenant, id), true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return old, common.ErrNotFound
+		}
+		return old, err
+	}
+	if version != 0 && old.Version != version {
+		return old, common.ErrVersionConflict
+	}
+	return old, nil
+}
+
+// match building the fts5 query, every term must match a searchable field as prefix or the phonetic code. The
+// tokenizer of fts5 folds the case and removes the diacritics of the terms and of the addresses.
+func match(q string) string {
+	terms := search.Words(q)
+	parts := make([]string, len(terms))
+	for x, t := range terms {
+		parts[x] = `({name firstname street city} : "` + t + `"*`
+		if c := search.Cologne(t); c != "" {
+			parts[x] += ` OR phonetic : "` + c + `"`
+		}
+		parts[x] += ")"
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// Search searching the addresses of the tenant with the fts5 index, ranked by bm25 with the weights of the fields.
+// Typos are only tolerated as far as the phonetic code is the same.
+func (a *AdrSqlite) Search(tenant string, q pmodel.SearchQuery) (*pmodel.SearchPage, error) {
+	p := pmodel.SearchPage{
+		Hits: []pmodel.SearchHit{},
+	}
+	m := match(q.Q)
+	if m == "" {
+		return &p, nil
+	}
+	from := fmt.Sprintf("%[1]s_fts JOIN %[1]s a ON a.id = %[1]s_fts.rowid WHERE %[1]s_fts MATCH ? AND a.tenant=? AND a.%[2]s", a.scfg.Table, notDeleted)
+	err := a.db.QueryRow("SELECT COUNT(*) FROM "+from, m, tenant).Scan(&p.Total)
+	if err != nil {
+		return nil, err
+	}
+	// bm25 is negative, better matches are lower
+	rows, err := a.db.Query(fmt.Sprintf("SELECT a.id, a.name, a.firstname, a.street, a.city, a.state, a.zip_code, a.country, a.version, -bm25(%s_fts, 3, 2, 1, 1.5, 0.5) AS score FROM %s ORDER BY score DESC, a.id LIMIT ? OFFSET ?",
+		a.scfg.Table, from), m, tenant, q.PageSize(), q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h pmodel.SearchHit
+		adr := &h.Address
+		err := rows.Scan(&adr.ID, &adr.Name, &adr.Firstname, &adr.Street, &adr.City, &adr.State, &adr.ZipCode, &adr.Country, &adr.Version, &h.Score)
+		if err != nil {
+			return nil, err
+		}
+		p.Hits = append(p.Hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CheckName should return the name of this healthcheck. The name should be unique.
+func (a *AdrSqlite) CheckName() string {
+	return "sqlite"
+}
+
+// Check proceed a check and return state, true for healthy or false and an optional error, if the healthcheck fails
+func (a *AdrSqlite) Check() (bool, error) {
+	err := a.db.Ping()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Init this service
+func (a *AdrSqlite) Init() error {
+	// Nothing to do here
+	return nil
+}
+
+// Shutdown this service, closing the database, the WAL is checkpointed with the last connection
+func (a *AdrSqlite) Shutdown() error {
+	return a.db.Close()
+}
+
+func (a *AdrSqlite) HealthCheck() error {
+	_, err := a.Check()
+	return err
+}
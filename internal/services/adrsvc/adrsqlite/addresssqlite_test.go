@@ -0,0 +1,354 @@
+package adrsqlite
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+const tenant = "tenant1"
+
+var adrs []pmodel.Address
+
+func init() {
+	data, err := os.ReadFile("../../../../testdata/addresses.json")
+	if err != nil {
+		panic(err)
+	}
+	err = json.Unmarshal(data, &adrs)
+	if err != nil {
+		panic(err)
+	}
+	// the test data has the name as lastname
+	var names []struct {
+		Lastname string `json:"lastname"`
+	}
+	err = json.Unmarshal(data, &names)
+	if err != nil {
+		panic(err)
+	}
+	for x, n := range names {
+		adrs[x].Name = n.Lastname
+	}
+}
+
+// newStorage creating a storage in a new database file with all test addresses of the tenant
+func newStorage(t *testing.T) (*AdrSqlite, []string) {
+	stg, err := NewAdrSqlite(Config{File: filepath.Join(t.TempDir(), "data", "addresses.db")})
+	if err != nil {
+		t.Fatalf("can't create storage: %v", err)
+	}
+	t.Cleanup(func() { _ = stg.Shutdown() })
+	ids := make([]string, 0, len(adrs))
+	for _, adr := range adrs {
+		id, err := stg.Create(tenant, adr, "tester")
+		if err != nil {
+			t.Fatalf("can't create address: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return stg, ids
+}
+
+func TestAdrSqliteSchema(t *testing.T) {
+	ast := assert.New(t)
+	file := filepath.Join(t.TempDir(), "addresses.db")
+
+	stg, err := NewAdrSqlite(Config{File: file})
+	ast.Nil(err)
+	ok, err := stg.Check()
+	ast.True(ok)
+	ast.Nil(err)
+	ast.Equal("sqlite", stg.CheckName())
+	var mode string
+	ast.Nil(stg.db.QueryRow("PRAGMA journal_mode").Scan(&mode))
+	ast.Equal("wal", mode)
+	id, err := stg.Create(tenant, adrs[0], "tester")
+	ast.Nil(err)
+	ast.Nil(stg.Shutdown())
+
+	// the existing schema and data is used
+	stg, err = NewAdrSqlite(Config{File: file})
+	ast.Nil(err)
+	defer stg.Shutdown()
+	adr, err := stg.Read(tenant, id)
+	ast.Nil(err)
+	ast.Equal(adrs[0].Name, adr.Name)
+	ast.Equal(common.FirstVersion, adr.Version)
+
+	_, err = NewAdrSqlite(Config{})
+	ast.NotNil(err)
+}
+
+func TestAdrSqliteQuery(t *testing.T) {
+	ast := assert.New(t)
+	stg, _ := newStorage(t)
+
+	p, err := stg.Addresses(tenant, pmodel.Query{})
+	ast.Nil(err)
+	ast.Equal(len(adrs), p.Total)
+	ast.Len(p.Addresses, len(adrs))
+
+	p, err = stg.Addresses(tenant, pmodel.Query{City: "Anytown"})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+	ast.Equal("Smith", p.Addresses[0].Name)
+	p, err = stg.Addresses(tenant, pmodel.Query{City: "ANYTOWN"})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+
+	// the wildcards of the name are escaped
+	p, err = stg.Addresses(tenant, pmodel.Query{Name: "%"})
+	ast.Nil(err)
+	ast.Equal(0, p.Total)
+	p, err = stg.Addresses(tenant, pmodel.Query{Name: "smi"})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+
+	// keyset paging forward and backward
+	names := make([]string, 0)
+	q := pmodel.Query{Sort: []string{"name"}, Limit: 3}
+	for {
+		p, err := stg.Addresses(tenant, q)
+		ast.Nil(err)
+		ast.Equal(len(adrs), p.Total)
+		for _, adr := range p.Addresses {
+			names = append(names, adr.Name)
+		}
+		if p.Next == "" {
+			break
+		}
+		q.Cursor = p.Next
+	}
+	ast.Len(names, len(adrs))
+	ast.IsNonDecreasing(names)
+
+	p, err = stg.Addresses(tenant, pmodel.Query{Sort: []string{"-name"}, Limit: 4})
+	ast.Nil(err)
+	p, err = stg.Addresses(tenant, pmodel.Query{Sort: []string{"-name"}, Limit: 4, Cursor: p.Next})
+	ast.Nil(err)
+	ast.NotEmpty(p.Prev)
+	prev, err := stg.Addresses(tenant, pmodel.Query{Sort: []string{"-name"}, Limit: 4, Cursor: p.Prev})
+	ast.Nil(err)
+	ast.Len(prev.Addresses, 4)
+	ast.Equal(names[len(names)-1], prev.Addresses[0].Name)
+
+	_, err = stg.Addresses(tenant, pmodel.Query{Sort: []string{"unknown"}})
+	ast.ErrorIs(err, pmodel.ErrInvalidQuery)
+}
+
+func TestAdrSqliteTenants(t *testing.T) {
+	ast := assert.New(t)
+	stg, ids := newStorage(t)
+
+	ast.True(stg.Has(tenant, ids[0]))
+	ast.False(stg.Has("tenant2", ids[0]))
+	_, err := stg.Read("tenant2", ids[0])
+	ast.ErrorIs(err, common.ErrNotFound)
+	_, err = stg.Update("tenant2", pmodel.Address{ID: ids[0], Name: "Other"}, 0, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+	_, err = stg.Delete("tenant2", ids[0], 0, "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+	p, err := stg.Addresses("tenant2", pmodel.Query{})
+	ast.Nil(err)
+	ast.Equal(0, p.Total)
+	ast.Empty(p.Addresses)
+}
+
+func TestAdrSqliteVersion(t *testing.T) {
+	ast := assert.New(t)
+	stg, ids := newStorage(t)
+
+	adr, err := stg.Read(tenant, ids[0])
+	ast.Nil(err)
+	adr.City = "Newtown"
+	v, err := stg.Update(tenant, *adr, 1, "tester")
+	ast.Nil(err)
+	ast.Equal(2, v)
+	_, err = stg.Update(tenant, *adr, 1, "tester")
+	ast.ErrorIs(err, common.ErrVersionConflict)
+	_, err = stg.Delete(tenant, ids[0], 1, "tester")
+	ast.ErrorIs(err, common.ErrVersionConflict)
+	v, err = stg.Update(tenant, *adr, 0, "tester")
+	ast.Nil(err)
+	ast.Equal(3, v)
+	adr, err = stg.Read(tenant, ids[0])
+	ast.Nil(err)
+	ast.Equal("Newtown", adr.City)
+	ast.Equal(3, adr.Version)
+}
+
+func TestAdrSqliteSearch(t *testing.T) {
+	ast := assert.New(t)
+	stg, ids := newStorage(t)
+
+	p, err := stg.Search(tenant, pmodel.SearchQuery{Q: "smi"})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+	ast.Equal(ids[0], p.Hits[0].Address.ID)
+	ast.Greater(p.Hits[0].Score, 0.0)
+
+	// phonetic match with a typo
+	p, err = stg.Search(tenant, pmodel.SearchQuery{Q: "Smyth anytown"})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+
+	// the index follows the updates
+	adr, err := stg.Read(tenant, ids[0])
+	ast.Nil(err)
+	adr.Name = "Müller"
+	_, err = stg.Update(tenant, *adr, 0, "tester")
+	ast.Nil(err)
+	p, err = stg.Search(tenant, pmodel.SearchQuery{Q: "smith"})
+	ast.Nil(err)
+	ast.Equal(0, p.Total)
+	// Miller has the same phonetic code, but is ranked lower
+	p, err = stg.Search(tenant, pmodel.SearchQuery{Q: "Muller"})
+	ast.Nil(err)
+	ast.Equal(2, p.Total)
+	ast.Equal(ids[0], p.Hits[0].Address.ID)
+	ast.Greater(p.Hits[0].Score, p.Hits[1].Score)
+
+	// deleted addresses and other tenants are not found
+	_, err = stg.Delete(tenant, ids[0], 0, "tester")
+	ast.Nil(err)
+	p, err = stg.Search(tenant, pmodel.SearchQuery{Q: "müller"})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+	ast.Equal("Miller", p.Hits[0].Address.Name)
+	p, err = stg.Search("tenant2", pmodel.SearchQuery{Q: "johnson"})
+	ast.Nil(err)
+	ast.Equal(0, p.Total)
+
+	p, err = stg.Search(tenant, pmodel.SearchQuery{Q: "st", Limit: 2, Offset: 1})
+	ast.Nil(err)
+	ast.Equal(len(adrs)-1, p.Total)
+	ast.Len(p.Hits, 2)
+
+	p, err = stg.Search(tenant, pmodel.SearchQuery{Q: "--"})
+	ast.Nil(err)
+	ast.Equal(0, p.Total)
+	ast.Empty(p.Hits)
+}
+
+func TestAdrSqliteTrash(t *testing.T) {
+	ast := assert.New(t)
+	stg, ids := newStorage(t)
+
+	adr, err := stg.Delete(tenant, ids[0], 0, "deleter")
+	ast.Nil(err)
+	ast.Equal(2, adr.Version)
+	ast.NotNil(adr.DeletedAt)
+	ast.False(stg.Has(tenant, ids[0]))
+	_, err = stg.Delete(tenant, ids[0], 0, "deleter")
+	ast.ErrorIs(err, common.ErrNotFound)
+
+	p, err := stg.Trash(tenant, pmodel.Query{})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+	ast.Equal("deleter", p.Addresses[0].DeletedBy)
+	ast.WithinDuration(time.Now(), *p.Addresses[0].DeletedAt, time.Minute)
+
+	adr, err = stg.Restore(tenant, ids[0], "tester")
+	ast.Nil(err)
+	ast.Equal(3, adr.Version)
+	ast.Nil(adr.DeletedAt)
+	ast.True(stg.Has(tenant, ids[0]))
+	_, err = stg.Restore(tenant, ids[0], "tester")
+	ast.ErrorIs(err, common.ErrNotFound)
+
+	adr, err = stg.Purge(tenant, ids[0], 0, "admin")
+	ast.Nil(err)
+	ast.Equal(3, adr.Version)
+	ast.False(stg.Has(tenant, ids[0]))
+
+	_, err = stg.Delete(tenant, ids[1], 0, "deleter")
+	ast.Nil(err)
+	_, err = stg.Delete(tenant, ids[2], 0, "deleter")
+	ast.Nil(err)
+	n, err := stg.PurgeDeleted(time.Now().Add(-time.Hour))
+	ast.Nil(err)
+	ast.Equal(0, n)
+	n, err = stg.PurgeDeleted(time.Now().Add(time.Minute))
+	ast.Nil(err)
+	ast.Equal(2, n)
+	p, err = stg.Trash(tenant, pmodel.Query{})
+	ast.Nil(err)
+	ast.Equal(0, p.Total)
+
+	// ids of purged addresses are not reused
+	id, err := stg.Create(tenant, adrs[0], "tester")
+	ast.Nil(err)
+	ast.NotContains(ids, id)
+}
+
+func TestAdrSqliteHistory(t *testing.T) {
+	ast := assert.New(t)
+	stg, ids := newStorage(t)
+
+	adr, err := stg.Read(tenant, ids[0])
+	ast.Nil(err)
+	adr.City = "Newtown"
+	_, err = stg.Update(tenant, *adr, 0, "updater")
+	ast.Nil(err)
+	_, err = stg.Delete(tenant, ids[0], 0, "deleter")
+	ast.Nil(err)
+	_, err = stg.Purge(tenant, ids[0], 0, "admin")
+	ast.Nil(err)
+
+	revs, err := stg.History(tenant, ids[0])
+	ast.Nil(err)
+	ast.Len(revs, 4)
+	actions := []string{pmodel.ActionCreate, pmodel.ActionUpdate, pmodel.ActionDelete, pmodel.ActionPurge}
+	for x, r := range revs {
+		ast.Equal(x+1, r.Version)
+		ast.Equal(actions[x], r.Action)
+		ast.Equal(tenant, r.Tenant)
+		ast.Equal(ids[0], r.ID)
+	}
+	ast.Equal("updater", revs[1].Actor)
+	ast.Len(revs[1].Changes, 1)
+	ast.Equal("city", revs[1].Changes[0].Field)
+	ast.Equal("Newtown", revs[1].Changes[0].New)
+	ast.Equal(time.UTC, revs[1].Time.Location())
+
+	_, err = stg.History("tenant2", ids[0])
+	ast.ErrorIs(err, common.ErrNotFound)
+}
+
+func TestAdrSqliteConcurrent(t *testing.T) {
+	ast := assert.New(t)
+	stg, ids := newStorage(t)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				_, err := stg.Create(tenant, adrs[1], "tester")
+				ast.Nil(err)
+				adr := adrs[0]
+				adr.ID = ids[0]
+				_, err = stg.Update(tenant, adr, 0, "tester")
+				ast.Nil(err)
+				_, err = stg.Addresses(tenant, pmodel.Query{})
+				ast.Nil(err)
+			}
+		}()
+	}
+	wg.Wait()
+	p, err := stg.Addresses(tenant, pmodel.Query{})
+	ast.Nil(err)
+	ast.Equal(len(adrs)+40, p.Total)
+	revs, err := stg.History(tenant, ids[0])
+	ast.Nil(err)
+	ast.Len(revs, 41)
+}
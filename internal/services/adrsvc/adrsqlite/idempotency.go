@@ -0,0 +1,128 @@
+package adrsqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+)
+
+// DefaultIdempotencyTable the default table for the responses of requests with an idempotency key
+const DefaultIdempotencyTable = "idempotency"
+
+// Idempotency storing the responses of requests with an idempotency key in a sqlite table, the expiry is stored as
+// unix seconds
+type Idempotency struct {
+	db      *sql.DB
+	table   string
+	ttl     time.Duration
+	lease   time.Duration
+	lock    sync.Mutex
+	created bool
+}
+
+// NewIdempotency creates the idempotency storage in the database of the address storage, a key is reserved for the
+// lease. The table will be created on first usage, if needed.
+func NewIdempotency(a *AdrSqlite, table string, ttl, lease time.Duration) *Idempotency {
+	if table == "" {
+		table = DefaultIdempotencyTable
+	}
+	return &Idempotency{
+		db:    a.db,
+		table: table,
+		ttl:   ttl,
+		lease: lease,
+	}
+}
+
+func (i *Idempotency) ensureTable() error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if i.created {
+		return nil
+	}
+	_, err := i.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		tenant TEXT NOT NULL,
+		ikey TEXT NOT NULL,
+		token TEXT NOT NULL DEFAULT '',
+		fingerprint TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		etag TEXT NOT NULL DEFAULT '',
+		body BLOB,
+		expires INTEGER NOT NULL,
+		PRIMARY KEY (tenant, ikey)
+	)`, i.table))
+	if err != nil {
+		return err
+	}
+	_, err = i.db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_expires ON %s (expires)", i.table, i.table))
+	i.created = err == nil
+	return err
+}
+
+// Reserve reserving the key of the tenant for a request with the token and the fingerprint for the lease. If the key
+// is already known, the stored entry is returned and false. Expired entries are removed, so an expired reservation is
+// taken over.
+func (i *Idempotency) Reserve(tenant, key, token, fingerprint string) (*common.IdempotencyEntry, bool, error) {
+	if err := i.ensureTable(); err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	if _, err := i.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expires <= ?", i.table), now.Unix()); err != nil {
+		return nil, false, err
+	}
+	// the entry can be released between the insert and the select, so the insert is tried a second time
+	for range 2 {
+		res, err := i.db.Exec(fmt.Sprintf("INSERT INTO %s (tenant, ikey, token, fingerprint, status, body, expires) VALUES (?, ?, ?, ?, 0, '', ?) ON CONFLICT DO NOTHING", i.table),
+			tenant, key, token, fingerprint, now.Add(i.lease).Unix())
+		if err != nil {
+			return nil, false, err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 1 {
+			return nil, err == nil, err
+		}
+		var e common.IdempotencyEntry
+		err = i.db.QueryRow(fmt.Sprintf("SELECT fingerprint, status, etag, body FROM %s WHERE tenant = ? AND ikey = ?", i.table), tenant, key).
+			Scan(&e.Fingerprint, &e.Status, &e.ETag, &e.Body)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return &e, false, nil
+	}
+	return nil, false, fmt.Errorf("can't reserve idempotency key %s", key)
+}
+
+// Complete storing the response of the request with the reserved key, if the reservation of the token is still active
+func (i *Idempotency) Complete(tenant, key, token string, e common.IdempotencyEntry) error {
+	if err := i.ensureTable(); err != nil {
+		return err
+	}
+	res, err := i.db.Exec(fmt.Sprintf("UPDATE %s SET fingerprint = ?, status = ?, etag = ?, body = ?, expires = ? WHERE tenant = ? AND ikey = ? AND token = ? AND status = 0", i.table),
+		e.Fingerprint, e.Status, e.ETag, e.Body, time.Now().Add(i.ttl).Unix(), tenant, key, token)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return common.ErrReservationLost
+	}
+	return nil
+}
+
+// Release removing the reservation of the key with the token, so the request can be retried
+func (i *Idempotency) Release(tenant, key, token string) error {
+	if err := i.ensureTable(); err != nil {
+		return err
+	}
+	_, err := i.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE tenant = ? AND ikey = ? AND token = ? AND status = 0", i.table), tenant, key, token)
+	return err
+}
@@ -0,0 +1,72 @@
+package adrsqlite
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/services/adrsvc/common"
+)
+
+func TestIdempotency(t *testing.T) {
+	ast := assert.New(t)
+	file := filepath.Join(t.TempDir(), "addresses.db")
+	stg, err := NewAdrSqlite(Config{File: file})
+	ast.Nil(err)
+
+	idem := NewIdempotency(stg, "", time.Hour, time.Minute)
+	ast.Equal(DefaultIdempotencyTable, idem.table)
+
+	e, ok, err := idem.Reserve("tenant1", "key1", "token1", "fp1")
+	ast.Nil(err)
+	ast.True(ok)
+	ast.Nil(e)
+
+	// in flight
+	e, ok, err = idem.Reserve("tenant1", "key1", "token2", "fp1")
+	ast.Nil(err)
+	ast.False(ok)
+	ast.Equal("fp1", e.Fingerprint)
+	ast.Equal(0, e.Status)
+
+	// keys are separated by tenant
+	_, ok, err = idem.Reserve("tenant2", "key1", "token3", "fp2")
+	ast.Nil(err)
+	ast.True(ok)
+	ast.Nil(idem.Release("tenant2", "key1", "token3"))
+	_, ok, err = idem.Reserve("tenant2", "key1", "token4", "fp2")
+	ast.Nil(err)
+	ast.True(ok)
+
+	// an expired reservation, e.g. of a crashed request, is taken over, the first request can't store or release it
+	_, err = stg.db.Exec("UPDATE idempotency SET expires = ? WHERE tenant = ?", time.Now().Add(-time.Second).Unix(), "tenant2")
+	ast.Nil(err)
+	_, ok, err = idem.Reserve("tenant2", "key1", "token5", "fp2")
+	ast.Nil(err)
+	ast.True(ok)
+	ast.ErrorIs(idem.Complete("tenant2", "key1", "token4", common.IdempotencyEntry{Fingerprint: "fp2", Status: http.StatusCreated}), common.ErrReservationLost)
+	ast.Nil(idem.Release("tenant2", "key1", "token4"))
+	_, ok, err = idem.Reserve("tenant2", "key1", "token6", "fp2")
+	ast.Nil(err)
+	ast.False(ok)
+
+	// only the owner of the reservation stores the response
+	ast.ErrorIs(idem.Complete("tenant1", "key1", "token2", common.IdempotencyEntry{Fingerprint: "fp1", Status: http.StatusOK}), common.ErrReservationLost)
+	ast.Nil(idem.Complete("tenant1", "key1", "token1", common.IdempotencyEntry{Fingerprint: "fp1", Status: http.StatusCreated, ETag: `"1"`, Body: []byte(`{"id":"1"}`)}))
+	ast.ErrorIs(idem.Complete("tenant1", "key1", "token1", common.IdempotencyEntry{Fingerprint: "fp1", Status: http.StatusOK}), common.ErrReservationLost)
+	ast.Nil(stg.Shutdown())
+
+	// the responses are kept with a restart
+	stg, err = NewAdrSqlite(Config{File: file})
+	ast.Nil(err)
+	defer stg.Shutdown()
+	idem = NewIdempotency(stg, "", time.Hour, time.Minute)
+	e, ok, err = idem.Reserve("tenant1", "key1", "token7", "fp1")
+	ast.Nil(err)
+	ast.False(ok)
+	ast.Equal(http.StatusCreated, e.Status)
+	ast.Equal(`"1"`, e.ETag)
+	ast.Equal(`{"id":"1"}`, string(e.Body))
+}
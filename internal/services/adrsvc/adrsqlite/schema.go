@@ -0,0 +1,59 @@
+package adrsqlite
+
+import "fmt"
+
+// schema the statements creating the tables, indexes and triggers of the storage, if they don't exist. Every query is
+// restricted to one tenant, so the tenant is the first column of all indexes, the id as last column makes the keyset
+// paging an index range scan. The ids are never reused (AUTOINCREMENT), because the revisions of purged addresses
+// are kept.
+//
+// The full text search uses a fts5 table with the address table as external content, it's kept in sync by triggers.
+// phonetic contains the codes of the Kölner Phonetik of the searchable fields, computed by the service.
+func schema(table, history string) []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  tenant TEXT NOT NULL,
+  name TEXT NOT NULL DEFAULT '',
+  firstname TEXT NOT NULL DEFAULT '',
+  street TEXT NOT NULL DEFAULT '',
+  city TEXT NOT NULL DEFAULT '',
+  state TEXT NOT NULL DEFAULT '',
+  zip_code TEXT NOT NULL DEFAULT '',
+  country TEXT NOT NULL DEFAULT '',
+  phonetic TEXT NOT NULL DEFAULT '',
+  version INTEGER NOT NULL DEFAULT 1,
+  deleted_at DATETIME NULL,
+  deleted_by TEXT NOT NULL DEFAULT ''
+)`, table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_tenant ON %[1]s (tenant, id)", table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_name ON %[1]s (tenant, name, id)", table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_city ON %[1]s (tenant, city, id)", table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_state ON %[1]s (tenant, state, id)", table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_zip_code ON %[1]s (tenant, zip_code, id)", table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_deleted_at ON %[1]s (deleted_at)", table),
+
+		fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %[1]s_fts USING fts5(name, firstname, street, city, phonetic, content='%[1]s', content_rowid='id')", table),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_fts_insert AFTER INSERT ON %[1]s BEGIN
+  INSERT INTO %[1]s_fts (rowid, name, firstname, street, city, phonetic) VALUES (new.id, new.name, new.firstname, new.street, new.city, new.phonetic);
+END`, table),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_fts_delete AFTER DELETE ON %[1]s BEGIN
+  INSERT INTO %[1]s_fts (%[1]s_fts, rowid, name, firstname, street, city, phonetic) VALUES ('delete', old.id, old.name, old.firstname, old.street, old.city, old.phonetic);
+END`, table),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_fts_update AFTER UPDATE OF name, firstname, street, city, phonetic ON %[1]s BEGIN
+  INSERT INTO %[1]s_fts (%[1]s_fts, rowid, name, firstname, street, city, phonetic) VALUES ('delete', old.id, old.name, old.firstname, old.street, old.city, old.phonetic);
+  INSERT INTO %[1]s_fts (rowid, name, firstname, street, city, phonetic) VALUES (new.id, new.name, new.firstname, new.street, new.city, new.phonetic);
+END`, table),
+
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  tenant TEXT NOT NULL,
+  address_id INTEGER NOT NULL,
+  version INTEGER NOT NULL,
+  action TEXT NOT NULL,
+  actor TEXT NOT NULL DEFAULT '',
+  changed_at DATETIME NOT NULL,
+  changes TEXT NOT NULL,
+  PRIMARY KEY (tenant, address_id, version)
+)`, history),
+	}
+}
@@ -0,0 +1,98 @@
+package adrsqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// DefaultSubscriptionTable the default table for the webhook subscriptions
+const DefaultSubscriptionTable = "subscriptions"
+
+// Subscriptions storing the webhook subscriptions with their secrets in a sqlite table, the event types are stored
+// comma separated, the creation as unix seconds
+type Subscriptions struct {
+	db      *sql.DB
+	table   string
+	lock    sync.Mutex
+	created bool
+}
+
+// NewSubscriptions creates the subscription storage in the database of the address storage. The table will
+// be created on first usage, if needed.
+func NewSubscriptions(a *AdrSqlite, table string) *Subscriptions {
+	if table == "" {
+		table = DefaultSubscriptionTable
+	}
+	return &Subscriptions{
+		db:    a.db,
+		table: table,
+	}
+}
+
+func (s *Subscriptions) ensureTable() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.created {
+		return nil
+	}
+	_, err := s.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		tenant TEXT NOT NULL,
+		id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		events TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		created INTEGER NOT NULL,
+		PRIMARY KEY (tenant, id)
+	)`, s.table))
+	s.created = err == nil
+	return err
+}
+
+// Subscriptions getting all subscriptions, by tenant
+func (s *Subscriptions) Subscriptions() (map[string][]pmodel.Subscription, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+	subs := make(map[string][]pmodel.Subscription)
+	rows, err := s.db.Query(fmt.Sprintf("SELECT tenant, id, url, events, secret, created FROM %s ORDER BY tenant, id", s.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tenant, events string
+		var created int64
+		var sub pmodel.Subscription
+		if err := rows.Scan(&tenant, &sub.ID, &sub.URL, &events, &sub.Secret, &created); err != nil {
+			return nil, err
+		}
+		sub.Events = strings.Split(events, ",")
+		sub.Created = time.Unix(created, 0).UTC()
+		subs[tenant] = append(subs[tenant], sub)
+	}
+	return subs, rows.Err()
+}
+
+// StoreSubscription storing a new subscription of the tenant
+func (s *Subscriptions) StoreSubscription(tenant string, sub pmodel.Subscription) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(fmt.Sprintf("INSERT INTO %s (tenant, id, url, events, secret, created) VALUES (?, ?, ?, ?, ?, ?)", s.table),
+		tenant, sub.ID, sub.URL, strings.Join(sub.Events, ","), sub.Secret, sub.Created.Unix())
+	return err
+}
+
+// DeleteSubscription deleting the subscription of the tenant
+func (s *Subscriptions) DeleteSubscription(tenant, id string) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE tenant = ? AND id = ?", s.table), tenant, id)
+	return err
+}
@@ -0,0 +1,43 @@
+package adrsqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+func TestSubscriptions(t *testing.T) {
+	ast := assert.New(t)
+	file := filepath.Join(t.TempDir(), "addresses.db")
+	stg, err := NewAdrSqlite(Config{File: file})
+	ast.Nil(err)
+
+	subs := NewSubscriptions(stg, "")
+	ast.Equal(DefaultSubscriptionTable, subs.table)
+
+	all, err := subs.Subscriptions()
+	ast.Nil(err)
+	ast.Empty(all)
+
+	created := time.Now().UTC().Truncate(time.Second)
+	sub1 := pmodel.Subscription{ID: "1", URL: "https://example.com/hook", Events: []string{pmodel.EventAddressCreated, pmodel.EventAddressDeleted}, Secret: "0123456789abcdef", Created: created}
+	sub2 := pmodel.Subscription{ID: "2", URL: "https://example.com/other", Events: []string{pmodel.EventAddressUpdated}, Secret: "fedcba9876543210", Created: created}
+	ast.Nil(subs.StoreSubscription("tenant1", sub1))
+	ast.Nil(subs.StoreSubscription("tenant1", sub2))
+	ast.Nil(subs.StoreSubscription("tenant2", sub1))
+	ast.NotNil(subs.StoreSubscription("tenant2", sub1))
+	ast.Nil(subs.DeleteSubscription("tenant1", "2"))
+	ast.Nil(subs.DeleteSubscription("tenant1", "unknown"))
+	ast.Nil(stg.Shutdown())
+
+	// the subscriptions are kept with a restart
+	stg, err = NewAdrSqlite(Config{File: file})
+	ast.Nil(err)
+	defer stg.Shutdown()
+	all, err = NewSubscriptions(stg, "").Subscriptions()
+	ast.Nil(err)
+	ast.Equal(map[string][]pmodel.Subscription{"tenant1": {sub1}, "tenant2": {sub1}}, all)
+}
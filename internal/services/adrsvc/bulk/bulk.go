@@ -0,0 +1,306 @@
+// Package bulk reading and writing streams of addresses as json array, ndjson or csv
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// Format the format of an address stream
+type Format string
+
+// the supported formats
+const (
+	JSON   Format = "json"
+	NDJSON Format = "ndjson"
+	CSV    Format = "csv"
+)
+
+// maxLine maximal length of one ndjson line
+const maxLine = 1024 * 1024
+
+// errors of the reader
+var (
+	// ErrInvalidRow the row can't be read, the following rows can
+	ErrInvalidRow = errors.New("invalid row")
+	// ErrUnknownFormat the format is not supported
+	ErrUnknownFormat = errors.New("unknown format")
+)
+
+var mediaTypes = map[Format]string{
+	JSON:   "application/json",
+	NDJSON: "application/x-ndjson",
+	CSV:    "text/csv",
+}
+
+// ParseFormat getting the format of the name (json, ndjson, csv) or media type
+func ParseFormat(s string) (Format, error) {
+	if mt, _, err := mime.ParseMediaType(s); err == nil {
+		s = mt
+	}
+	for f, mt := range mediaTypes {
+		if s == string(f) || s == mt {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownFormat, s)
+}
+
+// MediaType the media type of the format
+func (f Format) MediaType() string {
+	return mediaTypes[f]
+}
+
+// Reader reading the addresses of a stream one by one
+type Reader struct {
+	next    func() (map[string]any, error)
+	mapping map[string]string
+	row     int
+}
+
+// NewReader creating a reader for the stream in the format. The mapping maps the field names of the source to the
+// address fields, unmapped names are taken as they are, unknown fields are ignored.
+func NewReader(r io.Reader, f Format, mapping map[string]string) (*Reader, error) {
+	rd := Reader{
+		mapping: mapping,
+	}
+	var err error
+	switch f {
+	case JSON:
+		rd.next, err = jsonRows(r)
+	case NDJSON:
+		rd.next = ndjsonRows(r)
+	case CSV:
+		rd.next, err = csvRows(r)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownFormat, f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rd, nil
+}
+
+// Next reading the next address and returning it with its row number, counted from 1. At the end io.EOF is returned.
+// Errors wrapping ErrInvalidRow are only affecting this row, all other errors are fatal.
+func (r *Reader) Next() (int, pmodel.Address, error) {
+	var adr pmodel.Address
+	m, err := r.next()
+	if errors.Is(err, io.EOF) {
+		return r.row, adr, err
+	}
+	r.row++
+	if err != nil {
+		return r.row, adr, err
+	}
+	for k, v := range m {
+		field := k
+		if f, ok := r.mapping[k]; ok {
+			field = f
+		}
+		var s string
+		switch vv := v.(type) {
+		case nil:
+		case string:
+			s = vv
+		case json.Number:
+			s = vv.String()
+		default:
+			return r.row, adr, fmt.Errorf("%w: field %s must be a string", ErrInvalidRow, k)
+		}
+		adr.SetField(field, s)
+	}
+	return r.row, adr, nil
+}
+
+func decodeObject(dec *json.Decoder) (map[string]any, error) {
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		var terr *json.UnmarshalTypeError
+		if errors.As(err, &terr) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRow, err)
+		}
+		return nil, err
+	}
+	return m, nil
+}
+
+// jsonRows reading the objects of a json array one by one, without reading the whole array
+func jsonRows(r io.Reader) (func() (map[string]any, error), error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := t.(json.Delim); !ok || d != '[' {
+		return nil, errors.New("json array expected")
+	}
+	done := false
+	return func() (map[string]any, error) {
+		if done {
+			return nil, io.EOF
+		}
+		if !dec.More() {
+			t, err := dec.Token()
+			if d, ok := t.(json.Delim); err != nil || !ok || d != ']' {
+				return nil, errors.New("json array not closed")
+			}
+			done = true
+			return nil, io.EOF
+		}
+		return decodeObject(dec)
+	}, nil
+}
+
+// ndjsonRows reading one json object per line, empty lines are skipped
+func ndjsonRows(r io.Reader) func() (map[string]any, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLine)
+	return func() (map[string]any, error) {
+		for sc.Scan() {
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			dec := json.NewDecoder(bytes.NewReader(line))
+			dec.UseNumber()
+			m, err := decodeObject(dec)
+			if err != nil && !errors.Is(err, ErrInvalidRow) {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidRow, err)
+			}
+			return m, err
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+// csvRows reading the rows of a csv with a header, the header contains the field names
+func csvRows(r io.Reader) (func() (map[string]any, error), error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("csv header missing")
+		}
+		return nil, err
+	}
+	header = append([]string(nil), header...)
+	return func() (map[string]any, error) {
+		rec, err := cr.Read()
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidRow, err)
+			}
+			return nil, err
+		}
+		m := make(map[string]any, len(header))
+		for x, h := range header {
+			m[h] = rec[x]
+		}
+		return m, nil
+	}, nil
+}
+
+// Writer writing addresses to a stream
+type Writer struct {
+	f     Format
+	w     io.Writer
+	cw    *csv.Writer
+	count int
+}
+
+// NewWriter creating a writer of the format to the stream, Close must be called after the last address
+func NewWriter(w io.Writer, f Format) (*Writer, error) {
+	if _, ok := mediaTypes[f]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, f)
+	}
+	wr := Writer{
+		f: f,
+		w: w,
+	}
+	if f == CSV {
+		wr.cw = csv.NewWriter(w)
+	}
+	return &wr, nil
+}
+
+// Write writing one address
+func (w *Writer) Write(adr pmodel.Address) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.count++
+	switch w.f {
+	case CSV:
+		rec := make([]string, len(pmodel.AddressFields))
+		for x, f := range pmodel.AddressFields {
+			rec[x] = adr.Field(f)
+		}
+		return w.cw.Write(rec)
+	case JSON:
+		if w.count > 1 {
+			if _, err := io.WriteString(w.w, ",\n"); err != nil {
+				return err
+			}
+		}
+		byt, err := json.Marshal(adr)
+		if err != nil {
+			return err
+		}
+		_, err = w.w.Write(byt)
+		return err
+	}
+	return json.NewEncoder(w.w).Encode(adr)
+}
+
+// start writing the json array start or the csv header before the first address
+func (w *Writer) start() error {
+	if w.count > 0 {
+		return nil
+	}
+	switch w.f {
+	case CSV:
+		return w.cw.Write(pmodel.AddressFields)
+	case JSON:
+		_, err := io.WriteString(w.w, "[\n")
+		return err
+	}
+	return nil
+}
+
+// Flush flushing buffered addresses to the stream
+func (w *Writer) Flush() error {
+	if w.cw != nil {
+		w.cw.Flush()
+		return w.cw.Error()
+	}
+	return nil
+}
+
+// Close finishing the stream, an empty stream is written as empty array or as csv with only the header
+func (w *Writer) Close() error {
+	if w.count == 0 {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	if w.f == JSON {
+		if _, err := io.WriteString(w.w, "\n]\n"); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,147 @@
+package bulk
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+func readAll(rd *Reader) ([]pmodel.Address, []error) {
+	adrs := make([]pmodel.Address, 0)
+	errs := make([]error, 0)
+	for {
+		_, adr, err := rd.Next()
+		if errors.Is(err, io.EOF) {
+			return adrs, errs
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if !errors.Is(err, ErrInvalidRow) {
+				return adrs, errs
+			}
+			continue
+		}
+		adrs = append(adrs, adr)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	ast := assert.New(t)
+	f, err := ParseFormat("text/csv; charset=utf-8")
+	ast.Nil(err)
+	ast.Equal(CSV, f)
+	f, err = ParseFormat("ndjson")
+	ast.Nil(err)
+	ast.Equal("application/x-ndjson", f.MediaType())
+	_, err = ParseFormat("application/xml")
+	ast.ErrorIs(err, ErrUnknownFormat)
+}
+
+func TestReadJSONMapping(t *testing.T) {
+	ast := assert.New(t)
+	f, err := os.Open("../../../../testdata/addresses.json")
+	ast.Nil(err)
+	defer f.Close()
+
+	rd, err := NewReader(f, JSON, map[string]string{"lastname": "name"})
+	ast.Nil(err)
+	adrs, errs := readAll(rd)
+	ast.Empty(errs)
+	ast.Len(adrs, 10)
+	ast.Equal("1", adrs[0].ID)
+	ast.Equal("Smith", adrs[0].Name)
+	ast.Equal("12345", adrs[0].ZipCode)
+}
+
+func TestReadRowErrors(t *testing.T) {
+	ast := assert.New(t)
+
+	// a wrong row in a json array is skipped
+	rd, err := NewReader(strings.NewReader(`[{"name": "Smith", "zip_code": 12345}, [1], {"name": true}, {"name": "Miller"}]`), JSON, nil)
+	ast.Nil(err)
+	adrs, errs := readAll(rd)
+	ast.Len(adrs, 2)
+	ast.Equal("12345", adrs[0].ZipCode)
+	ast.Len(errs, 2)
+
+	// a broken array is aborting
+	rd, err = NewReader(strings.NewReader(`[{"name": "Smith"}, {"name": `), JSON, nil)
+	ast.Nil(err)
+	adrs, errs = readAll(rd)
+	ast.Len(adrs, 1)
+	ast.Len(errs, 1)
+	ast.NotErrorIs(errs[0], ErrInvalidRow)
+	_, err = NewReader(strings.NewReader(`{"name": "Smith"}`), JSON, nil)
+	ast.NotNil(err)
+
+	// ndjson lines are independent
+	rd, err = NewReader(strings.NewReader("{\"name\": \"Smith\"}\n\n{\"name\": \n{\"name\": \"Miller\"}\n"), NDJSON, nil)
+	ast.Nil(err)
+	adrs, errs = readAll(rd)
+	ast.Len(adrs, 2)
+	ast.Len(errs, 1)
+	ast.ErrorIs(errs[0], ErrInvalidRow)
+}
+
+func TestReadCSV(t *testing.T) {
+	ast := assert.New(t)
+	src := "id,lastname,city,unknown\n1,Smith,Anytown,x\n2,Miller\n3,\"Schmidt, Jr.\",Sometown,\n"
+	rd, err := NewReader(strings.NewReader(src), CSV, map[string]string{"lastname": "name"})
+	ast.Nil(err)
+	row, adr, err := rd.Next()
+	ast.Nil(err)
+	ast.Equal(1, row)
+	ast.Equal(pmodel.Address{ID: "1", Name: "Smith", City: "Anytown"}, adr)
+	row, _, err = rd.Next()
+	ast.Equal(2, row)
+	ast.ErrorIs(err, ErrInvalidRow)
+	_, adr, err = rd.Next()
+	ast.Nil(err)
+	ast.Equal("Schmidt, Jr.", adr.Name)
+	_, _, err = rd.Next()
+	ast.ErrorIs(err, io.EOF)
+
+	_, err = NewReader(strings.NewReader(""), CSV, nil)
+	ast.NotNil(err)
+}
+
+func TestWriteRead(t *testing.T) {
+	ast := assert.New(t)
+	adrs := []pmodel.Address{
+		{ID: "1", Name: "Smith", Firstname: "John", City: "Anytown", Country: "US"},
+		{ID: "2", Name: "Müller", Street: "Hauptstraße 1, Hinterhaus", ZipCode: "10115"},
+	}
+	for _, f := range []Format{JSON, NDJSON, CSV} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, f)
+		ast.Nil(err)
+		for _, adr := range adrs {
+			ast.Nil(w.Write(adr))
+		}
+		ast.Nil(w.Close())
+
+		rd, err := NewReader(&buf, f, nil)
+		ast.Nil(err)
+		radrs, errs := readAll(rd)
+		ast.Empty(errs, f)
+		ast.Equal(adrs, radrs, f)
+
+		// empty streams are readable, too
+		buf.Reset()
+		w, _ = NewWriter(&buf, f)
+		ast.Nil(w.Close())
+		rd, err = NewReader(&buf, f, nil)
+		ast.Nil(err)
+		radrs, errs = readAll(rd)
+		ast.Empty(errs, f)
+		ast.Empty(radrs, f)
+	}
+	_, err := NewWriter(io.Discard, "xml")
+	ast.ErrorIs(err, ErrUnknownFormat)
+}
@@ -1,14 +1,64 @@
 package common
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // Error definitions
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound        = errors.New("not found")
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrReservationLost the reservation of an idempotency key expired and was taken over by another request
+	ErrReservationLost = errors.New("idempotency reservation lost")
 )
 
+// FirstVersion the version of a newly created address
+const FirstVersion = 1
+
+// SystemActor the actor of the changes of the background jobs
+const SystemActor = "system"
+
+// DefaultIdempotencyTTL the default time the responses of requests with an idempotency key are kept
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// DefaultIdempotencyLease the default time a key is reserved for a request in flight. An expired reservation, e.g.
+// after a crash, is taken over by the next request with the key.
+const DefaultIdempotencyLease = time.Minute
+
+// IdempotencyEntry the stored response of a request with an idempotency key. The fingerprint identifies the request
+// body, a status of 0 marks a request still in flight. The ETag header of the response is replayed with the body.
+type IdempotencyEntry struct {
+	Fingerprint string
+	Status      int
+	ETag        string
+	Body        []byte
+}
+
 // Config general config for the storage
 type Config struct {
 	Type       string         `yaml:"type"`
 	Connection map[string]any `yaml:"connection"`
+	// PurgeDays days a deleted address is kept in the trash, before it's deleted permanently, 0 keeps it forever
+	PurgeDays int `yaml:"purgedays"`
+	// IdempotencyTTL seconds the responses of requests with an idempotency key are kept, default 24h
+	IdempotencyTTL int `yaml:"idempotencyttl"`
+	// IdempotencyLease seconds a key is reserved for a request in flight, default 60
+	IdempotencyLease int `yaml:"idempotencylease"`
+}
+
+// IdempotencyWindow getting the time the responses of requests with an idempotency key are kept
+func (c Config) IdempotencyWindow() time.Duration {
+	if c.IdempotencyTTL <= 0 {
+		return DefaultIdempotencyTTL
+	}
+	return time.Duration(c.IdempotencyTTL) * time.Second
+}
+
+// IdempotencyReservation getting the time a key is reserved for a request in flight
+func (c Config) IdempotencyReservation() time.Duration {
+	if c.IdempotencyLease <= 0 {
+		return DefaultIdempotencyLease
+	}
+	return time.Duration(c.IdempotencyLease) * time.Second
 }
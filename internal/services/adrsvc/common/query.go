@@ -0,0 +1,143 @@
+package common
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// SortField one field of the sort order
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Cursor the position in the sorted address list, the values are the sort field values of the address at the
+// position. Backward cursors are pointing to the page before the position.
+type Cursor struct {
+	Sort     string   `json:"s"`
+	Values   []string `json:"v"`
+	Backward bool     `json:"b,omitempty"`
+}
+
+// SortOrder building the sort order of the query. The id is always the last field, so the order is stable and every
+// position is unique.
+func SortOrder(sort []string) ([]SortField, error) {
+	order := make([]SortField, 0, len(sort)+1)
+	hasID := false
+	for _, s := range sort {
+		sf := SortField{Field: strings.TrimPrefix(s, "-"), Desc: strings.HasPrefix(s, "-")}
+		if !slices.Contains(pmodel.SortFields, sf.Field) {
+			return nil, fmt.Errorf("%w: unknown sort field %q", pmodel.ErrInvalidQuery, s)
+		}
+		if slices.ContainsFunc(order, func(o SortField) bool { return o.Field == sf.Field }) {
+			continue
+		}
+		hasID = hasID || sf.Field == "id"
+		order = append(order, sf)
+	}
+	if !hasID {
+		order = append(order, SortField{Field: "id"})
+	}
+	return order, nil
+}
+
+func orderKey(order []SortField) string {
+	fs := make([]string, len(order))
+	for x, o := range order {
+		fs[x] = o.Field
+		if o.Desc {
+			fs[x] = "-" + o.Field
+		}
+	}
+	return strings.Join(fs, ",")
+}
+
+// NewCursor creating the opaque cursor for the position of the address
+func NewCursor(order []SortField, adr pmodel.Address, backward bool) string {
+	c := Cursor{
+		Sort:     orderKey(order),
+		Values:   make([]string, len(order)),
+		Backward: backward,
+	}
+	for x, o := range order {
+		c.Values[x] = adr.Field(o.Field)
+	}
+	byt, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(byt)
+}
+
+// ParseCursor decoding the opaque cursor, the cursor must belong to the same sort order
+func ParseCursor(s string, order []SortField) (*Cursor, error) {
+	byt, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cursor malformed", pmodel.ErrInvalidQuery)
+	}
+	var c Cursor
+	if err := json.Unmarshal(byt, &c); err != nil {
+		return nil, fmt.Errorf("%w: cursor malformed", pmodel.ErrInvalidQuery)
+	}
+	if c.Sort != orderKey(order) || len(c.Values) != len(order) {
+		return nil, fmt.Errorf("%w: cursor doesn't match the sort order", pmodel.ErrInvalidQuery)
+	}
+	return &c, nil
+}
+
+// Compare comparing two addresses in the sort order
+func Compare(order []SortField, a, b pmodel.Address) int {
+	for _, o := range order {
+		c := strings.Compare(a.Field(o.Field), b.Field(o.Field))
+		if o.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Compare comparing the address with the cursor position in the sort order
+func (c *Cursor) Compare(order []SortField, adr pmodel.Address) int {
+	for x, o := range order {
+		r := strings.Compare(adr.Field(o.Field), c.Values[x])
+		if o.Desc {
+			r = -r
+		}
+		if r != 0 {
+			return r
+		}
+	}
+	return 0
+}
+
+// NewPage building the page of the query from the found addresses. The addresses must be fetched with one more than
+// the limit, to detect further pages. Backward addresses are in reversed order.
+func NewPage(adrs []pmodel.Address, q pmodel.Query, order []SortField, cursor *Cursor, total int) *pmodel.Page {
+	backward := cursor != nil && cursor.Backward
+	more := len(adrs) > q.PageSize()
+	if more {
+		adrs = adrs[:q.PageSize()]
+	}
+	if backward {
+		slices.Reverse(adrs)
+	}
+	p := pmodel.Page{
+		Addresses: adrs,
+		Total:     total,
+	}
+	if len(adrs) == 0 {
+		return &p
+	}
+	if more || backward {
+		p.Next = NewCursor(order, adrs[len(adrs)-1], false)
+	}
+	if (backward && more) || (!backward && (cursor != nil || q.Offset > 0)) {
+		p.Prev = NewCursor(order, adrs[0], true)
+	}
+	return &p
+}
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+func TestSortOrder(t *testing.T) {
+	ast := assert.New(t)
+	order, err := SortOrder(nil)
+	ast.Nil(err)
+	ast.Equal([]SortField{{Field: "id"}}, order)
+	order, err = SortOrder([]string{"name", "-city", "name"})
+	ast.Nil(err)
+	ast.Equal([]SortField{{Field: "name"}, {Field: "city", Desc: true}, {Field: "id"}}, order)
+	order, err = SortOrder([]string{"-id", "name"})
+	ast.Nil(err)
+	ast.Equal([]SortField{{Field: "id", Desc: true}, {Field: "name"}}, order)
+	_, err = SortOrder([]string{"name; DROP TABLE address"})
+	ast.ErrorIs(err, pmodel.ErrInvalidQuery)
+}
+
+func TestCursor(t *testing.T) {
+	ast := assert.New(t)
+	order, _ := SortOrder([]string{"-city"})
+	adr := pmodel.Address{ID: "4", City: "Anytown"}
+	s := NewCursor(order, adr, true)
+
+	c, err := ParseCursor(s, order)
+	ast.Nil(err)
+	ast.True(c.Backward)
+	ast.Equal([]string{"Anytown", "4"}, c.Values)
+
+	other, _ := SortOrder([]string{"city"})
+	_, err = ParseCursor(s, other)
+	ast.ErrorIs(err, pmodel.ErrInvalidQuery)
+	_, err = ParseCursor("muck!", order)
+	ast.ErrorIs(err, pmodel.ErrInvalidQuery)
+}
+
+func TestNewPage(t *testing.T) {
+	ast := assert.New(t)
+	order, _ := SortOrder(nil)
+	adrs := []pmodel.Address{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	q := pmodel.Query{Limit: 2}
+
+	p := NewPage(adrs, q, order, nil, 5)
+	ast.Len(p.Addresses, 2)
+	ast.Equal(5, p.Total)
+	ast.Empty(p.Prev)
+	c, err := ParseCursor(p.Next, order)
+	ast.Nil(err)
+	ast.Equal("2", c.Values[0])
+
+	// backward pages are reversed, the first address is the start of the previous page
+	p = NewPage([]pmodel.Address{{ID: "4"}, {ID: "3"}, {ID: "2"}}, q, order, &Cursor{Backward: true}, 5)
+	ast.Equal("3", p.Addresses[0].ID)
+	ast.Equal("4", p.Addresses[1].ID)
+	ast.NotEmpty(p.Next)
+	c, err = ParseCursor(p.Prev, order)
+	ast.Nil(err)
+	ast.True(c.Backward)
+	ast.Equal("3", c.Values[0])
+}
@@ -0,0 +1,77 @@
+package adrsvc
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/willie68/go-micro/internal/logging"
+)
+
+// purgeInterval the time between two runs of the purger
+const purgeInterval = time.Hour
+
+// trash the part of the address storage, which deletes the addresses of the trash permanently
+type trash interface {
+	PurgeDeleted(before time.Time) (int, error)
+}
+
+// Purger the background job, which deletes the addresses of the trash permanently after the purge days
+type Purger struct {
+	stg    trash
+	days   int
+	ticker *time.Ticker
+	done   chan bool
+	logger *slog.Logger
+}
+
+// NewPurger creates a new purger for the storage, the addresses are kept in the trash for the days
+func NewPurger(stg trash, days int) *Purger {
+	return &Purger{
+		stg:    stg,
+		days:   days,
+		logger: logging.New("purger"),
+	}
+}
+
+// Init starting the background job, the first run is immediately
+func (p *Purger) Init() error {
+	ticker := time.NewTicker(purgeInterval)
+	done := make(chan bool)
+	p.ticker, p.done = ticker, done
+	go func() {
+		p.Purge(time.Now())
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				p.Purge(now)
+			}
+		}
+	}()
+	return nil
+}
+
+// Purge deletes all addresses permanently, which are longer than the purge days in the trash
+func (p *Purger) Purge(now time.Time) int {
+	count, err := p.stg.PurgeDeleted(now.AddDate(0, 0, -p.days))
+	if err != nil {
+		p.logger.Error(fmt.Sprintf("error purging deleted addresses: %v", err))
+		return 0
+	}
+	if count > 0 {
+		p.logger.Info(fmt.Sprintf("%d deleted addresses purged", count))
+	}
+	return count
+}
+
+// Shutdown stopping the background job
+func (p *Purger) Shutdown() error {
+	if p.ticker != nil {
+		p.ticker.Stop()
+		close(p.done)
+		p.ticker = nil
+	}
+	return nil
+}
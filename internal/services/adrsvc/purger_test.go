@@ -0,0 +1,28 @@
+package adrsvc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/services/adrsvc/adrint"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+func TestPurger(t *testing.T) {
+	ast := assert.New(t)
+	stg, err := adrint.NewAdrInt()
+	ast.Nil(err)
+	id, err := stg.Create("tenant1", pmodel.Address{Name: "Smith"}, "tester")
+	ast.Nil(err)
+	_, err = stg.Delete("tenant1", id, 0, "tester")
+	ast.Nil(err)
+
+	p := NewPurger(stg, 30)
+	ast.Equal(0, p.Purge(time.Now().AddDate(0, 0, 29)))
+	ast.Equal(1, p.Purge(time.Now().AddDate(0, 0, 31)))
+
+	ast.Nil(p.Init())
+	ast.Nil(p.Shutdown())
+	ast.Nil(p.Shutdown())
+}
@@ -0,0 +1,115 @@
+package search
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// Hit one found address with the score of the ranking
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// Index an inverted index of the tokens of addresses, the index is not safe for concurrent use
+type Index struct {
+	// postings the ids of the addresses with the token, with the bits of the fields containing it
+	postings map[string]map[string]uint8
+	// codes the phonetic codes of the tokens
+	codes map[string]string
+}
+
+// NewIndex creating an empty index
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[string]uint8),
+		codes:    make(map[string]string),
+	}
+}
+
+// Add adding the tokens of the address to the index
+func (i *Index) Add(adr pmodel.Address) {
+	for x, ts := range AddressTokens(adr) {
+		for _, t := range ts {
+			ids, ok := i.postings[t]
+			if !ok {
+				ids = make(map[string]uint8)
+				i.postings[t] = ids
+				i.codes[t] = Cologne(t)
+			}
+			ids[adr.ID] |= 1 << x
+		}
+	}
+}
+
+// Remove removing the tokens of the address from the index, the address must be the indexed version
+func (i *Index) Remove(adr pmodel.Address) {
+	for _, ts := range AddressTokens(adr) {
+		for _, t := range ts {
+			ids, ok := i.postings[t]
+			if !ok {
+				continue
+			}
+			delete(ids, adr.ID)
+			if len(ids) == 0 {
+				delete(i.postings, t)
+				delete(i.codes, t)
+			}
+		}
+	}
+}
+
+// Search searching the addresses matching all terms of the query, ranked by score. Every term is scored with its best
+// match with a token, weighted by the field of the token.
+func (i *Index) Search(query string) []Hit {
+	terms := Tokens(query)
+	if len(terms) == 0 {
+		return []Hit{}
+	}
+	scores := make(map[string]float64)
+	for x, term := range terms {
+		code := Cologne(term)
+		best := make(map[string]float64)
+		for t, ids := range i.postings {
+			s := Match(term, code, t, i.codes[t])
+			if s == 0 {
+				continue
+			}
+			for id, fields := range ids {
+				if _, ok := scores[id]; x > 0 && !ok {
+					// an earlier term didn't match
+					continue
+				}
+				best[id] = max(best[id], s*weight(fields))
+			}
+		}
+		for id, s := range best {
+			best[id] = s + scores[id]
+		}
+		scores = best
+	}
+	hits := make([]Hit, 0, len(scores))
+	for id, s := range scores {
+		hits = append(hits, Hit{ID: id, Score: s})
+	}
+	slices.SortFunc(hits, func(a, b Hit) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return hits
+}
+
+// weight the highest weight of the fields
+func weight(fields uint8) float64 {
+	w := 0.0
+	for x, f := range Fields {
+		if fields&(1<<x) != 0 {
+			w = max(w, f.Weight)
+		}
+	}
+	return w
+}
@@ -0,0 +1,86 @@
+package search
+
+import "strings"
+
+// umlauts folding the german special characters for the phonetic code
+var phoneticFolder = strings.NewReplacer("ä", "a", "ö", "o", "ü", "u", "ß", "s")
+
+// Cologne computing the code of the Kölner Phonetik (cologne phonetics) of the word, a phonetic algorithm for german
+// words. Similar sounding words like Meier, Mayer and Maier get the same code. Characters other than a-z are ignored.
+func Cologne(word string) string {
+	w := []rune(phoneticFolder.Replace(strings.ToLower(word)))
+	letters := make([]rune, 0, len(w))
+	for _, r := range w {
+		if r >= 'a' && r <= 'z' {
+			letters = append(letters, r)
+		}
+	}
+	at := func(x int) rune {
+		if x < 0 || x >= len(letters) {
+			return 0
+		}
+		return letters[x]
+	}
+	codes := make([]byte, 0, len(letters)*2)
+	for x, r := range letters {
+		prev, next := at(x-1), at(x+1)
+		var c string
+		switch r {
+		case 'a', 'e', 'i', 'j', 'o', 'u', 'y':
+			c = "0"
+		case 'h':
+			// ignored
+		case 'b':
+			c = "1"
+		case 'p':
+			c = "1"
+			if next == 'h' {
+				c = "3"
+			}
+		case 'd', 't':
+			c = "2"
+			if strings.ContainsRune("csz", next) {
+				c = "8"
+			}
+		case 'f', 'v', 'w':
+			c = "3"
+		case 'g', 'k', 'q':
+			c = "4"
+		case 'c':
+			c = "8"
+			if x == 0 {
+				if strings.ContainsRune("ahkloqrux", next) {
+					c = "4"
+				}
+			} else if strings.ContainsRune("ahkoqux", next) && !strings.ContainsRune("sz", prev) {
+				c = "4"
+			}
+		case 'x':
+			c = "48"
+			if strings.ContainsRune("ckq", prev) {
+				c = "8"
+			}
+		case 'l':
+			c = "5"
+		case 'm', 'n':
+			c = "6"
+		case 'r':
+			c = "7"
+		case 's', 'z':
+			c = "8"
+		}
+		codes = append(codes, c...)
+	}
+	// removing repeated codes, then all 0 but the first
+	res := make([]byte, 0, len(codes))
+	for x, c := range codes {
+		if x > 0 && codes[x-1] == c {
+			continue
+		}
+		if c == '0' && len(res) > 0 {
+			continue
+		}
+		res = append(res, c)
+	}
+	return string(res)
+}
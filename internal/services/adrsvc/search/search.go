@@ -0,0 +1,144 @@
+// Package search the full text search of addresses with typo tolerance and phonetic matching, shared by the storages
+package search
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// Fields the searchable fields of an address with their weight in the ranking
+var Fields = []struct {
+	Name   string
+	Weight float64
+}{
+	{Name: "name", Weight: 3},
+	{Name: "firstname", Weight: 2},
+	{Name: "city", Weight: 1.5},
+	{Name: "street", Weight: 1},
+}
+
+// scores of the different kinds of matches of a term with a token
+const (
+	scoreExact    = 1.0
+	scorePrefix   = 0.8
+	scorePhonetic = 0.6
+	scoreInfix    = 0.5
+	scoreFuzzy    = 0.4
+)
+
+// CodePrefix the prefix of the phonetic codes in the fulltext indexes of the sql storages, so they are not mixed up with
+// numbers of the address and are longer than the minimal token size of mysql (innodb_ft_min_token_size, default 3)
+const CodePrefix = "kp"
+
+var folder = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss")
+
+// Words splitting the text into lower case words
+func Words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Tokens splitting the text into lower case words, umlauts are written as ae, oe, ue and ss
+func Tokens(s string) []string {
+	return Words(folder.Replace(strings.ToLower(s)))
+}
+
+// AddressTokens the tokens of every searchable field of the address
+func AddressTokens(adr pmodel.Address) [][]string {
+	ts := make([][]string, len(Fields))
+	for x, f := range Fields {
+		ts[x] = Tokens(adr.Field(f.Name))
+	}
+	return ts
+}
+
+// Codes the phonetic codes of all searchable tokens of the address, separated by space and without duplicates
+func Codes(adr pmodel.Address) string {
+	codes := make([]string, 0)
+	for _, ts := range AddressTokens(adr) {
+		for _, t := range ts {
+			if c := Cologne(t); c != "" && !slices.Contains(codes, c) {
+				codes = append(codes, c)
+			}
+		}
+	}
+	return strings.Join(codes, " ")
+}
+
+// PrefixedCodes the phonetic codes of the address like Codes, every code with the CodePrefix
+func PrefixedCodes(adr pmodel.Address) string {
+	codes := strings.Fields(Codes(adr))
+	for x, c := range codes {
+		codes[x] = CodePrefix + c
+	}
+	return strings.Join(codes, " ")
+}
+
+// maxDistance the number of typos tolerated for the term, longer terms can have more typos
+func maxDistance(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	}
+	return 2
+}
+
+// Match scoring the match of the query term with the token of an address, 0 for no match. The codes are the
+// phonetic codes of the term and the token.
+func Match(term, termCode, token, tokenCode string) float64 {
+	switch {
+	case token == term:
+		return scoreExact
+	case strings.HasPrefix(token, term):
+		return scorePrefix
+	case termCode != "" && termCode == tokenCode:
+		return scorePhonetic
+	case len(term) > 2 && strings.Contains(token, term):
+		return scoreInfix
+	}
+	limit := maxDistance(term)
+	if limit == 0 {
+		return 0
+	}
+	if d := Distance(term, token, limit); d <= limit {
+		return scoreFuzzy / float64(d)
+	}
+	return 0
+}
+
+// Distance the levenshtein distance of the two strings, the calculation stops at limit, a greater distance is
+// returned as limit+1
+func Distance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for y := range prev {
+		prev[y] = y
+	}
+	for x := 1; x <= len(ra); x++ {
+		cur[0] = x
+		rowMin := cur[0]
+		for y := 1; y <= len(rb); y++ {
+			cost := 1
+			if ra[x-1] == rb[y-1] {
+				cost = 0
+			}
+			cur[y] = min(prev[y]+1, cur[y-1]+1, prev[y-1]+cost)
+			rowMin = min(rowMin, cur[y])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, cur = cur, prev
+	}
+	return min(prev[len(rb)], limit+1)
+}
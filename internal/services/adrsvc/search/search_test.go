@@ -0,0 +1,83 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+func TestCologne(t *testing.T) {
+	ast := assert.New(t)
+	ast.Equal("65752682", Cologne("Müller-Lüdenscheidt"))
+	ast.Equal("3412", Cologne("Wikipedia"))
+	ast.Equal("17863", Cologne("Breschnew"))
+	ast.Equal("67", Cologne("Meier"))
+	ast.Equal(Cologne("Meier"), Cologne("Mayer"))
+	ast.Equal(Cologne("Schmidt"), Cologne("Schmitt"))
+	ast.Equal(Cologne("Müller"), Cologne("Mueller"))
+	ast.Equal("475", Cologne("Carl"))
+	ast.Equal("862", Cologne("Cent"))
+	ast.Equal("", Cologne("123"))
+}
+
+func TestPrefixedCodes(t *testing.T) {
+	ast := assert.New(t)
+	ast.Equal("kp67 kp456 kp764", PrefixedCodes(pmodel.Address{Name: "Meier", City: "Köln", Street: "Maier-Ring"}))
+	ast.Equal("", PrefixedCodes(pmodel.Address{Street: "123"}))
+}
+
+func TestDistance(t *testing.T) {
+	ast := assert.New(t)
+	ast.Equal(0, Distance("berlin", "berlin", 2))
+	ast.Equal(1, Distance("berlin", "berln", 2))
+	ast.Equal(3, Distance("kitten", "sitting", 3))
+	ast.Equal(3, Distance("kitten", "sitting", 2))
+	ast.Equal(3, Distance("a", "abcd", 2))
+}
+
+func TestIndex(t *testing.T) {
+	ast := assert.New(t)
+	idx := NewIndex()
+	adrs := []pmodel.Address{
+		{ID: "1", Name: "Meier", Firstname: "Hans", City: "München", Street: "Hauptstraße 1"},
+		{ID: "2", Name: "Schmidt", Firstname: "Anna", City: "Berlin", Street: "Unter den Linden 5"},
+		{ID: "3", Name: "Berliner", Firstname: "Klaus", City: "Hamburg", Street: "Elbchaussee 2"},
+		{ID: "4", Name: "Schmitz", Firstname: "Maier", City: "Köln", Street: "Domplatz 1"},
+	}
+	for _, adr := range adrs {
+		idx.Add(adr)
+	}
+
+	ids := func(hits []Hit) []string {
+		s := make([]string, len(hits))
+		for x, h := range hits {
+			s[x] = h.ID
+		}
+		return s
+	}
+	// phonetic, the name is ranked before the first name
+	ast.Equal([]string{"1", "4"}, ids(idx.Search("Mayer")))
+	// partial and typo
+	ast.Equal([]string{"3", "2"}, ids(idx.Search("berlin")))
+	ast.Equal([]string{"2"}, ids(idx.Search("Berlni anna")))
+	ast.Equal([]string{"2"}, ids(idx.Search("schmid berlin")))
+	ast.Equal([]string{"1"}, ids(idx.Search("muenchen")))
+	ast.Equal([]string{"1"}, ids(idx.Search("München hauptstr")))
+	ast.Empty(idx.Search("xyz"))
+	ast.Empty(idx.Search(" - "))
+
+	// the index follows the changes
+	idx.Remove(adrs[0])
+	ast.Equal([]string{"4"}, ids(idx.Search("Mayer")))
+	idx.Remove(adrs[1])
+	adrs[1].City = "Potsdam"
+	idx.Add(adrs[1])
+	ast.Equal([]string{"3"}, ids(idx.Search("berlin")))
+	ast.Equal([]string{"2"}, ids(idx.Search("potsdam")))
+	for _, adr := range adrs[1:] {
+		idx.Remove(adr)
+	}
+	ast.Empty(idx.postings)
+	ast.Empty(idx.codes)
+}
@@ -2,8 +2,11 @@ package adrsvc
 
 import (
 	"github.com/samber/do/v2"
+	"github.com/willie68/go-micro/internal/config"
 	"github.com/willie68/go-micro/internal/services/adrsvc/adrint"
 	"github.com/willie68/go-micro/internal/services/adrsvc/adrmysql"
+	"github.com/willie68/go-micro/internal/services/adrsvc/adrpostgres"
+	"github.com/willie68/go-micro/internal/services/adrsvc/adrsqlite"
 	"github.com/willie68/go-micro/internal/services/adrsvc/common"
 )
 
@@ -11,12 +14,13 @@ import (
 func New(inj do.Injector, cfn common.Config) error {
 	switch cfn.Type {
 	case "internal":
-		adrstg, err := adrint.NewAdrInt()
+		adrstg, err := newAdrInt(cfn)
 		if err != nil {
 			return err
 		}
 		do.ProvideValue(inj, adrstg)
-		return err
+		do.ProvideValue(inj, adrint.NewIdempotency(cfn.IdempotencyWindow(), cfn.IdempotencyReservation()))
+		return purger(inj, adrstg, cfn)
 	case "mysql":
 		c := adrmysql.Config{
 			Host:     cfn.Connection["host"].(string),
@@ -25,12 +29,96 @@ func New(inj do.Injector, cfn common.Config) error {
 			Username: cfn.Connection["username"].(string),
 			Password: cfn.Connection["password"].(string),
 		}
+		c.HistoryTable, _ = cfn.Connection["historytable"].(string)
 		sqlstg, err := adrmysql.NewAdrMdb(c)
 		if err != nil {
 			return err
 		}
 		do.ProvideValue(inj, sqlstg)
-		return err
+		// token revocations, idempotency keys and webhook subscriptions are stored in the same database
+		rt, _ := cfn.Connection["revocationtable"].(string)
+		do.ProvideValue(inj, adrmysql.NewRevocations(sqlstg, rt))
+		it, _ := cfn.Connection["idempotencytable"].(string)
+		do.ProvideValue(inj, adrmysql.NewIdempotency(sqlstg, it, cfn.IdempotencyWindow(), cfn.IdempotencyReservation()))
+		st, _ := cfn.Connection["subscriptiontable"].(string)
+		do.ProvideValue(inj, adrmysql.NewSubscriptions(sqlstg, st))
+		return purger(inj, sqlstg, cfn)
+	case "postgres":
+		c := adrpostgres.Config{}
+		c.URL, _ = cfn.Connection["url"].(string)
+		c.Host, _ = cfn.Connection["host"].(string)
+		c.Port, _ = cfn.Connection["port"].(int)
+		c.Database, _ = cfn.Connection["database"].(string)
+		c.Username, _ = cfn.Connection["username"].(string)
+		c.Password, _ = cfn.Connection["password"].(string)
+		c.SSLMode, _ = cfn.Connection["sslmode"].(string)
+		c.Schema, _ = cfn.Connection["schema"].(string)
+		c.Table, _ = cfn.Connection["table"].(string)
+		c.HistoryTable, _ = cfn.Connection["historytable"].(string)
+		pgstg, err := adrpostgres.NewAdrPg(c)
+		if err != nil {
+			return err
+		}
+		do.ProvideValue(inj, pgstg)
+		// token revocations, idempotency keys and webhook subscriptions are stored in the same database and schema
+		rt, _ := cfn.Connection["revocationtable"].(string)
+		do.ProvideValue(inj, adrpostgres.NewRevocations(pgstg, rt))
+		it, _ := cfn.Connection["idempotencytable"].(string)
+		do.ProvideValue(inj, adrpostgres.NewIdempotency(pgstg, it, cfn.IdempotencyWindow(), cfn.IdempotencyReservation()))
+		st, _ := cfn.Connection["subscriptiontable"].(string)
+		do.ProvideValue(inj, adrpostgres.NewSubscriptions(pgstg, st))
+		return purger(inj, pgstg, cfn)
+	case "sqlite":
+		file, _ := cfn.Connection["file"].(string)
+		file, err := config.ReplaceConfigdir(file)
+		if err != nil {
+			return err
+		}
+		c := adrsqlite.Config{
+			File: file,
+		}
+		c.Table, _ = cfn.Connection["table"].(string)
+		c.HistoryTable, _ = cfn.Connection["historytable"].(string)
+		c.BusyTimeout, _ = cfn.Connection["busytimeout"].(int)
+		litestg, err := adrsqlite.NewAdrSqlite(c)
+		if err != nil {
+			return err
+		}
+		do.ProvideValue(inj, litestg)
+		// token revocations are stored in the revocation file, idempotency keys and webhook subscriptions in the same
+		// database
+		it, _ := cfn.Connection["idempotencytable"].(string)
+		do.ProvideValue(inj, adrsqlite.NewIdempotency(litestg, it, cfn.IdempotencyWindow(), cfn.IdempotencyReservation()))
+		st, _ := cfn.Connection["subscriptiontable"].(string)
+		do.ProvideValue(inj, adrsqlite.NewSubscriptions(litestg, st))
+		return purger(inj, litestg, cfn)
 	}
 	return common.ErrNotFound
 }
+
+// newAdrInt creating the internal storage, persistent if a file is configured
+func newAdrInt(cfn common.Config) (*adrint.AdrInt, error) {
+	file, _ := cfn.Connection["file"].(string)
+	if file == "" {
+		return adrint.NewAdrInt()
+	}
+	file, err := config.ReplaceConfigdir(file)
+	if err != nil {
+		return nil, err
+	}
+	every, _ := cfn.Connection["snapshotevery"].(int)
+	return adrint.NewPersistentAdrInt(file, every)
+}
+
+// purger starting the purger of the trash, if purge days are configured
+func purger(inj do.Injector, stg trash, cfn common.Config) error {
+	if cfn.PurgeDays <= 0 {
+		return nil
+	}
+	p := NewPurger(stg, cfn.PurgeDays)
+	if err := p.Init(); err != nil {
+		return err
+	}
+	do.ProvideValue(inj, p)
+	return nil
+}
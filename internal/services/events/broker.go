@@ -0,0 +1,196 @@
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/samber/do/v2"
+	"github.com/willie68/go-micro/internal/logging"
+	"github.com/willie68/go-micro/internal/services/shttp"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// defaults of the event configuration
+const (
+	defaultReplay    = 1000
+	defaultHeartbeat = 10
+	defaultBuffer    = 64
+	// the heartbeat must be shorter than the write timeout of the server
+	maxHeartbeat = int(shttp.WriteTimeout/time.Second) - 1
+)
+
+var (
+	logger = logging.New("events")
+
+	streamGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gomicro_event_streams",
+		Help: "The number of connected event streams",
+	})
+	droppedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gomicro_event_streams_dropped_total",
+		Help: "The total number of event streams closed, because they didn't keep up with the events",
+	})
+)
+
+// Broker distributing the address changes to the subscribers of the tenant. The events get an ascending id, the last
+// events of every tenant are kept in a bounded replay buffer, so a subscriber can resume after the last received event.
+// Publishing never blocks, a subscriber, whose buffer is full, is closed.
+type Broker struct {
+	cfg    Config
+	lock   sync.Mutex
+	seq    uint64
+	replay map[string][]pmodel.Event
+	subs   map[string]map[*Subscriber]struct{}
+	closed bool
+}
+
+// Subscriber a subscriber of the events of a tenant
+type Subscriber struct {
+	tenant string
+	events chan pmodel.Event
+}
+
+// New creates the broker, if enabled, and provides it to the dependency injection
+func New(inj do.Injector, cfg Config) error {
+	if !cfg.Enable {
+		return nil
+	}
+	do.ProvideValue(inj, NewBroker(cfg))
+	return nil
+}
+
+// NewBroker creates a new broker
+func NewBroker(cfg Config) *Broker {
+	if cfg.Replay <= 0 {
+		cfg.Replay = defaultReplay
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = defaultHeartbeat
+	}
+	if cfg.Heartbeat > maxHeartbeat {
+		logger.Warn(fmt.Sprintf("heartbeat of %d seconds is not shorter than the write timeout, using %d seconds", cfg.Heartbeat, maxHeartbeat))
+		cfg.Heartbeat = maxHeartbeat
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = defaultBuffer
+	}
+	return &Broker{
+		cfg:    cfg,
+		replay: make(map[string][]pmodel.Event),
+		subs:   make(map[string]map[*Subscriber]struct{}),
+	}
+}
+
+// Heartbeat the time between the heartbeats of an idle stream
+func (b *Broker) Heartbeat() time.Duration {
+	return time.Duration(b.cfg.Heartbeat) * time.Second
+}
+
+// Publish publishing the change of the address to every subscriber of the tenant
+func (b *Broker) Publish(tenant, typ string, adr pmodel.Address) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return
+	}
+	b.seq++
+	ev := pmodel.Event{
+		ID:      strconv.FormatUint(b.seq, 10),
+		Type:    typ,
+		Tenant:  tenant,
+		Time:    time.Now().UTC(),
+		Address: adr,
+	}
+	buf := append(b.replay[tenant], ev)
+	if len(buf) > b.cfg.Replay {
+		buf = buf[len(buf)-b.cfg.Replay:]
+	}
+	b.replay[tenant] = buf
+	for s := range b.subs[tenant] {
+		select {
+		case s.events <- ev:
+		default:
+			logger.Warn(fmt.Sprintf("event stream of tenant %s is not keeping up, closing it", tenant))
+			droppedCounter.Inc()
+			b.remove(s)
+		}
+	}
+}
+
+// Subscribe subscribing to the events of the tenant. With the id of the last received event, the newer events of the
+// replay buffer are returned, all following events are sent to the subscriber. An unknown or empty id replays nothing.
+func (b *Broker) Subscribe(tenant, lastID string) (*Subscriber, []pmodel.Event) {
+	s := &Subscriber{
+		tenant: tenant,
+		events: make(chan pmodel.Event, b.cfg.Buffer),
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		close(s.events)
+		return s, nil
+	}
+	subs, ok := b.subs[tenant]
+	if !ok {
+		subs = make(map[*Subscriber]struct{})
+		b.subs[tenant] = subs
+	}
+	subs[s] = struct{}{}
+	streamGauge.Inc()
+	return s, b.since(tenant, lastID)
+}
+
+// Unsubscribe removing the subscriber, its channel is closed
+func (b *Broker) Unsubscribe(s *Subscriber) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.remove(s)
+}
+
+// Shutdown closing all subscribers, no more events are published
+func (b *Broker) Shutdown() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	for _, subs := range b.subs {
+		for s := range subs {
+			b.remove(s)
+		}
+	}
+}
+
+// Events the events of the subscriber, the channel is closed, when the subscriber is removed
+func (s *Subscriber) Events() <-chan pmodel.Event {
+	return s.events
+}
+
+// since the events of the replay buffer after the last id, must be called with the lock held
+func (b *Broker) since(tenant, lastID string) []pmodel.Event {
+	last, err := strconv.ParseUint(lastID, 10, 64)
+	if err != nil {
+		return nil
+	}
+	evs := make([]pmodel.Event, 0)
+	for _, ev := range b.replay[tenant] {
+		// the ids of the buffer are ascending and valid
+		if id, _ := strconv.ParseUint(ev.ID, 10, 64); id > last {
+			evs = append(evs, ev)
+		}
+	}
+	return evs
+}
+
+// remove removing and closing the subscriber, must be called with the lock held
+func (b *Broker) remove(s *Subscriber) {
+	subs := b.subs[s.tenant]
+	if _, ok := subs[s]; !ok {
+		return
+	}
+	delete(subs, s)
+	close(s.events)
+	streamGauge.Dec()
+}
@@ -0,0 +1,95 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+func TestBroker(t *testing.T) {
+	ast := assert.New(t)
+	b := NewBroker(Config{Enable: true})
+	defer b.Shutdown()
+	ast.Equal(10*time.Second, b.Heartbeat())
+	// the heartbeat is shorter than the write timeout
+	ast.Equal(14*time.Second, NewBroker(Config{Enable: true, Heartbeat: 15}).Heartbeat())
+	ast.Equal(time.Second, NewBroker(Config{Enable: true, Heartbeat: 1}).Heartbeat())
+
+	s1, replay := b.Subscribe("tenant1", "")
+	ast.Len(replay, 0)
+	s2, _ := b.Subscribe("tenant2", "")
+
+	b.Publish("tenant1", pmodel.EventAddressCreated, pmodel.Address{ID: "1", Name: "Smith"})
+	b.Publish("tenant2", pmodel.EventAddressCreated, pmodel.Address{ID: "2", Name: "Miller"})
+	b.Publish("tenant1", pmodel.EventAddressUpdated, pmodel.Address{ID: "1", Name: "Smith", Version: 2})
+
+	ev := <-s1.Events()
+	ast.Equal("1", ev.ID)
+	ast.Equal(pmodel.EventAddressCreated, ev.Type)
+	ast.Equal("tenant1", ev.Tenant)
+	ev = <-s1.Events()
+	ast.Equal("3", ev.ID)
+	ast.Equal(2, ev.Address.Version)
+	ev = <-s2.Events()
+	ast.Equal("2", ev.ID)
+	ast.Equal("Miller", ev.Address.Name)
+
+	b.Unsubscribe(s1)
+	_, ok := <-s1.Events()
+	ast.False(ok)
+	// a second unsubscribe is ignored
+	b.Unsubscribe(s1)
+}
+
+func TestBrokerReplay(t *testing.T) {
+	ast := assert.New(t)
+	b := NewBroker(Config{Enable: true, Replay: 3})
+	defer b.Shutdown()
+
+	for range 5 {
+		b.Publish("tenant1", pmodel.EventAddressCreated, pmodel.Address{Name: "Smith"})
+	}
+	b.Publish("tenant2", pmodel.EventAddressCreated, pmodel.Address{Name: "Miller"})
+
+	_, replay := b.Subscribe("tenant1", "3")
+	ast.Len(replay, 2)
+	ast.Equal("4", replay[0].ID)
+	ast.Equal("5", replay[1].ID)
+
+	// only the last 3 events are kept
+	_, replay = b.Subscribe("tenant1", "0")
+	ast.Len(replay, 3)
+	ast.Equal("3", replay[0].ID)
+
+	_, replay = b.Subscribe("tenant1", "5")
+	ast.Len(replay, 0)
+	_, replay = b.Subscribe("tenant1", "unknown")
+	ast.Len(replay, 0)
+}
+
+func TestBrokerBackPressure(t *testing.T) {
+	ast := assert.New(t)
+	b := NewBroker(Config{Enable: true, Buffer: 2})
+
+	slow, _ := b.Subscribe("tenant1", "")
+	fast, _ := b.Subscribe("tenant1", "")
+	for range 3 {
+		b.Publish("tenant1", pmodel.EventAddressCreated, pmodel.Address{Name: "Smith"})
+		<-fast.Events()
+	}
+
+	// the slow subscriber is closed after the buffered events
+	ast.Equal("1", (<-slow.Events()).ID)
+	ast.Equal("2", (<-slow.Events()).ID)
+	_, ok := <-slow.Events()
+	ast.False(ok)
+
+	b.Shutdown()
+	_, ok = <-fast.Events()
+	ast.False(ok)
+	s, _ := b.Subscribe("tenant1", "")
+	_, ok = <-s.Events()
+	ast.False(ok)
+}
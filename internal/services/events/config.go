@@ -0,0 +1,13 @@
+package events
+
+// Config configuration of the event streams of the address changes
+type Config struct {
+	// Enable the event streams
+	Enable bool `yaml:"enable"`
+	// Replay number of events per tenant kept for the resume of a stream with Last-Event-ID, default 1000
+	Replay int `yaml:"replay"`
+	// Heartbeat seconds between the heartbeats of an idle stream, default 10, at most 14, less than the write timeout
+	Heartbeat int `yaml:"heartbeat"`
+	// Buffer number of events buffered per stream, a stream not keeping up is closed, default 64
+	Buffer int `yaml:"buffer"`
+}
@@ -0,0 +1,21 @@
+package issuer
+
+// Config configuration of the built-in development token issuer. Never enable this in production.
+type Config struct {
+	// Enable the issuer endpoints
+	Enable bool `yaml:"enable"`
+	// Issuer the iss claim of the tokens, default is the service url with the issuer path
+	Issuer string `yaml:"issuer"`
+	// KeyFile pem file with the rsa signing key, will be generated if not present. Empty for a new key on every start.
+	KeyFile string `yaml:"keyfile"`
+	// Audience the aud claim of the tokens, empty for none
+	Audience string `yaml:"audience"`
+	// TTL default lifetime of the tokens in seconds
+	TTL int `yaml:"ttl"`
+	// TenantClaim claim for the tenant of the token, default Tenant
+	TenantClaim string `yaml:"tenantClaim"`
+	// TenantsClaim claim for the list of tenants of the token, default tenants
+	TenantsClaim string `yaml:"tenantsClaim"`
+	// RoleClaim dot separated claim path for the roles of the token, default realm_access.roles
+	RoleClaim string `yaml:"roleClaim"`
+}
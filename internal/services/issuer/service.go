@@ -0,0 +1,278 @@
+package issuer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/samber/do/v2"
+	"github.com/willie68/go-micro/internal/logging"
+)
+
+// Subpath the path of the issuer endpoints, relative to the service url
+const Subpath = "/issuer"
+
+// Algorithm the signing algorithm of the tokens
+const Algorithm = "RS256"
+
+// defaults of the issuer configuration
+const (
+	defaultTTL          = 3600
+	defaultTenantClaim  = "Tenant"
+	defaultTenantsClaim = "tenants"
+	defaultRoleClaim    = "realm_access.roles"
+)
+
+var logger = logging.New("issuer")
+
+// Issuer the development token issuer, signing tokens with its own rsa key
+type Issuer struct {
+	cfg Config
+	key *rsa.PrivateKey
+	kid string
+}
+
+// TokenRequest the parameters of a new token
+type TokenRequest struct {
+	Subject string   `json:"sub"`
+	Tenant  string   `json:"tenant,omitempty"`
+	Tenants []string `json:"tenants,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	// TTL lifetime of the token in seconds, 0 for the configured default
+	TTL int `json:"ttl,omitempty"`
+	// Claims additional claims of the token
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+// TokenResponse the response of the token endpoint
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// New creates the issuer, if enabled, and provides it to the dependency injection
+func New(inj do.Injector, cfg Config, serviceURL string) error {
+	if !cfg.Enable {
+		return nil
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = strings.TrimSuffix(serviceURL, "/") + Subpath
+	}
+	iss, err := NewIssuer(cfg)
+	if err != nil {
+		return err
+	}
+	logger.Warn(fmt.Sprintf("development token issuer enabled: %s", cfg.Issuer))
+	do.ProvideValue(inj, iss)
+	return nil
+}
+
+// NewIssuer creates a new issuer, the signing key is loaded from or generated into the key file
+func NewIssuer(cfg Config) (*Issuer, error) {
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultTTL
+	}
+	if cfg.TenantClaim == "" {
+		cfg.TenantClaim = defaultTenantClaim
+	}
+	if cfg.TenantsClaim == "" {
+		cfg.TenantsClaim = defaultTenantsClaim
+	}
+	if cfg.RoleClaim == "" {
+		cfg.RoleClaim = defaultRoleClaim
+	}
+	key, err := signingKey(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Issuer{
+		cfg: cfg,
+		key: key,
+		kid: thumbprint(&key.PublicKey),
+	}, nil
+}
+
+func signingKey(file string) (*rsa.PrivateKey, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			return parseKey(data)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("can't read issuer key file: %v", err)
+		}
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		if err := os.WriteFile(file, data, 0o600); err != nil {
+			return nil, fmt.Errorf("can't write issuer key file: %v", err)
+		}
+	}
+	return key, nil
+}
+
+func parseKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("issuer key file is not pem encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	pk, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse issuer key: %v", err)
+	}
+	key, ok := pk.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("issuer key is not a rsa key")
+	}
+	return key, nil
+}
+
+// thumbprint the RFC 7638 thumbprint of the key, used as kid
+func thumbprint(pub *rsa.PublicKey) string {
+	s := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, b64(big.NewInt(int64(pub.E)).Bytes()), b64(pub.N.Bytes()))
+	sum := sha256.Sum256([]byte(s))
+	return b64(sum[:])
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Issuer the iss claim of the tokens
+func (i *Issuer) Issuer() string {
+	return i.cfg.Issuer
+}
+
+// KeyID the kid of the signing key
+func (i *Issuer) KeyID() string {
+	return i.kid
+}
+
+// PublicKey the public key for verifying the tokens
+func (i *Issuer) PublicKey() *rsa.PublicKey {
+	return &i.key.PublicKey
+}
+
+// JWKS the json web key set with the public key of the issuer
+func (i *Issuer) JWKS() map[string]any {
+	pub := i.PublicKey()
+	return map[string]any{
+		"keys": []any{
+			map[string]any{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": Algorithm,
+				"kid": i.kid,
+				"n":   b64(pub.N.Bytes()),
+				"e":   b64(big.NewInt(int64(pub.E)).Bytes()),
+			},
+		},
+	}
+}
+
+// Discovery the openid discovery document
+func (i *Issuer) Discovery() map[string]any {
+	return map[string]any{
+		"issuer":                                i.cfg.Issuer,
+		"jwks_uri":                              i.cfg.Issuer + "/.well-known/jwks.json",
+		"token_endpoint":                        i.cfg.Issuer + "/token",
+		"grant_types_supported":                 []string{"client_credentials"},
+		"response_types_supported":              []string{"token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{Algorithm},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "nbf", "jti", i.cfg.TenantClaim, i.cfg.TenantsClaim},
+	}
+}
+
+// Mint creating a new signed token
+func (i *Issuer) Mint(tr TokenRequest, now time.Time) (*TokenResponse, error) {
+	if tr.Subject == "" {
+		return nil, errors.New("subject is missing")
+	}
+	ttl := tr.TTL
+	if ttl <= 0 {
+		ttl = i.cfg.TTL
+	}
+	claims := make(map[string]any)
+	for k, v := range tr.Claims {
+		claims[k] = v
+	}
+	claims["iss"] = i.cfg.Issuer
+	claims["sub"] = tr.Subject
+	claims["jti"] = xid.New().String()
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(time.Duration(ttl) * time.Second).Unix()
+	if i.cfg.Audience != "" {
+		claims["aud"] = i.cfg.Audience
+	}
+	if tr.Tenant != "" {
+		claims[i.cfg.TenantClaim] = tr.Tenant
+	}
+	if len(tr.Tenants) > 0 {
+		claims[i.cfg.TenantsClaim] = tr.Tenants
+	}
+	if len(tr.Roles) > 0 {
+		setPath(claims, strings.Split(i.cfg.RoleClaim, "."), tr.Roles)
+	}
+	token, err := i.sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   ttl,
+	}, nil
+}
+
+// setPath setting the value into the claims, creating all needed sub objects
+func setPath(claims map[string]any, path []string, value any) {
+	for _, p := range path[:len(path)-1] {
+		sub, ok := claims[p].(map[string]any)
+		if !ok {
+			sub = make(map[string]any)
+			claims[p] = sub
+		}
+		claims = sub
+	}
+	claims[path[len(path)-1]] = value
+}
+
+func (i *Issuer) sign(claims map[string]any) (string, error) {
+	hb, err := json.Marshal(map[string]any{"alg": Algorithm, "typ": "JWT", "kid": i.kid})
+	if err != nil {
+		return "", err
+	}
+	pb, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := b64(hb) + "." + b64(pb)
+	hash := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return input + "." + b64(sig), nil
+}
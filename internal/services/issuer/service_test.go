@@ -0,0 +1,94 @@
+package issuer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samber/do/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodePart(t *testing.T, part string) map[string]any {
+	ast := assert.New(t)
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	ast.Nil(err)
+	var m map[string]any
+	ast.Nil(json.Unmarshal(b, &m))
+	return m
+}
+
+func TestMint(t *testing.T) {
+	ast := assert.New(t)
+	iss, err := NewIssuer(Config{Issuer: "https://localhost:8443/issuer", Audience: "go-micro"})
+	ast.Nil(err)
+
+	now := time.Now()
+	tr, err := iss.Mint(TokenRequest{
+		Subject: "tester",
+		Tenant:  "tenant1",
+		Tenants: []string{"tenant1", "tenant2"},
+		Roles:   []string{"object-reader"},
+		Claims:  map[string]any{"email": "tester@example.com"},
+	}, now)
+	ast.Nil(err)
+	ast.Equal("Bearer", tr.TokenType)
+	ast.Equal(defaultTTL, tr.ExpiresIn)
+
+	parts := strings.Split(tr.AccessToken, ".")
+	ast.Len(parts, 3)
+	header := decodePart(t, parts[0])
+	ast.Equal(Algorithm, header["alg"])
+	ast.Equal(iss.KeyID(), header["kid"])
+
+	claims := decodePart(t, parts[1])
+	ast.Equal("tester", claims["sub"])
+	ast.Equal("https://localhost:8443/issuer", claims["iss"])
+	ast.Equal("go-micro", claims["aud"])
+	ast.Equal("tenant1", claims["Tenant"])
+	ast.Equal([]any{"tenant1", "tenant2"}, claims["tenants"])
+	ast.Equal(map[string]any{"roles": []any{"object-reader"}}, claims["realm_access"])
+	ast.Equal("tester@example.com", claims["email"])
+	ast.Equal(float64(now.Add(time.Hour).Unix()), claims["exp"])
+
+	_, err = iss.Mint(TokenRequest{}, now)
+	ast.NotNil(err)
+}
+
+func TestKeyFile(t *testing.T) {
+	ast := assert.New(t)
+	file := filepath.Join(t.TempDir(), "issuer.pem")
+
+	iss1, err := NewIssuer(Config{KeyFile: file})
+	ast.Nil(err)
+	iss2, err := NewIssuer(Config{KeyFile: file})
+	ast.Nil(err)
+	ast.Equal(iss1.KeyID(), iss2.KeyID())
+	ast.True(iss1.PublicKey().Equal(iss2.PublicKey()))
+
+	iss3, err := NewIssuer(Config{})
+	ast.Nil(err)
+	ast.NotEqual(iss1.KeyID(), iss3.KeyID())
+
+	jwks := iss1.JWKS()
+	keys := jwks["keys"].([]any)
+	ast.Len(keys, 1)
+	ast.Equal(iss1.KeyID(), keys[0].(map[string]any)["kid"])
+}
+
+func TestNew(t *testing.T) {
+	ast := assert.New(t)
+	inj := do.New()
+	ast.Nil(New(inj, Config{Enable: false}, "https://localhost:8443"))
+	_, err := do.Invoke[*Issuer](inj)
+	ast.NotNil(err)
+
+	ast.Nil(New(inj, Config{Enable: true}, "https://localhost:8443/"))
+	iss, err := do.Invoke[*Issuer](inj)
+	ast.Nil(err)
+	ast.Equal("https://localhost:8443/issuer", iss.Issuer())
+	ast.Equal("https://localhost:8443/issuer/.well-known/jwks.json", iss.Discovery()["jwks_uri"])
+}
@@ -5,8 +5,11 @@ import (
 	"github.com/willie68/go-micro/internal/config"
 	"github.com/willie68/go-micro/internal/logging"
 	"github.com/willie68/go-micro/internal/services/adrsvc"
+	"github.com/willie68/go-micro/internal/services/events"
 	"github.com/willie68/go-micro/internal/services/health"
+	"github.com/willie68/go-micro/internal/services/issuer"
 	"github.com/willie68/go-micro/internal/services/shttp"
+	"github.com/willie68/go-micro/internal/services/webhooks"
 )
 
 var (
@@ -33,6 +36,26 @@ func InitServices(inj do.Injector, cfg config.Config) error {
 		return err
 	}
 
+	err = issuer.New(inj, cfg.Issuer, cfg.HTTP.ServiceURL)
+	if err != nil {
+		return err
+	}
+
+	whcfg := cfg.Webhooks
+	whcfg.SubscriptionFile, err = config.ReplaceConfigdir(whcfg.SubscriptionFile)
+	if err != nil {
+		return err
+	}
+	err = webhooks.New(inj, whcfg)
+	if err != nil {
+		return err
+	}
+
+	err = events.New(inj, cfg.Events)
+	if err != nil {
+		return err
+	}
+
 	return InitRESTService(inj, cfg)
 }
 
@@ -0,0 +1,92 @@
+package shttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// verification modes for client certificates
+const (
+	ClientAuthNone          = "none"
+	ClientAuthRequest       = "request"
+	ClientAuthRequire       = "require"
+	ClientAuthVerifyIfGiven = "verifyifgiven"
+)
+
+// ClientAuth configuration of the client certificate authentication (mTLS) of the https server
+type ClientAuth struct {
+	// Mode verification mode of the client certificate: none, request, require or verifyifgiven
+	Mode string `yaml:"mode"`
+	// CA path and name to the pem bundle with the accepted client CAs
+	CA string `yaml:"ca"`
+	// Identity source of the client identity: subject (common name) or san (first uri, dns name or email)
+	Identity string `yaml:"identity"`
+	// Tenant source of the client tenant: ou or o of the subject, empty for no tenant
+	Tenant string `yaml:"tenant"`
+}
+
+// Active client certificates are requested
+func (c ClientAuth) Active() bool {
+	m := c.mode()
+	return m != "" && m != ClientAuthNone
+}
+
+// TLSClientAuth getting the tls client auth type of the configured mode
+func (c ClientAuth) TLSClientAuth() (tls.ClientAuthType, error) {
+	switch c.mode() {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		return tls.RequestClientCert, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q", c.Mode)
+}
+
+// Apply setting the client authentication into the tls config
+func (c ClientAuth) Apply(tlsConfig *tls.Config) error {
+	ca, err := c.TLSClientAuth()
+	if err != nil {
+		return err
+	}
+	tlsConfig.ClientAuth = ca
+	if ca == tls.NoClientCert {
+		return nil
+	}
+	if c.CA == "" {
+		if ca == tls.RequestClientCert {
+			return nil
+		}
+		return fmt.Errorf("client auth mode %s needs a client ca bundle", c.Mode)
+	}
+	pool, err := loadCertPool(c.CA)
+	if err != nil {
+		return err
+	}
+	tlsConfig.ClientCAs = pool
+	return nil
+}
+
+func (c ClientAuth) mode() string {
+	return strings.ReplaceAll(strings.ToLower(c.Mode), "-", "")
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading client ca bundle")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in client ca bundle %s", file)
+	}
+	return pool, nil
+}
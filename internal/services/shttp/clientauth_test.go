@@ -0,0 +1,114 @@
+package shttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	ast := assert.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ast.Nil(err)
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent = &tmpl
+		parentKey = key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, parent, &key.PublicKey, parentKey)
+	ast.Nil(err)
+	cert, err := x509.ParseCertificate(der)
+	ast.Nil(err)
+	return cert, key
+}
+
+func TestClientAuthModes(t *testing.T) {
+	ast := assert.New(t)
+	tests := []struct {
+		mode string
+		auth tls.ClientAuthType
+	}{
+		{mode: "", auth: tls.NoClientCert},
+		{mode: "none", auth: tls.NoClientCert},
+		{mode: "request", auth: tls.RequestClientCert},
+		{mode: "Require", auth: tls.RequireAndVerifyClientCert},
+		{mode: "verify-if-given", auth: tls.VerifyClientCertIfGiven},
+	}
+	for _, tc := range tests {
+		ca, err := ClientAuth{Mode: tc.mode}.TLSClientAuth()
+		ast.Nil(err)
+		ast.Equal(tc.auth, ca, tc.mode)
+	}
+	_, err := ClientAuth{Mode: "always"}.TLSClientAuth()
+	ast.NotNil(err)
+
+	ast.False(ClientAuth{Mode: "none"}.Active())
+	ast.True(ClientAuth{Mode: "request"}.Active())
+
+	// verifying modes need the ca bundle
+	ast.NotNil(ClientAuth{Mode: "require"}.Apply(&tls.Config{}))
+	ast.Nil(ClientAuth{Mode: "request"}.Apply(&tls.Config{}))
+}
+
+func TestClientAuthHandshake(t *testing.T) {
+	ast := assert.New(t)
+	caCert, caKey := testCert(t, "test-ca", nil, nil)
+	clientCert, clientKey := testCert(t, "client", caCert, caKey)
+	otherCA, otherKey := testCert(t, "other-ca", nil, nil)
+	otherCert, otherClientKey := testCert(t, "other", otherCA, otherKey)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ast.Nil(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw}), 0o600))
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) > 0 {
+			_, _ = w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+		}
+	}))
+	srv.TLS = &tls.Config{}
+	ast.Nil(ClientAuth{Mode: "require", CA: caFile}.Apply(srv.TLS))
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(cert *x509.Certificate, key *ecdsa.PrivateKey) (*http.Response, error) {
+		tr := srv.Client().Transport.(*http.Transport).Clone()
+		if cert != nil {
+			tr.TLSClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}
+		}
+		cl := http.Client{Transport: tr}
+		return cl.Get(srv.URL)
+	}
+
+	res, err := get(clientCert, clientKey)
+	ast.Nil(err)
+	ast.Equal(http.StatusOK, res.StatusCode)
+	_ = res.Body.Close()
+
+	_, err = get(nil, nil)
+	ast.NotNil(err)
+
+	_, err = get(otherCert, otherClientKey)
+	ast.NotNil(err)
+}
@@ -18,4 +18,6 @@ type Config struct {
 	Certificate string `yaml:"certificate"`
 	// path and name to the private key
 	Key string `yaml:"key"`
+	// client certificate authentication (mTLS) of the https server
+	ClientAuth ClientAuth `yaml:"clientauth"`
 }
@@ -17,6 +17,13 @@ import (
 
 var logger = logging.New("shttp")
 
+// timeouts of the servers, streaming responses are exempt from the write timeout, see Streamer
+const (
+	WriteTimeout = time.Second * 15
+	ReadTimeout  = time.Second * 15
+	IdleTimeout  = time.Second * 60
+)
+
 // SHttp a service encapsulating http and https server
 type SHttp struct {
 	cfn     Config
@@ -117,14 +124,19 @@ func (s *SHttp) startHTTPSServer(router *chi.Mux) {
 			}
 		}
 	}
+	if err := s.cfn.ClientAuth.Apply(tlsConfig); err != nil {
+		logger.Warn(fmt.Sprintf("could not configure client authentication. %s", err.Error()))
+		panic(-1)
+	}
 	s.sslsrv = &http.Server{
 		Addr:         "0.0.0.0:" + strconv.Itoa(s.cfn.Sslport),
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
+		WriteTimeout: WriteTimeout,
+		ReadTimeout:  ReadTimeout,
+		IdleTimeout:  IdleTimeout,
 		Handler:      router,
 		TLSConfig:    tlsConfig,
 	}
+	withShutdown(s.sslsrv)
 	go func() {
 		logger.Info(fmt.Sprintf("starting https server on address: %s", s.sslsrv.Addr))
 		if err := s.sslsrv.ListenAndServeTLS("", ""); err != nil {
@@ -137,11 +149,12 @@ func (s *SHttp) startHTTPServer(router *chi.Mux) {
 	// own http server for the healthchecks
 	s.srv = &http.Server{
 		Addr:         "0.0.0.0:" + strconv.Itoa(s.cfn.Port),
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
+		WriteTimeout: WriteTimeout,
+		ReadTimeout:  ReadTimeout,
+		IdleTimeout:  IdleTimeout,
 		Handler:      router,
 	}
+	withShutdown(s.srv)
 	go func() {
 		logger.Info(fmt.Sprintf("starting http server on address: %s", s.srv.Addr))
 		if err := s.srv.ListenAndServe(); err != nil {
@@ -0,0 +1,64 @@
+package shttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+type shutdownKey struct{}
+
+// withShutdown adding a channel to the base context of the requests of the server, which is closed, when the server
+// shuts down, so long-lived streams can be ended
+func withShutdown(srv *http.Server) {
+	done := make(chan struct{})
+	srv.BaseContext = func(net.Listener) context.Context {
+		return context.WithValue(context.Background(), shutdownKey{}, done)
+	}
+	srv.RegisterOnShutdown(func() {
+		close(done)
+	})
+}
+
+// Streamer a long-lived streaming response, e.g. server-sent events. The response is exempt from the write timeout of
+// the server, instead every write has its own deadline, so a stalled client can't block the stream forever. Every
+// write is flushed to the client.
+type Streamer struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+	// Done is closed, when the server shuts down, nil if the server isn't signaling it
+	Done <-chan struct{}
+}
+
+// NewStreamer creates a streamer for the response, the response writer must support write deadlines and flushing
+func NewStreamer(w http.ResponseWriter, r *http.Request) (*Streamer, error) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	done, _ := r.Context().Value(shutdownKey{}).(chan struct{})
+	return &Streamer{
+		w:       w,
+		rc:      rc,
+		timeout: WriteTimeout,
+		Done:    done,
+	}, nil
+}
+
+// Write writing and flushing the data within the write timeout. The deadline is cleared after the flush, with http/2
+// an expired deadline resets the stream, even if no write is pending.
+func (s *Streamer) Write(p []byte) (int, error) {
+	if err := s.rc.SetWriteDeadline(time.Now().Add(s.timeout)); err != nil {
+		return 0, err
+	}
+	n, err := s.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := s.rc.Flush(); err != nil {
+		return n, err
+	}
+	return n, s.rc.SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,90 @@
+package shttp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamer(t *testing.T) {
+	ast := assert.New(t)
+	ended := make(chan bool, 1)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := NewStreamer(w, r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// the stream is longer than the write timeout of the server
+		for i := range 3 {
+			if _, err := fmt.Fprintf(s, "line %d\n", i); err != nil {
+				return
+			}
+			time.Sleep(150 * time.Millisecond)
+		}
+		<-s.Done
+		ended <- true
+	}))
+	ts.Config.WriteTimeout = 200 * time.Millisecond
+	withShutdown(ts.Config)
+	ts.Start()
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	ast.Nil(err)
+	defer res.Body.Close()
+	sc := bufio.NewScanner(res.Body)
+	for i := range 3 {
+		ast.True(sc.Scan())
+		ast.Equal(fmt.Sprintf("line %d", i), sc.Text())
+	}
+
+	// the shutdown ends the stream
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_ = ts.Config.Shutdown(ctx)
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Error("stream not ended on shutdown")
+	}
+}
+
+func TestStreamerHTTP2(t *testing.T) {
+	ast := assert.New(t)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := NewStreamer(w, r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.timeout = 200 * time.Millisecond
+		// the stream is idle longer than the write timeout
+		for i := range 2 {
+			if _, err := fmt.Fprintf(s, "line %d\n", i); err != nil {
+				return
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	res, err := ts.Client().Get(ts.URL)
+	ast.Nil(err)
+	defer res.Body.Close()
+	ast.Equal(2, res.ProtoMajor)
+	sc := bufio.NewScanner(res.Body)
+	for i := range 2 {
+		ast.True(sc.Scan())
+		ast.Equal(fmt.Sprintf("line %d", i), sc.Text())
+	}
+	ast.Nil(sc.Err())
+}
@@ -0,0 +1,23 @@
+package webhooks
+
+// Config configuration of the webhook deliveries
+type Config struct {
+	// Enable the webhook subscriptions and deliveries
+	Enable bool `yaml:"enable"`
+	// Workers number of parallel deliveries, default 4
+	Workers int `yaml:"workers"`
+	// Attempts maximal number of attempts of a delivery, before it's moved to the dead letters, default 8
+	Attempts int `yaml:"attempts"`
+	// Backoff seconds to wait before the first retry, doubled with every further retry, default 1
+	Backoff int `yaml:"backoff"`
+	// MaxBackoff maximal seconds to wait before a retry, default 300
+	MaxBackoff int `yaml:"maxbackoff"`
+	// Timeout seconds to wait for the response of the receiver, default 10
+	Timeout int `yaml:"timeout"`
+	// History number of deliveries kept per tenant, the oldest finished deliveries are removed first, default 1000
+	History int `yaml:"history"`
+	// SubscriptionFile file to persist the subscriptions in, if the address storage has no subscription storage
+	SubscriptionFile string `yaml:"subscriptionfile"`
+	// AllowPrivate allows deliveries to loopback, private and link-local addresses, only for local tests, default false
+	AllowPrivate bool `yaml:"allowprivate"`
+}
@@ -0,0 +1,566 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/xid"
+	"github.com/samber/do/v2"
+	"github.com/willie68/go-micro/internal/logging"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// Subpath the path of the webhook endpoints, relative to the api base url
+const Subpath = "/webhooks"
+
+// defaults of the webhook configuration
+const (
+	defaultWorkers    = 4
+	defaultAttempts   = 8
+	defaultBackoff    = 1
+	defaultMaxBackoff = 300
+	defaultTimeout    = 10
+	defaultHistory    = 1000
+	queueSize         = 1000
+	// maximal size of a response body, which is read, so the connection can be reused
+	maxResponseBody = 64 * 1024
+)
+
+// Errors of the dispatcher
+var (
+	ErrNotFound       = errors.New("not found")
+	ErrNotDead        = errors.New("delivery is not dead")
+	ErrPrivateAddress = errors.New("receiver has a loopback, private, link-local or reserved address")
+)
+
+// deniedPrefixes the special purpose ranges of the iana registries, which are no public unicast addresses, beside
+// the loopback, private, link-local, multicast and unspecified addresses
+var deniedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // this network
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space, carrier-grade nat
+	netip.MustParsePrefix("192.0.0.0/24"),    // ietf protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation, test-net-1
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay anycast
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation, test-net-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation, test-net-3
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, including the limited broadcast
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use nat64
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001::/23"),       // ietf protocol assignments, e.g. teredo and benchmarking
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("3fff::/20"),       // documentation
+	netip.MustParsePrefix("fc00::/7"),        // unique local
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+}
+
+var (
+	// nat64 the well-known prefix of nat64, the last 32 bits are the ipv4 address
+	nat64 = netip.MustParsePrefix("64:ff9b::/96")
+	// sixToFour the prefix of 6to4, the bits 16 to 47 are the ipv4 address
+	sixToFour = netip.MustParsePrefix("2002::/16")
+)
+
+var (
+	logger = logging.New("webhooks")
+
+	deliveryCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gomicro_webhook_deliveries_total",
+		Help: "The total number of webhook delivery attempts by result, delivered, failed or dead",
+	}, []string{"result"})
+	pendingGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gomicro_webhook_pending_deliveries",
+		Help: "The number of webhook deliveries, which are not delivered and not dead",
+	})
+)
+
+// Dispatcher the webhook subscriptions of the tenants and the asynchronous deliveries of the events. A failed delivery
+// is retried with an exponential backoff, until the maximal number of attempts is reached and the delivery is moved
+// to the dead letters. The subscriptions are persisted in the subscription storage, if present, the deliveries and
+// the dead letters are kept in memory only.
+type Dispatcher struct {
+	cfg        Config
+	backoff    time.Duration
+	maxBackoff time.Duration
+	client     *http.Client
+	stg        SubscriptionStorage
+	lock       sync.Mutex
+	subs       map[string]map[string]pmodel.Subscription
+	deliveries map[string][]*delivery
+	queue      chan *delivery
+	done       chan struct{}
+	wg         sync.WaitGroup
+	closed     bool
+}
+
+// delivery one delivery with the tenant and the marshalled event, all fields are guarded by the lock of the dispatcher
+type delivery struct {
+	pmodel.Delivery
+	tenant  string
+	payload []byte
+	timer   *time.Timer
+}
+
+// New creates the dispatcher, if enabled, and provides it to the dependency injection. The subscriptions are stored
+// in the subscription storage of the address storage, if present, otherwise in the configured file. The configdir
+// macro of the file has to be replaced already.
+func New(inj do.Injector, cfg Config) error {
+	if !cfg.Enable {
+		return nil
+	}
+	var stg SubscriptionStorage
+	if s, err := do.InvokeAs[SubscriptionStorage](inj); err == nil {
+		stg = s
+	} else if cfg.SubscriptionFile != "" {
+		stg = NewFileSubscriptions(cfg.SubscriptionFile)
+	} else {
+		logger.Warn("no subscription storage configured, webhook subscriptions will be lost on restart")
+	}
+	logger.Warn("webhook deliveries and dead letters are kept in memory, pending deliveries will be lost on restart")
+	d := NewDispatcher(cfg, stg)
+	if err := d.Init(); err != nil {
+		return err
+	}
+	do.ProvideValue(inj, d)
+	return nil
+}
+
+// NewDispatcher creates a new dispatcher, the workers are started with Init. The storage can be nil, then the
+// subscriptions are kept in memory only.
+func NewDispatcher(cfg Config, stg SubscriptionStorage) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = defaultAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.History <= 0 {
+		cfg.History = defaultHistory
+	}
+	return &Dispatcher{
+		cfg:        cfg,
+		backoff:    time.Duration(cfg.Backoff) * time.Second,
+		maxBackoff: time.Duration(cfg.MaxBackoff) * time.Second,
+		client:     newClient(cfg),
+		stg:        stg,
+		subs:       make(map[string]map[string]pmodel.Subscription),
+		deliveries: make(map[string][]*delivery),
+		queue:      make(chan *delivery, queueSize),
+		done:       make(chan struct{}),
+	}
+}
+
+// newClient creating the http client of the deliveries. Redirects are not followed and only public addresses are
+// dialed, unless private addresses are allowed, so the subscriptions can't be used to probe the internal network.
+func newClient(cfg Config) *http.Client {
+	dialer := &net.Dialer{Timeout: time.Duration(cfg.Timeout) * time.Second}
+	if !cfg.AllowPrivate {
+		dialer.Control = public
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would be dialed instead of the receiver
+	tr.Proxy = nil
+	tr.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   time.Duration(cfg.Timeout) * time.Second,
+		Transport: tr,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// public a dialer control refusing connections to all but public unicast addresses. It checks the resolved address,
+// so a host name of an internal address is refused, too.
+func public(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublic(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
+
+// isPublic checking if the address is a public unicast address. The ipv4 addresses embedded in mapped, nat64 and
+// 6to4 addresses are checked, too.
+func isPublic(ip netip.Addr) bool {
+	ip = ip.WithZone("").Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, p := range deniedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	b := ip.As16()
+	switch {
+	case nat64.Contains(ip):
+		return isPublic(netip.AddrFrom4([4]byte(b[12:16])))
+	case sixToFour.Contains(ip):
+		return isPublic(netip.AddrFrom4([4]byte(b[2:6])))
+	}
+	return true
+}
+
+// Init loading the stored subscriptions and starting the delivery workers
+func (d *Dispatcher) Init() error {
+	if d.stg != nil {
+		subs, err := d.stg.Subscriptions()
+		if err != nil {
+			return fmt.Errorf("can't load webhook subscriptions: %w", err)
+		}
+		d.lock.Lock()
+		for tenant, ts := range subs {
+			d.subs[tenant] = make(map[string]pmodel.Subscription, len(ts))
+			for _, sub := range ts {
+				d.subs[tenant][sub.ID] = sub
+			}
+		}
+		d.lock.Unlock()
+	}
+	for range d.cfg.Workers {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for {
+				select {
+				case <-d.done:
+					return
+				case dl := <-d.queue:
+					d.attempt(dl)
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// Shutdown stopping the workers and the scheduled retries, pending deliveries are not delivered anymore
+func (d *Dispatcher) Shutdown() {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return
+	}
+	d.closed = true
+	for _, dls := range d.deliveries {
+		for _, dl := range dls {
+			if dl.timer != nil {
+				dl.timer.Stop()
+			}
+		}
+	}
+	close(d.done)
+	d.lock.Unlock()
+	d.wg.Wait()
+}
+
+// Subscribe adding a new subscription to the tenant, the returned subscription has the new id, but no secret
+func (d *Dispatcher) Subscribe(tenant string, sub pmodel.Subscription) (pmodel.Subscription, error) {
+	sub.ID = xid.New().String()
+	// the storages keep the creation in seconds
+	sub.Created = time.Now().UTC().Truncate(time.Second)
+	sub.Events = slices.Compact(slices.Sorted(slices.Values(sub.Events)))
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.stg != nil {
+		if err := d.stg.StoreSubscription(tenant, sub); err != nil {
+			return pmodel.Subscription{}, err
+		}
+	}
+	subs, ok := d.subs[tenant]
+	if !ok {
+		subs = make(map[string]pmodel.Subscription)
+		d.subs[tenant] = subs
+	}
+	subs[sub.ID] = sub
+	sub.Secret = ""
+	return sub, nil
+}
+
+// Subscriptions getting all subscriptions of the tenant, sorted by creation, without the secrets
+func (d *Dispatcher) Subscriptions(tenant string) []pmodel.Subscription {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	subs := make([]pmodel.Subscription, 0, len(d.subs[tenant]))
+	for _, sub := range d.subs[tenant] {
+		sub.Secret = ""
+		subs = append(subs, sub)
+	}
+	slices.SortFunc(subs, func(a, b pmodel.Subscription) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return subs
+}
+
+// Subscription getting the subscription of the tenant with the id, without the secret
+func (d *Dispatcher) Subscription(tenant, id string) (*pmodel.Subscription, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	sub, ok := d.subs[tenant][id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	sub.Secret = ""
+	return &sub, nil
+}
+
+// Unsubscribe deleting the subscription of the tenant, the pending deliveries of the subscription are moved to the
+// dead letters on their next attempt
+func (d *Dispatcher) Unsubscribe(tenant, id string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.subs[tenant][id]; !ok {
+		return ErrNotFound
+	}
+	if d.stg != nil {
+		if err := d.stg.DeleteSubscription(tenant, id); err != nil {
+			return err
+		}
+	}
+	delete(d.subs[tenant], id)
+	return nil
+}
+
+// Publish publishing the change of the address to every subscription of the tenant for the event type, the events
+// are delivered asynchronously
+func (d *Dispatcher) Publish(tenant, typ string, adr pmodel.Address) {
+	ev := pmodel.Event{
+		ID:      xid.New().String(),
+		Type:    typ,
+		Tenant:  tenant,
+		Time:    time.Now().UTC(),
+		Address: adr,
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		logger.Error(fmt.Sprintf("can't marshal event %s: %v", ev.ID, err))
+		return
+	}
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return
+	}
+	dls := make([]*delivery, 0)
+	for _, sub := range d.subs[tenant] {
+		if !slices.Contains(sub.Events, typ) {
+			continue
+		}
+		dl := &delivery{
+			Delivery: pmodel.Delivery{
+				ID:           xid.New().String(),
+				Subscription: sub.ID,
+				Event:        ev,
+				Status:       pmodel.DeliveryPending,
+				Created:      ev.Time,
+				Updated:      ev.Time,
+			},
+			tenant:  tenant,
+			payload: payload,
+		}
+		dls = append(dls, dl)
+		d.deliveries[tenant] = append(d.deliveries[tenant], dl)
+	}
+	d.trim(tenant)
+	d.lock.Unlock()
+	for _, dl := range dls {
+		pendingGauge.Inc()
+		d.enqueue(dl)
+	}
+}
+
+// Deliveries getting the deliveries of the subscription of the tenant, sorted by creation
+func (d *Dispatcher) Deliveries(tenant, id string) ([]pmodel.Delivery, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.subs[tenant][id]; !ok {
+		return nil, ErrNotFound
+	}
+	return d.filter(tenant, func(dl *delivery) bool {
+		return dl.Subscription == id
+	}), nil
+}
+
+// DeadLetters getting the dead deliveries of the tenant, sorted by creation
+func (d *Dispatcher) DeadLetters(tenant string) []pmodel.Delivery {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.filter(tenant, func(dl *delivery) bool {
+		return dl.Status == pmodel.DeliveryDead
+	})
+}
+
+// Redeliver delivering a dead delivery of the tenant again, with a new set of attempts
+func (d *Dispatcher) Redeliver(tenant, id string) (*pmodel.Delivery, error) {
+	d.lock.Lock()
+	idx := slices.IndexFunc(d.deliveries[tenant], func(dl *delivery) bool {
+		return dl.ID == id
+	})
+	if idx < 0 {
+		d.lock.Unlock()
+		return nil, ErrNotFound
+	}
+	dl := d.deliveries[tenant][idx]
+	if dl.Status != pmodel.DeliveryDead {
+		d.lock.Unlock()
+		return nil, ErrNotDead
+	}
+	dl.Status = pmodel.DeliveryPending
+	dl.Attempts = 0
+	dl.Updated = time.Now().UTC()
+	res := dl.Delivery
+	d.lock.Unlock()
+	pendingGauge.Inc()
+	d.enqueue(dl)
+	return &res, nil
+}
+
+// filter copying the matching deliveries of the tenant, must be called with the lock held
+func (d *Dispatcher) filter(tenant string, match func(dl *delivery) bool) []pmodel.Delivery {
+	res := make([]pmodel.Delivery, 0)
+	for _, dl := range d.deliveries[tenant] {
+		if match(dl) {
+			res = append(res, dl.Delivery)
+		}
+	}
+	return res
+}
+
+// trim removing the oldest finished deliveries of the tenant, if there are more than the history, must be called with
+// the lock held
+func (d *Dispatcher) trim(tenant string) {
+	dls := d.deliveries[tenant]
+	remove := len(dls) - d.cfg.History
+	if remove <= 0 {
+		return
+	}
+	d.deliveries[tenant] = slices.DeleteFunc(dls, func(dl *delivery) bool {
+		if remove > 0 && dl.Status != pmodel.DeliveryPending {
+			remove--
+			return true
+		}
+		return false
+	})
+}
+
+// enqueue queueing the delivery for the next attempt, if the queue is full, the attempt is scheduled later
+func (d *Dispatcher) enqueue(dl *delivery) {
+	select {
+	case d.queue <- dl:
+	default:
+		d.lock.Lock()
+		d.schedule(dl, d.backoff)
+		d.lock.Unlock()
+	}
+}
+
+// schedule scheduling the next attempt of the delivery after the wait, must be called with the lock held
+func (d *Dispatcher) schedule(dl *delivery, wait time.Duration) {
+	if d.closed {
+		return
+	}
+	next := time.Now().Add(wait).UTC()
+	dl.NextAttempt = &next
+	dl.timer = time.AfterFunc(wait, func() {
+		d.enqueue(dl)
+	})
+}
+
+// wait the backoff before the next attempt, doubled with every attempt up to the maximal backoff
+func (d *Dispatcher) wait(attempts int) time.Duration {
+	w := d.backoff
+	for i := 1; i < attempts && w < d.maxBackoff; i++ {
+		w *= 2
+	}
+	return min(w, d.maxBackoff)
+}
+
+// attempt one attempt of the delivery, a failed delivery is scheduled for a retry or moved to the dead letters
+func (d *Dispatcher) attempt(dl *delivery) {
+	d.lock.Lock()
+	sub, ok := d.subs[dl.tenant][dl.Subscription]
+	dl.Attempts++
+	dl.NextAttempt = nil
+	d.lock.Unlock()
+
+	status := 0
+	err := errors.New("subscription deleted")
+	if ok {
+		status, err = d.post(sub, dl)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	dl.Updated = time.Now().UTC()
+	dl.ResponseStatus = status
+	dl.LastError = ""
+	if err == nil {
+		dl.Status = pmodel.DeliveryDelivered
+		deliveryCounter.WithLabelValues("delivered").Inc()
+		pendingGauge.Dec()
+		return
+	}
+	dl.LastError = err.Error()
+	if !ok || dl.Attempts >= d.cfg.Attempts {
+		dl.Status = pmodel.DeliveryDead
+		deliveryCounter.WithLabelValues("dead").Inc()
+		pendingGauge.Dec()
+		logger.Warn(fmt.Sprintf("webhook delivery %s of tenant %s is dead after %d attempts: %v", dl.ID, dl.tenant, dl.Attempts, err))
+		return
+	}
+	deliveryCounter.WithLabelValues("failed").Inc()
+	d.schedule(dl, d.wait(dl.Attempts))
+}
+
+// post posting the signed event to the receiver, every response other than 2xx is an error
+func (d *Dispatcher) post(sub pmodel.Subscription, dl *delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(dl.payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-micro-webhooks")
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, time.Now(), dl.payload))
+	req.Header.Set(EventHeader, dl.Event.Type)
+	req.Header.Set(DeliveryHeader, dl.ID)
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxResponseBody))
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return res.StatusCode, fmt.Errorf("receiver responded with status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,295 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+const secret = "0123456789abcdef"
+
+// receiver a local webhook receiver, answering with the status of the status function
+type receiver struct {
+	srv    *httptest.Server
+	lock   sync.Mutex
+	events []pmodel.Event
+	calls  atomic.Int32
+}
+
+func newReceiver(t *testing.T, status func(call int) int) *receiver {
+	r := &receiver{}
+	r.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		call := int(r.calls.Add(1))
+		body, _ := io.ReadAll(req.Body)
+		if err := Verify(secret, req.Header.Get(SignatureHeader), body, time.Minute); err != nil {
+			t.Errorf("invalid signature: %v", err)
+		}
+		var ev pmodel.Event
+		if err := json.Unmarshal(body, &ev); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		if ev.Type != req.Header.Get(EventHeader) {
+			t.Errorf("wrong event header: %s", req.Header.Get(EventHeader))
+		}
+		s := status(call)
+		if s == http.StatusOK {
+			r.lock.Lock()
+			r.events = append(r.events, ev)
+			r.lock.Unlock()
+		}
+		w.WriteHeader(s)
+	}))
+	t.Cleanup(r.srv.Close)
+	return r
+}
+
+func (r *receiver) received() []pmodel.Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]pmodel.Event{}, r.events...)
+}
+
+func newTestDispatcher(t *testing.T, attempts int) *Dispatcher {
+	d := NewDispatcher(Config{Enable: true, Attempts: attempts, AllowPrivate: true}, nil)
+	d.backoff = 10 * time.Millisecond
+	d.maxBackoff = 40 * time.Millisecond
+	assert.Nil(t, d.Init())
+	t.Cleanup(d.Shutdown)
+	return d
+}
+
+func TestSignature(t *testing.T) {
+	ast := assert.New(t)
+	payload := []byte(`{"id":"1"}`)
+	now := time.Now()
+
+	sig := Sign(secret, now, payload)
+	ast.Nil(Verify(secret, sig, payload, time.Minute))
+	ast.ErrorIs(Verify("otherotherother1", sig, payload, time.Minute), ErrInvalidSignature)
+	ast.ErrorIs(Verify(secret, sig, []byte(`{"id":"2"}`), time.Minute), ErrInvalidSignature)
+	ast.ErrorIs(Verify(secret, "v1=abc", payload, 0), ErrInvalidSignature)
+
+	old := Sign(secret, now.Add(-time.Hour), payload)
+	ast.ErrorIs(Verify(secret, old, payload, time.Minute), ErrSignatureExpired)
+	ast.Nil(Verify(secret, old, payload, 0))
+}
+
+func TestDelivery(t *testing.T) {
+	ast := assert.New(t)
+	d := newTestDispatcher(t, 3)
+	rcv := newReceiver(t, func(int) int { return http.StatusOK })
+
+	sub, _ := d.Subscribe("tenant1", pmodel.Subscription{URL: rcv.srv.URL, Events: []string{pmodel.EventAddressCreated, pmodel.EventAddressDeleted}, Secret: secret})
+	ast.NotEmpty(sub.ID)
+	ast.Empty(sub.Secret)
+	ast.Len(d.Subscriptions("tenant1"), 1)
+	ast.Len(d.Subscriptions("tenant2"), 0)
+
+	d.Publish("tenant1", pmodel.EventAddressCreated, pmodel.Address{ID: "1", Name: "Smith"})
+	// not subscribed
+	d.Publish("tenant1", pmodel.EventAddressUpdated, pmodel.Address{ID: "1", Name: "Smith"})
+	d.Publish("tenant2", pmodel.EventAddressCreated, pmodel.Address{ID: "2", Name: "Miller"})
+
+	ast.Eventually(func() bool {
+		dls, err := d.Deliveries("tenant1", sub.ID)
+		return err == nil && len(dls) == 1 && dls[0].Status == pmodel.DeliveryDelivered
+	}, 2*time.Second, 10*time.Millisecond)
+	evs := rcv.received()
+	ast.Len(evs, 1)
+	ast.Equal(pmodel.EventAddressCreated, evs[0].Type)
+	ast.Equal("tenant1", evs[0].Tenant)
+	ast.Equal("Smith", evs[0].Address.Name)
+
+	dls, err := d.Deliveries("tenant1", sub.ID)
+	ast.Nil(err)
+	ast.Equal(1, dls[0].Attempts)
+	ast.Equal(http.StatusOK, dls[0].ResponseStatus)
+
+	ast.Nil(d.Unsubscribe("tenant1", sub.ID))
+	ast.ErrorIs(d.Unsubscribe("tenant1", sub.ID), ErrNotFound)
+	_, err = d.Deliveries("tenant1", sub.ID)
+	ast.ErrorIs(err, ErrNotFound)
+}
+
+func TestRetry(t *testing.T) {
+	ast := assert.New(t)
+	d := newTestDispatcher(t, 5)
+	// the first two attempts fail
+	rcv := newReceiver(t, func(call int) int {
+		if call <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+
+	sub, _ := d.Subscribe("tenant1", pmodel.Subscription{URL: rcv.srv.URL, Events: []string{pmodel.EventAddressUpdated}, Secret: secret})
+	d.Publish("tenant1", pmodel.EventAddressUpdated, pmodel.Address{ID: "1", Name: "Smith"})
+
+	ast.Eventually(func() bool {
+		dls, err := d.Deliveries("tenant1", sub.ID)
+		return err == nil && len(dls) > 0 && dls[0].Status == pmodel.DeliveryDelivered
+	}, 2*time.Second, 10*time.Millisecond)
+	dls, err := d.Deliveries("tenant1", sub.ID)
+	ast.Nil(err)
+	ast.Len(dls, 1)
+	ast.Equal(3, dls[0].Attempts)
+	ast.Empty(dls[0].LastError)
+	ast.Len(rcv.received(), 1)
+}
+
+func TestDeadLetters(t *testing.T) {
+	ast := assert.New(t)
+	d := newTestDispatcher(t, 3)
+	var healthy atomic.Bool
+	rcv := newReceiver(t, func(int) int {
+		if healthy.Load() {
+			return http.StatusOK
+		}
+		return http.StatusInternalServerError
+	})
+
+	sub, _ := d.Subscribe("tenant1", pmodel.Subscription{URL: rcv.srv.URL, Events: []string{pmodel.EventAddressDeleted}, Secret: secret})
+	d.Publish("tenant1", pmodel.EventAddressDeleted, pmodel.Address{ID: "1", Name: "Smith"})
+
+	ast.Eventually(func() bool {
+		return len(d.DeadLetters("tenant1")) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	dead := d.DeadLetters("tenant1")[0]
+	ast.Equal(sub.ID, dead.Subscription)
+	ast.Equal(3, dead.Attempts)
+	ast.Equal(http.StatusInternalServerError, dead.ResponseStatus)
+	ast.NotEmpty(dead.LastError)
+	ast.Len(rcv.received(), 0)
+
+	healthy.Store(true)
+	dl, err := d.Redeliver("tenant1", dead.ID)
+	ast.Nil(err)
+	ast.Equal(pmodel.DeliveryPending, dl.Status)
+	ast.Eventually(func() bool {
+		dls, err := d.Deliveries("tenant1", sub.ID)
+		return err == nil && len(dls) > 0 && dls[0].Status == pmodel.DeliveryDelivered
+	}, 2*time.Second, 10*time.Millisecond)
+	ast.Len(d.DeadLetters("tenant1"), 0)
+	ast.Len(rcv.received(), 1)
+
+	_, err = d.Redeliver("tenant1", dead.ID)
+	ast.ErrorIs(err, ErrNotDead)
+	_, err = d.Redeliver("tenant1", "unknown")
+	ast.ErrorIs(err, ErrNotFound)
+}
+
+func TestPrivateAddress(t *testing.T) {
+	ast := assert.New(t)
+	d := NewDispatcher(Config{Enable: true, Attempts: 1}, nil)
+	ast.Nil(d.Init())
+	t.Cleanup(d.Shutdown)
+	rcv := newReceiver(t, func(int) int {
+		return http.StatusOK
+	})
+
+	sub, _ := d.Subscribe("tenant1", pmodel.Subscription{URL: rcv.srv.URL, Events: []string{pmodel.EventAddressCreated}, Secret: secret})
+	d.Publish("tenant1", pmodel.EventAddressCreated, pmodel.Address{ID: "1", Name: "Smith"})
+
+	ast.Eventually(func() bool {
+		return len(d.DeadLetters("tenant1")) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	dead := d.DeadLetters("tenant1")[0]
+	ast.Equal(sub.ID, dead.Subscription)
+	ast.Equal(0, dead.ResponseStatus)
+	ast.Contains(dead.LastError, ErrPrivateAddress.Error())
+	ast.Equal(int32(0), rcv.calls.Load())
+}
+
+func TestPublicAddress(t *testing.T) {
+	denied := map[string]string{
+		"loopback":               "127.0.0.1:80",
+		"loopback v6":            "[::1]:80",
+		"private 10/8":           "10.0.0.1:80",
+		"private 172.16/12":      "172.16.0.1:80",
+		"private 192.168/16":     "192.168.1.1:80",
+		"link-local":             "169.254.169.254:80",
+		"link-local v6":          "[fe80::1%eth0]:80",
+		"unspecified":            "0.0.0.0:80",
+		"unspecified v6":         "[::]:80",
+		"this network":           "0.1.2.3:80",
+		"carrier-grade nat":      "100.64.0.1:80",
+		"ietf protocol":          "192.0.0.8:80",
+		"test-net-1":             "192.0.2.1:80",
+		"6to4 relay":             "192.88.99.1:80",
+		"benchmarking":           "198.19.255.1:80",
+		"test-net-2":             "198.51.100.1:80",
+		"test-net-3":             "203.0.113.1:80",
+		"multicast":              "224.0.0.251:80",
+		"multicast global":       "239.1.2.3:80",
+		"reserved":               "240.0.0.1:80",
+		"broadcast":              "255.255.255.255:80",
+		"mapped loopback":        "[::ffff:127.0.0.1]:80",
+		"nat64 private":          "[64:ff9b::a00:1]:80",
+		"nat64 metadata":         "[64:ff9b::a9fe:a9fe]:80",
+		"local-use nat64":        "[64:ff9b:1::5db8:d822]:80",
+		"6to4 private":           "[2002:c0a8:101::1]:80",
+		"discard-only":           "[100::1]:80",
+		"teredo":                 "[2001::1]:80",
+		"benchmarking v6":        "[2001:2::1]:80",
+		"documentation v6":       "[2001:db8::1]:80",
+		"documentation 3fff":     "[3fff::1]:80",
+		"unique local":           "[fd00::1]:80",
+		"site-local":             "[fec0::1]:80",
+		"multicast v6":           "[ff02::1]:80",
+		"multicast v6 global":    "[ff0e::1]:80",
+		"interface-local v6":     "[ff01::1]:80",
+		"private v4 mapped v6":   "[::ffff:10.0.0.1]:80",
+		"link-local multicast":   "[ff02::1:2]:80",
+		"cgnat in nat64":         "[64:ff9b::6440:1]:80",
+		"loopback in 6to4":       "[2002:7f00:1::1]:80",
+		"documentation in nat64": "[64:ff9b::c000:201]:80",
+	}
+	for name, addr := range denied {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, public("tcp", addr, nil), ErrPrivateAddress, addr)
+		})
+	}
+
+	ast := assert.New(t)
+	for _, addr := range []string{"93.184.216.34:443", "[2606:2800:220:1::]:443", "[64:ff9b::5db8:d822]:443", "[2002:5db8:d822::1]:443", "[::ffff:93.184.216.34]:443"} {
+		ast.Nil(public("tcp", addr, nil), addr)
+	}
+	ast.NotNil(public("tcp", "localhost", nil))
+}
+
+func TestRedirect(t *testing.T) {
+	ast := assert.New(t)
+	d := newTestDispatcher(t, 1)
+	target := newReceiver(t, func(int) int {
+		return http.StatusOK
+	})
+	rcv := httptest.NewServer(http.RedirectHandler(target.srv.URL, http.StatusFound))
+	t.Cleanup(rcv.Close)
+
+	_, _ = d.Subscribe("tenant1", pmodel.Subscription{URL: rcv.URL, Events: []string{pmodel.EventAddressCreated}, Secret: secret})
+	d.Publish("tenant1", pmodel.EventAddressCreated, pmodel.Address{ID: "1", Name: "Smith"})
+
+	ast.Eventually(func() bool {
+		return len(d.DeadLetters("tenant1")) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	ast.Equal(http.StatusFound, d.DeadLetters("tenant1")[0].ResponseStatus)
+	ast.Equal(int32(0), target.calls.Load())
+}
+
+func TestBackoff(t *testing.T) {
+	ast := assert.New(t)
+	d := NewDispatcher(Config{Backoff: 1, MaxBackoff: 10}, nil)
+	ast.Equal(time.Second, d.wait(1))
+	ast.Equal(2*time.Second, d.wait(2))
+	ast.Equal(8*time.Second, d.wait(4))
+	ast.Equal(10*time.Second, d.wait(5))
+	ast.Equal(10*time.Second, d.wait(100))
+}
@@ -0,0 +1,68 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of a webhook request
+const (
+	// SignatureHeader the signature of the payload, t=<unix time>,v1=<hex hmac sha256 of "<unix time>.<payload>">
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader the type of the event
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader the id of the delivery, the same for every attempt
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// Errors of the signature verification
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrSignatureExpired = errors.New("webhook signature expired")
+)
+
+// Sign signing the payload with the secret, the time is part of the signature, so a receiver can reject replays
+func Sign(secret string, t time.Time, payload []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, mac(secret, ts, payload))
+}
+
+// Verify verifying the signature header of the payload with the secret. A signature older than the tolerance is
+// rejected, a tolerance of 0 accepts every time.
+func Verify(secret, header string, payload []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, p := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, ts, payload))) {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 && time.Since(time.Unix(unix, 0)) > tolerance {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+func mac(secret, ts string, payload []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
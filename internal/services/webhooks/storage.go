@@ -0,0 +1,102 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+// SubscriptionStorage persistence of the subscriptions with their secrets, so they survive restarts
+type SubscriptionStorage interface {
+	// Subscriptions getting all stored subscriptions, by tenant
+	Subscriptions() (map[string][]pmodel.Subscription, error)
+	// StoreSubscription storing a new subscription of the tenant
+	StoreSubscription(tenant string, sub pmodel.Subscription) error
+	// DeleteSubscription deleting the subscription of the tenant, an unknown subscription is no error
+	DeleteSubscription(tenant, id string) error
+}
+
+// FileSubscriptions storing the subscriptions as json in a file, the file is only readable by the owner, as it
+// contains the secrets
+type FileSubscriptions struct {
+	file string
+	lock sync.Mutex
+}
+
+// NewFileSubscriptions creates a new file based subscription storage
+func NewFileSubscriptions(file string) *FileSubscriptions {
+	return &FileSubscriptions{
+		file: file,
+	}
+}
+
+// Subscriptions getting all stored subscriptions, a missing file is an empty list
+func (f *FileSubscriptions) Subscriptions() (map[string][]pmodel.Subscription, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.read()
+}
+
+// StoreSubscription storing a new subscription of the tenant
+func (f *FileSubscriptions) StoreSubscription(tenant string, sub pmodel.Subscription) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	subs, err := f.read()
+	if err != nil {
+		return err
+	}
+	subs[tenant] = append(subs[tenant], sub)
+	return f.write(subs)
+}
+
+// DeleteSubscription deleting the subscription of the tenant
+func (f *FileSubscriptions) DeleteSubscription(tenant, id string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	subs, err := f.read()
+	if err != nil {
+		return err
+	}
+	active := make([]pmodel.Subscription, 0, len(subs[tenant]))
+	for _, sub := range subs[tenant] {
+		if sub.ID != id {
+			active = append(active, sub)
+		}
+	}
+	subs[tenant] = active
+	if len(active) == 0 {
+		delete(subs, tenant)
+	}
+	return f.write(subs)
+}
+
+func (f *FileSubscriptions) read() (map[string][]pmodel.Subscription, error) {
+	data, err := os.ReadFile(f.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string][]pmodel.Subscription{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read subscription file: %w", err)
+	}
+	subs := make(map[string][]pmodel.Subscription)
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return nil, fmt.Errorf("can't parse subscription file: %w", err)
+	}
+	return subs, nil
+}
+
+func (f *FileSubscriptions) write(subs map[string][]pmodel.Subscription) error {
+	data, err := json.MarshalIndent(subs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := f.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("can't write subscription file: %w", err)
+	}
+	return os.Rename(tmp, f.file)
+}
@@ -0,0 +1,51 @@
+package webhooks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+func TestFileSubscriptions(t *testing.T) {
+	ast := assert.New(t)
+	file := filepath.Join(t.TempDir(), "subscriptions.json")
+	stg := NewFileSubscriptions(file)
+
+	subs, err := stg.Subscriptions()
+	ast.Nil(err)
+	ast.Empty(subs)
+
+	d := NewDispatcher(Config{Enable: true}, stg)
+	ast.Nil(d.Init())
+	sub1, err := d.Subscribe("tenant1", pmodel.Subscription{URL: "https://example.com/hook", Events: []string{pmodel.EventAddressCreated}, Secret: secret})
+	ast.Nil(err)
+	ast.Empty(sub1.Secret)
+	sub2, err := d.Subscribe("tenant1", pmodel.Subscription{URL: "https://example.com/other", Events: []string{pmodel.EventAddressDeleted}, Secret: secret})
+	ast.Nil(err)
+	sub3, err := d.Subscribe("tenant2", pmodel.Subscription{URL: "https://example.com/hook", Events: []string{pmodel.EventAddressUpdated}, Secret: secret})
+	ast.Nil(err)
+	ast.Nil(d.Unsubscribe("tenant1", sub2.ID))
+	d.Shutdown()
+
+	// the file contains the secrets
+	fi, err := os.Stat(file)
+	ast.Nil(err)
+	ast.Equal(os.FileMode(0o600), fi.Mode().Perm())
+
+	// the subscriptions are kept with a restart
+	d = NewDispatcher(Config{Enable: true}, NewFileSubscriptions(file))
+	ast.Nil(d.Init())
+	defer d.Shutdown()
+	ast.Equal([]pmodel.Subscription{sub1}, d.Subscriptions("tenant1"))
+	ast.Equal([]pmodel.Subscription{sub3}, d.Subscriptions("tenant2"))
+	ast.Equal(secret, d.subs["tenant1"][sub1.ID].Secret)
+
+	ast.Nil(d.Unsubscribe("tenant2", sub3.ID))
+	subs, err = stg.Subscriptions()
+	ast.Nil(err)
+	ast.Len(subs, 1)
+	ast.Len(subs["tenant1"], 1)
+}
@@ -1,8 +1,11 @@
 package httputils
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
@@ -19,32 +22,67 @@ var val *validator.Validate
 // TenantClaim the claim used in the jwt claims, where the actual tenant is stored
 var TenantClaim string
 
+// TenantsClaim the claim pathes in the jwt claims with all tenants the token is a member of
+var TenantsClaim []string
+
 // Strict throwing an error if the tenant is not present in the token
 var Strict bool
 
-// TenantID gets the tenant-id of the given request
+// TenantID gets the tenant-id of the given request. With an active jwt authentication the requested tenant must be one
+// of the tenants of the tenants claim, or the tenant is taken from the tenant claim of the token. A different tenant in
+// the url or header is forbidden. The same applies to the tenant of a verified client certificate.
 func TenantID(r *http.Request) (string, error) {
-	tntID := chi.URLParam(r, api.URLParamTenantID)
-	if tntID != "" {
-		return strings.ToLower(tntID), nil
+	requested := auth.RequestedTenant(r)
+	if ci, ok := auth.ClientIdentityFromContext(r.Context()); ok && ci.Tenant != "" {
+		if requested != "" && requested != ci.Tenant {
+			return "", serror.Forbidden(nil, "tenant-mismatch", fmt.Sprintf("tenant %s not allowed for this client certificate", requested))
+		}
+		requested = ci.Tenant
 	}
-	var id string
-	_, claims, _ := auth.FromContext(r.Context())
-	if claims != nil {
-		tenant, ok := claims[TenantClaim].(string)
-		if ok {
-			return strings.ToLower(tenant), nil
+	token, claims, err := auth.FromContext(r.Context())
+	if err == nil && token != nil {
+		if len(TenantsClaim) > 0 {
+			return memberTenant(requested, claims)
 		}
-		if Strict {
-			return "", serror.BadRequest(nil, "missing-tenant", "no tenant claim in jwt token")
+		if TenantClaim != "" {
+			tenant, ok := claims[TenantClaim].(string)
+			if ok && tenant != "" {
+				tenant = strings.ToLower(tenant)
+				if requested != "" && requested != tenant {
+					return "", serror.Forbidden(nil, "tenant-mismatch", fmt.Sprintf("tenant %s not allowed for this token", requested))
+				}
+				return tenant, nil
+			}
+			if Strict {
+				return "", serror.BadRequest(nil, "missing-tenant", "no tenant claim in jwt token")
+			}
 		}
 	}
-	id = r.Header.Get(api.TenantHeaderKey)
-	if id == "" {
+	if requested == "" {
 		msg := fmt.Sprintf("tenant header %s missing", api.TenantHeaderKey)
 		return "", serror.BadRequest(nil, "missing-tenant", msg)
 	}
-	return strings.ToLower(id), nil
+	return requested, nil
+}
+
+// memberTenant checking the requested tenant against the tenants of the token. Without a requested tenant the only
+// tenant of the token is used.
+func memberTenant(requested string, claims map[string]any) (string, error) {
+	tenants := auth.ClaimValues(claims, TenantsClaim)
+	for x, t := range tenants {
+		tenants[x] = strings.ToLower(t)
+	}
+	if requested == "" {
+		if len(tenants) == 1 {
+			return tenants[0], nil
+		}
+		msg := fmt.Sprintf("tenant header %s missing", api.TenantHeaderKey)
+		return "", serror.BadRequest(nil, "missing-tenant", msg)
+	}
+	if !slices.Contains(tenants, requested) {
+		return "", serror.Forbidden(nil, "tenant-not-allowed", fmt.Sprintf("token is not a member of tenant %s", requested))
+	}
+	return requested, nil
 }
 
 // Decode decodes and validates an object
@@ -53,10 +91,60 @@ func Decode(r *http.Request, v any) error {
 	if err != nil {
 		return serror.BadRequest(err, "decode-body", "could not decode body")
 	}
-	if err := val.Struct(v); err != nil {
-		return serror.BadRequest(err, "validate-body", "body invalid")
+	return Validate(v)
+}
+
+// Validate validates an object, the error lists every failing field with the rule and a message
+func Validate(v any) error {
+	err := val.Struct(v)
+	if err == nil {
+		return nil
 	}
-	return nil
+	serr := serror.BadRequest(err, "validate-body", "body invalid")
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		serr.Fields = make([]serror.FieldError, 0, len(verrs))
+		for _, fe := range verrs {
+			serr.Fields = append(serr.Fields, serror.FieldError{
+				Field: fieldPath(fe),
+				Rule:  fe.Tag(),
+				Msg:   fieldMessage(fe),
+			})
+		}
+	}
+	return serr
+}
+
+// RegisterStructValidation registers a struct level validation for the types
+func RegisterStructValidation(fn validator.StructLevelFunc, types ...any) {
+	val.RegisterStructValidation(fn, types...)
+}
+
+// fieldPath the json path of the field without the name of the root struct
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if _, p, ok := strings.Cut(ns, "."); ok {
+		return p
+	}
+	return ns
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max":
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	case "min":
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case "iso3166_1_alpha2":
+		return "must be an ISO 3166-1 alpha-2 country code"
+	case "zipcode":
+		return fmt.Sprintf("is not a valid zip code of %s", fe.Param())
+	case "statecode":
+		return fmt.Sprintf("is not a valid state code of %s", fe.Param())
+	}
+	return fmt.Sprintf("failed on the %s rule", fe.Tag())
 }
 
 // Param gets the url param of the given request
@@ -86,6 +174,17 @@ func Err(w http.ResponseWriter, r *http.Request, err error) {
 
 func init() {
 	val = validator.New()
+	// field errors are reported with the json names
+	val.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		name, _, _ := strings.Cut(fld.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return fld.Name
+		}
+		return name
+	})
 }
 
 // FileServer conveniently sets up a http.FileServer handler to serve
@@ -0,0 +1,168 @@
+package httputils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/api"
+	"github.com/willie68/go-micro/internal/auth"
+	"github.com/willie68/go-micro/internal/serror"
+	"github.com/willie68/go-micro/pkg/pmodel"
+)
+
+func tenantRequest(header, param string, claims map[string]any) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		req.Header.Set(api.TenantHeaderKey, header)
+	}
+	ctx := req.Context()
+	if param != "" {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add(api.URLParamTenantID, param)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+	}
+	if claims != nil {
+		ctx = auth.NewContext(ctx, &auth.JWT{Payload: claims, IsValid: true}, nil, false)
+	}
+	return req.WithContext(ctx)
+}
+
+func TestTenantIDWithoutAuth(t *testing.T) {
+	ast := assert.New(t)
+	TenantClaim = ""
+	Strict = false
+
+	tnt, err := TenantID(tenantRequest("Tenant1", "", nil))
+	ast.Nil(err)
+	ast.Equal("tenant1", tnt)
+
+	tnt, err = TenantID(tenantRequest("tenant1", "tenant2", nil))
+	ast.Nil(err)
+	ast.Equal("tenant2", tnt)
+
+	_, err = TenantID(tenantRequest("", "", nil))
+	ast.True(serror.Is(err, http.StatusBadRequest))
+}
+
+func TestTenantIDFromClaim(t *testing.T) {
+	ast := assert.New(t)
+	TenantClaim = "Tenant"
+	Strict = true
+	defer func() {
+		TenantClaim = ""
+		Strict = false
+	}()
+	claims := map[string]any{"Tenant": "Tenant1"}
+
+	tnt, err := TenantID(tenantRequest("", "", claims))
+	ast.Nil(err)
+	ast.Equal("tenant1", tnt)
+
+	tnt, err = TenantID(tenantRequest("tenant1", "", claims))
+	ast.Nil(err)
+	ast.Equal("tenant1", tnt)
+
+	// changing the header or the url is not allowed
+	_, err = TenantID(tenantRequest("tenant2", "", claims))
+	ast.True(serror.Is(err, http.StatusForbidden))
+	_, err = TenantID(tenantRequest("", "tenant2", claims))
+	ast.True(serror.Is(err, http.StatusForbidden))
+
+	// strict needs the claim
+	_, err = TenantID(tenantRequest("tenant1", "", map[string]any{}))
+	ast.True(serror.Is(err, http.StatusBadRequest))
+
+	// not strict falls back to the header
+	Strict = false
+	tnt, err = TenantID(tenantRequest("tenant1", "", map[string]any{}))
+	ast.Nil(err)
+	ast.Equal("tenant1", tnt)
+}
+
+func TestTenantIDMembership(t *testing.T) {
+	ast := assert.New(t)
+	TenantsClaim = []string{"tenants", "systemidentities.tenant"}
+	defer func() {
+		TenantsClaim = nil
+	}()
+	claims := map[string]any{
+		"tenants":          []any{"Tenant1", "tenant2"},
+		"systemidentities": []any{map[string]any{"tenant": "tenant3", "system": "s1"}},
+	}
+
+	tnt, err := TenantID(tenantRequest("tenant1", "", claims))
+	ast.Nil(err)
+	ast.Equal("tenant1", tnt)
+
+	tnt, err = TenantID(tenantRequest("", "tenant3", claims))
+	ast.Nil(err)
+	ast.Equal("tenant3", tnt)
+
+	_, err = TenantID(tenantRequest("tenant4", "", claims))
+	ast.True(serror.Is(err, http.StatusForbidden))
+
+	// more than one tenant, the tenant must be given
+	_, err = TenantID(tenantRequest("", "", claims))
+	ast.True(serror.Is(err, http.StatusBadRequest))
+
+	tnt, err = TenantID(tenantRequest("", "", map[string]any{"tenants": []any{"tenant1"}}))
+	ast.Nil(err)
+	ast.Equal("tenant1", tnt)
+}
+
+func TestTenantIDFromClientCert(t *testing.T) {
+	ast := assert.New(t)
+	withCert := func(req *http.Request) *http.Request {
+		ci := &auth.ClientIdentity{ID: "importer", Tenant: "tenant1"}
+		return req.WithContext(context.WithValue(req.Context(), auth.ClientCertCtxKey, ci))
+	}
+
+	tnt, err := TenantID(withCert(tenantRequest("", "", nil)))
+	ast.Nil(err)
+	ast.Equal("tenant1", tnt)
+
+	tnt, err = TenantID(withCert(tenantRequest("Tenant1", "", nil)))
+	ast.Nil(err)
+	ast.Equal("tenant1", tnt)
+
+	_, err = TenantID(withCert(tenantRequest("tenant2", "", nil)))
+	ast.True(serror.Is(err, http.StatusForbidden))
+}
+
+func TestDecodeValidation(t *testing.T) {
+	ast := assert.New(t)
+	RegisterStructValidation(pmodel.ValidateAddress, pmodel.Address{})
+	decode := func(body string) error {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		var adr pmodel.Address
+		return Decode(req, &adr)
+	}
+
+	ast.Nil(decode(`{"name":"Smith","state":"CA","zip_code":"12345"}`))
+	ast.Nil(decode(`{"name":"Müller","state":"BY","zip_code":"80331","country":"DE"}`))
+	ast.Nil(decode(`{"name":"Smith","state":"Queensland","zip_code":"4000","country":"AU"}`))
+
+	err := decode(`{"name":`)
+	ast.Equal("decode-body", err.(*serror.Serr).Key)
+
+	err = decode(`{"firstname":"` + strings.Repeat("x", 256) + `","state":"XX","zip_code":"1234","country":"US"}`)
+	serr, ok := err.(*serror.Serr)
+	ast.True(ok)
+	ast.Equal(http.StatusBadRequest, serr.Code)
+	ast.Equal("validate-body", serr.Key)
+	ast.ElementsMatch([]serror.FieldError{
+		{Field: "name", Rule: "required", Msg: "is required"},
+		{Field: "firstname", Rule: "max", Msg: "must be at most 255 characters long"},
+		{Field: "zip_code", Rule: "zipcode", Msg: "is not a valid zip code of US"},
+		{Field: "state", Rule: "statecode", Msg: "is not a valid state code of US"},
+	}, serr.Fields)
+
+	err = decode(`{"name":"Smith","country":"Germany"}`)
+	ast.Equal([]serror.FieldError{{Field: "country", Rule: "iso3166_1_alpha2", Msg: "must be an ISO 3166-1 alpha-2 country code"}}, err.(*serror.Serr).Fields)
+}
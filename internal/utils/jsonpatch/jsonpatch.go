@@ -0,0 +1,312 @@
+// Package jsonpatch implements JSON Patch (RFC 6902) and JSON Merge Patch (RFC 7386) on json documents
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// media types of the patch formats
+const (
+	PatchMediaType      = "application/json-patch+json"
+	MergePatchMediaType = "application/merge-patch+json"
+)
+
+// errors of the patching
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	ErrPathNotFound = errors.New("path not found")
+	ErrTestFailed   = errors.New("test operation failed")
+)
+
+// Operation one operation of a json patch
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MergePatch applying the json merge patch (RFC 7386) to the document. Members of the patch with null values are
+// removed from the document, objects are merged recursively, all other values replace the values of the document.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var d, p any
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return json.Marshal(mergePatch(d, p))
+}
+
+func mergePatch(target, patch any) any {
+	pm, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	tm, ok := target.(map[string]any)
+	if !ok {
+		tm = make(map[string]any)
+	}
+	for k, v := range pm {
+		if v == nil {
+			delete(tm, k)
+			continue
+		}
+		tm[k] = mergePatch(tm[k], v)
+	}
+	return tm
+}
+
+// Apply applying the json patch (RFC 6902) to the document. The operations are applied in order, if one fails the
+// whole patch fails.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	var d any
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+	for x, op := range ops {
+		var err error
+		if d, err = op.apply(d); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", x, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(d)
+}
+
+func (o Operation) value() (any, error) {
+	if len(o.Value) == 0 {
+		return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+	}
+	var v any
+	if err := json.Unmarshal(o.Value, &v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return v, nil
+}
+
+func (o Operation) apply(doc any) (any, error) {
+	path, err := parsePointer(o.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch o.Op {
+	case "add":
+		v, err := o.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "remove":
+		return remove(doc, path)
+	case "replace":
+		v, err := o.value()
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return v, nil
+		}
+		if doc, err = remove(doc, path); err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "move", "copy":
+		from, err := parsePointer(o.From)
+		if err != nil {
+			return nil, err
+		}
+		v, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if o.Op == "copy" {
+			return add(doc, path, deepCopy(v))
+		}
+		if o.Path != o.From && strings.HasPrefix(o.Path, o.From+"/") {
+			return nil, fmt.Errorf("%w: can't move into a child of itself", ErrInvalidPatch)
+		}
+		if doc, err = remove(doc, from); err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "test":
+		v, err := o.value()
+		if err != nil {
+			return nil, err
+		}
+		act, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(v, act) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, o.Op)
+}
+
+// parsePointer splitting the json pointer (RFC 6901) into the unescaped reference tokens
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("%w: pointer %q must start with /", ErrInvalidPatch, p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for x, t := range tokens {
+		tokens[x] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// index parsing the array index of the token, with appendable "-" stands for the end of the array
+func index(token string, size int, appendable bool) (int, error) {
+	if appendable && token == "-" {
+		return size, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+	last := size - 1
+	if appendable {
+		last = size
+	}
+	if i > last {
+		return 0, fmt.Errorf("%w: array index %d out of bounds", ErrPathNotFound, i)
+	}
+	return i, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, t := range path {
+		switch n := doc.(type) {
+		case map[string]any:
+			v, ok := n[t]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrPathNotFound, t)
+			}
+			doc = v
+		case []any:
+			i, err := index(t, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = n[i]
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, t)
+		}
+	}
+	return doc, nil
+}
+
+// modify walking to the parent of the path and calling fn with it, fn returns the changed parent
+func modify(doc any, path []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	switch n := doc.(type) {
+	case map[string]any:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, path[0])
+		}
+		c, err := modify(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = c
+		return n, nil
+	case []any:
+		i, err := index(path[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		c, err := modify(n[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = c
+		return n, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrPathNotFound, path[0])
+}
+
+func add(doc any, path []string, v any) (any, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	return modify(doc, path, func(parent any, token string) (any, error) {
+		switch n := parent.(type) {
+		case map[string]any:
+			n[token] = v
+			return n, nil
+		case []any:
+			i, err := index(token, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = v
+			return n, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrPathNotFound, token)
+	})
+}
+
+func remove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: the whole document can't be removed", ErrInvalidPatch)
+	}
+	return modify(doc, path, func(parent any, token string) (any, error) {
+		switch n := parent.(type) {
+		case map[string]any:
+			if _, ok := n[token]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrPathNotFound, token)
+			}
+			delete(n, token)
+			return n, nil
+		case []any:
+			i, err := index(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(n[:i], n[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrPathNotFound, token)
+	})
+}
+
+func deepCopy(v any) any {
+	switch n := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(n))
+		for k, e := range n {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []any:
+		a := make([]any, len(n))
+		for x, e := range n {
+			a[x] = deepCopy(e)
+		}
+		return a
+	}
+	return v
+}
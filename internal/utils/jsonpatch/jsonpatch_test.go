@@ -0,0 +1,89 @@
+package jsonpatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	ast := assert.New(t)
+	tests := []struct {
+		doc, patch, result string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tc := range tests {
+		res, err := MergePatch([]byte(tc.doc), []byte(tc.patch))
+		ast.Nil(err)
+		ast.JSONEq(tc.result, string(res), tc.patch)
+	}
+	_, err := MergePatch([]byte(`{}`), []byte(`{`))
+	ast.ErrorIs(err, ErrInvalidPatch)
+}
+
+func TestApply(t *testing.T) {
+	ast := assert.New(t)
+	tests := []struct {
+		doc, patch, result string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc"]}]`, `{"foo":["bar",["abc"]]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"foo":{"bar":1}}`, `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`, `{"foo":{"bar":1},"baz":{"bar":2}}`},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{`{"/":1,"m~n":2}`, `[{"op":"remove","path":"/~1"},{"op":"replace","path":"/m~0n","value":null}]`, `{"m~n":null}`},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+	for _, tc := range tests {
+		res, err := Apply([]byte(tc.doc), []byte(tc.patch))
+		ast.Nil(err, tc.patch)
+		ast.JSONEq(tc.result, string(res), tc.patch)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	ast := assert.New(t)
+	tests := []struct {
+		doc, patch string
+		err        error
+	}{
+		{`{"foo":"bar"}`, `{"op":"add"}`, ErrInvalidPatch},
+		{`{"foo":"bar"}`, `[{"op":"muck","path":"/foo"}]`, ErrInvalidPatch},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"foo","value":1}]`, ErrInvalidPatch},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/foo"}]`, ErrInvalidPatch},
+		{`{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, ErrPathNotFound},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`, ErrPathNotFound},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ErrPathNotFound},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"qux"}]`, ErrPathNotFound},
+		{`{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/01"}]`, ErrInvalidPatch},
+		{`{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/baz"}]`, ErrInvalidPatch},
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ErrTestFailed},
+	}
+	for _, tc := range tests {
+		_, err := Apply([]byte(tc.doc), []byte(tc.patch))
+		ast.ErrorIs(err, tc.err, tc.patch)
+	}
+
+	// a failing operation doesn't change anything
+	doc := []byte(`{"foo":"bar"}`)
+	_, err := Apply(doc, []byte(`[{"op":"add","path":"/baz","value":1},{"op":"test","path":"/foo","value":"muck"}]`))
+	ast.ErrorIs(err, ErrTestFailed)
+	ast.Equal(`{"foo":"bar"}`, string(doc))
+}
@@ -15,6 +15,7 @@ type Cache[K comparable, V any] struct {
 	items          map[K]entry[V]
 	ttl            time.Duration
 	deletions      chan K
+	closed         bool
 	autodelete     *time.Ticker
 	doneAutodelete chan bool
 }
@@ -39,7 +40,7 @@ func New[K comparable, V any](opts ...Option[K, V]) *Cache[K, V] {
 	for _, opt := range opts {
 		opt(c)
 	}
-	if c.ttl > 0 {
+	if c.ttl >= 0 {
 		go func() {
 			for k := range c.deletions {
 				c.deleteEvicted(k)
@@ -69,15 +70,17 @@ func WithNoTTL[K comparable, V any]() Option[K, V] {
 // WithAutoDeletion will start a timer and automatically delete evicted entries. The timer will run every d duration
 func WithAutoDeletion[K comparable, V any](d time.Duration) Option[K, V] {
 	return func(c *Cache[K, V]) {
-		c.autodelete = time.NewTicker(d)
-		c.doneAutodelete = make(chan bool)
+		ticker := time.NewTicker(d)
+		done := make(chan bool)
+		c.autodelete = ticker
+		c.doneAutodelete = done
 
 		go func() {
 			for {
 				select {
-				case <-c.doneAutodelete:
+				case <-done:
 					return
-				case <-c.autodelete.C:
+				case <-ticker.C:
 					c.DeleteEvicted()
 				}
 			}
@@ -89,7 +92,8 @@ func WithAutoDeletion[K comparable, V any](d time.Duration) Option[K, V] {
 func (c *Cache[K, V]) Stop() {
 	if c.autodelete != nil {
 		c.autodelete.Stop()
-		c.doneAutodelete <- true
+		close(c.doneAutodelete)
+		c.autodelete = nil
 	}
 }
 
@@ -102,7 +106,7 @@ func (c *Cache[K, V]) Get(key K) (*V, bool) {
 		return nil, false
 	}
 	if c.isEvicted(e) {
-		c.deletions <- key
+		c.evict(key)
 		return nil, false
 	}
 	return &e.value, true
@@ -123,7 +127,7 @@ func (c *Cache[K, V]) Add(k K, v V) {
 	c.items[k] = e
 }
 
-// Add adding a new value to the cache with default TTL
+// AddWithTTL adding a new value to the cache with a specific TTL
 func (c *Cache[K, V]) AddWithTTL(k K, v V, ttl time.Duration) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -134,6 +138,21 @@ func (c *Cache[K, V]) AddWithTTL(k K, v V, ttl time.Duration) {
 	c.items[k] = e
 }
 
+// AddIfAbsent adding a new value to the cache with a specific TTL, if there is no active value for the key. Otherwise
+// the active value is returned and false
+func (c *Cache[K, V]) AddIfAbsent(k K, v V, ttl time.Duration) (*V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.items[k]; ok && !c.isEvicted(e) {
+		return &e.value, false
+	}
+	c.items[k] = entry[V]{
+		value:     v,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return nil, true
+}
+
 // Has checking if a value is in the map
 func (c *Cache[K, V]) Has(k K) bool {
 	c.lock.RLock()
@@ -143,7 +162,7 @@ func (c *Cache[K, V]) Has(k K) bool {
 		return false
 	}
 	if c.isEvicted(e) {
-		c.deletions <- k
+		c.evict(k)
 		return false
 	}
 	return true
@@ -176,22 +195,51 @@ func (c *Cache[K, V]) Purge() {
 	c.items = make(map[K]entry[V])
 }
 
+// Items getting a copy of all active values
+func (c *Cache[K, V]) Items() map[K]V {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	items := make(map[K]V, len(c.items))
+	for k, v := range c.items {
+		if !c.isEvicted(v) {
+			items[k] = v.value
+		}
+	}
+	return items
+}
+
 // DeleteEvicted remove all evicted values from cache
 func (c *Cache[K, V]) DeleteEvicted() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	for k, v := range c.items {
 		if c.isEvicted(v) {
-			c.deletions <- k
+			delete(c.items, k)
 		}
 	}
 }
 
 // Close closes all needed resources, e.g. the deletion queue channel
 func (c *Cache[K, V]) Close() {
+	c.Stop()
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	c.Stop()
-	close(c.deletions)
-	close(c.doneAutodelete)
+	if !c.closed {
+		c.closed = true
+		close(c.deletions)
+	}
+}
+
+// evict queue an evicted entry for deletion. If the queue is full or closed, the entry will be deleted later.
+// Must be called with at least the read lock held.
+func (c *Cache[K, V]) evict(k K) {
+	if c.closed || c.ttl < 0 {
+		return
+	}
+	select {
+	case c.deletions <- k:
+	default:
+	}
 }
 
 // deleteEvicted delete an entry only if it's evicted
@@ -31,7 +31,7 @@ func TestSimpleFastFullCircle(t *testing.T) {
 	ast.Nil(v)
 
 	time.Sleep(1 * time.Second)
-	ast.Equal(0, len(c.items))
+	ast.Equal(0, c.size())
 }
 
 type kventry struct {
@@ -123,7 +123,7 @@ func TestAutoDelete(t *testing.T) {
 
 	time.Sleep(11 * time.Second)
 
-	ast.Equal(0, len(c.items))
+	ast.Equal(0, c.size())
 
 	c.Stop()
 
@@ -132,7 +132,14 @@ func TestAutoDelete(t *testing.T) {
 
 	time.Sleep(11 * time.Second)
 
-	ast.Equal(1, len(c.items))
+	ast.Equal(1, c.size())
+}
+
+// size getting the number of stored entries, including the evicted ones, the auto deletion runs concurrently
+func (c *Cache[K, V]) size() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.items)
 }
 
 func TestVariableTTL(t *testing.T) {
@@ -171,3 +178,46 @@ func TestVariableTTL(t *testing.T) {
 	ast.False(c.Has("onesecond"))
 	ast.False(c.Has("tenseconds"))
 }
+
+func TestItems(t *testing.T) {
+	ast := assert.New(t)
+
+	c := New(WithTTL[string, string](0))
+	ast.NotNil(c)
+
+	c.Add("static", "sicher")
+	c.AddWithTTL("short", "kurz", 10*time.Millisecond)
+	ast.Equal(map[string]string{"static": "sicher", "short": "kurz"}, c.Items())
+
+	time.Sleep(20 * time.Millisecond)
+	ast.Equal(map[string]string{"static": "sicher"}, c.Items())
+
+	// closing twice is possible
+	c.Close()
+	c.Close()
+}
+
+func TestAddIfAbsent(t *testing.T) {
+	ast := assert.New(t)
+
+	c := New(WithTTL[string, string](0))
+	ast.NotNil(c)
+	defer c.Close()
+
+	v, ok := c.AddIfAbsent("test", "first", 1*time.Second)
+	ast.True(ok)
+	ast.Nil(v)
+
+	v, ok = c.AddIfAbsent("test", "second", 1*time.Second)
+	ast.False(ok)
+	ast.Equal("first", *v)
+
+	time.Sleep(2 * time.Second)
+	v, ok = c.AddIfAbsent("test", "second", 1*time.Second)
+	ast.True(ok)
+	ast.Nil(v)
+
+	v, ok = c.Get("test")
+	ast.True(ok)
+	ast.Equal("second", *v)
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
@@ -9,8 +10,11 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/willie68/go-micro/internal/api"
 	"github.com/willie68/go-micro/internal/logging"
 	"github.com/willie68/go-micro/internal/serror"
 	"github.com/willie68/go-micro/pkg/pmodel"
@@ -20,6 +24,7 @@ import (
 type Client struct {
 	url      string
 	tenant   string
+	token    string
 	clt      http.Client
 	ctx      context.Context
 	insecure bool
@@ -65,6 +70,11 @@ func (c *Client) init(u string) error {
 	return nil
 }
 
+// SetToken setting the bearer token for all following requests, empty for none
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
 // GetAddresses getting all config names
 func (c *Client) GetAddresses() (*[]pmodel.Address, error) {
 	res, err := c.Get("addresses")
@@ -86,6 +96,81 @@ func (c *Client) GetAddresses() (*[]pmodel.Address, error) {
 	return &l, nil
 }
 
+// QueryAddresses getting one page of the filtered and sorted addresses, the cursors of the next and previous page
+// are taken from the Link header
+func (c *Client) QueryAddresses(q pmodel.Query) (*pmodel.Page, error) {
+	return c.queryPage("addresses", q)
+}
+
+// GetTrash getting one page of the filtered and sorted deleted addresses, the cursors of the next and previous page
+// are taken from the Link header
+func (c *Client) GetTrash(q pmodel.Query) (*pmodel.Page, error) {
+	return c.queryPage("addresses/trash", q)
+}
+
+func (c *Client) queryPage(endpoint string, q pmodel.Query) (*pmodel.Page, error) {
+	res, err := c.Get(endpoint + "?" + q.Values().Encode())
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("get request failed: %v", err))
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		logging.Root.Error(fmt.Sprintf("get bad response: %d", res.StatusCode))
+		return nil, ReadErr(res)
+	}
+	p := pmodel.Page{
+		Addresses: make([]pmodel.Address, 0),
+	}
+	err = ReadJSON(res, &p.Addresses)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("parsing response failed: %v", err))
+		return nil, err
+	}
+	p.Total, _ = strconv.Atoi(res.Header.Get(api.TotalCountHeader))
+	for _, l := range strings.Split(res.Header.Get("Link"), ",") {
+		ul, rel, ok := strings.Cut(strings.TrimSpace(l), ";")
+		if !ok {
+			continue
+		}
+		lu, err := url.Parse(strings.Trim(ul, "<>"))
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(rel) {
+		case `rel="next"`:
+			p.Next = lu.Query().Get("cursor")
+		case `rel="prev"`:
+			p.Prev = lu.Query().Get("cursor")
+		}
+	}
+	return &p, nil
+}
+
+// SearchAddresses searching addresses with typo tolerance and phonetic matching, the hits are ranked by score
+func (c *Client) SearchAddresses(q pmodel.SearchQuery) (*pmodel.SearchPage, error) {
+	res, err := c.Get("addresses/search?" + q.Values().Encode())
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("search request failed: %v", err))
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		logging.Root.Error(fmt.Sprintf("search bad response: %d", res.StatusCode))
+		return nil, ReadErr(res)
+	}
+	p := pmodel.SearchPage{
+		Hits: make([]pmodel.SearchHit, 0),
+	}
+	err = ReadJSON(res, &p.Hits)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("parsing response failed: %v", err))
+		return nil, err
+	}
+	p.Total, _ = strconv.Atoi(res.Header.Get(api.TotalCountHeader))
+	return &p, nil
+}
+
 // GetAddress getting the address of a id
 func (c *Client) GetAddress(n string) (*pmodel.Address, error) {
 	res, err := c.Get(fmt.Sprintf("addresses/%s", n))
@@ -107,9 +192,58 @@ func (c *Client) GetAddress(n string) (*pmodel.Address, error) {
 	return &cd, nil
 }
 
+// GetAddressAt getting the address of a id as it was at the time
+func (c *Client) GetAddressAt(n string, at time.Time) (*pmodel.Address, error) {
+	res, err := c.Get(fmt.Sprintf("addresses/%s?asOf=%s", n, url.QueryEscape(at.Format(time.RFC3339Nano))))
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("get request failed: %v", err))
+		return nil, err
+	}
+	return readAddress(res)
+}
+
+// GetHistory getting the revisions of the address of a id, sorted by version
+func (c *Client) GetHistory(n string) ([]pmodel.Revision, error) {
+	res, err := c.Get(fmt.Sprintf("addresses/%s/history", n))
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("history request failed: %v", err))
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		logging.Root.Error(fmt.Sprintf("history bad response: %d", res.StatusCode))
+		return nil, ReadErr(res)
+	}
+	revs := make([]pmodel.Revision, 0)
+	err = ReadJSON(res, &revs)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("parsing response failed: %v", err))
+		return nil, err
+	}
+	return revs, nil
+}
+
 // CreateAddress create the address
 func (c *Client) CreateAddress(pcd pmodel.Address) (string, error) {
-	res, err := c.PostJSON("addresses/", pcd)
+	return c.CreateAddressIdempotent(pcd, "")
+}
+
+// CreateAddressIdempotent creating the address with an idempotency key, a retry with the same key and address
+// returns the id of the first request, instead of creating the address again
+func (c *Client) CreateAddressIdempotent(pcd pmodel.Address, key string) (string, error) {
+	byt, err := json.Marshal(pcd)
+	if err != nil {
+		return "", err
+	}
+	req, err := c.newRequest(http.MethodPost, "addresses/", bytes.NewBuffer(byt))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(api.IdempotencyKeyHeader, key)
+	}
+	res, err := c.do(req)
 	if err != nil {
 		logging.Root.Error(fmt.Sprintf("put request failed: %v", err))
 		return "", err
@@ -130,9 +264,81 @@ func (c *Client) CreateAddress(pcd pmodel.Address) (string, error) {
 	return cd.ID, nil
 }
 
-// DeleteAddress getting the address
+// UpdateAddress replacing the address with the id of the address. An address with a version, e.g. read with
+// GetAddress, is only replaced, if it wasn't changed meanwhile, otherwise a 412 error is returned.
+func (c *Client) UpdateAddress(adr pmodel.Address) (*pmodel.Address, error) {
+	byt, err := json.Marshal(adr)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(http.MethodPut, fmt.Sprintf("addresses/%s", adr.ID), bytes.NewBuffer(byt))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if adr.Version != 0 {
+		req.Header.Set("If-Match", strconv.Quote(strconv.Itoa(adr.Version)))
+	}
+	res, err := c.do(req)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("put request failed: %v", err))
+		return nil, err
+	}
+	return readAddress(res)
+}
+
+// PatchAddress patching the address with the id. The content type is jsonpatch.MergePatchMediaType for a json merge
+// patch (RFC 7386) or jsonpatch.PatchMediaType for a json patch (RFC 6902), the patch is marshalled to json.
+func (c *Client) PatchAddress(id, contentType string, patch any) (*pmodel.Address, error) {
+	byt, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Patch(fmt.Sprintf("addresses/%s", id), contentType, bytes.NewBuffer(byt))
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("patch request failed: %v", err))
+		return nil, err
+	}
+	return readAddress(res)
+}
+
+func readAddress(res *http.Response) (*pmodel.Address, error) {
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		logging.Root.Error(fmt.Sprintf("bad response: %d", res.StatusCode))
+		return nil, ReadErr(res)
+	}
+	var adr pmodel.Address
+	err := ReadJSON(res, &adr)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("parsing response failed: %v", err))
+		return nil, err
+	}
+	return &adr, nil
+}
+
+// DeleteAddress deleting the address, the address is moved into the trash
 func (c *Client) DeleteAddress(n string) (bool, error) {
-	res, err := c.Delete(fmt.Sprintf("addresses/%s", n))
+	return c.deleteAddress(fmt.Sprintf("addresses/%s", n))
+}
+
+// PurgeAddress deleting the address permanently, deleted or not, this needs the tenant-admin role
+func (c *Client) PurgeAddress(n string) (bool, error) {
+	return c.deleteAddress(fmt.Sprintf("addresses/%s?hard=true", n))
+}
+
+// RestoreAddress restoring the deleted address from the trash
+func (c *Client) RestoreAddress(n string) (*pmodel.Address, error) {
+	res, err := c.Post(fmt.Sprintf("addresses/%s:restore", n), "application/json", nil)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("restore request failed: %v", err))
+		return nil, err
+	}
+	return readAddress(res)
+}
+
+func (c *Client) deleteAddress(endpoint string) (bool, error) {
+	res, err := c.Delete(endpoint)
 	if err != nil {
 		logging.Root.Error(fmt.Sprintf("delete request failed: %v", err))
 		return false, err
@@ -148,6 +354,193 @@ func (c *Client) DeleteAddress(n string) (bool, error) {
 	return true, nil
 }
 
+// ImportAddresses importing the addresses of the reader, the content type is application/json for a json array,
+// application/x-ndjson or text/csv
+func (c *Client) ImportAddresses(r io.Reader, contentType string, opts pmodel.ImportOptions) (*pmodel.ImportReport, error) {
+	res, err := c.Post(fmt.Sprintf("addresses:import?%s", opts.Values().Encode()), contentType, r)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("import request failed: %v", err))
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		logging.Root.Error(fmt.Sprintf("import bad response: %d", res.StatusCode))
+		return nil, ReadErr(res)
+	}
+	var report pmodel.ImportReport
+	err = ReadJSON(res, &report)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("parsing response failed: %v", err))
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ExportAddresses exporting the addresses matching the filters of the query to the writer, the format is json, ndjson
+// or csv. Limit, offset and cursor of the query are ignored.
+func (c *Client) ExportAddresses(w io.Writer, format string, q pmodel.Query) error {
+	v := q.Values()
+	v.Set("format", format)
+	res, err := c.Get(fmt.Sprintf("addresses:export?%s", v.Encode()))
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("export request failed: %v", err))
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		logging.Root.Error(fmt.Sprintf("export bad response: %d", res.StatusCode))
+		return ReadErr(res)
+	}
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// CreateSubscription subscribing the url of the subscription to the address events of the tenant, the returned
+// subscription has the id, but no secret
+func (c *Client) CreateSubscription(sub pmodel.Subscription) (*pmodel.Subscription, error) {
+	res, err := c.PostJSON("webhooks/", sub)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("subscribe request failed: %v", err))
+		return nil, err
+	}
+	var cs pmodel.Subscription
+	if err := readResponse(res, http.StatusCreated, "subscribe", &cs); err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// GetSubscriptions getting all webhook subscriptions of the tenant
+func (c *Client) GetSubscriptions() ([]pmodel.Subscription, error) {
+	res, err := c.Get("webhooks/")
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("subscriptions request failed: %v", err))
+		return nil, err
+	}
+	subs := make([]pmodel.Subscription, 0)
+	if err := readResponse(res, http.StatusOK, "subscriptions", &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// DeleteSubscription deleting the webhook subscription of the id
+func (c *Client) DeleteSubscription(id string) error {
+	res, err := c.Delete(fmt.Sprintf("webhooks/%s", id))
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("unsubscribe request failed: %v", err))
+		return err
+	}
+	return readResponse(res, http.StatusNoContent, "unsubscribe", nil)
+}
+
+// GetDeliveries getting the deliveries of the webhook subscription of the id, sorted by creation
+func (c *Client) GetDeliveries(id string) ([]pmodel.Delivery, error) {
+	return c.deliveries(fmt.Sprintf("webhooks/%s/deliveries", id))
+}
+
+// GetDeadLetters getting the webhook deliveries of the tenant, which failed all attempts
+func (c *Client) GetDeadLetters() ([]pmodel.Delivery, error) {
+	return c.deliveries("webhooks/deadletters")
+}
+
+func (c *Client) deliveries(endpoint string) ([]pmodel.Delivery, error) {
+	res, err := c.Get(endpoint)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("deliveries request failed: %v", err))
+		return nil, err
+	}
+	dls := make([]pmodel.Delivery, 0)
+	if err := readResponse(res, http.StatusOK, "deliveries", &dls); err != nil {
+		return nil, err
+	}
+	return dls, nil
+}
+
+// Redeliver delivering the dead webhook delivery of the id again
+func (c *Client) Redeliver(id string) (*pmodel.Delivery, error) {
+	res, err := c.Post(fmt.Sprintf("webhooks/deadletters/%s:redeliver", id), "application/json", nil)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("redeliver request failed: %v", err))
+		return nil, err
+	}
+	var dl pmodel.Delivery
+	if err := readResponse(res, http.StatusAccepted, "redeliver", &dl); err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// readResponse checking the status of the response and reading the json body into dst, if not nil
+func readResponse(res *http.Response, status int, name string, dst any) error {
+	defer res.Body.Close()
+	if res.StatusCode != status {
+		logging.Root.Error(fmt.Sprintf("%s bad response: %d", name, res.StatusCode))
+		return ReadErr(res)
+	}
+	if dst == nil {
+		return nil
+	}
+	if err := ReadJSON(res, dst); err != nil {
+		logging.Root.Error(fmt.Sprintf("parsing response failed: %v", err))
+		return err
+	}
+	return nil
+}
+
+// StreamEvents streaming the address changes of the tenant, every event is given to the function, until the function
+// returns false, the context is done or the stream is closed by the server. With the id of the last received event the
+// stream is resumed with the missed events.
+func (c *Client) StreamEvents(ctx context.Context, lastID string, fn func(ev pmodel.Event) bool) error {
+	req, err := c.newRequest(http.MethodGet, "addresses/events", nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	// the stream is not limited by the client timeout
+	clt := c.clt
+	clt.Timeout = 0
+	res, err := clt.Do(req)
+	if err != nil {
+		logging.Root.Error(fmt.Sprintf("events request failed: %v", err))
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		logging.Root.Error(fmt.Sprintf("events bad response: %d", res.StatusCode))
+		return ReadErr(res)
+	}
+	sc := bufio.NewScanner(res.Body)
+	var data []byte
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				continue
+			}
+			var ev pmodel.Event
+			if err := json.Unmarshal(data, &ev); err != nil {
+				return err
+			}
+			data = data[:0]
+			if !fn(ev) {
+				return nil
+			}
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return sc.Err()
+}
+
 // Get getting something from the endpoint
 func (c *Client) Get(endpoint string) (*http.Response, error) {
 	req, err := c.newRequest(http.MethodGet, endpoint, nil)
@@ -176,6 +569,35 @@ func (c *Client) PostJSON(endpoint string, body any) (*http.Response, error) {
 	return c.Post(endpoint, "application/json", bytes.NewBuffer(byt))
 }
 
+// Put putting something to the endpoint
+func (c *Client) Put(endpoint, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := c.newRequest(http.MethodPut, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.do(req)
+}
+
+// PutJSON putting a json string to the endpoint
+func (c *Client) PutJSON(endpoint string, body any) (*http.Response, error) {
+	byt, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.Put(endpoint, "application/json", bytes.NewBuffer(byt))
+}
+
+// Patch sending a patch with the content type to the endpoint
+func (c *Client) Patch(endpoint, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := c.newRequest(http.MethodPatch, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.do(req)
+}
+
 // Delete sending a delete to an endpoint
 func (c *Client) Delete(endpoint string) (*http.Response, error) {
 	req, err := c.newRequest(http.MethodDelete, endpoint, nil)
@@ -206,6 +628,9 @@ func (c *Client) newRequest(method, endpoint string, body io.Reader) (*http.Requ
 		return nil, err
 	}
 	req.Header.Set("tenant", c.tenant)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
 	logging.Root.Debug(fmt.Sprintf("request %s %s", method, ul))
 	return req, nil
 }
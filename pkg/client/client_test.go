@@ -1,10 +1,27 @@
 package client
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/rs/xid"
 	"github.com/samber/do/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/willie68/go-micro/internal/api"
+	"github.com/willie68/go-micro/internal/serror"
+	"github.com/willie68/go-micro/internal/services/webhooks"
+	"github.com/willie68/go-micro/internal/utils/jsonpatch"
 	"github.com/willie68/go-micro/pkg/pmodel"
 )
 
@@ -22,6 +39,11 @@ func initCl() {
 	if err != nil {
 		panic(err)
 	}
+	tk, err := IssueToken("tester", Tenant, "Admin")
+	if err != nil {
+		panic(err)
+	}
+	cl.SetToken(tk)
 }
 
 func TestClientCRUD(t *testing.T) {
@@ -69,3 +91,720 @@ func TestClientCRUD(t *testing.T) {
 	ast.Nil(err)
 	ast.False(ok)
 }
+
+func TestClientQuery(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	ids := make([]string, 0)
+	for _, n := range []string{"Miller", "Smith", "Smithson", "Schmidt", "Smithers"} {
+		id, err := cl.CreateAddress(pmodel.Address{Name: n, City: "Anytown"})
+		ast.Nil(err)
+		ids = append(ids, id)
+	}
+	defer func() {
+		for _, id := range ids {
+			_, err := cl.DeleteAddress(id)
+			ast.Nil(err)
+		}
+	}()
+
+	q := pmodel.Query{Limit: 2, City: "Anytown", Name: "Smith", Sort: []string{"-name"}}
+	p, err := cl.QueryAddresses(q)
+	ast.Nil(err)
+	ast.Equal(3, p.Total)
+	ast.Len(p.Addresses, 2)
+	ast.Equal("Smithson", p.Addresses[0].Name)
+	ast.Equal("Smithers", p.Addresses[1].Name)
+	ast.Empty(p.Prev)
+
+	q.Cursor = p.Next
+	p, err = cl.QueryAddresses(q)
+	ast.Nil(err)
+	ast.Len(p.Addresses, 1)
+	ast.Equal("Smith", p.Addresses[0].Name)
+	ast.Empty(p.Next)
+
+	q.Cursor = p.Prev
+	p, err = cl.QueryAddresses(q)
+	ast.Nil(err)
+	ast.Len(p.Addresses, 2)
+	ast.Equal("Smithson", p.Addresses[0].Name)
+
+	_, err = cl.QueryAddresses(pmodel.Query{Sort: []string{"muck"}})
+	ast.NotNil(err)
+}
+
+func TestClientSearch(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	ids := make([]string, 0)
+	for _, adr := range []pmodel.Address{
+		{Name: "Meier", Firstname: "Hans", City: "Köln"},
+		{Name: "Mayer", Firstname: "Eva", City: "Bonn"},
+		{Name: "Schulz", Firstname: "Maier", City: "Köln"},
+	} {
+		id, err := cl.CreateAddress(adr)
+		ast.Nil(err)
+		ids = append(ids, id)
+	}
+	defer func() {
+		for _, id := range ids {
+			_, err := cl.DeleteAddress(id)
+			ast.Nil(err)
+		}
+	}()
+
+	// the exact match of the first name is ranked before the phonetic matches of the name
+	p, err := cl.SearchAddresses(pmodel.SearchQuery{Q: "Maier"})
+	ast.Nil(err)
+	ast.Equal(3, p.Total)
+	ast.Equal(ids[2], p.Hits[0].Address.ID)
+	ast.Equal("Schulz", p.Hits[0].Address.Name)
+
+	p, err = cl.SearchAddresses(pmodel.SearchQuery{Q: "meier koln", Limit: 1})
+	ast.Nil(err)
+	ast.Equal(2, p.Total)
+	ast.Len(p.Hits, 1)
+
+	// typo
+	p, err = cl.SearchAddresses(pmodel.SearchQuery{Q: "Schluz"})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+
+	_, err = cl.SearchAddresses(pmodel.SearchQuery{})
+	ast.True(serror.Is(err, http.StatusBadRequest))
+}
+
+func TestClientUpdate(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	adr := pmodel.Address{Name: "Smith", Firstname: "John", City: "Anytown", ZipCode: "12345"}
+	id, err := cl.CreateAddress(adr)
+	ast.Nil(err)
+	defer func() {
+		_, err := cl.DeleteAddress(id)
+		ast.Nil(err)
+	}()
+
+	// put replaces the whole address
+	adr.ID = id
+	adr.Street = "123 Main St"
+	adr.ZipCode = ""
+	uadr, err := cl.UpdateAddress(adr)
+	ast.Nil(err)
+	ast.Equal(2, uadr.Version)
+	adr.Version = uadr.Version
+	ast.Equal(adr, *uadr)
+	radr, err := cl.GetAddress(id)
+	ast.Nil(err)
+	ast.Equal(adr, *radr)
+
+	// the id of the body must match the path
+	res, err := cl.PutJSON("addresses/"+id, pmodel.Address{ID: "muck", Name: "Smith"})
+	ast.Nil(err)
+	ast.Equal(http.StatusBadRequest, res.StatusCode)
+	_ = res.Body.Close()
+	_, err = cl.UpdateAddress(pmodel.Address{ID: "unknown", Name: "Smith"})
+	ast.True(serror.Is(err, http.StatusNotFound))
+
+	// merge patch
+	padr, err := cl.PatchAddress(id, jsonpatch.MergePatchMediaType, map[string]any{"city": "Sometown", "street": nil})
+	ast.Nil(err)
+	ast.Equal("Sometown", padr.City)
+	ast.Empty(padr.Street)
+	ast.Equal("John", padr.Firstname)
+
+	// json patch
+	padr, err = cl.PatchAddress(id, jsonpatch.PatchMediaType, []map[string]any{
+		{"op": "test", "path": "/city", "value": "Sometown"},
+		{"op": "replace", "path": "/firstname", "value": "Jane"},
+		{"op": "copy", "from": "/city", "path": "/state"},
+	})
+	ast.Nil(err)
+	ast.Equal("Jane", padr.Firstname)
+	ast.Equal("Sometown", padr.State)
+	_, err = cl.PatchAddress(id, jsonpatch.PatchMediaType, []map[string]any{{"op": "test", "path": "/city", "value": "Anytown"}})
+	ast.True(serror.Is(err, http.StatusConflict))
+	_, err = cl.PatchAddress(id, jsonpatch.MergePatchMediaType, map[string]any{"id": "muck"})
+	ast.True(serror.Is(err, http.StatusBadRequest))
+	_, err = cl.PatchAddress(id, "application/json", map[string]any{"city": "Anytown"})
+	ast.True(serror.Is(err, http.StatusUnsupportedMediaType))
+
+	// the legacy post is deprecated
+	res, err = cl.PostJSON("addresses/"+id, adr)
+	ast.Nil(err)
+	ast.Equal(http.StatusCreated, res.StatusCode)
+	ast.Equal("true", res.Header.Get("Deprecation"))
+	ast.Empty(res.Header.Get("Link"))
+	_ = res.Body.Close()
+}
+
+func TestClientVersion(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	id, err := cl.CreateAddress(pmodel.Address{Name: "Smith", City: "Anytown"})
+	ast.Nil(err)
+	defer func() {
+		_, err := cl.DeleteAddress(id)
+		ast.Nil(err)
+	}()
+
+	adr, err := cl.GetAddress(id)
+	ast.Nil(err)
+	ast.Equal(1, adr.Version)
+
+	// a cached address is not modified
+	req, err := cl.newRequest(http.MethodGet, "addresses/"+id, nil)
+	ast.Nil(err)
+	req.Header.Set("If-None-Match", `"1"`)
+	res, err := cl.do(req)
+	ast.Nil(err)
+	ast.Equal(http.StatusNotModified, res.StatusCode)
+	ast.Equal(`"1"`, res.Header.Get("ETag"))
+	_ = res.Body.Close()
+
+	// the first update wins, the second is based on an outdated version
+	adr.City = "Sometown"
+	uadr, err := cl.UpdateAddress(*adr)
+	ast.Nil(err)
+	ast.Equal(2, uadr.Version)
+	adr.City = "Othertown"
+	_, err = cl.UpdateAddress(*adr)
+	ast.True(serror.Is(err, http.StatusPreconditionFailed))
+
+	res, err = cl.Get("addresses/" + id)
+	ast.Nil(err)
+	ast.Equal(`"2"`, res.Header.Get("ETag"))
+	_ = res.Body.Close()
+
+	// patches and deletes with an outdated version are rejected
+	for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+		req, err = cl.newRequest(method, "addresses/"+id, strings.NewReader(`{"city": "Othertown"}`))
+		ast.Nil(err)
+		req.Header.Set("Content-Type", jsonpatch.MergePatchMediaType)
+		req.Header.Set("If-Match", `"1"`)
+		res, err = cl.do(req)
+		ast.Nil(err)
+		ast.Equal(http.StatusPreconditionFailed, res.StatusCode, method)
+		_ = res.Body.Close()
+	}
+
+	req, err = cl.newRequest(http.MethodPatch, "addresses/"+id, strings.NewReader(`{"city": "Othertown"}`))
+	ast.Nil(err)
+	req.Header.Set("Content-Type", jsonpatch.MergePatchMediaType)
+	req.Header.Set("If-Match", `"1", "2"`)
+	res, err = cl.do(req)
+	ast.Nil(err)
+	ast.Equal(http.StatusOK, res.StatusCode)
+	ast.Equal(`"3"`, res.Header.Get("ETag"))
+	_ = res.Body.Close()
+}
+
+func TestClientValidation(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	_, err := cl.CreateAddress(pmodel.Address{City: "Berlin", ZipCode: "1234", Country: "DE"})
+	serr, ok := err.(*serror.Serr)
+	ast.True(ok)
+	ast.Equal(http.StatusBadRequest, serr.Code)
+	ast.Len(serr.Fields, 2)
+	ast.Equal("name", serr.Fields[0].Field)
+	ast.Equal("required", serr.Fields[0].Rule)
+	ast.Equal("zip_code", serr.Fields[1].Field)
+
+	id, err := cl.CreateAddress(pmodel.Address{Name: "Müller", City: "Berlin", ZipCode: "10115", State: "BE", Country: "DE"})
+	ast.Nil(err)
+	_, err = cl.PatchAddress(id, jsonpatch.MergePatchMediaType, map[string]any{"state": "XX"})
+	ast.True(serror.Is(err, http.StatusBadRequest))
+	ok, err = cl.DeleteAddress(id)
+	ast.Nil(err)
+	ast.True(ok)
+}
+
+func TestClientTenants(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	id, err := cl.CreateAddress(pmodel.Address{Name: "Smith", City: "Anytown"})
+	ast.Nil(err)
+
+	// the address is not visible for other tenants
+	cl2, err := NewClient("https://127.0.0.1:9443", "tester2")
+	ast.Nil(err)
+	tk, err := IssueToken("tester", "tester2", "Admin")
+	ast.Nil(err)
+	cl2.SetToken(tk)
+	l, err := cl2.GetAddresses()
+	ast.Nil(err)
+	ast.Empty(*l)
+	_, err = cl2.GetAddress(id)
+	ast.True(serror.Is(err, http.StatusNotFound))
+	ok, err := cl2.DeleteAddress(id)
+	ast.Nil(err)
+	ast.False(ok)
+
+	ok, err = cl.DeleteAddress(id)
+	ast.Nil(err)
+	ast.True(ok)
+}
+
+func TestClientTrash(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	// an own tenant, so the deleted addresses of the other tests are not disturbing
+	tcl, err := NewClient("https://127.0.0.1:9443", "trasher")
+	ast.Nil(err)
+	admin, err := IssueToken("tester", "trasher", "Admin")
+	ast.Nil(err)
+	tcl.SetToken(admin)
+
+	id, err := tcl.CreateAddress(pmodel.Address{Name: "Smith", City: "Anytown"})
+	ast.Nil(err)
+	ok, err := tcl.DeleteAddress(id)
+	ast.Nil(err)
+	ast.True(ok)
+
+	// the deleted address is only in the trash
+	_, err = tcl.GetAddress(id)
+	ast.True(serror.Is(err, http.StatusNotFound))
+	p, err := tcl.GetTrash(pmodel.Query{Name: "Smith"})
+	ast.Nil(err)
+	ast.Len(p.Addresses, 1)
+	ast.Equal(id, p.Addresses[0].ID)
+	ast.NotNil(p.Addresses[0].DeletedAt)
+	ast.Equal("tester", p.Addresses[0].DeletedBy)
+
+	adr, err := tcl.RestoreAddress(id)
+	ast.Nil(err)
+	ast.Equal(3, adr.Version)
+	ast.Nil(adr.DeletedAt)
+	adr, err = tcl.GetAddress(id)
+	ast.Nil(err)
+	ast.Equal("Anytown", adr.City)
+	_, err = tcl.RestoreAddress(id)
+	ast.True(serror.Is(err, http.StatusNotFound))
+
+	// the hard delete is only allowed for admins
+	tk, err := IssueToken("tester", "trasher", "ObAdmin")
+	ast.Nil(err)
+	tcl.SetToken(tk)
+	_, err = tcl.PurgeAddress(id)
+	ast.True(serror.Is(err, http.StatusForbidden))
+	_, err = tcl.GetTrash(pmodel.Query{})
+	ast.Nil(err)
+	ok, err = tcl.DeleteAddress(id)
+	ast.Nil(err)
+	ast.True(ok)
+
+	tcl.SetToken(admin)
+	ok, err = tcl.PurgeAddress(id)
+	ast.Nil(err)
+	ast.True(ok)
+	p, err = tcl.GetTrash(pmodel.Query{Name: "Smith"})
+	ast.Nil(err)
+	ast.Empty(p.Addresses)
+	_, err = tcl.RestoreAddress(id)
+	ast.True(serror.Is(err, http.StatusNotFound))
+}
+
+func TestClientHistory(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	id, err := cl.CreateAddress(pmodel.Address{Name: "Meier", City: "Köln"})
+	ast.Nil(err)
+	_, err = cl.UpdateAddress(pmodel.Address{ID: id, Name: "Maier", City: "Köln"})
+	ast.Nil(err)
+
+	// the changes are recorded with the subject of the token
+	revs, err := cl.GetHistory(id)
+	ast.Nil(err)
+	ast.Len(revs, 2)
+	ast.Equal(pmodel.ActionUpdate, revs[1].Action)
+	ast.Equal("tester", revs[1].Actor)
+	ast.Equal([]pmodel.FieldChange{{Field: "name", Old: "Meier", New: "Maier"}}, revs[1].Changes)
+
+	adr, err := cl.GetAddressAt(id, revs[0].Time)
+	ast.Nil(err)
+	ast.Equal("Meier", adr.Name)
+	ast.Equal(1, adr.Version)
+	_, err = cl.GetAddressAt(id, revs[0].Time.Add(-time.Second))
+	ast.True(serror.Is(err, http.StatusNotFound))
+	res, err := cl.Get("addresses/" + id + "?asOf=yesterday")
+	ast.Nil(err)
+	ast.Equal(http.StatusBadRequest, res.StatusCode)
+	_ = res.Body.Close()
+
+	ok, err := cl.DeleteAddress(id)
+	ast.Nil(err)
+	ast.True(ok)
+	_, err = cl.GetAddressAt(id, time.Now())
+	ast.True(serror.Is(err, http.StatusNotFound))
+	adr, err = cl.GetAddressAt(id, revs[1].Time)
+	ast.Nil(err)
+	ast.Equal("Maier", adr.Name)
+	revs, err = cl.GetHistory(id)
+	ast.Nil(err)
+	ast.Len(revs, 3)
+	ast.Equal(pmodel.ActionDelete, revs[2].Action)
+
+	_, err = cl.GetHistory("unknown")
+	ast.True(serror.Is(err, http.StatusNotFound))
+}
+
+func TestClientIdempotency(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	// an own tenant for every run, so the addresses can be counted
+	tenant := "idempotent-" + xid.New().String()
+	icl, err := NewClient("https://127.0.0.1:9443", tenant)
+	ast.Nil(err)
+	tk, err := IssueToken("tester", tenant, "Creator")
+	ast.Nil(err)
+	icl.SetToken(tk)
+
+	key := "create-smith-" + xid.New().String()
+	adr := pmodel.Address{Name: "Smith", City: "Anytown"}
+	id, err := icl.CreateAddressIdempotent(adr, key)
+	ast.Nil(err)
+	ast.NotEmpty(id)
+
+	// the retry gets the response of the first request
+	rid, err := icl.CreateAddressIdempotent(adr, key)
+	ast.Nil(err)
+	ast.Equal(id, rid)
+	p, err := icl.QueryAddresses(pmodel.Query{})
+	ast.Nil(err)
+	ast.Equal(1, p.Total)
+
+	// with the version of the created address
+	byt, err := json.Marshal(adr)
+	ast.Nil(err)
+	req, err := icl.newRequest(http.MethodPost, "addresses/", bytes.NewReader(byt))
+	ast.Nil(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(api.IdempotencyKeyHeader, key)
+	res, err := icl.do(req)
+	ast.Nil(err)
+	ast.Equal(http.StatusCreated, res.StatusCode)
+	ast.Equal("true", res.Header.Get(api.IdempotentReplayedHeader))
+	ast.Equal(`"1"`, res.Header.Get("ETag"))
+	_ = res.Body.Close()
+
+	// the same key with a different body
+	adr.City = "Othertown"
+	_, err = icl.CreateAddressIdempotent(adr, key)
+	ast.True(serror.Is(err, http.StatusUnprocessableEntity))
+
+	// without a key every request creates an address
+	rid, err = icl.CreateAddress(adr)
+	ast.Nil(err)
+	ast.NotEqual(id, rid)
+	p, err = icl.QueryAddresses(pmodel.Query{})
+	ast.Nil(err)
+	ast.Equal(2, p.Total)
+}
+
+func TestClientWebhooks(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+	const secret = "0123456789abcdef"
+
+	var lock sync.Mutex
+	events := make([]pmodel.Event, 0)
+	rcv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhooks.Verify(secret, r.Header.Get(webhooks.SignatureHeader), body, time.Minute); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var ev pmodel.Event
+		_ = json.Unmarshal(body, &ev)
+		lock.Lock()
+		events = append(events, ev)
+		lock.Unlock()
+	}))
+	defer rcv.Close()
+	received := func() []pmodel.Event {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]pmodel.Event{}, events...)
+	}
+
+	// an own tenant, so the changes of the other tests are not delivered
+	wcl, err := NewClient("https://127.0.0.1:9443", "hooks")
+	ast.Nil(err)
+	tk, err := IssueToken("tester", "hooks", "TnAdmin")
+	ast.Nil(err)
+	wcl.SetToken(tk)
+
+	_, err = wcl.CreateSubscription(pmodel.Subscription{URL: "ftp://localhost", Events: []string{"address.moved"}, Secret: "short"})
+	ast.True(serror.Is(err, http.StatusBadRequest))
+
+	sub, err := wcl.CreateSubscription(pmodel.Subscription{URL: rcv.URL, Events: []string{pmodel.EventAddressCreated, pmodel.EventAddressUpdated, pmodel.EventAddressDeleted}, Secret: secret})
+	ast.Nil(err)
+	ast.NotEmpty(sub.ID)
+	ast.Empty(sub.Secret)
+	subs, err := wcl.GetSubscriptions()
+	ast.Nil(err)
+	ast.Len(subs, 1)
+
+	id, err := wcl.CreateAddress(pmodel.Address{Name: "Smith", City: "Anytown"})
+	ast.Nil(err)
+	adr, err := wcl.GetAddress(id)
+	ast.Nil(err)
+	adr.City = "Othertown"
+	_, err = wcl.UpdateAddress(*adr)
+	ast.Nil(err)
+	_, err = wcl.DeleteAddress(id)
+	ast.Nil(err)
+
+	// the delivery is marked as delivered after the receiver has answered
+	ast.Eventually(func() bool {
+		dls, err := wcl.GetDeliveries(sub.ID)
+		return err == nil && len(dls) == 3 && !slices.ContainsFunc(dls, func(dl pmodel.Delivery) bool {
+			return dl.Status != pmodel.DeliveryDelivered
+		})
+	}, 5*time.Second, 50*time.Millisecond)
+	ast.Len(received(), 3)
+	types := make([]string, 0)
+	for _, ev := range received() {
+		ast.Equal(id, ev.Address.ID)
+		ast.Equal("hooks", ev.Tenant)
+		types = append(types, ev.Type)
+		// the deleted event carries the address in the trash
+		if ev.Type == pmodel.EventAddressDeleted {
+			ast.Equal("Othertown", ev.Address.City)
+			ast.NotNil(ev.Address.DeletedAt)
+			ast.Equal("tester", ev.Address.DeletedBy)
+		} else {
+			ast.Nil(ev.Address.DeletedAt)
+		}
+	}
+	ast.ElementsMatch([]string{pmodel.EventAddressCreated, pmodel.EventAddressUpdated, pmodel.EventAddressDeleted}, types)
+
+	dls, err := wcl.GetDeliveries(sub.ID)
+	ast.Nil(err)
+	ast.Len(dls, 3)
+	for _, dl := range dls {
+		ast.Equal(pmodel.DeliveryDelivered, dl.Status)
+		ast.Equal(http.StatusOK, dl.ResponseStatus)
+	}
+	dead, err := wcl.GetDeadLetters()
+	ast.Nil(err)
+	ast.Len(dead, 0)
+	_, err = wcl.Redeliver(dls[0].ID)
+	ast.True(serror.Is(err, http.StatusConflict))
+
+	// the subscriptions are managed by the tenant admin
+	tk, err = IssueToken("tester", "hooks", "ObAdmin")
+	ast.Nil(err)
+	wcl.SetToken(tk)
+	_, err = wcl.GetSubscriptions()
+	ast.True(serror.Is(err, http.StatusForbidden))
+
+	tk, err = IssueToken("tester", "hooks", "TnAdmin")
+	ast.Nil(err)
+	wcl.SetToken(tk)
+	ast.Nil(wcl.DeleteSubscription(sub.ID))
+	_, err = wcl.GetDeliveries(sub.ID)
+	ast.True(serror.Is(err, http.StatusNotFound))
+}
+
+func TestClientEvents(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	// an own tenant for every run, so the changes of the other tests and runs are not streamed
+	tenant := "streamer-" + xid.New().String()
+	ecl, err := NewClient("https://127.0.0.1:9443", tenant)
+	ast.Nil(err)
+	tk, err := IssueToken("tester", tenant, "ObAdmin")
+	ast.Nil(err)
+	ecl.SetToken(tk)
+
+	id, err := ecl.CreateAddress(pmodel.Address{Name: "Smith", City: "Anytown"})
+	ast.Nil(err)
+	adr, err := ecl.GetAddress(id)
+	ast.Nil(err)
+	adr.City = "Othertown"
+	_, err = ecl.UpdateAddress(*adr)
+	ast.Nil(err)
+	_, err = ecl.DeleteAddress(id)
+	ast.Nil(err)
+
+	// resuming from the start replays all events of the tenant
+	collect := func(lastID string, count int) []pmodel.Event {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		evs := make([]pmodel.Event, 0)
+		err := ecl.StreamEvents(ctx, lastID, func(ev pmodel.Event) bool {
+			evs = append(evs, ev)
+			return len(evs) < count
+		})
+		ast.Nil(err)
+		return evs
+	}
+	evs := collect("0", 3)
+	ast.Len(evs, 3)
+	ast.Equal(pmodel.EventAddressCreated, evs[0].Type)
+	ast.Equal(pmodel.EventAddressUpdated, evs[1].Type)
+	ast.Equal("Othertown", evs[1].Address.City)
+	ast.Equal(pmodel.EventAddressDeleted, evs[2].Type)
+	ast.NotNil(evs[2].Address.DeletedAt)
+	ast.Equal("tester", evs[2].Address.DeletedBy)
+	for _, ev := range evs {
+		ast.Equal(id, ev.Address.ID)
+		ast.Equal(tenant, ev.Tenant)
+	}
+
+	// the resumed stream gets the missed and the new events
+	done := make(chan []pmodel.Event)
+	go func() {
+		done <- collect(evs[1].ID, 2)
+	}()
+	_, err = ecl.RestoreAddress(id)
+	ast.Nil(err)
+	resumed := <-done
+	ast.Len(resumed, 2)
+	ast.Equal(evs[2].ID, resumed[0].ID)
+	ast.Equal(pmodel.EventAddressCreated, resumed[1].Type)
+
+	// an idle stream gets heartbeats
+	res, err := ecl.Get("addresses/events")
+	ast.Nil(err)
+	defer res.Body.Close()
+	ast.Equal("text/event-stream", res.Header.Get("Content-Type"))
+	sc := bufio.NewScanner(res.Body)
+	heartbeat := false
+	for !heartbeat && sc.Scan() {
+		heartbeat = sc.Text() == ": heartbeat"
+	}
+	ast.True(heartbeat)
+}
+
+func TestClientAuth(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	// a token for a different tenant is forbidden
+	tk, err := IssueToken("tester", "tester2", "Admin")
+	ast.Nil(err)
+	cl.SetToken(tk)
+	_, err = cl.GetAddresses()
+	ast.True(serror.Is(err, http.StatusForbidden))
+
+	// a reader can not create addresses
+	tk, err = IssueToken("tester", Tenant, "Reader")
+	ast.Nil(err)
+	cl.SetToken(tk)
+	_, err = cl.GetAddresses()
+	ast.Nil(err)
+	_, err = cl.CreateAddress(pmodel.Address{Name: "Smith"})
+	ast.True(serror.Is(err, http.StatusForbidden))
+
+	// revoking the reader token
+	admin, err := IssueToken("admin", Tenant, "Admin")
+	ast.Nil(err)
+	cl.SetToken(admin)
+	res, err := cl.PostJSON("admin/revocations", map[string]any{"token": tk, "reason": "test"})
+	ast.Nil(err)
+	ast.Equal(http.StatusCreated, res.StatusCode)
+	_ = res.Body.Close()
+	cl.SetToken(tk)
+	_, err = cl.GetAddresses()
+	ast.True(serror.Is(err, http.StatusUnauthorized))
+
+	cl.SetToken("")
+	_, err = cl.GetAddresses()
+	ast.True(serror.Is(err, http.StatusUnauthorized))
+}
+
+func TestClientImportExport(t *testing.T) {
+	initCl()
+	ast := assert.New(t)
+
+	// an own tenant, so the other tests are not disturbing
+	icl, err := NewClient("https://127.0.0.1:9443", "importer")
+	ast.Nil(err)
+	tk, err := IssueToken("tester", "importer", "Admin")
+	ast.Nil(err)
+	icl.SetToken(tk)
+
+	fixture, err := os.ReadFile("testdata/addresses.json")
+	ast.Nil(err)
+	mapping := map[string]string{"lastname": "name"}
+	report, err := icl.ImportAddresses(bytes.NewReader(fixture), "application/json", pmodel.ImportOptions{DryRun: true, Mapping: mapping})
+	ast.Nil(err)
+	ast.True(report.DryRun)
+	ast.Equal(10, report.Rows)
+	ast.Equal(10, report.Created)
+	l, err := icl.GetAddresses()
+	ast.Nil(err)
+	ast.Empty(*l)
+
+	// without mapping the name is missing
+	report, err = icl.ImportAddresses(bytes.NewReader(fixture), "application/json", pmodel.ImportOptions{DryRun: true})
+	ast.Nil(err)
+	ast.Equal(10, report.Failed)
+	ast.Equal(1, report.Errors[0].Row)
+	ast.Equal("name", report.Errors[0].Fields[0].Field)
+
+	report, err = icl.ImportAddresses(bytes.NewReader(fixture), "application/json", pmodel.ImportOptions{Mapping: mapping})
+	ast.Nil(err)
+	ast.Equal(10, report.Created)
+	ast.Empty(report.Errors)
+
+	var buf bytes.Buffer
+	ast.Nil(icl.ExportAddresses(&buf, "csv", pmodel.Query{Sort: []string{"name"}}))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	ast.Len(lines, 11)
+	ast.Equal("id,name,firstname,street,city,state,zip_code,country", lines[0])
+	csv := buf.Bytes()
+
+	// the exported addresses are already there
+	report, err = icl.ImportAddresses(bytes.NewReader(csv), "text/csv", pmodel.ImportOptions{Mode: pmodel.ImportSkip, DryRun: true})
+	ast.Nil(err)
+	ast.Equal(10, report.Skipped)
+
+	buf.Reset()
+	ast.Nil(icl.ExportAddresses(&buf, "ndjson", pmodel.Query{City: "Anytown"}))
+	var adr pmodel.Address
+	ast.Nil(json.Unmarshal(bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0], &adr))
+	ast.Equal("Anytown", adr.City)
+
+	// upsert updates the existing address, creates the one without id and fails unknown and repeated ids
+	existing := `{"id":"` + adr.ID + `","name":"` + adr.Name + `","street":"1 New St"}` + "\n"
+	ndjson := []byte(existing + `{"id":"unknown","name":"Newman"}` + "\n" + `{"name":"Newman"}` + "\n" + existing + `{"name":` + "\n")
+	report, err = icl.ImportAddresses(bytes.NewReader(ndjson), "application/x-ndjson", pmodel.ImportOptions{Mode: pmodel.ImportUpsert})
+	ast.Nil(err)
+	ast.Equal(5, report.Rows)
+	ast.Equal(1, report.Updated)
+	ast.Equal(1, report.Created)
+	ast.Equal(3, report.Failed)
+	ast.Equal(2, report.Errors[0].Row)
+	ast.Equal("unknown", report.Errors[0].ID)
+	ast.Equal(4, report.Errors[1].Row)
+	ast.Equal(5, report.Errors[2].Row)
+	radr, err := icl.GetAddress(adr.ID)
+	ast.Nil(err)
+	ast.Equal("1 New St", radr.Street)
+
+	_, err = icl.ImportAddresses(bytes.NewReader(csv), "application/xml", pmodel.ImportOptions{})
+	ast.True(serror.Is(err, http.StatusUnsupportedMediaType))
+
+	l, err = icl.GetAddresses()
+	ast.Nil(err)
+	ast.Len(*l, 11)
+	for _, adr := range *l {
+		_, err := icl.DeleteAddress(adr.ID)
+		ast.Nil(err)
+	}
+}
@@ -1,7 +1,11 @@
 package client
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"testing"
 	"time"
@@ -54,6 +58,35 @@ func StartServer(inj do.Injector) {
 	}
 }
 
+// IssueToken getting a token from the development issuer of the test server
+func IssueToken(sub, tenant string, roles ...string) (string, error) {
+	byt, err := json.Marshal(map[string]any{"sub": sub, "tenant": tenant, "roles": roles})
+	if err != nil {
+		return "", err
+	}
+	clt := http.Client{
+		Transport: &http.Transport{
+			// #nosec G402 -- self signed certificate of the test server
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	res, err := clt.Post("https://127.0.0.1:9443/issuer/token", "application/json", bytes.NewBuffer(byt))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", ReadErr(res)
+	}
+	tr := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := ReadJSON(res, &tr); err != nil {
+		return "", err
+	}
+	return tr.AccessToken, nil
+}
+
 func TestStartServer(t *testing.T) {
 	inj := do.New()
 	ast := assert.New(t)
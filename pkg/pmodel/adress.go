@@ -1,12 +1,19 @@
 package pmodel
 
-// Address this is the main model
+import "time"
+
+// Address this is the main model, the version is counted up by the storage with every change. Deleted addresses are
+// kept in the trash with the time and the user of the deletion, until they are restored or purged.
 type Address struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	Firstname string `json:"firstname"`
-	Street    string `json:"street"`
-	City      string `json:"city"`
-	State     string `json:"state"`
-	ZipCode   string `json:"zip_code"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name" validate:"required,max=255"`
+	Firstname string     `json:"firstname" validate:"max=255"`
+	Street    string     `json:"street" validate:"max=255"`
+	City      string     `json:"city" validate:"max=255"`
+	State     string     `json:"state" validate:"max=64"`
+	ZipCode   string     `json:"zip_code" validate:"max=16"`
+	Country   string     `json:"country,omitempty" validate:"omitempty,iso3166_1_alpha2"`
+	Version   int        `json:"version,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
 }
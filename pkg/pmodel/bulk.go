@@ -0,0 +1,117 @@
+package pmodel
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/willie68/go-micro/internal/serror"
+)
+
+// modes of the import, how rows with an id are handled
+const (
+	// ImportCreate every row is created as a new address, the id of the row is ignored
+	ImportCreate = "create"
+	// ImportUpsert rows with the id of an existing address are updating this address, rows without id are created,
+	// rows with an unknown or repeated id are failing
+	ImportUpsert = "upsert"
+	// ImportSkip rows with the id of an existing address or an id already imported are skipped
+	ImportSkip = "skip"
+)
+
+// MaxImportErrors maximal number of row errors in the import report
+const MaxImportErrors = 1000
+
+// AddressFields the json names of all fields of an address, which can be imported and exported
+var AddressFields = []string{"id", "name", "firstname", "street", "city", "state", "zip_code", "country"}
+
+// ImportOptions options of the address import
+type ImportOptions struct {
+	// Mode one of ImportCreate, ImportUpsert or ImportSkip, default ImportCreate
+	Mode string
+	// DryRun only checking the rows, nothing is stored
+	DryRun bool
+	// Mapping the field names of the source to the address fields, e.g. lastname: name
+	Mapping map[string]string
+}
+
+// ImportReport the result of an import, the rows are counted from 1, for csv without the header
+type ImportReport struct {
+	DryRun  bool          `json:"dryRun"`
+	Rows    int           `json:"rows"`
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Skipped int           `json:"skipped"`
+	Failed  int           `json:"failed"`
+	Errors  []ImportError `json:"errors,omitempty"`
+	// Truncated more than MaxImportErrors rows failed, only the first are reported
+	Truncated bool `json:"truncated,omitempty"`
+	// Aborted the source is broken, the rows behind the aborting error are not imported
+	Aborted bool `json:"aborted,omitempty"`
+}
+
+// ImportError the error of one row of the import
+type ImportError struct {
+	Row    int                 `json:"row"`
+	ID     string              `json:"id,omitempty"`
+	Msg    string              `json:"message"`
+	Fields []serror.FieldError `json:"fields,omitempty"`
+}
+
+// ParseImportOptions parsing the import options of the url, the mapping is given as comma separated list of
+// source:field pairs, e.g. map=lastname:name,zip:zip_code
+func ParseImportOptions(v url.Values) (ImportOptions, error) {
+	o := ImportOptions{
+		Mode: ImportCreate,
+	}
+	if m := v.Get("mode"); m != "" {
+		if !slices.Contains([]string{ImportCreate, ImportUpsert, ImportSkip}, m) {
+			return o, fmt.Errorf("%w: unknown import mode %q", ErrInvalidQuery, m)
+		}
+		o.Mode = m
+	}
+	if d := v.Get("dryrun"); d != "" {
+		var err error
+		if o.DryRun, err = strconv.ParseBool(d); err != nil {
+			return o, fmt.Errorf("%w: dryrun must be a boolean", ErrInvalidQuery)
+		}
+	}
+	for _, s := range v["map"] {
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			src, field, ok := strings.Cut(p, ":")
+			if !ok || src == "" || !slices.Contains(AddressFields, field) {
+				return o, fmt.Errorf("%w: invalid mapping %q", ErrInvalidQuery, p)
+			}
+			if o.Mapping == nil {
+				o.Mapping = make(map[string]string)
+			}
+			o.Mapping[src] = field
+		}
+	}
+	return o, nil
+}
+
+// Values converting the import options into url values, only set values are added
+func (o ImportOptions) Values() url.Values {
+	v := url.Values{}
+	if o.Mode != "" {
+		v.Set("mode", o.Mode)
+	}
+	if o.DryRun {
+		v.Set("dryrun", "true")
+	}
+	if len(o.Mapping) > 0 {
+		ms := make([]string, 0, len(o.Mapping))
+		for src, field := range o.Mapping {
+			ms = append(ms, src+":"+field)
+		}
+		slices.Sort(ms)
+		v.Set("map", strings.Join(ms, ","))
+	}
+	return v
+}
@@ -0,0 +1,71 @@
+package pmodel
+
+import "time"
+
+// the actions of the revisions of an address
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+)
+
+// FieldChange the change of one field of an address, by the json name of the field
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Revision one change of an address, the version is the version of the address after the change. The revisions are
+// never changed or deleted, not even by purging the address.
+type Revision struct {
+	Tenant  string        `json:"tenant"`
+	ID      string        `json:"id"`
+	Version int           `json:"version"`
+	Action  string        `json:"action"`
+	Actor   string        `json:"actor"`
+	Time    time.Time     `json:"time"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// Diff the changes of the fields from the old to the new address, the id is never changed
+func Diff(old, adr Address) []FieldChange {
+	changes := make([]FieldChange, 0)
+	for _, f := range AddressFields {
+		if f == "id" {
+			continue
+		}
+		if o, n := old.Field(f), adr.Field(f); o != n {
+			changes = append(changes, FieldChange{Field: f, Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+// AddressAt replaying the revisions, sorted by version, up to the time. False, if the address didn't exist at this
+// time or was deleted.
+func AddressAt(revs []Revision, at time.Time) (Address, bool) {
+	var adr Address
+	exists := false
+	for _, r := range revs {
+		if r.Time.After(at) {
+			break
+		}
+		switch r.Action {
+		case ActionCreate:
+			adr = Address{ID: r.ID}
+			exists = true
+		case ActionDelete, ActionPurge:
+			exists = false
+		case ActionRestore:
+			exists = true
+		}
+		for _, c := range r.Changes {
+			adr.SetField(c.Field, c.New)
+		}
+		adr.Version = r.Version
+	}
+	return adr, exists
+}
@@ -0,0 +1,168 @@
+package pmodel
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaults and limits of the paging
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// SortFields all fields of an address, which can be used for sorting
+var SortFields = []string{"id", "name", "firstname", "street", "city", "state", "zip_code"}
+
+// ErrInvalidQuery the query parameters are not valid
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Query filtering, sorting and paging of the address list
+type Query struct {
+	// Limit maximal number of addresses of one page
+	Limit int
+	// Offset number of addresses to skip, not used together with a cursor
+	Offset int
+	// Cursor opaque token of the next or previous page
+	Cursor string
+	// City, State, ZipCode filters, all must match exactly
+	City    string
+	State   string
+	ZipCode string
+	// Name filter, the name must start with this prefix
+	Name string
+	// Sort the sort fields, a leading - for descending order, e.g. name,-city
+	Sort []string
+}
+
+// Page one page of the address list
+type Page struct {
+	Addresses []Address
+	// Total number of addresses matching the filters
+	Total int
+	// Next and Prev cursors of the next and previous page, empty if there is no such page
+	Next string
+	Prev string
+}
+
+// ParseQuery parsing the query of the url, unset values get their defaults
+func ParseQuery(v url.Values) (Query, error) {
+	q := Query{
+		Limit:   DefaultLimit,
+		Cursor:  v.Get("cursor"),
+		City:    v.Get("city"),
+		State:   v.Get("state"),
+		ZipCode: v.Get("zip_code"),
+		Name:    v.Get("name"),
+	}
+	var err error
+	if s := v.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit < 1 || q.Limit > MaxLimit {
+			return q, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxLimit)
+		}
+	}
+	if s := v.Get("offset"); s != "" {
+		if q.Offset, err = strconv.Atoi(s); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("%w: offset must not be negative", ErrInvalidQuery)
+		}
+	}
+	if q.Cursor != "" && q.Offset > 0 {
+		return q, fmt.Errorf("%w: cursor and offset can't be used together", ErrInvalidQuery)
+	}
+	for _, s := range v["sort"] {
+		for _, f := range strings.Split(s, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				q.Sort = append(q.Sort, f)
+			}
+		}
+	}
+	for _, f := range q.Sort {
+		if !slices.Contains(SortFields, strings.TrimPrefix(f, "-")) {
+			return q, fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, f)
+		}
+	}
+	return q, nil
+}
+
+// PageSize the limit of the query, DefaultLimit if not set
+func (q Query) PageSize() int {
+	if q.Limit <= 0 {
+		return DefaultLimit
+	}
+	return min(q.Limit, MaxLimit)
+}
+
+// Values converting the query into url values, only set values are added
+func (q Query) Values() url.Values {
+	v := url.Values{}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		v.Set("offset", strconv.Itoa(q.Offset))
+	}
+	set := func(k, s string) {
+		if s != "" {
+			v.Set(k, s)
+		}
+	}
+	set("cursor", q.Cursor)
+	set("city", q.City)
+	set("state", q.State)
+	set("zip_code", q.ZipCode)
+	set("name", q.Name)
+	set("sort", strings.Join(q.Sort, ","))
+	return v
+}
+
+// Field getting the value of the field of the address by the json name
+func (a Address) Field(field string) string {
+	switch field {
+	case "id":
+		return a.ID
+	case "name":
+		return a.Name
+	case "firstname":
+		return a.Firstname
+	case "street":
+		return a.Street
+	case "city":
+		return a.City
+	case "state":
+		return a.State
+	case "zip_code":
+		return a.ZipCode
+	case "country":
+		return a.Country
+	}
+	return ""
+}
+
+// SetField setting the value of the field of the address by the json name, false for an unknown field
+func (a *Address) SetField(field, value string) bool {
+	switch field {
+	case "id":
+		a.ID = value
+	case "name":
+		a.Name = value
+	case "firstname":
+		a.Firstname = value
+	case "street":
+		a.Street = value
+	case "city":
+		a.City = value
+	case "state":
+		a.State = value
+	case "zip_code":
+		a.ZipCode = value
+	case "country":
+		a.Country = value
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package pmodel
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SearchQuery the full text search of addresses, paged by offset
+type SearchQuery struct {
+	// Q the search terms, all terms must match
+	Q      string
+	Limit  int
+	Offset int
+}
+
+// SearchHit one found address with the score of the ranking
+type SearchHit struct {
+	Address Address `json:"address"`
+	Score   float64 `json:"score"`
+}
+
+// SearchPage one page of the search result, ranked by score
+type SearchPage struct {
+	Hits []SearchHit
+	// Total number of found addresses
+	Total int
+}
+
+// ParseSearchQuery parsing the search query of the url
+func ParseSearchQuery(v url.Values) (SearchQuery, error) {
+	q := SearchQuery{
+		Q:     strings.TrimSpace(v.Get("q")),
+		Limit: DefaultLimit,
+	}
+	if q.Q == "" {
+		return q, fmt.Errorf("%w: q is missing", ErrInvalidQuery)
+	}
+	var err error
+	if s := v.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit < 1 || q.Limit > MaxLimit {
+			return q, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxLimit)
+		}
+	}
+	if s := v.Get("offset"); s != "" {
+		if q.Offset, err = strconv.Atoi(s); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("%w: offset must not be negative", ErrInvalidQuery)
+		}
+	}
+	return q, nil
+}
+
+// PageSize the limit of the query, DefaultLimit if not set
+func (q SearchQuery) PageSize() int {
+	if q.Limit <= 0 {
+		return DefaultLimit
+	}
+	return min(q.Limit, MaxLimit)
+}
+
+// Values converting the search query into url values, only set values are added
+func (q SearchQuery) Values() url.Values {
+	v := url.Values{}
+	v.Set("q", q.Q)
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		v.Set("offset", strconv.Itoa(q.Offset))
+	}
+	return v
+}
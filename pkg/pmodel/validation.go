@@ -0,0 +1,48 @@
+package pmodel
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// zipFormats the formats of the zip codes of the countries, zip codes of other countries are only checked for length
+var zipFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^\d{4}$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+	"CH": regexp.MustCompile(`^\d{4}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+	"NL": regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`),
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+}
+
+// stateCodes the allowed state codes of the countries, states of other countries are only checked for length
+var stateCodes = map[string][]string{
+	"AT": {"1", "2", "3", "4", "5", "6", "7", "8", "9"},
+	"CA": {"AB", "BC", "MB", "NB", "NL", "NS", "NT", "NU", "ON", "PE", "QC", "SK", "YT"},
+	"CH": {"AG", "AI", "AR", "BE", "BL", "BS", "FR", "GE", "GL", "GR", "JU", "LU", "NE", "NW", "OW", "SG", "SH", "SO",
+		"SZ", "TG", "TI", "UR", "VD", "VS", "ZG", "ZH"},
+	"DE": {"BB", "BE", "BW", "BY", "HB", "HE", "HH", "MV", "NI", "NW", "RP", "SH", "SL", "SN", "ST", "TH"},
+	"US": {"AK", "AL", "AR", "AZ", "CA", "CO", "CT", "DC", "DE", "FL", "GA", "HI", "IA", "ID", "IL", "IN", "KS", "KY",
+		"LA", "MA", "MD", "ME", "MI", "MN", "MO", "MS", "MT", "NC", "ND", "NE", "NH", "NJ", "NM", "NV", "NY", "OH", "OK",
+		"OR", "PA", "RI", "SC", "SD", "TN", "TX", "UT", "VA", "VT", "WA", "WI", "WV", "WY", "AS", "GU", "MP", "PR", "VI"},
+}
+
+// ValidateAddress the validation of the address fields depending on the country, the zip code must match the format
+// and the state must be one of the state codes of the country. Register it with
+// validate.RegisterStructValidation(ValidateAddress, Address{}).
+func ValidateAddress(sl validator.StructLevel) {
+	adr, ok := sl.Current().Interface().(Address)
+	if !ok || adr.Country == "" {
+		return
+	}
+	if f, ok := zipFormats[adr.Country]; ok && adr.ZipCode != "" && !f.MatchString(adr.ZipCode) {
+		sl.ReportError(adr.ZipCode, "zip_code", "ZipCode", "zipcode", adr.Country)
+	}
+	if codes, ok := stateCodes[adr.Country]; ok && adr.State != "" && !slices.Contains(codes, adr.State) {
+		sl.ReportError(adr.State, "state", "State", "statecode", adr.Country)
+	}
+}
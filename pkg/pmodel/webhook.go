@@ -0,0 +1,53 @@
+package pmodel
+
+import "time"
+
+// Event types of the address changes
+const (
+	EventAddressCreated = "address.created"
+	EventAddressUpdated = "address.updated"
+	EventAddressDeleted = "address.deleted"
+)
+
+// Status of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Subscription a webhook subscription of a tenant, the events are posted to the url, signed with the secret. The
+// secret is never returned. Deliveries to loopback, private or link-local addresses are refused by the service.
+type Subscription struct {
+	ID      string    `json:"id"`
+	URL     string    `json:"url" validate:"required,http_url,max=2048"`
+	Events  []string  `json:"events" validate:"required,min=1,dive,oneof=address.created address.updated address.deleted"`
+	Secret  string    `json:"secret,omitempty" validate:"required,min=16,max=255"`
+	Created time.Time `json:"created"`
+}
+
+// Event the payload of a webhook, a change of an address. The address of a deleted event is the deleted address, moved
+// into the trash with deleted_at and deleted_by, or the last state of a hard deleted address, which was not in the
+// trash.
+type Event struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Tenant  string    `json:"tenant"`
+	Time    time.Time `json:"time"`
+	Address Address   `json:"address"`
+}
+
+// Delivery the delivery of an event to a subscription, with the status, the number of attempts and the result of the
+// last attempt. A delivery, which failed all attempts, is dead and kept in the dead letters until it's redelivered.
+type Delivery struct {
+	ID             string     `json:"id"`
+	Subscription   string     `json:"subscription"`
+	Event          Event      `json:"event"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttempt    *time.Time `json:"next_attempt,omitempty"`
+	Created        time.Time  `json:"created"`
+	Updated        time.Time  `json:"updated"`
+}